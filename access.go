@@ -0,0 +1,73 @@
+package sweetnothings
+
+import (
+	"net"
+	"strings"
+)
+
+/**
+ * Access lists
+ *
+ * For semi-private meshes, the profile's config.json can list who may
+ * link with us:
+ *
+ *	{"allow": ["10.0.0.0/8", "vpn.example.com"], "deny": ["10.0.0.13"]}
+ *
+ * Entries are CIDRs, IPs, or host names with or without a port. With an
+ * allow list, only addresses on it are accepted or dialed; anything on
+ * the deny list never is. Names are resolved when we dial them, except
+ * through a proxy, where they can only match by name.
+ */
+
+// accessMatch reports whether addr, or the IPs it resolves to, matches
+// one of entries.
+func accessMatch(entries []string, addr string, ips []net.IP) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if strings.EqualFold(e, addr) || strings.EqualFold(e, host) {
+			return true
+		}
+		_, cidr, err := net.ParseCIDR(e)
+		if err != nil {
+			if ip := net.ParseIP(e); ip != nil {
+				if ip4 := ip.To4(); ip4 != nil {
+					ip = ip4
+				}
+				cidr = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+			}
+		}
+		for _, ip := range ips {
+			if cidr != nil && cidr.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accessAllowed checks addr against the allow and deny lists, resolving
+// it if it's a name and resolve is set.
+func accessAllowed(addr string, resolve bool) bool {
+	allow, deny := profileConfig.Allow, profileConfig.Deny
+	if len(allow) == 0 && len(deny) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if resolve && proxyURL == nil {
+		ips, _ = net.LookupIP(host)
+	}
+	if len(allow) > 0 && !accessMatch(allow, addr, ips) {
+		return false
+	}
+	return !accessMatch(deny, addr, ips)
+}
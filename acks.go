@@ -0,0 +1,112 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+/**
+ * Acknowledgements
+ *
+ * A message written into a socket isn't delivered until the other end
+ * has read it, and a connection that dies in between takes it along. To
+ * peers that can acknowledge, each message frame goes out with a
+ * sequence number and stays in unacked until the peer acks it or a later
+ * one; the reader acks what it's read every ackDelay. Whatever is still
+ * unacked when the link closes goes back to the front of the outbox, to
+ * be sent again once it's back. Receivers drop the copies they already
+ * had by message ID.
+ */
+
+const ackDelay = 200 * time.Millisecond
+
+// Messages tracked per peer; beyond this the oldest go untracked.
+const maxUnacked = 1000
+
+type msgAck struct {
+	Seq uint64
+}
+
+type sentFrame struct {
+	seq uint64
+	f   Frame
+}
+
+var acks = struct {
+	seq     map[string]uint64
+	unacked map[string][]sentFrame
+	// Highest sequence read from each peer not yet acked, and whether an
+	// ack is on its way.
+	read    map[string]uint64
+	pending map[string]bool
+	sync.Mutex
+}{seq: make(map[string]uint64), unacked: make(map[string][]sentFrame), read: make(map[string]uint64), pending: make(map[string]bool)}
+
+func init() {
+	controlHandlers["msgack"] = handleMsgAck
+}
+
+// trackUnacked numbers f for addr and holds on to it until it's acked.
+func trackUnacked(addr string, f Frame) Frame {
+	acks.Lock()
+	defer acks.Unlock()
+	acks.seq[addr]++
+	f.Seq = acks.seq[addr]
+	l := append(acks.unacked[addr], sentFrame{f.Seq, f})
+	if len(l) > maxUnacked {
+		l = l[len(l)-maxUnacked:]
+	}
+	acks.unacked[addr] = l
+	return f
+}
+
+func handleMsgAck(from string, data json.RawMessage) {
+	var a msgAck
+	if json.Unmarshal(data, &a) != nil {
+		return
+	}
+	acks.Lock()
+	defer acks.Unlock()
+	l := acks.unacked[from]
+	i := 0
+	for i < len(l) && l[i].seq <= a.Seq {
+		i++
+	}
+	acks.unacked[from] = l[i:]
+}
+
+// requeueUnacked puts what addr never acked back in its outbox as the
+// link closes.
+func requeueUnacked(addr string) {
+	acks.Lock()
+	l := acks.unacked[addr]
+	delete(acks.unacked, addr)
+	acks.Unlock()
+	frames := make([]Frame, len(l))
+	for i, s := range l {
+		s.f.Seq = 0
+		frames[i] = s.f
+	}
+	requeue(addr, frames)
+}
+
+// ackLater acks frame seq from addr soon, along with any that follow it
+// in the meantime.
+func ackLater(addr string, seq uint64) {
+	acks.Lock()
+	defer acks.Unlock()
+	acks.read[addr] = max(acks.read[addr], seq)
+	if acks.pending[addr] {
+		return
+	}
+	acks.pending[addr] = true
+	time.AfterFunc(ackDelay, func() {
+		acks.Lock()
+		seq := acks.read[addr]
+		delete(acks.read, addr)
+		delete(acks.pending, addr)
+		acks.Unlock()
+		sendSoon(addr, controlFrame("msgack", msgAck{Seq: seq}), sessionTimeout)
+	})
+}
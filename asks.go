@@ -0,0 +1,152 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	askKind = "ask"
+	ackKind = "ack"
+)
+
+// Authors heard from this recently are expected to acknowledge an /ask.
+const askAudienceWindow = time.Hour
+
+type askState struct {
+	ask      SweetNothing
+	expected map[string]bool
+	acked    map[string]time.Time
+}
+
+var asks = struct {
+	mine map[string]*askState
+	// Asks from others we haven't acknowledged yet, oldest first.
+	pending []SweetNothing
+	sync.Mutex
+}{mine: make(map[string]*askState)}
+
+// askAudience is everyone on network we're connected to or have heard
+// from lately.
+func askAudience(network string) map[string]bool {
+	m := make(map[string]bool)
+	for addr := range netPeers(network) {
+		m[addr] = true
+	}
+	recent.Lock()
+	for _, e := range recent.entries {
+		if time.Since(e.seen) < askAudienceWindow && e.whisper.Net == network {
+			m[e.whisper.Addr] = true
+		}
+	}
+	recent.Unlock()
+	delete(m, localAddr(network))
+	return m
+}
+
+func ask(text string) {
+	if len(text) == 0 {
+		statusLn(tr("Usage: /ask <text>"))
+		return
+	}
+	expected := askAudience(currentNetwork())
+	whisper, ok := publishText(SweetNothing{Kind: askKind, Room: activeRoom(), Body: text})
+	if !ok {
+		return
+	}
+	asks.Lock()
+	asks.mine[whisper.ID] = &askState{whisper, expected, make(map[string]time.Time)}
+	asks.Unlock()
+	statusLn(tr("Asked %d peers to acknowledge %s", len(expected), whisper.ID))
+}
+
+func showAsk(whisper SweetNothing) {
+	if accessible {
+		chatLn(whisper.Addr, tr("asking for acknowledgment: %s", whisper.Body))
+	} else {
+		chatLn(whisper.Addr, wrapColor(T("ACK?"), "yellow")+" "+whisper.Body)
+	}
+	noteLn(T("To acknowledge"), "", fmt.Sprintf("/ack %s", whisper.ID), "blue")
+	asks.Lock()
+	asks.pending = append(asks.pending, whisper)
+	asks.Unlock()
+}
+
+// ackAsk acknowledges the ask with the given ID prefix, or the oldest
+// unacknowledged one when id is empty.
+func ackAsk(id string) {
+	asks.Lock()
+	var target SweetNothing
+	found := -1
+	for i, a := range asks.pending {
+		if len(id) == 0 || strings.HasPrefix(a.ID, id) {
+			target, found = a, i
+			break
+		}
+	}
+	if found >= 0 {
+		asks.pending = append(asks.pending[:found], asks.pending[found+1:]...)
+	}
+	asks.Unlock()
+	if found < 0 {
+		statusLn(tr("Nothing to acknowledge"))
+		return
+	}
+	publishIn(target.Net, SweetNothing{Kind: ackKind, Ref: target.ID})
+	statusLn(tr("Acknowledged %s: %s", nickName(target.Addr), target.Body))
+}
+
+func countAck(whisper SweetNothing) {
+	asks.Lock()
+	a, ok := asks.mine[whisper.Ref]
+	if !ok {
+		asks.Unlock()
+		return
+	}
+	_, dup := a.acked[whisper.Addr]
+	a.acked[whisper.Addr] = whisper.Timestamp
+	a.expected[whisper.Addr] = true
+	n, total := len(a.acked), len(a.expected)
+	asks.Unlock()
+	if !dup {
+		statusLn(tr("%s acknowledged \"%s\" (%d/%d)", nickName(whisper.Addr), a.ask.Body, n, total))
+	}
+}
+
+func showAsks() {
+	asks.Lock()
+	defer asks.Unlock()
+	if len(asks.mine) == 0 {
+		statusLn(tr("You haven't asked anything"))
+		return
+	}
+	l := make([]*askState, 0, len(asks.mine))
+	for _, a := range asks.mine {
+		l = append(l, a)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ask.Timestamp.Before(l[j].ask.Timestamp) })
+	for _, a := range l {
+		var acked, waiting []string
+		for addr := range a.expected {
+			if _, ok := a.acked[addr]; ok {
+				acked = append(acked, nickName(addr))
+			} else {
+				waiting = append(waiting, nickName(addr))
+			}
+		}
+		sort.Strings(acked)
+		sort.Strings(waiting)
+		statusLn(tr("%s \"%s\" acked: %s; waiting on: %s", a.ask.ID, a.ask.Body,
+			listOrNone(acked), listOrNone(waiting)))
+	}
+}
+
+func listOrNone(l []string) string {
+	if len(l) == 0 {
+		return T("nobody")
+	}
+	return strings.Join(l, ", ")
+}
@@ -0,0 +1,259 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * Backfill
+ *
+ * The first time we link up on a network, we ask that peer for up to
+ * -backfill of the messages it has from after our newest, so we don't
+ * join a quiet room with no idea what's been said. /backfill [n] asks
+ * the peer we've been linked to longest for its last n. Answers come from
+ * history, or the recent messages kept for gossip without it, in
+ * batches on the bulk lane. Only messages still carrying their author's
+ * signature in the clear are passed on: no DMs, and nothing that was
+ * end-to-end encrypted. What we're sent goes through the same checks as
+ * any message we receive, and batches we didn't ask for are dropped.
+ */
+
+var backfillLimit = 50
+
+const maxBackfill = 500
+
+// Batches are kept well under maxBulkFrame.
+const backfillBatch = maxBulkFrame / 2
+
+type backfillRequest struct {
+	Limit int
+	Since time.Time `json:",omitempty"`
+}
+
+type backfillBatchFrame struct {
+	Msgs []SweetNothing
+	Last bool `json:",omitempty"`
+}
+
+var backfills = struct {
+	// Networks we've backfilled on, batches still coming in by peer,
+	// peers asked with /backfill, and how many more messages we'll take
+	// from each peer we've asked at all.
+	done    map[string]bool
+	pending map[string][]SweetNothing
+	asked   map[string]bool
+	wanted  map[string]int
+	sync.Mutex
+}{done: make(map[string]bool), pending: make(map[string][]SweetNothing), asked: make(map[string]bool), wanted: make(map[string]int)}
+
+func init() {
+	controlHandlers["history-req"] = handleBackfillRequest
+	controlHandlers["history"] = handleBackfill
+}
+
+// backfillOnJoin asks addr to catch us up if it's our first link on its
+// network.
+func backfillOnJoin(addr string) {
+	if backfillLimit <= 0 {
+		return
+	}
+	network := netOf(addr)
+	backfills.Lock()
+	first := !backfills.done[network]
+	backfills.done[network] = true
+	backfills.Unlock()
+	if first {
+		requestBackfill(addr, backfillLimit, true)
+	}
+}
+
+// requestBackfill asks addr for its last limit messages, or with newer
+// set only those after the newest we have.
+func requestBackfill(addr string, limit int, newer bool) {
+	req := backfillRequest{Limit: limit}
+	if history != nil && newer {
+		if msgs := history.Since(max(0, history.Len()-1)); len(msgs) > 0 {
+			req.Since = msgs[0].Timestamp
+		}
+	}
+	backfills.Lock()
+	backfills.wanted[addr] = min(limit, maxBackfill)
+	backfills.Unlock()
+	sendSoon(addr, controlFrame("history-req", req), sessionTimeout)
+}
+
+// backfillCommand handles /backfill [n].
+func backfillCommand(n int) {
+	var oldest string
+	for addr := range peers.Channels() {
+		if len(oldest) == 0 || peers.Since(addr).Before(peers.Since(oldest)) {
+			oldest = addr
+		}
+	}
+	if len(oldest) == 0 {
+		statusLn(tr("No peers"))
+		return
+	}
+	statusLn(tr("Asking %s for earlier messages", nickName(oldest)))
+	backfills.Lock()
+	backfills.asked[oldest] = true
+	backfills.Unlock()
+	go requestBackfill(oldest, n, false)
+}
+
+// shareable is whisper as it can be passed on to someone catching up, if
+// it can be.
+func shareable(whisper SweetNothing, network string) (SweetNothing, bool) {
+	if whisper.Net != network || len(whisper.To) > 0 || whisper.Sealed != nil || whisper.Deleted || expired(whisper, time.Now()) || blocked(whisper.Addr) {
+		return whisper, false
+	}
+	if whisper.Sig == nil {
+		// We keep our own messages unsigned, and can only vouch for them
+		// if they were never sealed.
+		if !isLocal(whisper.Addr) || e2eEnabled {
+			return whisper, false
+		}
+		whisper = signMessage(whisper)
+	}
+	if verifyMessage(whisper) != nil {
+		return whisper, false
+	}
+	whisper.Path = nil
+	return whisper, true
+}
+
+func handleBackfillRequest(from string, data json.RawMessage) {
+	var req backfillRequest
+	if json.Unmarshal(data, &req) != nil || req.Limit <= 0 {
+		return
+	}
+	go serveBackfill(from, min(req.Limit, maxBackfill), req.Since)
+}
+
+func serveBackfill(addr string, limit int, since time.Time) {
+	var msgs []SweetNothing
+	if history != nil {
+		msgs = history.Since(0)
+	} else {
+		recent.Lock()
+		for _, e := range recent.entries {
+			msgs = append(msgs, e.whisper)
+		}
+		recent.Unlock()
+	}
+	network := netOf(addr)
+	var out []SweetNothing
+	for i := len(msgs) - 1; i >= 0 && len(out) < limit; i-- {
+		if !msgs[i].Timestamp.After(since) {
+			continue
+		}
+		if whisper, ok := shareable(msgs[i], network); ok {
+			out = append(out, whisper)
+		}
+	}
+	// Oldest first, in batches that fit the bulk lane.
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	var batch []SweetNothing
+	size := 0
+	for _, whisper := range out {
+		b, _ := json.Marshal(whisper)
+		if size+len(b) > backfillBatch && len(batch) > 0 {
+			if !sendBackfill(addr, backfillBatchFrame{Msgs: batch}) {
+				return
+			}
+			batch, size = nil, 0
+		}
+		batch = append(batch, whisper)
+		size += len(b)
+	}
+	sendBackfill(addr, backfillBatchFrame{Msgs: batch, Last: true})
+}
+
+// sendBackfill waits for a link to addr if it hasn't dialed us back yet.
+func sendBackfill(addr string, b backfillBatchFrame) bool {
+	deadline := time.Now().Add(sessionTimeout)
+	for peers.Bulk(addr) == nil && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return sendBulk(addr, controlFrame("history", b), wantTimeout)
+}
+
+func handleBackfill(from string, data json.RawMessage) {
+	var b backfillBatchFrame
+	if json.Unmarshal(data, &b) != nil {
+		return
+	}
+	// Only take what we asked for, and no more of it than we asked for.
+	backfills.Lock()
+	wanted, ok := backfills.wanted[from]
+	if ok {
+		backfills.wanted[from] = wanted - len(b.Msgs)
+	}
+	backfills.Unlock()
+	if !ok {
+		return
+	}
+	msgs := b.Msgs[:min(len(b.Msgs), max(wanted, 0))]
+
+	network := netOf(from)
+	var fresh []SweetNothing
+	for _, whisper := range msgs {
+		whisper.Net = network
+		if whisper.Sig == nil || len(whisper.To) > 0 || whisper.Sealed != nil || expired(whisper, time.Now()) || verifyMessage(whisper) != nil || SeenId(whisper.ID) {
+			continue
+		}
+		if blocked(whisper.Addr) || !allowInbound(from, whisper.Addr) {
+			continue
+		}
+		if oversized(whisper) {
+			logger.Warn(T("Message over -max-body"), "event", "reject", "peer", whisper.Addr, "id", whisper.ID, "bytes", bodySize(whisper))
+			if bodyAction == bodyReject {
+				continue
+			}
+			whisper = truncateBody(whisper)
+		}
+		recordHistory(whisper)
+		fresh = append(fresh, whisper)
+	}
+	backfills.Lock()
+	got := append(backfills.pending[from], fresh...)
+	asked := backfills.asked[from]
+	if b.Last {
+		delete(backfills.pending, from)
+		delete(backfills.asked, from)
+		delete(backfills.wanted, from)
+	} else {
+		backfills.pending[from] = got
+	}
+	backfills.Unlock()
+	if b.Last && len(got) == 0 && asked {
+		statusLn(tr("Nothing from %s that we haven't seen", nickName(from)))
+	} else if b.Last {
+		showBackfill(from, got)
+	}
+}
+
+// showBackfill prints what we caught up on and brings polls, reactions
+// and edits up to date with it.
+func showBackfill(from string, msgs []SweetNothing) {
+	if len(msgs) == 0 {
+		return
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Timestamp.Before(msgs[j].Timestamp) })
+	replayPolls(msgs)
+	replayReactions(msgs)
+	replayAmendments(msgs)
+	statusLn(tr("%d earlier messages from %s:", len(msgs), nickName(from)))
+	for _, whisper := range msgs {
+		whisper = amended(whisper)
+		if len(whisper.Kind) == 0 && inRoom(whisper.Room) && !whisper.Deleted && !ignoring(whisper.Addr) {
+			showMessage(whisper)
+		}
+	}
+	statusLn(T("End of earlier messages"))
+}
@@ -0,0 +1,65 @@
+package sweetnothings
+
+/**
+ * Batching
+ *
+ * When a peer falls behind and frames pile up for it, the writer takes
+ * up to maxBatch of them at once, or about maxBulkFrame's worth, and
+ * writes them as one batch frame, rather than encoding and writing each
+ * on its own. Only peers that list
+ * the "batch" feature get them; the reader unpacks a batch and handles
+ * its frames in order, as if they'd come one by one.
+ */
+
+const batchFrame = "batch"
+
+const maxBatch = 32
+
+// moreFrames takes more interactive frames for addr to go with first
+// that are ready now, without waiting.
+func moreFrames(addr string, ch <-chan Frame, first Frame) []Frame {
+	var more []Frame
+	size := frameSize(first)
+	for len(more) < maxBatch-1 && size < maxBulkFrame {
+		var f Frame
+		select {
+		case f = <-ch:
+		default:
+			var ok bool
+			if f, ok = nextQueued(addr); !ok {
+				return more
+			}
+		}
+		more = append(more, f)
+		size += frameSize(f)
+	}
+	return more
+}
+
+// frameSize is roughly how long f will be once encoded.
+func frameSize(f Frame) int {
+	n := 64 + len(f.Data)
+	if f.Msg != nil {
+		n += 256 + len(f.Msg.Body) + len(f.Msg.Key) + len(f.Msg.Sig)
+		if f.Msg.Sealed != nil {
+			n += len(f.Msg.Sealed.Body) + 64*len(f.Msg.Sealed.Keys)
+		}
+	}
+	return n
+}
+
+// unbatch is the frames f carries, or f itself if it isn't a batch.
+func unbatch(f Frame) []Frame {
+	if f.Type != batchFrame {
+		return []Frame{f}
+	}
+	frames := make([]Frame, 0, len(f.Batch))
+	for _, b := range f.Batch {
+		if b.Type == batchFrame || b.Type == helloFrame || b.Type == compressFrame || b.Type == encodingFrame {
+			continue
+		}
+		b.From = f.From
+		frames = append(frames, b)
+	}
+	return frames
+}
@@ -0,0 +1,117 @@
+package sweetnothings
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+/**
+ * Broadcast beacons
+ *
+ * Where multicast is filtered and mDNS can't get through, -broadcast sends
+ * a small beacon with our listen address to the local broadcast address
+ * every so often, and dials whoever else's beacon we hear. Beacons are
+ * signed with an HMAC over -broadcast-key so strangers on the segment
+ * can't steer us to dial them; without a key they're only checked for
+ * being well formed. Only one instance per host can listen for beacons,
+ * but all of them send.
+ */
+
+var broadcastEnabled bool
+var broadcastKey string
+
+const beaconPort = 5354
+
+const beaconInterval = 30 * time.Second
+
+// Beacons older than this are ignored, which limits replaying them.
+const beaconMaxAge = 2 * beaconInterval
+
+type beacon struct {
+	Addr string
+	Time int64
+	Sig  string `json:",omitempty"`
+}
+
+func (b beacon) sign() string {
+	mac := hmac.New(sha256.New, []byte(broadcastKey))
+	fmt.Fprintf(mac, "%s|%d", b.Addr, b.Time)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (b beacon) valid() bool {
+	age := time.Since(time.Unix(b.Time, 0))
+	if age > beaconMaxAge || age < -beaconMaxAge {
+		return false
+	}
+	sig, err := hex.DecodeString(b.Sig)
+	if err != nil {
+		return false
+	}
+	want, _ := hex.DecodeString(b.sign())
+	return hmac.Equal(sig, want)
+}
+
+func sendBeacons() {
+	c, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		logger.Error(T("Error sending beacons"), "event", "beacon", "err", err)
+		return
+	}
+	to := &net.UDPAddr{IP: net.IPv4bcast, Port: beaconPort}
+	for {
+		b := beacon{Addr: localInfo.Addr(), Time: time.Now().Unix()}
+		b.Sig = b.sign()
+		data, _ := json.Marshal(b)
+		if _, err := c.WriteToUDP(data, to); err != nil {
+			logger.Error(T("Error sending beacons"), "event", "beacon", "err", err)
+		}
+		time.Sleep(beaconInterval)
+	}
+}
+
+func startBeacons() {
+	go sendBeacons()
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{Port: beaconPort})
+	if err != nil {
+		statusLn(tr("Sending beacons, but not listening for them: %s", err))
+		return
+	}
+	statusLn(tr("Listening for beacons on UDP port %d", beaconPort))
+	found := make(map[string]bool)
+	buf := make([]byte, 1024)
+	for {
+		n, from, err := c.ReadFromUDP(buf)
+		if err != nil {
+			logger.Error(T("Error reading beacons"), "event", "beacon", "err", err)
+			return
+		}
+		var b beacon
+		if err := json.Unmarshal(buf[:n], &b); err != nil || !b.valid() || isLocal(b.Addr) {
+			continue
+		}
+		addr := b.Addr
+		// Like mDNS, a peer that only knows itself as loopback is found
+		// at the address its beacon came from.
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip == nil || (ip.IsLoopback() && !from.IP.IsLoopback()) {
+			addr = net.JoinHostPort(from.IP.String(), port)
+		}
+		if isLocal(addr) || peers.Get(addr) != nil {
+			continue
+		}
+		if !found[addr] {
+			found[addr] = true
+			statusLn(tr("Heard a beacon from %s", addr))
+		}
+		go autoDial(addr)
+	}
+}
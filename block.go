@@ -0,0 +1,126 @@
+package sweetnothings
+
+import (
+	"sort"
+	"sync"
+)
+
+/**
+ * Ignoring and blocking
+ *
+ * /ignore <peer> hides what a peer says from us, though we still relay
+ * it for everyone else. /block <peer> goes further: we drop our link to
+ * it, refuse the ones it makes, won't dial it and won't pass on its
+ * messages, whoever they come through. /unignore and /unblock undo them,
+ * and /ignore or /block alone lists who's on each. Both lists are kept in
+ * the profile's config.json.
+ */
+
+var shunned = struct {
+	ignored map[string]bool
+	blocked map[string]bool
+	sync.Mutex
+}{ignored: make(map[string]bool), blocked: make(map[string]bool)}
+
+// loadShunned picks up the lists from the profile.
+func loadShunned() {
+	shunned.Lock()
+	defer shunned.Unlock()
+	for _, addr := range profileConfig.Ignored {
+		shunned.ignored[addr] = true
+	}
+	for _, addr := range profileConfig.Blocked {
+		shunned.blocked[addr] = true
+	}
+}
+
+func ignoring(addr string) bool {
+	shunned.Lock()
+	defer shunned.Unlock()
+	return shunned.ignored[addr] || shunned.blocked[addr]
+}
+
+func blocked(addr string) bool {
+	shunned.Lock()
+	defer shunned.Unlock()
+	return shunned.blocked[addr]
+}
+
+// shun adds addr to or takes it off one of the lists, keeping the
+// profile up to date. It reports whether anything changed.
+func shun(list map[string]bool, addr string, on bool) bool {
+	shunned.Lock()
+	changed := list[addr] != on
+	if on {
+		list[addr] = true
+	} else {
+		delete(list, addr)
+	}
+	profileConfig.Ignored = sortedAddrs(shunned.ignored)
+	profileConfig.Blocked = sortedAddrs(shunned.blocked)
+	shunned.Unlock()
+	if changed && !ephemeral {
+		if err := saveProfile(); err != nil {
+			logger.Error(T("Error saving profile"), "event", "block", "err", err)
+		}
+	}
+	return changed
+}
+
+func sortedAddrs(m map[string]bool) []string {
+	var l []string
+	for addr := range m {
+		l = append(l, addr)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// ignoreCommand handles /ignore and /unignore.
+func ignoreCommand(name string, on bool) {
+	if len(name) == 0 {
+		listShunned(shunned.ignored, T("Not ignoring anyone"), T("Ignoring"))
+		return
+	}
+	addr := dialAddr(peerFor(name))
+	switch {
+	case !shun(shunned.ignored, addr, on):
+	case on:
+		statusLn(tr("Ignoring %s; their messages are still relayed", nickName(addr)))
+	default:
+		statusLn(tr("No longer ignoring %s", nickName(addr)))
+	}
+}
+
+// blockCommand handles /block and /unblock.
+func blockCommand(name string, on bool) {
+	if len(name) == 0 {
+		listShunned(shunned.blocked, T("Not blocking anyone"), T("Blocked"))
+		return
+	}
+	addr := dialAddr(peerFor(name))
+	if !shun(shunned.blocked, addr, on) {
+		return
+	}
+	if on {
+		noReconnect(addr)
+		unrememberPeer(addr)
+		peers.Disconnect(addr)
+		statusLn(tr("Blocked %s", nickName(addr)))
+	} else {
+		statusLn(tr("Unblocked %s", nickName(addr)))
+	}
+}
+
+func listShunned(list map[string]bool, none string, label string) {
+	shunned.Lock()
+	addrs := sortedAddrs(list)
+	shunned.Unlock()
+	if len(addrs) == 0 {
+		statusLn(none)
+		return
+	}
+	for _, addr := range addrs {
+		noteLn(label, "", nickName(addr), "blue")
+	}
+}
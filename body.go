@@ -0,0 +1,70 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+/**
+ * Body limits
+ *
+ * -max-body caps how long a message body may be, so a huge paste isn't
+ * gossiped to the whole mesh. With -body-action truncate, the default,
+ * one of ours over it is cut short before it's signed, and one we receive
+ * is shown cut short; with reject, ours isn't sent and theirs is dropped.
+ * Direct messages are held to the same limit both ways.
+ * Either way we never relay or backfill someone else's oversized message.
+ * Sealed messages are measured by their ciphertext, less what sealing
+ * adds.
+ */
+
+const (
+	bodyTruncate = "truncate"
+	bodyReject   = "reject"
+)
+
+// Longest message body in bytes; 0 means no limit.
+var maxBody = 64 << 10
+
+var bodyAction = bodyTruncate
+
+// What sealWith adds to a body: a GCM nonce and tag.
+const sealOverhead = 12 + 16
+
+func bodySize(whisper SweetNothing) int {
+	if whisper.Sealed != nil {
+		return max(len(whisper.Sealed.Body)-sealOverhead, 0)
+	}
+	return len(whisper.Body)
+}
+
+func oversized(whisper SweetNothing) bool {
+	return maxBody > 0 && bodySize(whisper) > maxBody
+}
+
+// truncateBody cuts whisper's body to at most maxBody bytes, on a rune
+// boundary, and marks it as cut.
+func truncateBody(whisper SweetNothing) SweetNothing {
+	const more = "…"
+	if maxBody <= 0 || len(whisper.Body) <= maxBody {
+		return whisper
+	}
+	n := max(maxBody-len(more), 0)
+	for n > 0 && !utf8.RuneStart(whisper.Body[n]) {
+		n--
+	}
+	whisper.Body = whisper.Body[:n] + more
+	return whisper
+}
+
+// limitOutgoing applies -max-body to a message we're about to send.
+func limitOutgoing(whisper SweetNothing) (SweetNothing, error) {
+	if !oversized(whisper) {
+		return whisper, nil
+	}
+	if bodyAction == bodyReject {
+		return whisper, fmt.Errorf(T("message is %d bytes, over -max-body of %d"), len(whisper.Body), maxBody)
+	}
+	statusLn(tr("Cut the message to %d bytes to fit -max-body", maxBody))
+	return truncateBody(whisper), nil
+}
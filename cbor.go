@@ -0,0 +1,451 @@
+package sweetnothings
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+/**
+ * CBOR
+ *
+ * The codec for -encoding cbor, for anyone who'd rather have a
+ * self-describing binary format than protobuf's schema. Frames and
+ * messages are maps keyed by their Go field names, as in JSON,
+ * timestamps are tagged date strings (the text that was signed) and
+ * binary fields are byte strings instead of base64. Fields we don't know
+ * are skipped when read.
+ */
+
+const (
+	cborUint  = 0
+	cborNeg   = 1
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+	cborOther = 7
+)
+
+// Deepest nesting we'll read: a batch of frames of messages of sealed
+// keys.
+const cborMaxDepth = 8
+
+var errBadCBOR = errors.New("malformed CBOR")
+
+type cborWriter []byte
+
+func (w *cborWriter) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		*w = append(*w, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		*w = append(*w, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		*w = binary.BigEndian.AppendUint16(append(*w, major<<5|25), uint16(n))
+	case n <= math.MaxUint32:
+		*w = binary.BigEndian.AppendUint32(append(*w, major<<5|26), uint32(n))
+	default:
+		*w = binary.BigEndian.AppendUint64(append(*w, major<<5|27), n)
+	}
+}
+
+func (w *cborWriter) text(s string) {
+	w.head(cborText, uint64(len(s)))
+	*w = append(*w, s...)
+}
+
+func (w *cborWriter) bytes(b []byte) {
+	w.head(cborBytes, uint64(len(b)))
+	*w = append(*w, b...)
+}
+
+// cborFields builds a map, leaving out empty fields.
+type cborFields struct {
+	n int
+	w cborWriter
+}
+
+func (m *cborFields) key(k string) {
+	m.n++
+	m.w.text(k)
+}
+
+func (m *cborFields) text(k string, s string) {
+	if len(s) > 0 {
+		m.key(k)
+		m.w.text(s)
+	}
+}
+
+func (m *cborFields) bytes(k string, b []byte) {
+	if len(b) > 0 {
+		m.key(k)
+		m.w.bytes(b)
+	}
+}
+
+func (m *cborFields) uint(k string, v uint64) {
+	if v != 0 {
+		m.key(k)
+		m.w.head(cborUint, v)
+	}
+}
+
+func (m *cborFields) bool(k string, v bool) {
+	if v {
+		m.key(k)
+		m.w = append(m.w, cborOther<<5|21)
+	}
+}
+
+func (m *cborFields) texts(k string, l []string) {
+	if len(l) > 0 {
+		m.key(k)
+		m.w.head(cborArray, uint64(len(l)))
+		for _, s := range l {
+			m.w.text(s)
+		}
+	}
+}
+
+// raw adds an item that's already encoded.
+func (m *cborFields) raw(k string, b []byte) {
+	m.key(k)
+	m.w = append(m.w, b...)
+}
+
+func (m cborFields) encoded() []byte {
+	var w cborWriter
+	w.head(cborMap, uint64(m.n))
+	return append(w, m.w...)
+}
+
+func marshalCBORFrame(f Frame) []byte {
+	var m cborFields
+	m.text("Type", f.Type)
+	m.text("From", f.From)
+	if f.Msg != nil {
+		m.raw("Msg", marshalCBORMessage(*f.Msg))
+	}
+	m.bytes("Data", f.Data)
+	m.uint("Seq", f.Seq)
+	if len(f.Batch) > 0 {
+		var w cborWriter
+		w.head(cborArray, uint64(len(f.Batch)))
+		for _, inner := range f.Batch {
+			w = append(w, marshalCBORFrame(inner)...)
+		}
+		m.raw("Batch", w)
+	}
+	return m.encoded()
+}
+
+func marshalCBORMessage(whisper SweetNothing) []byte {
+	var m cborFields
+	m.text("ID", whisper.ID)
+	m.text("Addr", whisper.Addr)
+	m.text("Body", whisper.Body)
+	ts, _ := whisper.Timestamp.MarshalText()
+	var w cborWriter
+	// Tag 0 is a date/time string.
+	w.head(cborTag, 0)
+	w.text(string(ts))
+	m.raw("Timestamp", w)
+	m.texts("Path", whisper.Path)
+	m.uint("Hops", uint64(max(whisper.Hops, 0)))
+	m.text("Room", whisper.Room)
+	m.text("To", whisper.To)
+	m.bool("Edited", whisper.Edited)
+	m.bool("Deleted", whisper.Deleted)
+	m.text("Kind", whisper.Kind)
+	m.text("Ref", whisper.Ref)
+	m.texts("Options", whisper.Options)
+	m.uint("Clock", whisper.Clock)
+	m.uint("TTL", uint64(max(whisper.TTL, 0)))
+	m.text("Net", whisper.Net)
+	if s := whisper.Sealed; s != nil {
+		var sealed cborFields
+		sealed.key("Body")
+		sealed.w.bytes(s.Body)
+		var keys cborFields
+		for to, key := range s.Keys {
+			keys.key(to)
+			keys.w.bytes(key)
+		}
+		sealed.raw("Keys", keys.encoded())
+		m.raw("Sealed", sealed.encoded())
+	}
+	m.bytes("Key", whisper.Key)
+	m.bytes("Sig", whisper.Sig)
+	return m.encoded()
+}
+
+// cborItem is one decoded item: uint64, int64, []byte, string, bool,
+// nil, float64, []any or map[string]any. Tags are dropped.
+func cborItem(b []byte, depth int) (any, []byte, error) {
+	if len(b) == 0 || depth > cborMaxDepth {
+		return nil, nil, errBadCBOR
+	}
+	major, info := b[0]>>5, b[0]&31
+	b = b[1:]
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < size {
+			return nil, nil, errBadCBOR
+		}
+		for _, c := range b[:size] {
+			n = n<<8 | uint64(c)
+		}
+		b = b[size:]
+	default:
+		// Indefinite lengths aren't written by us.
+		return nil, nil, errBadCBOR
+	}
+	switch major {
+	case cborUint:
+		return n, b, nil
+	case cborNeg:
+		if n > math.MaxInt64 {
+			return nil, nil, errBadCBOR
+		}
+		return -1 - int64(n), b, nil
+	case cborBytes, cborText:
+		if n > uint64(len(b)) {
+			return nil, nil, errBadCBOR
+		}
+		if major == cborText {
+			return string(b[:n]), b[n:], nil
+		}
+		return append([]byte{}, b[:n]...), b[n:], nil
+	case cborArray:
+		if n > uint64(len(b)) {
+			return nil, nil, errBadCBOR
+		}
+		l := make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var v any
+			var err error
+			if v, b, err = cborItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			l = append(l, v)
+		}
+		return l, b, nil
+	case cborMap:
+		if n > uint64(len(b)) {
+			return nil, nil, errBadCBOR
+		}
+		m := make(map[string]any, n)
+		for i := uint64(0); i < n; i++ {
+			k, rest, err := cborItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, nil, errBadCBOR
+			}
+			if m[key], b, err = cborItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+		}
+		return m, b, nil
+	case cborTag:
+		return cborItem(b, depth+1)
+	}
+	switch {
+	case info == 20:
+		return false, b, nil
+	case info == 21:
+		return true, b, nil
+	case info == 22 || info == 23:
+		return nil, b, nil
+	case info == 25:
+		return float16(uint16(n)), b, nil
+	case info == 26:
+		return float64(math.Float32frombits(uint32(n))), b, nil
+	case info == 27:
+		return math.Float64frombits(n), b, nil
+	}
+	return nil, nil, errBadCBOR
+}
+
+// float16 is the value of a half-precision float.
+func float16(h uint16) float64 {
+	exp, frac := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if frac != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h>>15 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// cborRecord reads the fields of a decoded map, noting any of the wrong
+// type.
+type cborRecord struct {
+	m   map[string]any
+	err error
+}
+
+func (r *cborRecord) text(k string) string {
+	s, ok := r.m[k].(string)
+	if !ok && r.m[k] != nil {
+		r.err = errBadCBOR
+	}
+	return s
+}
+
+func (r *cborRecord) bytes(k string) []byte {
+	b, ok := r.m[k].([]byte)
+	if !ok && r.m[k] != nil {
+		r.err = errBadCBOR
+	}
+	return b
+}
+
+func (r *cborRecord) uint(k string) uint64 {
+	v, ok := r.m[k].(uint64)
+	if !ok && r.m[k] != nil {
+		r.err = errBadCBOR
+	}
+	return v
+}
+
+func (r *cborRecord) bool(k string) bool {
+	v, ok := r.m[k].(bool)
+	if !ok && r.m[k] != nil {
+		r.err = errBadCBOR
+	}
+	return v
+}
+
+func (r *cborRecord) texts(k string) []string {
+	l, ok := r.m[k].([]any)
+	if !ok && r.m[k] != nil {
+		r.err = errBadCBOR
+	}
+	var out []string
+	for _, v := range l {
+		s, ok := v.(string)
+		if !ok {
+			r.err = errBadCBOR
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (r *cborRecord) record(k string) (*cborRecord, bool) {
+	m, ok := r.m[k].(map[string]any)
+	if !ok && r.m[k] != nil {
+		r.err = errBadCBOR
+	}
+	return &cborRecord{m: m}, ok
+}
+
+func unmarshalCBORFrame(b []byte, f *Frame) error {
+	v, rest, err := cborItem(b, 0)
+	if err != nil {
+		return err
+	}
+	m, ok := v.(map[string]any)
+	if !ok || len(rest) > 0 {
+		return errBadCBOR
+	}
+	return cborFrame(&cborRecord{m: m}, f)
+}
+
+func cborFrame(r *cborRecord, f *Frame) error {
+	f.Type = r.text("Type")
+	f.From = r.text("From")
+	if msg, ok := r.record("Msg"); ok {
+		var whisper SweetNothing
+		if err := cborMessage(msg, &whisper); err != nil {
+			return err
+		}
+		f.Msg = &whisper
+	}
+	if data := r.bytes("Data"); len(data) > 0 {
+		f.Data = json.RawMessage(data)
+	}
+	f.Seq = r.uint("Seq")
+	batch, ok := r.m["Batch"].([]any)
+	if !ok && r.m["Batch"] != nil {
+		return errBadCBOR
+	}
+	for _, v := range batch {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return errBadCBOR
+		}
+		var inner Frame
+		if err := cborFrame(&cborRecord{m: m}, &inner); err != nil {
+			return err
+		}
+		f.Batch = append(f.Batch, inner)
+	}
+	return r.err
+}
+
+func cborMessage(r *cborRecord, whisper *SweetNothing) error {
+	whisper.ID = r.text("ID")
+	whisper.Addr = r.text("Addr")
+	whisper.Body = r.text("Body")
+	if ts := r.text("Timestamp"); len(ts) > 0 {
+		if err := whisper.Timestamp.UnmarshalText([]byte(ts)); err != nil {
+			return err
+		}
+	}
+	whisper.Path = r.texts("Path")
+	whisper.Hops = int(min(r.uint("Hops"), math.MaxInt32))
+	whisper.Room = r.text("Room")
+	whisper.To = r.text("To")
+	whisper.Edited = r.bool("Edited")
+	whisper.Deleted = r.bool("Deleted")
+	whisper.Kind = r.text("Kind")
+	whisper.Ref = r.text("Ref")
+	whisper.Options = r.texts("Options")
+	whisper.Clock = r.uint("Clock")
+	whisper.TTL = time.Duration(min(r.uint("TTL"), math.MaxInt64))
+	whisper.Net = r.text("Net")
+	if sealed, ok := r.record("Sealed"); ok {
+		s := &Sealed{Body: sealed.bytes("Body"), Keys: make(map[string][]byte)}
+		if s.Body == nil {
+			s.Body = []byte{}
+		}
+		keys, _ := sealed.record("Keys")
+		for to := range keys.m {
+			if key := keys.bytes(to); key != nil {
+				s.Keys[to] = key
+			} else {
+				s.Keys[to] = []byte{}
+			}
+		}
+		if sealed.err != nil || keys.err != nil {
+			return errBadCBOR
+		}
+		whisper.Sealed = s
+	}
+	whisper.Key = r.bytes("Key")
+	whisper.Sig = r.bytes("Sig")
+	return r.err
+}
@@ -0,0 +1,113 @@
+package sweetnothings
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * Ordering
+ *
+ * Messages carry a Lamport clock: we tick it for each message we write
+ * and move it past any clock we receive, so a reply always has a higher
+ * clock than what it answers. Incoming messages wait in a reorder buffer
+ * for -reorder-window before they're shown, and come out by clock rather
+ * than by arrival, so a mesh with several routes between peers still
+ * shows a conversation in an order that makes sense. Messages from peers
+ * without clocks sort by their timestamp among themselves.
+ */
+
+var reorderWindow = 250 * time.Millisecond
+
+var lamport = struct {
+	t uint64
+	sync.Mutex
+}{}
+
+// tickClock advances our clock for a message we're writing.
+func tickClock() uint64 {
+	lamport.Lock()
+	defer lamport.Unlock()
+	lamport.t++
+	return lamport.t
+}
+
+// observeClock moves our clock past one we've seen.
+func observeClock(t uint64) {
+	lamport.Lock()
+	defer lamport.Unlock()
+	lamport.t = max(lamport.t, t)
+}
+
+type heldMessage struct {
+	whisper SweetNothing
+	arrived time.Time
+}
+
+var reorderBuf = struct {
+	held  []heldMessage
+	timer *time.Timer
+	sync.Mutex
+}{}
+
+// Keeps flushes, and so what they show, in order.
+var flushMu sync.Mutex
+
+func causallyBefore(a SweetNothing, b SweetNothing) bool {
+	if a.Clock != b.Clock {
+		return a.Clock < b.Clock
+	}
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.ID < b.ID
+}
+
+// reorder shows whisper once anything that should come before it has had
+// a chance to arrive.
+func reorder(whisper SweetNothing) {
+	if reorderWindow <= 0 {
+		displayMessage(whisper)
+		return
+	}
+	reorderBuf.Lock()
+	defer reorderBuf.Unlock()
+	reorderBuf.held = append(reorderBuf.held, heldMessage{whisper, time.Now()})
+	if reorderBuf.timer == nil {
+		reorderBuf.timer = time.AfterFunc(reorderWindow, flushReorder)
+	}
+}
+
+// flushReorder shows every held message that has waited out the window,
+// along with any that sort before one of them.
+func flushReorder() {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	reorderBuf.Lock()
+	held := reorderBuf.held
+	sort.SliceStable(held, func(i, j int) bool { return causallyBefore(held[i].whisper, held[j].whisper) })
+	cutoff := time.Now().Add(-reorderWindow)
+	n := 0
+	for i, m := range held {
+		if !m.arrived.After(cutoff) {
+			n = i + 1
+		}
+	}
+	ready := append([]heldMessage(nil), held[:n]...)
+	reorderBuf.held = append([]heldMessage(nil), held[n:]...)
+	reorderBuf.timer = nil
+	if len(reorderBuf.held) > 0 {
+		first := reorderBuf.held[0].arrived
+		for _, m := range reorderBuf.held {
+			if m.arrived.Before(first) {
+				first = m.arrived
+			}
+		}
+		reorderBuf.timer = time.AfterFunc(time.Until(first.Add(reorderWindow)), flushReorder)
+	}
+	reorderBuf.Unlock()
+	for _, m := range ready {
+		displayMessage(m.whisper)
+	}
+}
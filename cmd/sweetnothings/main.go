@@ -0,0 +1,8 @@
+// Command sweetnothings is a peer-to-peer chat client.
+package main
+
+import "github.com/harveyr/sweetnothings"
+
+func main() {
+	sweetnothings.Main()
+}
@@ -0,0 +1,204 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/**
+ * Codecs
+ *
+ * Links start out as JSON, one frame per line. Once the writer has the
+ * reader's hello, it sends an encoding frame naming the codec it chose
+ * with -encoding, if the hello lists it, and writes the rest of the link
+ * in that codec, each frame prefixed with its length as a varint. Older
+ * peers list none and carry on with lines. Either way a frame over
+ * -max-frame is skipped rather than buffered, and one that won't decode
+ * is dropped without losing our place in the stream. Codecs sit on the
+ * byte stream, under whichever transport carries it.
+ */
+
+const jsonEncoding = "json"
+
+var linkEncoding = jsonEncoding
+
+const encodingFrame = "encoding"
+
+// Longest frame we'll read, in bytes.
+var maxFrame = 1 << 20
+
+type wireEncoding struct {
+	Format string
+}
+
+type wireCodec struct {
+	marshal   func(Frame) []byte
+	unmarshal func([]byte, *Frame) error
+}
+
+var wireCodecs = map[string]wireCodec{
+	"cbor":       {marshalCBORFrame, unmarshalCBORFrame},
+	jsonEncoding: {marshalJSONFrame, unmarshalJSONFrame},
+	"proto":      {marshalProtoFrame, unmarshalProtoFrame},
+}
+
+func marshalJSONFrame(f Frame) []byte {
+	b, _ := json.Marshal(f)
+	return b
+}
+
+func unmarshalJSONFrame(b []byte, f *Frame) error {
+	return json.Unmarshal(b, f)
+}
+
+// codecNames lists the encodings -encoding can choose.
+func codecNames() []string {
+	var names []string
+	for name := range wireCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// startEncoding tells the reader that what follows on w is in the codec
+// called name, and returns the encoder to carry on with.
+func startEncoding(addr string, name string, encode func(Frame) error, w io.Writer) (func(Frame) error, error) {
+	c := wireCodecs[name]
+	f := controlFrame(encodingFrame, wireEncoding{Format: name})
+	f.From = localAddr(netOf(addr))
+	if err := encode(f); err != nil {
+		return nil, err
+	}
+	return func(f Frame) error {
+		b := c.marshal(f)
+		_, err := w.Write(append(binary.AppendUvarint(nil, uint64(len(b))), b...))
+		return err
+	}, nil
+}
+
+// frameReader reads the frames on a link as its writer changes
+// compression and codec.
+type frameReader struct {
+	br    *bufio.Reader
+	codec *wireCodec
+	// Peer is who we're reading from, for logs, and started is set once
+	// a frame has decoded.
+	peer    string
+	started bool
+}
+
+func newFrameReader(r io.Reader, peer string) *frameReader {
+	return &frameReader{br: bufio.NewReader(r), peer: peer}
+}
+
+func (r *frameReader) Read(f *Frame) error {
+	for {
+		b, err := r.frame()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			continue
+		}
+		*f = Frame{}
+		if r.codec == nil {
+			err = json.Unmarshal(b, f)
+		} else {
+			err = r.codec.unmarshal(b, f)
+		}
+		if err == nil {
+			r.started = true
+			return nil
+		}
+		if !r.started {
+			// Whatever this is, it isn't a peer.
+			return err
+		}
+		logger.Warn(T("Skipping a frame that won't decode"), "event", "link", "peer", r.peer, "err", err)
+	}
+}
+
+// frame reads the next frame's bytes, or nil for one that's too long
+// or blank.
+func (r *frameReader) frame() ([]byte, error) {
+	if r.codec != nil {
+		n, err := binary.ReadUvarint(r.br)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(maxFrame) {
+			logger.Warn(T("Skipping a frame longer than -max-frame"), "event", "link", "peer", r.peer, "bytes", n)
+			_, err := io.CopyN(io.Discard, r.br, int64(n))
+			return nil, err
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r.br, b)
+		return b, err
+	}
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.br.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			tooLong = len(line) > maxFrame
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if tooLong {
+		logger.Warn(T("Skipping a frame longer than -max-frame"), "event", "link", "peer", r.peer, "bytes", len(line))
+		return nil, nil
+	}
+	if line = bytes.TrimSpace(line); len(line) == 0 {
+		return nil, nil
+	}
+	return line, nil
+}
+
+// decompress reads the rest of the link as gzip.
+func (r *frameReader) decompress(f Frame) error {
+	var c compression
+	if err := json.Unmarshal(f.Data, &c); err != nil {
+		return err
+	}
+	if r.codec != nil {
+		return errors.New(T("compression must start before the encoding changes"))
+	}
+	if c.Algo != "gzip" {
+		return fmt.Errorf(T("unknown compression %q"), c.Algo)
+	}
+	zr, err := gzip.NewReader(r.br)
+	if err != nil {
+		return err
+	}
+	r.br = bufio.NewReader(zr)
+	return nil
+}
+
+// decode reads the rest of the link in the codec f names.
+func (r *frameReader) decode(f Frame) error {
+	var e wireEncoding
+	if err := json.Unmarshal(f.Data, &e); err != nil {
+		return err
+	}
+	c, ok := wireCodecs[e.Format]
+	if !ok {
+		return fmt.Errorf(T("unknown encoding %q"), e.Format)
+	}
+	r.codec = &c
+	return nil
+}
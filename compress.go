@@ -0,0 +1,53 @@
+package sweetnothings
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+/**
+ * Compression
+ *
+ * With -compress, once a peer's hello says it can read gzip, the writer
+ * sends a compress frame and gzips the rest of the link, flushing after
+ * each frame so nothing waits in the compressor. Every node can read
+ * compressed links; only those started with -compress write them. Chat
+ * compresses well against what came before it, and backfills and file
+ * chunks shrink too, which helps on slow links. Snappy isn't offered, as
+ * it's not in the standard library.
+ */
+
+var compressLinks bool
+
+const compressFrame = "compress"
+
+type compression struct {
+	Algo string
+}
+
+// startCompression tells the reader that what follows on w is gzipped,
+// and returns the writer to carry on with.
+func startCompression(addr string, encode func(Frame) error, w io.Writer) (io.Writer, error) {
+	f := controlFrame(compressFrame, compression{Algo: "gzip"})
+	f.From = localAddr(netOf(addr))
+	if err := encode(f); err != nil {
+		return nil, err
+	}
+	zw := gzip.NewWriter(w)
+	// The reader waits for the gzip header before going on.
+	return flushingWriter{zw}, zw.Flush()
+}
+
+// flushingWriter flushes the compressor after every frame, which the
+// encoders write in one go.
+type flushingWriter struct {
+	zw *gzip.Writer
+}
+
+func (w flushingWriter) Write(b []byte) (int, error) {
+	n, err := w.zw.Write(b)
+	if err == nil {
+		err = w.zw.Flush()
+	}
+	return n, err
+}
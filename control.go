@@ -0,0 +1,215 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/**
+ * Control socket
+ *
+ * Scripts can drive a running node through a Unix socket in the profile,
+ * control.sock by default. Each line sent is a JSON request and gets one
+ * JSON response line back:
+ *
+ *	{"Command": "send", "Body": "hello", "Room": "#ops"}
+ *	{"Command": "dial", "Addr": "10.0.0.2:9000"}
+ *	{"Command": "peers"}
+ *	{"Command": "run", "Line": "/topic standup at ten"}
+ *	{"Command": "typing"}
+ *	{"Command": "attach"}
+ *
+ * "run" takes anything that could be typed, but what it prints goes to
+ * the node's own output. After "attach" the socket is a terminal instead,
+ * as `sweetnothings attach` uses it: the node's output comes back, and
+ * each line sent is handled as typed.
+ *
+ * Only our own user may connect: the socket is never reachable by anyone
+ * else, even briefly, and where the kernel tells us who's on the other
+ * end (SO_PEERCRED) we check that too.
+ */
+
+var controlPath string
+
+// Longest request or typed line the control socket takes.
+const maxControlLine = 16 << 20
+
+type controlRequest struct {
+	Command string
+	Body    string `json:",omitempty"`
+	Room    string `json:",omitempty"`
+	Addr    string `json:",omitempty"`
+	Line    string `json:",omitempty"`
+	// Graphics is the image protocol an attaching terminal speaks.
+	Graphics int `json:",omitempty"`
+}
+
+type controlPeer struct {
+	Addr      string
+	Nick      string
+	Transport string
+}
+
+type controlResponse struct {
+	OK    bool
+	Error string        `json:",omitempty"`
+	ID    string        `json:",omitempty"`
+	Peers []controlPeer `json:",omitempty"`
+}
+
+func handleControlRequest(req controlRequest) controlResponse {
+	switch req.Command {
+	case "send":
+		if len(req.Body) == 0 {
+			return controlResponse{Error: T("nothing to send")}
+		}
+		room := activeRoom()
+		if len(req.Room) > 0 {
+			room = roomName(req.Room)
+		}
+		whisper, ok := publishText(SweetNothing{Room: room, Body: req.Body})
+		if !ok {
+			return controlResponse{Error: T("not sent")}
+		}
+		return controlResponse{OK: true, ID: whisper.ID}
+	case "dial":
+		if len(req.Addr) == 0 {
+			return controlResponse{Error: T("no address to dial")}
+		}
+		addr := dialAddr(req.Addr)
+		setNet(addr, currentNetwork())
+		pinPeer(addr)
+		go dial(addr)
+		return controlResponse{OK: true}
+	case "peers":
+		r := controlResponse{OK: true, Peers: []controlPeer{}}
+		for addr := range peers.Channels() {
+			r.Peers = append(r.Peers, controlPeer{addr, nickName(addr), peers.Transport(addr)})
+		}
+		sort.Slice(r.Peers, func(i, j int) bool { return r.Peers[i].Addr < r.Peers[j].Addr })
+		return r
+	case "run":
+		if len(req.Line) == 0 {
+			return controlResponse{Error: T("nothing to run")}
+		}
+		if req.Line[0] == '/' {
+			handleCommand(req.Line)
+		} else {
+			publishText(SweetNothing{Room: activeRoom(), Body: req.Line})
+		}
+		return controlResponse{OK: true}
+	case "typing":
+		nowTyping()
+		return controlResponse{OK: true}
+	}
+	return controlResponse{Error: tr("unknown command %q", req.Command)}
+}
+
+func serveControlConn(c net.Conn) {
+	defer c.Close()
+	// A command that blows up shouldn't take a daemon down with it.
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error(T("Control command failed"), "event", "control", "err", r)
+		}
+	}()
+	s := bufio.NewScanner(c)
+	// Attached terminals paste long lines too; -max-body deals with them.
+	s.Buffer(make([]byte, 64*1024), maxControlLine)
+	enc := json.NewEncoder(c)
+	for s.Scan() {
+		var req controlRequest
+		var resp controlResponse
+		if err := json.Unmarshal(s.Bytes(), &req); err != nil {
+			resp.Error = err.Error()
+		} else if req.Command == "attach" {
+			if enc.Encode(controlResponse{OK: true}) == nil {
+				attach(c, s, req.Graphics)
+			}
+			return
+		} else {
+			resp = handleControlRequest(req)
+		}
+		if enc.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+// controlInUse reports whether a node is answering on path.
+func controlInUse(path string) bool {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// listenControl opens the control socket, unless another node on this
+// profile already has it.
+func listenControl(path string) {
+	if controlInUse(path) && !upgraded() {
+		statusLn(tr("Another instance is using %s; no control socket", path))
+		return
+	}
+	// An upgrade takes the socket over from the process before us; any
+	// other file there is left over from a crash.
+	os.Remove(path)
+	l, err := listenPrivate(path)
+	if err != nil {
+		logger.Error(T("Error opening control socket"), "event", "control", "path", path, "err", err)
+		return
+	}
+	statusLn(tr("Control socket at %s", path))
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				logger.Error(T("Error on control socket"), "event", "control", "err", err)
+				return
+			}
+			if !sameUser(c) {
+				logger.Warn(T("Refused a control connection from another user"), "event", "control")
+				c.Close()
+				continue
+			}
+			go serveControlConn(c)
+		}
+	}()
+}
+
+// listenPrivate opens a Unix socket at path that only we can connect to.
+// The profile directory is usually readable by everyone, so the socket is
+// bound in a fresh 0700 directory and locked down before it's moved into
+// place, leaving no moment when the umask lets others connect.
+func listenPrivate(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(dir, ".control")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	bound := filepath.Join(tmp, "sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: bound, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The name it was bound to is gone once it's moved.
+	l.SetUnlinkOnClose(false)
+	if err = os.Chmod(bound, 0600); err == nil {
+		err = os.Rename(bound, path)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,113 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ORSet is an observed-remove set layered on the metadata store. Every add
+// writes a key tagged uniquely for that add; removing an element tombstones
+// only the tags this node has seen. An add made concurrently elsewhere keeps
+// its own tag alive, so concurrent add and remove settle on "present" rather
+// than depending on which arrived last.
+type ORSet struct {
+	Name string
+}
+
+func (s ORSet) prefix(elem string) string {
+	return s.Name + "/" + url.PathEscape(elem) + "#"
+}
+
+func (s ORSet) Add(elem string) {
+	setMeta(s.prefix(elem)+uniqueId()+"@"+localInfo.Addr(), "")
+}
+
+func (s ORSet) Remove(elem string) bool {
+	tags := meta.Prefix(s.prefix(elem))
+	for _, e := range tags {
+		deleteMeta(e.Key)
+	}
+	return len(tags) > 0
+}
+
+func (s ORSet) Contains(elem string) bool {
+	return len(meta.Prefix(s.prefix(elem))) > 0
+}
+
+// Elements returns the set's members in key order.
+func (s ORSet) Elements() []string {
+	var l []string
+	seen := make(map[string]bool)
+	for _, e := range meta.Prefix(s.Name + "/") {
+		elem, ok := s.elemOf(e.Key)
+		if ok && !seen[elem] {
+			seen[elem] = true
+			l = append(l, elem)
+		}
+	}
+	return l
+}
+
+// elemOf extracts the element from one of the set's tag keys.
+func (s ORSet) elemOf(key string) (string, bool) {
+	rest := strings.TrimPrefix(key, s.Name+"/")
+	i := strings.LastIndex(rest, "#")
+	if i < 0 || rest == key {
+		return "", false
+	}
+	elem, err := url.PathUnescape(rest[:i])
+	return elem, err == nil
+}
+
+var pins = ORSet{"pins"}
+
+func pinMessage(id string) {
+	if history != nil {
+		if whisper, ok := history.FindPrefix(id); ok {
+			id = whisper.ID
+		}
+	}
+	pins.Add(id)
+}
+
+func unpinMessage(id string) {
+	for _, pinned := range pins.Elements() {
+		if strings.HasPrefix(pinned, id) {
+			pins.Remove(pinned)
+			return
+		}
+	}
+	statusLn(tr("%s isn't pinned", id))
+}
+
+func showPins() {
+	l := pins.Elements()
+	if len(l) == 0 {
+		statusLn(tr("Nothing pinned"))
+		return
+	}
+	for _, id := range l {
+		if history != nil {
+			if whisper, ok := history.Get(id); ok {
+				statusLn(fmt.Sprintf("%s %s %s", id, nick(whisper.Addr), whisper.Body))
+				continue
+			}
+		}
+		statusLn(id)
+	}
+}
+
+func watchPins() {
+	meta.Watch(pins.Name+"/", func(e MetaEntry) {
+		id, ok := pins.elemOf(e.Key)
+		if !ok {
+			return
+		}
+		if e.Deleted && !pins.Contains(id) {
+			statusLn(tr("%s unpinned %s", nickName(e.Origin), id))
+		} else if !e.Deleted {
+			statusLn(tr("%s pinned %s", nickName(e.Origin), id))
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+ * Daemon
+ *
+ * `sweetnothings daemon [flags]` starts a node in the background, away
+ * from the terminal, taking the same flags as running one directly. Its
+ * diagnostics go to daemon.log in the profile unless -logfile says
+ * otherwise. `sweetnothings attach` connects to a node over its control
+ * socket for the interactive UI: we print what the node prints, and what
+ * we type goes to it. Ctrl-D or closing the terminal detaches and leaves
+ * the node in the mesh; /quit stops it. Any number of terminals may be
+ * attached at once, to a daemon or to a node in the foreground.
+ */
+
+// Set in a daemon's environment by the command that started it. Its
+// first extra file descriptor is the ready pipe.
+const daemonEnv = "SWEETNOTHINGS_DAEMON"
+
+const daemonTimeout = 30 * time.Second
+
+// How long a write to an attached terminal may take before we detach it.
+const attachWriteTimeout = time.Second
+
+var daemonMode bool
+
+// Closed with a byte once the daemon is up, for the command waiting on it.
+var daemonReady *os.File
+
+// inheritDaemon reports whether we're the daemon, rather than the command
+// asked to start one. A daemon started by an upgrade stays one.
+func inheritDaemon() bool {
+	if len(os.Getenv(upgradeEnv)) > 0 {
+		return true
+	}
+	if len(os.Getenv(daemonEnv)) == 0 {
+		return false
+	}
+	os.Unsetenv(daemonEnv)
+	daemonReady = os.NewFile(3, "daemon-ready")
+	return true
+}
+
+// signalDaemonReady tells the command that started us we're up.
+func signalDaemonReady() {
+	if daemonReady != nil {
+		daemonReady.Write([]byte{1})
+		daemonReady.Close()
+		daemonReady = nil
+	}
+}
+
+// The attached terminals, with the image protocol each speaks.
+var attachments = struct {
+	m map[net.Conn]int
+	sync.Mutex
+}{m: make(map[net.Conn]int)}
+
+// attachedOutput copies what we print to the attached terminals.
+type attachedOutput struct{}
+
+func (attachedOutput) Write(b []byte) (int, error) {
+	attachments.Lock()
+	defer attachments.Unlock()
+	for c := range attachments.m {
+		writeAttached(c, b)
+	}
+	return len(b), nil
+}
+
+// writeAttached must be called with attachments locked.
+func writeAttached(c net.Conn, b []byte) {
+	c.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+	if _, err := c.Write(b); err != nil {
+		c.Close()
+		delete(attachments.m, c)
+	}
+}
+
+// attachedGraphics reports whether any attached terminal can show images.
+func attachedGraphics() bool {
+	attachments.Lock()
+	defer attachments.Unlock()
+	for _, graphics := range attachments.m {
+		if graphics != graphicsNone {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAttachedImage draws an image on each attached terminal that can
+// show one, as render draws it for that terminal's protocol.
+func writeAttachedImage(render func(graphics int) []byte) {
+	attachments.Lock()
+	defer attachments.Unlock()
+	for c, graphics := range attachments.m {
+		if graphics != graphicsNone {
+			writeAttached(c, render(graphics))
+		}
+	}
+}
+
+// attach shows c what we print and takes what's typed on it, until it
+// hangs up. graphics is the image protocol its terminal speaks.
+func attach(c net.Conn, s *bufio.Scanner, graphics int) {
+	attachments.Lock()
+	attachments.m[c] = graphics
+	attachments.Unlock()
+	defer func() {
+		attachments.Lock()
+		delete(attachments.m, c)
+		attachments.Unlock()
+	}()
+	for s.Scan() {
+		handleInput(s.Text())
+	}
+}
+
+// runAttach handles `sweetnothings attach`.
+func runAttach(args []string) {
+	setupLocale("")
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	fs.StringVar(&dataRoot, "dir", "", "Directory holding history and profiles (default: ~/.sweetnothings)")
+	fs.StringVar(&profile, "profile", "", "Profile whose node to attach to")
+	path := fs.String("control", "", "Control socket to attach to (default: control.sock in the profile)")
+	fs.Parse(args)
+	if len(profile) > 0 && !validProfile(profile) {
+		log.Fatalf(T("Invalid profile name (%s)"), profile)
+	}
+	if len(*path) == 0 {
+		*path = filepath.Join(dataDir(), "control.sock")
+	}
+
+	c, err := net.Dial("unix", *path)
+	if err != nil {
+		log.Fatal(T("No node to attach to:"), err)
+	}
+	req := controlRequest{Command: "attach", Graphics: terminalGraphics(os.Stdout)}
+	if err := json.NewEncoder(c).Encode(req); err != nil {
+		log.Fatal(err)
+	}
+	r := bufio.NewReader(c)
+	var resp controlResponse
+	if line, err := r.ReadBytes('\n'); err != nil {
+		log.Fatal(err)
+	} else if err := json.Unmarshal(line, &resp); err != nil {
+		log.Fatal(err)
+	} else if !resp.OK {
+		log.Fatal(resp.Error)
+	}
+	statusLn(tr("Attached to %s; Ctrl-D detaches and /quit stops the node", *path))
+
+	detached := make(chan struct{})
+	go func() {
+		io.Copy(c, os.Stdin)
+		close(detached)
+		c.(*net.UnixConn).CloseWrite()
+	}()
+	io.Copy(os.Stdout, r)
+	select {
+	case <-detached:
+		statusLn(T("Detached; the node is still running"))
+	default:
+		statusLn(T("The node stopped"))
+	}
+}
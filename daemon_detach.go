@@ -0,0 +1,67 @@
+//go:build !windows
+
+package sweetnothings
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// runDaemon handles `sweetnothings daemon`: it starts the node in its own
+// session and waits for it to come up.
+func runDaemon(args []string) {
+	setupLocale("")
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Whatever the daemon prints before its log is open, to show if it
+	// doesn't start.
+	out, err := os.CreateTemp("", "sweetnothings-daemon")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(out.Name())
+	defer out.Close()
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(exe, append([]string{"daemon"}, args...)...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.ExtraFiles = []*os.File{readyW}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The pipe closes without a byte if the daemon dies first.
+	ok := make(chan bool, 1)
+	go func() {
+		b := make([]byte, 1)
+		n, _ := ready.Read(b)
+		ok <- n == 1
+	}()
+	select {
+	case started := <-ok:
+		if !started {
+			cmd.Wait()
+			out.Seek(0, 0)
+			io.Copy(os.Stderr, out)
+			log.Fatal(T("The daemon didn't start"))
+		}
+		statusLn(tr("Started the daemon (pid %d); sweetnothings attach to use it", cmd.Process.Pid))
+	case <-time.After(daemonTimeout):
+		statusLn(tr("The daemon (pid %d) is still starting", cmd.Process.Pid))
+	}
+	cmd.Process.Release()
+}
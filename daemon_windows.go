@@ -0,0 +1,10 @@
+package sweetnothings
+
+import "log"
+
+// Windows can't hand a child the ready pipe or start it in its own
+// session this way; a service does the daemon's job there.
+func runDaemon(args []string) {
+	setupLocale("")
+	log.Fatal(T("No daemon mode on Windows; use sweetnothings service install"))
+}
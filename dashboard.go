@@ -0,0 +1,215 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of one-second message rate samples kept for the dashboard.
+const rateSamples = 60
+
+var rates = struct {
+	samples []uint64
+	sync.Mutex
+}{}
+
+func sampleRates() {
+	var last uint64
+	for range time.Tick(time.Second) {
+		total := atomic.LoadUint64(&stats.Sent) + atomic.LoadUint64(&stats.Received)
+		rates.Lock()
+		rates.samples = append(rates.samples, total-last)
+		if len(rates.samples) > rateSamples {
+			rates.samples = rates.samples[1:]
+		}
+		rates.Unlock()
+		last = total
+	}
+}
+
+type dashboardPeer struct {
+	Addr      string
+	Nick      string
+	Transport string
+	Queue     int
+	RTT       *RTTStats `json:",omitempty"`
+}
+
+func dashboardData() map[string]interface{} {
+	var l []dashboardPeer
+	for addr, depth := range peers.Depths() {
+		p := dashboardPeer{Addr: addr, Nick: nickName(addr), Transport: peers.Transport(addr), Queue: depth}
+		if r, ok := peerRTT(addr); ok {
+			p.RTT = &r
+		}
+		l = append(l, p)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Addr < l[j].Addr })
+
+	rates.Lock()
+	r := make([]uint64, len(rates.samples))
+	copy(r, rates.samples)
+	rates.Unlock()
+
+	return map[string]interface{}{
+		"Local":  localInfo.Addr(),
+		"Uptime": int(time.Since(stats.Started).Seconds()),
+		"Counters": map[string]uint64{
+			"Sent":       atomic.LoadUint64(&stats.Sent),
+			"Received":   atomic.LoadUint64(&stats.Received),
+			"Duplicates": atomic.LoadUint64(&stats.Duplicates),
+			"Relayed":    atomic.LoadUint64(&stats.Relayed),
+			"Dropped":    atomic.LoadUint64(&stats.Dropped),
+		},
+		"Peers":     l,
+		"PeerStats": stats.Peers(),
+		"Rate":      r,
+		"Events":    stats.Events(),
+		"Relay":     relayStats(),
+	}
+}
+
+func serveDashboard(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		dashboardTemplate.Execute(w, localInfo.Addr())
+	})
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/topology.json", handleTopology)
+	mux.HandleFunc("/topology.dot", handleTopology)
+	mux.HandleFunc("/dashboard.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dashboardData())
+	})
+
+	go sampleRates()
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Sweet Nothings - {{.}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, sans-serif; background: #1d1f21; color: #c5c8c6; margin: 2em; }
+h1 { font-size: 1.2em; color: #b294bb; }
+h2 { font-size: 0.9em; text-transform: uppercase; color: #969896; margin-top: 2em; }
+.row { display: flex; flex-wrap: wrap; gap: 2em; }
+.counter { background: #282a2e; padding: 0.8em 1.2em; border-radius: 4px; min-width: 7em; }
+.counter b { display: block; font-size: 1.6em; color: #81a2be; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 1em 0.2em 0; text-align: left; font-family: monospace; }
+svg text { fill: #c5c8c6; font-size: 11px; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Sweet Nothings &mdash; <span id="local">{{.}}</span> &mdash; up <span id="uptime"></span></h1>
+<div class="row" id="counters"></div>
+<div class="row">
+<div><h2>Peers</h2><svg id="graph" width="360" height="360"></svg></div>
+<div><h2>Queues</h2><table id="queues"></table></div>
+</div>
+<h2>Traffic by peer</h2>
+<table id="traffic"></table>
+<h2>Messages per second</h2>
+<svg id="rate" width="600" height="80"></svg>
+<h2>Recent events</h2>
+<table id="events"></table>
+<script>
+var ns = "http://www.w3.org/2000/svg";
+function el(tag, attrs, parent) {
+	var e = document.createElementNS(ns, tag);
+	for (var k in attrs) e.setAttribute(k, attrs[k]);
+	parent.appendChild(e);
+	return e;
+}
+function text(s) { return document.createTextNode(s); }
+function duration(s) {
+	var h = Math.floor(s / 3600), m = Math.floor(s / 60) % 60;
+	return (h ? h + "h " : "") + m + "m " + (s % 60) + "s";
+}
+function render(d) {
+	document.getElementById("uptime").textContent = duration(d.Uptime);
+
+	var counters = document.getElementById("counters");
+	counters.innerHTML = "";
+	for (var k in d.Counters) {
+		var div = document.createElement("div");
+		div.className = "counter";
+		var b = document.createElement("b");
+		b.appendChild(text(d.Counters[k]));
+		div.appendChild(b);
+		div.appendChild(text(k));
+		counters.appendChild(div);
+	}
+
+	var peers = d.Peers || [];
+	var g = document.getElementById("graph");
+	g.innerHTML = "";
+	var cx = 180, cy = 180, r = 130;
+	peers.forEach(function(p, i) {
+		var a = 2 * Math.PI * i / peers.length;
+		var x = cx + r * Math.cos(a), y = cy + r * Math.sin(a);
+		el("line", {x1: cx, y1: cy, x2: x, y2: y, stroke: p.Queue ? "#de935f" : "#5f819d"}, g);
+		el("circle", {cx: x, cy: y, r: 8, fill: "#8abeb7"}, g);
+		el("text", {x: x + 10, y: y + 4}, g).appendChild(text(p.Nick));
+	});
+	el("circle", {cx: cx, cy: cy, r: 12, fill: "#b294bb"}, g);
+	el("text", {x: cx + 14, y: cy + 4}, g).appendChild(text("you"));
+
+	var queues = document.getElementById("queues");
+	queues.innerHTML = "<tr><th>Peer</th><th>Transport</th><th>Queued</th><th>RTT min/avg/p95 (ms)</th></tr>";
+	peers.forEach(function(p) {
+		var tr = queues.insertRow();
+		tr.insertCell().appendChild(text(p.Nick));
+		tr.insertCell().appendChild(text(p.Transport));
+		tr.insertCell().appendChild(text(p.Queue));
+		var ms = function(ns) { return (ns / 1e6).toFixed(2); };
+		tr.insertCell().appendChild(text(p.RTT ? [p.RTT.Min, p.RTT.Avg, p.RTT.P95].map(ms).join(" / ") : "-"));
+	});
+
+	var traffic = document.getElementById("traffic");
+	traffic.innerHTML = "<tr><th>Peer</th><th>Msgs in</th><th>Msgs out</th><th>Bytes in</th><th>Bytes out</th><th>Dropped</th></tr>";
+	Object.keys(d.PeerStats || {}).sort().forEach(function(addr) {
+		var s = d.PeerStats[addr], tr = traffic.insertRow();
+		[addr, s.MessagesIn, s.MessagesOut, s.BytesIn, s.BytesOut, s.Dropped].forEach(function(v) {
+			tr.insertCell().appendChild(text(v));
+		});
+	});
+
+	var rate = document.getElementById("rate");
+	rate.innerHTML = "";
+	var samples = d.Rate || [], max = Math.max.apply(null, samples.concat([1]));
+	var pts = samples.map(function(v, i) { return (i * 10) + "," + (75 - 70 * v / max); });
+	el("polyline", {points: pts.join(" "), fill: "none", stroke: "#b5bd68", "stroke-width": 2}, rate);
+	el("text", {x: 0, y: 10}, rate).appendChild(text("max " + max + "/s"));
+
+	var events = document.getElementById("events");
+	events.innerHTML = "";
+	(d.Events || []).slice().reverse().forEach(function(e) {
+		var tr = events.insertRow();
+		tr.insertCell().appendChild(text(new Date(e.Time).toLocaleTimeString()));
+		tr.insertCell().appendChild(text(e.Kind));
+		tr.insertCell().appendChild(text(e.Addr));
+	});
+}
+function poll() {
+	fetch("dashboard.json").then(function(r) { return r.json(); }).then(render);
+}
+poll();
+setInterval(poll, 2000);
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,75 @@
+// Package dht is a small Kademlia distributed hash table over UDP. Nodes
+// keep a routing table of other nodes bucketed by XOR distance, find the
+// nodes closest to a key with iterative lookups, and store short-lived
+// values on them. Sweet Nothings uses it to publish its listen address
+// under a shared network key so peers can find each other without a
+// central server.
+package dht
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+)
+
+const idLen = 20
+
+// ID identifies both nodes and keys.
+type ID [idLen]byte
+
+// NewID returns a random node ID.
+func NewID() ID {
+	var id ID
+	rand.Read(id[:])
+	return id
+}
+
+// KeyFor hashes a name into a key.
+func KeyFor(name string) ID {
+	return ID(sha1.Sum([]byte(name)))
+}
+
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *ID) UnmarshalText(b []byte) error {
+	if hex.DecodedLen(len(b)) != idLen {
+		return fmt.Errorf("dht: bad id length %d", len(b))
+	}
+	_, err := hex.Decode(id[:], b)
+	return err
+}
+
+func (id ID) xor(o ID) ID {
+	var d ID
+	for i := range id {
+		d[i] = id[i] ^ o[i]
+	}
+	return d
+}
+
+// closer reports whether a is closer to target than b.
+func closer(target, a, b ID) bool {
+	da, db := target.xor(a), target.xor(b)
+	return bytes.Compare(da[:], db[:]) < 0
+}
+
+// bucketOf returns the index of the bucket o belongs in from id's point of
+// view: the number of leading bits they share.
+func (id ID) bucketOf(o ID) int {
+	d := id.xor(o)
+	for i, b := range d {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return idLen*8 - 1
+}
@@ -0,0 +1,391 @@
+package dht
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Alpha is how many queries a lookup keeps in flight.
+const Alpha = 3
+
+// How long a stored value lives unless it's announced again.
+const ValueTTL = 30 * time.Minute
+
+const rpcTimeout = 2 * time.Second
+
+const maxPacket = 8192
+
+// Kept small enough to fit a response in one packet.
+const maxValues = 64
+
+// Most keys we'll hold values for, so nobody can fill our memory with
+// stores.
+const maxKeys = 4096
+
+// How often expired values are cleared out.
+const expireEvery = time.Minute
+
+var ErrNoNodes = errors.New("dht: no known nodes")
+
+type message struct {
+	Type   string
+	Txn    uint64
+	ID     ID
+	Target *ID       `json:",omitempty"`
+	Port   int       `json:",omitempty"`
+	Nodes  []Contact `json:",omitempty"`
+	Values []string  `json:",omitempty"`
+}
+
+// Node is our participant in the table.
+type Node struct {
+	ID ID
+
+	conn  *net.UDPConn
+	table *table
+
+	pending map[uint64]pendingCall
+	values  map[ID]map[string]time.Time
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+// pendingCall is a call waiting for its reply, which has to come from the
+// address it went to.
+type pendingCall struct {
+	to *net.UDPAddr
+	ch chan message
+}
+
+// Listen starts a node on the UDP address addr.
+func Listen(addr string, id ID) (*Node, error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.ListenUDP("udp", ua)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		ID:      id,
+		conn:    c,
+		table:   &table{self: id},
+		pending: make(map[uint64]pendingCall),
+		values:  make(map[ID]map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+	go n.serve()
+	go n.expire()
+	return n, nil
+}
+
+func (n *Node) Close() error {
+	close(n.done)
+	return n.conn.Close()
+}
+
+// Size returns how many nodes are in the routing table.
+func (n *Node) Size() int {
+	return n.table.size()
+}
+
+func (n *Node) serve() {
+	buf := make([]byte, maxPacket)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var m message
+		if err := json.Unmarshal(buf[:size], &m); err != nil {
+			continue
+		}
+		n.saw(Contact{ID: m.ID, Addr: from.String()})
+		n.mu.Lock()
+		p, ok := n.pending[m.Txn]
+		// A reply from anywhere else is someone guessing.
+		ok = ok && p.to.IP.Equal(from.IP) && p.to.Port == from.Port
+		if ok {
+			delete(n.pending, m.Txn)
+		}
+		n.mu.Unlock()
+		if ok {
+			p.ch <- m
+			continue
+		}
+		n.handle(m, from)
+	}
+}
+
+// saw updates the routing table, checking whether a full bucket's oldest
+// member is still around before giving its place away.
+func (n *Node) saw(c Contact) {
+	oldest := n.table.seen(c)
+	if oldest == nil {
+		return
+	}
+	go func() {
+		if _, err := n.call(oldest.Addr, message{Type: "ping"}); err != nil {
+			n.table.replace(*oldest, c)
+		} else {
+			n.table.seen(*oldest)
+		}
+	}()
+}
+
+func (n *Node) handle(m message, from *net.UDPAddr) {
+	reply := message{Txn: m.Txn}
+	switch m.Type {
+	case "ping":
+		reply.Type = "pong"
+	case "find_node", "find_value":
+		if m.Target == nil {
+			return
+		}
+		if m.Type == "find_value" {
+			reply.Values = n.stored(*m.Target)
+		}
+		reply.Type = "nodes"
+		reply.Nodes = n.table.closest(*m.Target, K)
+	case "store":
+		if m.Target == nil || m.Port <= 0 || m.Port > 65535 {
+			return
+		}
+		// Values are the sender's own address, so it can't plant
+		// someone else's.
+		n.store(*m.Target, net.JoinHostPort(from.IP.String(), strconv.Itoa(m.Port)))
+		reply.Type = "stored"
+	default:
+		return
+	}
+	n.send(from, reply)
+}
+
+func (n *Node) send(to *net.UDPAddr, m message) error {
+	m.ID = n.ID
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = n.conn.WriteToUDP(b, to)
+	return err
+}
+
+// call sends m to addr and waits for the reply.
+func (n *Node) call(addr string, m message) (message, error) {
+	to, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return message{}, err
+	}
+	ch := make(chan message, 1)
+	n.mu.Lock()
+	// Random, so a reply can't be forged by counting.
+	for m.Txn == 0 || n.pending[m.Txn].ch != nil {
+		m.Txn = randomTxn()
+	}
+	n.pending[m.Txn] = pendingCall{to, ch}
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.pending, m.Txn)
+		n.mu.Unlock()
+	}()
+	if err := n.send(to, m); err != nil {
+		return message{}, err
+	}
+	select {
+	case r := <-ch:
+		return r, nil
+	case <-time.After(rpcTimeout):
+		return message{}, errors.New("dht: timeout")
+	}
+}
+
+func randomTxn() uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:])
+}
+
+func (n *Node) store(key ID, value string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	vs, ok := n.values[key]
+	if !ok {
+		if len(n.values) >= maxKeys {
+			return
+		}
+		vs = make(map[string]time.Time)
+		n.values[key] = vs
+	}
+	if _, ok := vs[value]; ok || len(vs) < maxValues {
+		vs[value] = time.Now().Add(ValueTTL)
+	}
+}
+
+// expire clears out values nobody has announced again in time, until the
+// node is closed.
+func (n *Node) expire() {
+	t := time.NewTicker(expireEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case now := <-t.C:
+			n.mu.Lock()
+			for key, vs := range n.values {
+				for v, expires := range vs {
+					if now.After(expires) {
+						delete(vs, v)
+					}
+				}
+				if len(vs) == 0 {
+					delete(n.values, key)
+				}
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+func (n *Node) stored(key ID) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var l []string
+	for v, expires := range n.values[key] {
+		if time.Now().After(expires) {
+			delete(n.values[key], v)
+		} else {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// Bootstrap joins the table through the nodes at addrs by looking
+// ourselves up, which fills in the buckets around our ID.
+func (n *Node) Bootstrap(addrs []string) error {
+	var err error
+	for _, addr := range addrs {
+		if _, err2 := n.call(addr, message{Type: "ping"}); err2 != nil {
+			err = err2
+		}
+	}
+	if n.table.size() == 0 {
+		if err == nil {
+			err = ErrNoNodes
+		}
+		return err
+	}
+	n.lookup(n.ID, false)
+	return nil
+}
+
+// lookup iteratively queries the nodes closest to target, returning the K
+// closest that answered and, for find_value, every value they hold.
+func (n *Node) lookup(target ID, values bool) ([]Contact, []string) {
+	kind := "find_node"
+	if values {
+		kind = "find_value"
+	}
+	shortlist := n.table.closest(target, K)
+	queried := make(map[ID]bool)
+	answered := make(map[ID]bool)
+	found := make(map[string]bool)
+	if values {
+		// We may be one of the closest ourselves.
+		for _, v := range n.stored(target) {
+			found[v] = true
+		}
+	}
+	for {
+		var batch []Contact
+		for _, c := range shortlist {
+			if !queried[c.ID] && len(batch) < Alpha {
+				batch = append(batch, c)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		type result struct {
+			c   Contact
+			m   message
+			err error
+		}
+		results := make(chan result, len(batch))
+		for _, c := range batch {
+			queried[c.ID] = true
+			go func(c Contact) {
+				m, err := n.call(c.Addr, message{Type: kind, Target: &target})
+				results <- result{c, m, err}
+			}(c)
+		}
+		seen := make(map[ID]bool)
+		for _, c := range shortlist {
+			seen[c.ID] = true
+		}
+		for range batch {
+			r := <-results
+			if r.err != nil {
+				n.table.remove(r.c.ID)
+				continue
+			}
+			answered[r.c.ID] = true
+			for _, v := range r.m.Values {
+				found[v] = true
+			}
+			for _, c := range r.m.Nodes {
+				if c.ID != n.ID && !seen[c.ID] {
+					seen[c.ID] = true
+					shortlist = append(shortlist, c)
+				}
+			}
+		}
+		sortByDistance(target, shortlist)
+		if len(shortlist) > K {
+			shortlist = shortlist[:K]
+		}
+	}
+	var closest []Contact
+	for _, c := range shortlist {
+		if answered[c.ID] {
+			closest = append(closest, c)
+		}
+	}
+	var vs []string
+	for v := range found {
+		vs = append(vs, v)
+	}
+	return closest, vs
+}
+
+// Announce stores our address, at port, under key on the nodes closest to
+// it. Announce again within ValueTTL to stay listed.
+func (n *Node) Announce(key ID, port int) error {
+	closest, _ := n.lookup(key, false)
+	if len(closest) == 0 {
+		return ErrNoNodes
+	}
+	for _, c := range closest {
+		go n.call(c.Addr, message{Type: "store", Target: &key, Port: port})
+	}
+	return nil
+}
+
+// Lookup returns the addresses announced under key.
+func (n *Node) Lookup(key ID) ([]string, error) {
+	if n.table.size() == 0 {
+		return nil, ErrNoNodes
+	}
+	_, vs := n.lookup(key, true)
+	return vs, nil
+}
@@ -0,0 +1,105 @@
+package dht
+
+import (
+	"sort"
+	"sync"
+)
+
+// K is the bucket size and the number of nodes a value is stored on.
+const K = 20
+
+// Contact is a node we know how to reach.
+type Contact struct {
+	ID   ID
+	Addr string
+}
+
+type table struct {
+	self    ID
+	buckets [idLen * 8][]Contact
+	mu      sync.Mutex
+}
+
+// seen records that c is alive. It returns the least recently seen
+// contact in c's bucket if the bucket is full, which the caller should
+// ping and evict if it doesn't answer.
+func (t *table) seen(c Contact) (oldest *Contact) {
+	if c.ID == t.self {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := t.self.bucketOf(c.ID)
+	b := t.buckets[i]
+	for j, e := range b {
+		if e.ID == c.ID {
+			// Move it to the tail, the most recently seen end.
+			copy(b[j:], b[j+1:])
+			b[len(b)-1] = c
+			return nil
+		}
+	}
+	if len(b) < K {
+		t.buckets[i] = append(b, c)
+		return nil
+	}
+	o := b[0]
+	return &o
+}
+
+// replace evicts old from its bucket in favor of c.
+func (t *table) replace(old Contact, c Contact) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := t.self.bucketOf(old.ID)
+	b := t.buckets[i]
+	for j, e := range b {
+		if e.ID == old.ID {
+			copy(b[j:], b[j+1:])
+			b[len(b)-1] = c
+			return
+		}
+	}
+}
+
+func (t *table) remove(id ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := t.self.bucketOf(id)
+	b := t.buckets[i]
+	for j, e := range b {
+		if e.ID == id {
+			t.buckets[i] = append(b[:j], b[j+1:]...)
+			return
+		}
+	}
+}
+
+// closest returns up to n known contacts nearest to target.
+func (t *table) closest(target ID, n int) []Contact {
+	t.mu.Lock()
+	var all []Contact
+	for _, b := range t.buckets {
+		all = append(all, b...)
+	}
+	t.mu.Unlock()
+	sortByDistance(target, all)
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+func (t *table) size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, b := range t.buckets {
+		n += len(b)
+	}
+	return n
+}
+
+func sortByDistance(target ID, l []Contact) {
+	sort.Slice(l, func(i, j int) bool { return closer(target, l[i].ID, l[j].ID) })
+}
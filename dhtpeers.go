@@ -0,0 +1,71 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harveyr/sweetnothings/dht"
+)
+
+/**
+ * DHT discovery
+ *
+ * With -dht-port we join a Kademlia table over UDP, announce our listen
+ * address under a key derived from -dht-network and dial whoever else
+ * announced there. A node with no -dht-bootstrap waits for others to find
+ * it; everyone else needs the address of at least one node already in the
+ * table.
+ */
+
+var dhtPort int
+var dhtBootstrap string
+var dhtNetwork string
+
+const dhtLookupEvery = time.Minute
+
+const dhtAnnounceEvery = 10 * time.Minute
+
+func startDHT() {
+	node, err := dht.Listen(fmt.Sprintf(":%d", dhtPort), dht.NewID())
+	if err != nil {
+		logger.Error(T("Error starting DHT"), "event", "dht", "err", err)
+		return
+	}
+	statusLn(tr("DHT node on UDP port %d", dhtPort))
+	var bootstrap []string
+	for _, addr := range strings.Split(dhtBootstrap, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			bootstrap = append(bootstrap, addr)
+		}
+	}
+	key := dht.KeyFor("sweetnothings/" + dhtNetwork)
+	port, _ := strconv.Atoi(localInfo.ListenPort)
+	var announced time.Time
+	for ; ; time.Sleep(dhtLookupEvery) {
+		if node.Size() == 0 && len(bootstrap) > 0 {
+			if err := node.Bootstrap(bootstrap); err != nil {
+				logger.Error(T("Error joining DHT"), "event", "dht", "err", err)
+				continue
+			}
+		}
+		if node.Size() == 0 {
+			continue
+		}
+		if time.Since(announced) > dhtAnnounceEvery {
+			if err := node.Announce(key, port); err == nil {
+				announced = time.Now()
+			}
+		}
+		addrs, err := node.Lookup(key)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if !isLocal(addr) && peers.Get(addr) == nil {
+				go autoDial(addr)
+			}
+		}
+	}
+}
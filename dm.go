@@ -0,0 +1,124 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/**
+ * Direct messages
+ *
+ * /msg sends a message to one peer only. It goes through the same
+ * -outgoing pipeline as anything else we type, is sealed to their node
+ * key, signed like any other message, and goes straight to them in a "dm"
+ * frame, through a relay if need be, instead of being gossiped, so the
+ * rest of the mesh never sees it, not even as ciphertext.
+ */
+
+const dmKind = "dm"
+
+func init() {
+	controlHandlers["dm"] = handleDM
+}
+
+// sendDM handles "/msg <peer> <text>".
+func sendDM(args []string) {
+	if len(args) < 2 {
+		statusLn(T("Usage: /msg <peer> <text>"))
+		return
+	}
+	addr := peerFor(args[0])
+	if isLocal(addr) {
+		return
+	}
+	pub, ok := e2eKeys()[addr]
+	if !ok || nodeKey == nil {
+		statusLn(tr("No key for %s yet, so we can't message them privately", addr))
+		return
+	}
+	network := netOf(addr)
+	whisper, err := prepareText(SweetNothing{
+		ID:        uniqueId(),
+		Addr:      localAddr(network),
+		Body:      strings.Join(args[1:], " "),
+		Timestamp: time.Now().UTC(),
+		Kind:      dmKind,
+		To:        addr,
+		Net:       network,
+	})
+	if err != nil {
+		statusLn(tr("Not sent: %v", err))
+		return
+	}
+	SeenId(whisper.ID)
+	trackReceipts(whisper)
+	sent := signMessage(sealTo(whisper, map[string][]byte{addr: pub}))
+	go func() {
+		if !sendSoon(addr, controlFrame("dm", sent), sessionTimeout) {
+			statusLn(tr("Couldn't reach %s; message not sent", nickName(addr)))
+			return
+		}
+		recordHistory(whisper)
+		showDM(whisper)
+	}()
+}
+
+func handleDM(from string, data json.RawMessage) {
+	var whisper SweetNothing
+	if json.Unmarshal(data, &whisper) != nil || whisper.Kind != dmKind || whisper.Sig == nil || !isLocal(whisper.To) {
+		return
+	}
+	whisper.Net = netOf(from)
+	if err := verifyMessage(whisper); err == errKeyChanged {
+		return
+	} else if err != nil {
+		logger.Warn(T("Rejected message"), "event", "reject", "peer", whisper.Addr, "id", whisper.ID, "err", err)
+		return
+	}
+	if SeenId(whisper.ID) {
+		return
+	}
+	if blocked(whisper.Addr) || !allowInbound(from, whisper.Addr) {
+		return
+	}
+	if oversized(whisper) {
+		logger.Warn(T("Message over -max-body"), "event", "reject", "peer", whisper.Addr, "id", whisper.ID, "bytes", bodySize(whisper))
+		if bodyAction == bodyReject {
+			return
+		}
+	}
+	shown, ok := unseal(whisper)
+	if !ok {
+		logger.Warn(T("Unreadable private message"), "event", "dm", "peer", whisper.Addr, "id", whisper.ID)
+		return
+	}
+	shown = truncateBody(shown)
+	recordHistory(shown)
+	sendReceipt(shown, false)
+	if ignoring(shown.Addr) {
+		return
+	}
+	switch filterMessage(shown) {
+	case filterDrop:
+		return
+	case filterNotify:
+		fmt.Fprint(stdout, "\a")
+	}
+	showDM(shown)
+	sendReceipt(shown, true)
+}
+
+// showDM prints a direct message so it stands out from the room.
+func showDM(whisper SweetNothing) {
+	label := tr("from %s", nickName(whisper.Addr))
+	if isLocal(whisper.Addr) {
+		label = tr("to %s", nickName(whisper.To))
+	}
+	if accessible {
+		fmt.Fprintf(stdout, "%s: %s\n", tr("Private message %s", label), whisper.Body)
+		return
+	}
+	fmt.Fprintf(stdout, "%s %s\n", wrapColor(fmt.Sprintf("[%s %s]", T("DM"), label), "magenta"), whisper.Body)
+}
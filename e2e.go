@@ -0,0 +1,233 @@
+package sweetnothings
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+)
+
+/**
+ * End-to-end encryption
+ *
+ * With -e2e, chat on the primary network is sealed so that only peers
+ * whose keys we know can read it; relays just pass the ciphertext along.
+ * Each node publishes its node key in the metadata store, which peers
+ * swap as a link comes up. A message body is encrypted under a fresh
+ * key, and that key is wrapped once per recipient with AES-GCM under the
+ * X25519 secret we share with them, much like NaCl's box. Only plain
+ * chat and edits to it are sealed; polls, asks and votes stay readable
+ * to the mesh.
+ * Nodes publish their keys even without -e2e, for /msg. Relay and
+ * rendezvous nodes don't publish one, and we never seal to a peer that
+ * says it is one, so that what they pass along stays unreadable to them.
+ *
+ * Anyone can write any metadata key, so a published key is signed with
+ * the publisher's identity key, and we only seal to it if that identity
+ * is the one pinned for the address (see trust.go) and, over -noise, the
+ * key is the one the link proved.
+ */
+
+var e2eEnabled bool
+
+const e2eKeyPrefix = "e2ekey/"
+
+// Sealed is an encrypted message body. Keys holds the body key wrapped
+// for each recipient, by address; every ciphertext starts with its nonce.
+type Sealed struct {
+	Body []byte
+	Keys map[string][]byte
+}
+
+func gcm(key []byte) cipher.AEAD {
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+func sealWith(key []byte, plaintext []byte, ad []byte) []byte {
+	aead := gcm(key)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plaintext, ad)
+}
+
+func openWith(key []byte, ciphertext []byte, ad []byte) ([]byte, error) {
+	aead := gcm(key)
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("e2e: short ciphertext")
+	}
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], ad)
+}
+
+// wrapKey derives the key that wraps body keys between us and pub.
+func wrapKey(pub []byte) ([]byte, error) {
+	p, err := ecdh.X25519().NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := nodeKey.ECDH(p)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append(shared, "sweetnothings e2e"...))
+	return sum[:], nil
+}
+
+// e2eKeyRecord is the value of an e2ekey/ entry: a node key, and the
+// identity that vouches for it.
+type e2eKeyRecord struct {
+	Key      []byte
+	Identity ed25519.PublicKey
+	Sig      []byte
+}
+
+func e2eKeySigningBytes(addr string, key []byte) []byte {
+	return append([]byte("sweetnothings e2ekey|"+addr+"|"), key...)
+}
+
+// publishE2EKey makes sure the mesh has our current key, or, on a relay
+// or rendezvous node, that it has none.
+func publishE2EKey() {
+	addr := localInfo.Addr()
+	if relayMode || rendezvousMode {
+		if _, ok := meta.Get(e2eKeyPrefix + addr); ok {
+			deleteMeta(e2eKeyPrefix + addr)
+		}
+		return
+	}
+	key := nodeKey.PublicKey().Bytes()
+	b, _ := json.Marshal(e2eKeyRecord{
+		Key:      key,
+		Identity: identityPublic(),
+		Sig:      ed25519.Sign(identityKey, e2eKeySigningBytes(addr, key)),
+	})
+	if cur, ok := meta.Get(e2eKeyPrefix + addr); !ok || cur != string(b) {
+		setMeta(e2eKeyPrefix+addr, string(b))
+	}
+}
+
+// e2eKeys returns the keys peers published for themselves that we can
+// check really are theirs.
+func e2eKeys() map[string][]byte {
+	keys := make(map[string][]byte)
+	for _, e := range meta.Prefix(e2eKeyPrefix) {
+		addr := e.Key[len(e2eKeyPrefix):]
+		if e.Origin != addr {
+			continue
+		}
+		if key, ok := verifiedE2EKey(addr, e.Value); ok {
+			keys[addr] = key
+		}
+	}
+	return keys
+}
+
+// verifiedE2EKey checks a published key record for addr. Records from
+// nodes that predate signing them, or signed by anyone but addr's pinned
+// identity, are ignored.
+func verifiedE2EKey(addr string, value string) ([]byte, bool) {
+	var r e2eKeyRecord
+	if json.Unmarshal([]byte(value), &r) != nil || len(r.Identity) != ed25519.PublicKeySize {
+		return nil, false
+	}
+	if !ed25519.Verify(r.Identity, e2eKeySigningBytes(addr, r.Key), r.Sig) {
+		return nil, false
+	}
+	if proven, ok := linkKey(addr); ok && !bytes.Equal(proven, r.Key) {
+		return nil, false
+	}
+	if isLocal(addr) {
+		return r.Key, r.Identity.Equal(identityPublic())
+	}
+	if checkKnownKey(addr, r.Identity) != nil {
+		return nil, false
+	}
+	return r.Key, true
+}
+
+// sealedAD binds the ciphertext to the message it belongs to.
+func sealedAD(whisper SweetNothing) []byte {
+	return []byte(whisper.ID + "|" + whisper.Addr)
+}
+
+func seal(whisper SweetNothing) SweetNothing {
+	if !e2eEnabled || (whisper.Kind != "" && whisper.Kind != editKind) || len(whisper.Net) > 0 {
+		return whisper
+	}
+	keys := e2eKeys()
+	for addr := range keys {
+		if forwarder(addr) {
+			delete(keys, addr)
+		}
+	}
+	return sealTo(whisper, keys)
+}
+
+// forwarder reports whether addr is a relay or rendezvous node, which
+// only pass messages on and shouldn't be able to read them.
+func forwarder(addr string) bool {
+	relayNodes.Lock()
+	relay := relayNodes.m[addr]
+	relayNodes.Unlock()
+	return relay || hasFeature(addr, "relay") || hasFeature(addr, "rendezvous")
+}
+
+// sealTo seals whisper for the holders of keys, by address.
+func sealTo(whisper SweetNothing, keys map[string][]byte) SweetNothing {
+	bodyKey := make([]byte, 32)
+	rand.Read(bodyKey)
+	s := &Sealed{
+		Body: sealWith(bodyKey, []byte(whisper.Body), sealedAD(whisper)),
+		Keys: make(map[string][]byte),
+	}
+	for addr, pub := range keys {
+		if k, err := wrapKey(pub); err == nil {
+			s.Keys[addr] = sealWith(k, bodyKey, sealedAD(whisper))
+		}
+	}
+	whisper.Body = ""
+	whisper.Sealed = s
+	return whisper
+}
+
+// unseal returns whisper with its body decrypted, or with a placeholder
+// and false if it wasn't sealed for us.
+func unseal(whisper SweetNothing) (SweetNothing, bool) {
+	s := whisper.Sealed
+	if s == nil {
+		return whisper, true
+	}
+	whisper.Sealed = nil
+	whisper.Body = T("[encrypted for others]")
+	me := localAddr(whisper.Net)
+	if len(whisper.To) > 0 {
+		// Direct messages are sealed to the address they were sent to,
+		// which the receiver has checked is one of ours.
+		me = whisper.To
+	}
+	wrapped, ok := s.Keys[me]
+	pub, known := e2eKeys()[whisper.Addr]
+	if !ok || !known || nodeKey == nil {
+		return whisper, false
+	}
+	k, err := wrapKey(pub)
+	if err != nil {
+		return whisper, false
+	}
+	bodyKey, err := openWith(k, wrapped, sealedAD(whisper))
+	if err != nil {
+		return whisper, false
+	}
+	body, err := openWith(bodyKey, s.Body, sealedAD(whisper))
+	if err != nil {
+		return whisper, false
+	}
+	whisper.Body = string(body)
+	return whisper, true
+}
@@ -0,0 +1,151 @@
+package sweetnothings
+
+import (
+	"strings"
+	"sync"
+)
+
+/**
+ * Edits and deletions
+ *
+ * /edit and /delete publish edit and delete messages that refer to one
+ * of our earlier messages by Ref. They gossip and dedup under their own
+ * IDs like anything else; receivers apply them to their copy of the
+ * original, in history too, and show the new text or that it's gone.
+ * Only a message's author can change it. One that arrives before its
+ * original is kept and applied when the original turns up.
+ */
+
+const (
+	editKind   = "edit"
+	deleteKind = "delete"
+)
+
+var amendments = struct {
+	// The latest edit or delete of each message, by amendmentKey.
+	m map[string]SweetNothing
+	sync.Mutex
+}{m: make(map[string]SweetNothing)}
+
+// amendmentKey includes the author so that nobody else's edits can get
+// in the way of theirs.
+func amendmentKey(id string, author string) string {
+	return id + "|" + author
+}
+
+// ownMessage finds one of our own messages for /edit or /delete.
+func ownMessage(id string) (SweetNothing, bool) {
+	target, ok := findMessage(id)
+	switch {
+	case !ok:
+		statusLn(tr("No message %s", id))
+	case !isLocal(target.Addr):
+		statusLn(T("You can only change your own messages"))
+	case target.Deleted:
+		statusLn(tr("%s was deleted", target.ID))
+	default:
+		return target, true
+	}
+	return target, false
+}
+
+func editMessage(args []string) {
+	if len(args) < 2 {
+		statusLn(T("Usage: /edit <id> <new text>"))
+		return
+	}
+	target, ok := ownMessage(args[0])
+	if !ok {
+		return
+	}
+	e, err := runOutgoing(SweetNothing{Kind: editKind, Ref: target.ID, Room: target.Room, Body: strings.Join(args[1:], " ")})
+	if err != nil {
+		statusLn(tr("Not sent: %v", err))
+		return
+	}
+	amend(publishIn(target.Net, e), true)
+}
+
+func deleteMessage(id string) {
+	target, ok := ownMessage(id)
+	if !ok {
+		return
+	}
+	amend(publishIn(target.Net, SweetNothing{Kind: deleteKind, Ref: target.ID, Room: target.Room}), true)
+}
+
+// rememberAmendment keeps a as the latest change by its author to the
+// message it refers to, unless a later one is already known. It reports
+// whether a is news.
+func rememberAmendment(a SweetNothing) bool {
+	key := amendmentKey(a.Ref, a.Addr)
+	amendments.Lock()
+	defer amendments.Unlock()
+	if prev, ok := amendments.m[key]; ok && (prev.Kind == deleteKind || prev.Timestamp.After(a.Timestamp)) {
+		return false
+	}
+	amendments.m[key] = a
+	return true
+}
+
+// applyAmendment makes an edit or delete to whisper.
+func applyAmendment(whisper *SweetNothing, a SweetNothing) {
+	if a.Kind == deleteKind {
+		whisper.Body = ""
+		whisper.Options = nil
+		whisper.Deleted = true
+		return
+	}
+	whisper.Body = a.Body
+	whisper.Edited = true
+}
+
+// amend applies an edit or delete to our copy of the message it refers
+// to, showing the result when show is set.
+func amend(a SweetNothing, show bool) {
+	if !rememberAmendment(a) {
+		return
+	}
+	target, ok := findMessage(a.Ref)
+	if !ok || target.ID != a.Ref || target.Addr != a.Addr {
+		return
+	}
+	if history != nil {
+		if _, err := history.Update(target.ID, func(w *SweetNothing) { applyAmendment(w, a) }); err != nil {
+			logger.Error(T("Error writing history"), "event", "history", "id", target.ID, "err", err)
+		}
+	}
+	applyAmendment(&target, a)
+	if a.Kind == editKind && searchIndex != nil {
+		searchIndex.Reindex(target)
+	}
+	if !show {
+		return
+	}
+	if target.Deleted {
+		noteLn(T("Deleted"), "✗ ", tr("%s deleted a message from %s", nickName(a.Addr), target.Timestamp.Local().Format("15:04")), "red")
+	} else {
+		showMessage(target)
+	}
+}
+
+// amended is whisper with any changes its author has already made to it.
+func amended(whisper SweetNothing) SweetNothing {
+	amendments.Lock()
+	a, ok := amendments.m[amendmentKey(whisper.ID, whisper.Addr)]
+	amendments.Unlock()
+	if ok {
+		applyAmendment(&whisper, a)
+	}
+	return whisper
+}
+
+// replayAmendments remembers the edits and deletes in history, which
+// were applied to their originals when they came in.
+func replayAmendments(msgs []SweetNothing) {
+	for _, whisper := range msgs {
+		if whisper.Kind == editKind || whisper.Kind == deleteKind {
+			rememberAmendment(whisper)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/**
+ * Emoji shortcodes
+ *
+ * :smile: and friends are turned into emoji by the "emoji" outgoing step,
+ * and in messages we receive with -expand-emoji. /emoji <query> looks up
+ * codes.
+ */
+
+var expandEmojiIn bool
+
+var emojiCodes = map[string]string{
+	// Faces
+	"smile":          "😄",
+	"smiley":         "😃",
+	"grin":           "😁",
+	"joy":            "😂",
+	"rofl":           "🤣",
+	"slight_smile":   "🙂",
+	"upside_down":    "🙃",
+	"wink":           "😉",
+	"blush":          "😊",
+	"innocent":       "😇",
+	"heart_eyes":     "😍",
+	"kiss":           "😘",
+	"yum":            "😋",
+	"tongue":         "😛",
+	"sunglasses":     "😎",
+	"nerd":           "🤓",
+	"neutral":        "😐",
+	"expressionless": "😑",
+	"unamused":       "😒",
+	"roll_eyes":      "🙄",
+	"smirk":          "😏",
+	"thinking":       "🤔",
+	"shush":          "🤫",
+	"zipper_mouth":   "🤐",
+	"relieved":       "😌",
+	"sleeping":       "😴",
+	"sleepy":         "😪",
+	"mask":           "😷",
+	"sick":           "🤢",
+	"hot":            "🥵",
+	"cold":           "🥶",
+	"dizzy_face":     "😵",
+	"exploding_head": "🤯",
+	"cowboy":         "🤠",
+	"party":          "🥳",
+	"confused":       "😕",
+	"worried":        "😟",
+	"frown":          "🙁",
+	"open_mouth":     "😮",
+	"astonished":     "😲",
+	"flushed":        "😳",
+	"pleading":       "🥺",
+	"fearful":        "😨",
+	"cold_sweat":     "😰",
+	"cry":            "😢",
+	"sob":            "😭",
+	"scream":         "😱",
+	"angry":          "😠",
+	"rage":           "😡",
+	"skull":          "💀",
+	"poop":           "💩",
+	"clown":          "🤡",
+	"ghost":          "👻",
+	"alien":          "👽",
+	"robot":          "🤖",
+	"see_no_evil":    "🙈",
+	// Hands and people
+	"wave":            "👋",
+	"ok":              "👌",
+	"thumbsup":        "👍",
+	"+1":              "👍",
+	"thumbsdown":      "👎",
+	"-1":              "👎",
+	"clap":            "👏",
+	"raised_hands":    "🙌",
+	"pray":            "🙏",
+	"handshake":       "🤝",
+	"muscle":          "💪",
+	"point_up":        "☝️",
+	"point_right":     "👉",
+	"v":               "✌️",
+	"crossed_fingers": "🤞",
+	"metal":           "🤘",
+	"fist":            "✊",
+	"shrug":           "🤷",
+	"facepalm":        "🤦",
+	"eyes":            "👀",
+	"brain":           "🧠",
+	// Hearts and symbols
+	"heart":            "❤️",
+	"orange_heart":     "🧡",
+	"yellow_heart":     "💛",
+	"green_heart":      "💚",
+	"blue_heart":       "💙",
+	"purple_heart":     "💜",
+	"broken_heart":     "💔",
+	"sparkling_heart":  "💖",
+	"100":              "💯",
+	"sparkles":         "✨",
+	"star":             "⭐",
+	"zap":              "⚡",
+	"boom":             "💥",
+	"fire":             "🔥",
+	"tada":             "🎉",
+	"balloon":          "🎈",
+	"gift":             "🎁",
+	"trophy":           "🏆",
+	"medal":            "🏅",
+	"check":            "✅",
+	"heavy_check_mark": "✔️",
+	"x":                "❌",
+	"warning":          "⚠️",
+	"no_entry":         "⛔",
+	"question":         "❓",
+	"exclamation":      "❗",
+	"bulb":             "💡",
+	"bell":             "🔔",
+	"lock":             "🔒",
+	"key":              "🔑",
+	"link":             "🔗",
+	"pushpin":          "📌",
+	"memo":             "📝",
+	"calendar":         "📅",
+	"hourglass":        "⌛",
+	"alarm_clock":      "⏰",
+	"zzz":              "💤",
+	"speech_balloon":   "💬",
+	// Things
+	"rocket":   "🚀",
+	"computer": "💻",
+	"keyboard": "⌨️",
+	"phone":    "📱",
+	"email":    "📧",
+	"package":  "📦",
+	"bug":      "🐛",
+	"wrench":   "🔧",
+	"hammer":   "🔨",
+	"gear":     "⚙️",
+	"chart":    "📈",
+	"books":    "📚",
+	"moneybag": "💰",
+	"coffee":   "☕",
+	"tea":      "🍵",
+	"beer":     "🍺",
+	"beers":    "🍻",
+	"wine":     "🍷",
+	"pizza":    "🍕",
+	"cake":     "🍰",
+	"cookie":   "🍪",
+	"apple":    "🍎",
+	"taco":     "🌮",
+	// Nature
+	"sunny":     "☀️",
+	"cloud":     "☁️",
+	"umbrella":  "☔",
+	"snowflake": "❄️",
+	"rainbow":   "🌈",
+	"moon":      "🌙",
+	"earth":     "🌍",
+	"seedling":  "🌱",
+	"tree":      "🌳",
+	"rose":      "🌹",
+	"cat":       "🐱",
+	"dog":       "🐶",
+	"fox":       "🦊",
+	"panda":     "🐼",
+	"unicorn":   "🦄",
+	"bee":       "🐝",
+	"turtle":    "🐢",
+	"octopus":   "🐙",
+}
+
+var emojiPattern = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+
+// expandShortcodes replaces the :shortcodes: in s that we know.
+func expandShortcodes(s string) string {
+	return emojiPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if e, ok := emojiCodes[m[1:len(m)-1]]; ok {
+			return e
+		}
+		return m
+	})
+}
+
+// expandEmoji is the "emoji" outgoing step.
+func expandEmoji(whisper SweetNothing) (SweetNothing, error) {
+	whisper.Body = expandShortcodes(whisper.Body)
+	return whisper, nil
+}
+
+// findEmoji lists the codes containing query, exact matches first.
+func findEmoji(query string) {
+	query = strings.ToLower(strings.Trim(query, ":"))
+	if len(query) == 0 {
+		statusLn(T("Usage: /emoji <query>"))
+		return
+	}
+	var codes []string
+	for code := range emojiCodes {
+		if strings.Contains(code, query) {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		statusLn(tr("No emoji matching %s", query))
+		return
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if (codes[i] == query) != (codes[j] == query) {
+			return codes[i] == query
+		}
+		return codes[i] < codes[j]
+	})
+	l := make([]string, len(codes))
+	for i, code := range codes {
+		l[i] = fmt.Sprintf("%s :%s:", emojiCodes[code], code)
+	}
+	statusLn(strings.Join(l, "  "))
+}
@@ -0,0 +1,375 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Images larger than this are linked rather than embedded in exports.
+const maxInlineImage = 2 * 1024 * 1024
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+var imageExts = []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}
+
+func isImageURL(u string) bool {
+	u = strings.ToLower(u)
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	for _, ext := range imageExts {
+		if strings.HasSuffix(u, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineImage fetches an image and returns it as a data URI so the export
+// doesn't depend on the image staying online. Falls back to the URL itself.
+func inlineImage(client *http.Client, u string) template.URL {
+	resp, err := client.Get(u)
+	if err != nil {
+		return template.URL(u)
+	}
+	defer resp.Body.Close()
+	ctype := resp.Header.Get("Content-Type")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(ctype, "image/") {
+		return template.URL(u)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxInlineImage+1))
+	if err != nil || len(b) > maxInlineImage {
+		return template.URL(u)
+	}
+	return template.URL("data:" + ctype + ";base64," + base64.StdEncoding.EncodeToString(b))
+}
+
+type exportPart struct {
+	Text  string
+	Link  string
+	Image template.URL
+}
+
+type exportLine struct {
+	Time  string
+	Room  string
+	Nick  string
+	Parts []exportPart
+}
+
+func exportParts(client *http.Client, body string) []exportPart {
+	var parts []exportPart
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		if loc[0] > last {
+			parts = append(parts, exportPart{Text: body[last:loc[0]]})
+		}
+		u := body[loc[0]:loc[1]]
+		if isImageURL(u) {
+			parts = append(parts, exportPart{Link: u, Image: inlineImage(client, u)})
+		} else {
+			parts = append(parts, exportPart{Link: u})
+		}
+		last = loc[1]
+	}
+	if last < len(body) {
+		parts = append(parts, exportPart{Text: body[last:]})
+	}
+	return parts
+}
+
+var exportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, sans-serif; background: #fafafa; color: #222; max-width: 48em; margin: 2em auto; padding: 0 1em; }
+h1 { font-size: 1.3em; color: #8a2be2; }
+.meta { color: #888; font-size: 0.85em; margin-bottom: 2em; }
+.msg { padding: 0.3em 0; border-bottom: 1px solid #eee; }
+.time { color: #999; font-size: 0.8em; font-family: monospace; margin-right: 0.5em; }
+.room { color: #0a7; margin-right: 0.5em; }
+.nick { font-weight: bold; margin-right: 0.5em; }
+.body { white-space: pre-wrap; word-wrap: break-word; }
+.body img { display: block; max-width: 100%; max-height: 24em; margin: 0.4em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">{{len .Lines}} messages, exported {{.Exported}}</div>
+{{range .Lines}}<div class="msg"><span class="time">{{.Time}}</span>{{if .Room}}<span class="room">{{.Room}}</span>{{end}}<span class="nick">{{.Nick}}</span><span class="body">{{range .Parts}}{{if .Image}}<a href="{{.Link}}"><img src="{{.Image}}" alt="{{.Link}}"></a>{{else if .Link}}<a href="{{.Link}}">{{.Link}}</a>{{else}}{{.Text}}{{end}}{{end}}</span></div>
+{{end}}</body>
+</html>
+`))
+
+func exportHTML(w io.Writer, title string, msgs []SweetNothing) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var lines []exportLine
+	for _, whisper := range msgs {
+		if whisper.Deleted {
+			continue
+		}
+		body := whisper.Body
+		switch whisper.Kind {
+		case voteKind, ackKind, reactKind, editKind, deleteKind:
+			continue
+		case pollKind:
+			body = fmt.Sprintf("Poll: %s (%s)", body, strings.Join(whisper.Options, " / "))
+		}
+		lines = append(lines, exportLine{
+			Time:  whisper.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			Room:  whisper.Room,
+			Nick:  nickName(whisper.Addr),
+			Parts: exportParts(client, body),
+		})
+	}
+	return exportTemplate.Execute(w, map[string]interface{}{
+		"Title":    title,
+		"Exported": time.Now().Format("2006-01-02 15:04"),
+		"Lines":    lines,
+	})
+}
+
+/**
+ * Export
+ *
+ * /export <file> [#room] [from] [to] [private], "sweetnothings export"
+ * and -export-html write history between optional dates as JSON Lines
+ * (which /import reads back), a plain text transcript or an HTML page,
+ * picked by the file's extension or -format. Dates are 2006-01-02 or
+ * RFC 3339; a bare date for the end takes in the whole day. Direct
+ * messages and ephemeral ones stay out unless asked for with "private"
+ * or -private, since an export tends to travel further than the chat.
+ */
+
+const (
+	exportJSONL = "jsonl"
+	exportText  = "text"
+	exportPage  = "html"
+)
+
+func exportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".json", ".ndjson":
+		return exportJSONL
+	case ".html", ".htm":
+		return exportPage
+	}
+	return exportText
+}
+
+// exportBound parses a date bound; end moves a bare date to the end of
+// its day.
+func exportBound(s string, end bool) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf(T("%q isn't a date like 2006-01-02"), s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// exportFilter picks the messages to export besides their dates.
+type exportFilter struct {
+	// Room limits the export to one room, "#" being the main one; empty
+	// takes in every room.
+	Room string
+	// Private takes in direct and ephemeral messages too.
+	Private bool
+}
+
+func (f exportFilter) keep(whisper SweetNothing) bool {
+	if len(f.Room) > 0 && whisper.Room != roomName(f.Room) {
+		return false
+	}
+	return f.Private || (len(whisper.To) == 0 && whisper.Kind != dmKind && whisper.TTL <= 0)
+}
+
+func exportRange(from time.Time, to time.Time, filter exportFilter) []SweetNothing {
+	var msgs []SweetNothing
+	for _, whisper := range history.Since(0) {
+		if whisper.Timestamp.Before(from) || (!to.IsZero() && whisper.Timestamp.After(to)) || !filter.keep(whisper) {
+			continue
+		}
+		msgs = append(msgs, whisper)
+	}
+	return msgs
+}
+
+func exportTranscript(w io.Writer, msgs []SweetNothing) error {
+	b := bufio.NewWriter(w)
+	for _, whisper := range msgs {
+		if whisper.Deleted {
+			continue
+		}
+		body := whisper.Body
+		switch whisper.Kind {
+		case voteKind, ackKind, reactKind, editKind, deleteKind:
+			continue
+		case pollKind:
+			body = fmt.Sprintf("Poll: %s (%s)", body, strings.Join(whisper.Options, " / "))
+		}
+		room := ""
+		if len(whisper.Room) > 0 {
+			room = whisper.Room + " "
+		}
+		fmt.Fprintf(b, "%s %s%s: %s\n", whisper.Timestamp.Local().Format("2006-01-02 15:04:05"), room, nickName(whisper.Addr), body)
+	}
+	return b.Flush()
+}
+
+func exportJSONLines(w io.Writer, msgs []SweetNothing) error {
+	b := bufio.NewWriter(w)
+	enc := json.NewEncoder(b)
+	for _, whisper := range msgs {
+		if err := enc.Encode(whisper); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
+
+// exportHistory writes history from from to to that filter keeps into
+// path, or stdout for "-". It returns how many messages that was.
+func exportHistory(path string, format string, from time.Time, to time.Time, filter exportFilter) (int, error) {
+	if history == nil {
+		return 0, errors.New(T("Nothing to export with history disabled"))
+	}
+	if len(format) == 0 {
+		format = exportFormat(path)
+	}
+	msgs := exportRange(from, to, filter)
+	w := io.Writer(os.Stdout)
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		w = f
+	}
+	var err error
+	switch format {
+	case exportJSONL:
+		err = exportJSONLines(w, msgs)
+	case exportText:
+		err = exportTranscript(w, msgs)
+	case exportPage:
+		err = exportHTML(w, "Sweet Nothings", msgs)
+	default:
+		err = fmt.Errorf(T("unknown export format %q"), format)
+	}
+	return len(msgs), err
+}
+
+// exportCommand handles /export <file> [#room] [from] [to] [private].
+func exportCommand(args []string) {
+	var filter exportFilter
+	var dates []string
+	for _, arg := range args[min(len(args), 1):] {
+		switch {
+		case strings.HasPrefix(arg, "#"):
+			filter.Room = arg
+		case arg == "private":
+			filter.Private = true
+		default:
+			dates = append(dates, arg)
+		}
+	}
+	if len(args) == 0 || len(dates) > 2 {
+		statusLn(T("Usage: /export <file> [#room] [from] [to] [private]"))
+		return
+	}
+	var bounds [2]time.Time
+	for i, arg := range dates {
+		t, err := exportBound(arg, i == 1)
+		if err != nil {
+			statusLn(err.Error())
+			return
+		}
+		bounds[i] = t
+	}
+	n, err := exportHistory(args[0], "", bounds[0], bounds[1], filter)
+	if err != nil {
+		statusLn(tr("Unable to export history: %v", err))
+		return
+	}
+	statusLn(tr("Exported %d messages to %s", n, args[0]))
+}
+
+// runExport is the export subcommand, for use without starting a node.
+func runExport(args []string) {
+	setupLocale("")
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.StringVar(&dataRoot, "dir", "", "Directory holding history and profiles (default: ~/.sweetnothings)")
+	fs.StringVar(&profile, "profile", "", "Profile to export")
+	historyPath := fs.String("history", "", "History store (default: history.db in the profile)")
+	format := fs.String("format", "", "jsonl, text or html (default: from the file's extension)")
+	fromArg := fs.String("from", "", "Only messages from this date on")
+	toArg := fs.String("to", "", "Only messages up to this date")
+	var filter exportFilter
+	fs.StringVar(&filter.Room, "room", "", "Only messages in this room, \"#\" for the main one")
+	fs.BoolVar(&filter.Private, "private", false, "Include direct and ephemeral messages")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), T("Usage: sweetnothings export [flags] <file>"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(profile) > 0 && !validProfile(profile) {
+		log.Fatalf(T("Invalid profile name (%s)"), profile)
+	}
+	from, err := exportBound(*fromArg, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := exportBound(*toArg, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*historyPath) == 0 {
+		*historyPath = defaultHistoryPath()
+	}
+	if _, err := os.Stat(*historyPath); err != nil {
+		log.Fatal(T("Unable to open history:"), err)
+	}
+	// Opened without the search index or replays, which would print to
+	// stdout, where "-" sends the export.
+	h, err := OpenHistory(*historyPath)
+	if err != nil {
+		log.Fatal(T("Unable to open history:"), err)
+	}
+	history = h
+	n, err := exportHistory(fs.Arg(0), *format, from, to, filter)
+	if err != nil {
+		log.Fatal(T("Unable to export history:"), err)
+	}
+	if fs.Arg(0) != "-" {
+		logger.Info(tr("Exported %d messages to %s", n, fs.Arg(0)), "event", "export")
+	}
+}
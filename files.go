@@ -0,0 +1,460 @@
+package sweetnothings
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * File transfer
+ *
+ * /sendfile <peer> <path> offers a file to one peer. If they /accept it,
+ * it's streamed to them in chunks on the bulk lane of our link, so chat
+ * keeps flowing while it goes, and checked against the SHA-256 sent with
+ * the offer before it's saved. Nothing about a transfer is gossiped.
+ * Files are saved to -downloads unless /accept is given a directory.
+ */
+
+var downloadDir string
+
+// Small enough that a chunk frame, base64 and all, fits in maxBulkFrame.
+const fileChunkSize = 16 * 1024
+
+// How often to report a transfer's progress.
+const fileProgressEvery = 2 * time.Second
+
+type fileOffer struct {
+	ID   string
+	Name string
+	Size int64
+	Sum  string
+}
+
+type fileChunk struct {
+	ID     string
+	Offset int64
+	Data   []byte
+}
+
+type fileRef struct {
+	ID string
+}
+
+type transfer struct {
+	offer    fileOffer
+	peer     string
+	incoming bool
+	// The file we're sending, or the directory we're saving to.
+	path     string
+	accepted bool
+	since    time.Time
+
+	f        *os.File
+	sum      hash.Hash
+	done     int64
+	reported time.Time
+	stop     chan struct{}
+}
+
+var transfers = struct {
+	m map[string]*transfer
+	sync.Mutex
+}{m: make(map[string]*transfer)}
+
+func init() {
+	controlHandlers["file-offer"] = handleFileOffer
+	controlHandlers["file-accept"] = handleFileAccept
+	controlHandlers["file-decline"] = handleFileDecline
+	controlHandlers["file-chunk"] = handleFileChunk
+	controlHandlers["file-done"] = handleFileDone
+	controlHandlers["file-cancel"] = handleFileCancel
+}
+
+func defaultDownloadDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if dir := filepath.Join(home, "Downloads"); isDir(dir) {
+			return dir
+		}
+	}
+	return "."
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+func transferID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// findTransfer looks a transfer up by ID prefix, or takes the newest
+// offer still waiting for an answer when id is empty.
+func findTransfer(id string) (*transfer, bool) {
+	transfers.Lock()
+	defer transfers.Unlock()
+	if len(id) == 0 {
+		var newest *transfer
+		for _, t := range transfers.m {
+			if t.incoming && !t.accepted && (newest == nil || t.since.After(newest.since)) {
+				newest = t
+			}
+		}
+		return newest, newest != nil
+	}
+	for tid, t := range transfers.m {
+		if strings.HasPrefix(tid, id) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func removeTransfer(t *transfer) {
+	transfers.Lock()
+	defer transfers.Unlock()
+	if transfers.m[t.offer.ID] != t {
+		return
+	}
+	delete(transfers.m, t.offer.ID)
+	close(t.stop)
+	if t.f != nil {
+		t.f.Close()
+		if t.incoming {
+			os.Remove(t.f.Name())
+		}
+	}
+}
+
+// progress reports how a transfer is going, at most every
+// fileProgressEvery.
+func (t *transfer) progress() {
+	if time.Since(t.reported) < fileProgressEvery || t.offer.Size == 0 {
+		return
+	}
+	t.reported = time.Now()
+	statusLn(tr("%s: %d%% (%s of %s)", t.offer.Name, t.done*100/t.offer.Size, formatSize(t.done), formatSize(t.offer.Size)))
+}
+
+// sendFile handles "/sendfile <peer> <path>".
+func sendFile(args []string) {
+	if len(args) < 2 {
+		statusLn(T("Usage: /sendfile <peer> <path>"))
+		return
+	}
+	addr := dialAddr(peerFor(args[0]))
+	path := strings.Join(args[1:], " ")
+	f, err := os.Open(path)
+	if err != nil {
+		statusLn(tr("Can't send %s: %v", path, err))
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		statusLn(tr("Can't send %s: not a file", path))
+		return
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		statusLn(tr("Can't send %s: %v", path, err))
+		return
+	}
+	t := &transfer{
+		offer: fileOffer{ID: transferID(), Name: filepath.Base(path), Size: fi.Size(), Sum: hex.EncodeToString(sum.Sum(nil))},
+		peer:  addr,
+		path:  path,
+		since: time.Now(),
+		stop:  make(chan struct{}),
+	}
+	transfers.Lock()
+	transfers.m[t.offer.ID] = t
+	transfers.Unlock()
+	go func() {
+		if !sendSoon(addr, controlFrame("file-offer", t.offer), sessionTimeout) {
+			statusLn(tr("Couldn't reach %s to offer %s", nickName(addr), t.offer.Name))
+			removeTransfer(t)
+			return
+		}
+		statusLn(tr("Offered %s (%s) to %s; waiting for them to accept", t.offer.Name, formatSize(t.offer.Size), nickName(addr)))
+	}()
+}
+
+func handleFileOffer(from string, data json.RawMessage) {
+	var offer fileOffer
+	if json.Unmarshal(data, &offer) != nil || len(offer.ID) == 0 {
+		return
+	}
+	offer.Name = filepath.Base(filepath.Clean("/" + offer.Name))
+	if offer.Name == "/" || offer.Name == "." || offer.Size < 0 {
+		return
+	}
+	transfers.Lock()
+	if _, ok := transfers.m[offer.ID]; ok {
+		transfers.Unlock()
+		return
+	}
+	transfers.m[offer.ID] = &transfer{offer: offer, peer: from, incoming: true, since: time.Now(), stop: make(chan struct{})}
+	transfers.Unlock()
+	fmt.Fprint(stdout, "\a")
+	statusLn(tr("%s wants to send you %s (%s)", nickName(from), offer.Name, formatSize(offer.Size)))
+	noteLn(T("To accept"), "", fmt.Sprintf("/accept %s [dir]  /decline %s", offer.ID, offer.ID), "blue")
+}
+
+// acceptFile handles "/accept [id] [dir]".
+func acceptFile(args []string) {
+	id, dir := "", downloadDir
+	if len(args) > 0 {
+		id = args[0]
+	}
+	if len(args) > 1 {
+		dir = strings.Join(args[1:], " ")
+	}
+	t, ok := findTransfer(id)
+	if !ok || !t.incoming || t.accepted {
+		statusLn(tr("No file offer %s", id))
+		return
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		statusLn(tr("Can't save to %s: %v", dir, err))
+		return
+	}
+	f, err := os.CreateTemp(dir, "."+t.offer.Name+".*.part")
+	if err != nil {
+		statusLn(tr("Can't save to %s: %v", dir, err))
+		return
+	}
+	transfers.Lock()
+	t.accepted, t.path, t.f, t.sum, t.reported = true, dir, f, sha256.New(), time.Now()
+	transfers.Unlock()
+	go func() {
+		if !sendSoon(t.peer, controlFrame("file-accept", fileRef{t.offer.ID}), sessionTimeout) {
+			statusLn(tr("Couldn't reach %s to accept %s", nickName(t.peer), t.offer.Name))
+			removeTransfer(t)
+			return
+		}
+		statusLn(tr("Receiving %s into %s", t.offer.Name, dir))
+	}()
+}
+
+func declineFile(id string) {
+	t, ok := findTransfer(id)
+	if !ok || !t.incoming || t.accepted {
+		statusLn(tr("No file offer %s", id))
+		return
+	}
+	removeTransfer(t)
+	go sendSoon(t.peer, controlFrame("file-decline", fileRef{t.offer.ID}), sessionTimeout)
+	statusLn(tr("Declined %s", t.offer.Name))
+}
+
+func cancelTransfer(id string) {
+	t, ok := findTransfer(id)
+	if !ok || len(id) == 0 {
+		statusLn(tr("No transfer %s", id))
+		return
+	}
+	removeTransfer(t)
+	go sendSoon(t.peer, controlFrame("file-cancel", fileRef{t.offer.ID}), sessionTimeout)
+	statusLn(tr("Cancelled the transfer of %s", t.offer.Name))
+}
+
+// peerTransfer finds the transfer a frame from from is about.
+func peerTransfer(from string, data json.RawMessage, incoming bool) (*transfer, bool) {
+	var ref fileRef
+	if json.Unmarshal(data, &ref) != nil {
+		return nil, false
+	}
+	transfers.Lock()
+	defer transfers.Unlock()
+	t, ok := transfers.m[ref.ID]
+	if !ok || t.peer != from || t.incoming != incoming {
+		return nil, false
+	}
+	return t, true
+}
+
+func handleFileAccept(from string, data json.RawMessage) {
+	t, ok := peerTransfer(from, data, false)
+	if !ok {
+		return
+	}
+	transfers.Lock()
+	already := t.accepted
+	t.accepted = true
+	transfers.Unlock()
+	if already {
+		return
+	}
+	statusLn(tr("%s accepted %s", nickName(from), t.offer.Name))
+	go streamFile(t)
+}
+
+func handleFileDecline(from string, data json.RawMessage) {
+	if t, ok := peerTransfer(from, data, false); ok {
+		removeTransfer(t)
+		statusLn(tr("%s declined %s", nickName(from), t.offer.Name))
+	}
+}
+
+func handleFileCancel(from string, data json.RawMessage) {
+	t, ok := peerTransfer(from, data, true)
+	if !ok {
+		t, ok = peerTransfer(from, data, false)
+	}
+	if ok {
+		removeTransfer(t)
+		statusLn(tr("%s cancelled the transfer of %s", nickName(from), t.offer.Name))
+	}
+}
+
+// streamFile sends an accepted file down the bulk lane, followed by
+// file-done.
+func streamFile(t *transfer) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		statusLn(tr("Can't send %s: %v", t.path, err))
+		cancelTransfer(t.offer.ID)
+		return
+	}
+	defer f.Close()
+	t.reported = time.Now()
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			select {
+			case <-t.stop:
+				return
+			default:
+			}
+			chunk := fileChunk{ID: t.offer.ID, Offset: t.done, Data: buf[:n]}
+			if !sendBulk(t.peer, controlFrame("file-chunk", chunk), sessionTimeout) {
+				statusLn(tr("Lost touch with %s while sending %s", nickName(t.peer), t.offer.Name))
+				removeTransfer(t)
+				return
+			}
+			t.done += int64(n)
+			t.progress()
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			statusLn(tr("Can't send %s: %v", t.path, err))
+			cancelTransfer(t.offer.ID)
+			return
+		}
+	}
+	if sendBulk(t.peer, controlFrame("file-done", fileRef{t.offer.ID}), sessionTimeout) {
+		statusLn(tr("Sent %s to %s", t.offer.Name, nickName(t.peer)))
+	}
+	transfers.Lock()
+	delete(transfers.m, t.offer.ID)
+	transfers.Unlock()
+}
+
+func handleFileChunk(from string, data json.RawMessage) {
+	var chunk fileChunk
+	if json.Unmarshal(data, &chunk) != nil {
+		return
+	}
+	t, ok := peerTransfer(from, data, true)
+	if !ok || !t.accepted || chunk.Offset != t.done || t.done+int64(len(chunk.Data)) > t.offer.Size {
+		return
+	}
+	if _, err := t.f.Write(chunk.Data); err != nil {
+		statusLn(tr("Can't save %s: %v", t.offer.Name, err))
+		cancelTransfer(t.offer.ID)
+		return
+	}
+	t.sum.Write(chunk.Data)
+	t.done += int64(len(chunk.Data))
+	t.progress()
+}
+
+func handleFileDone(from string, data json.RawMessage) {
+	t, ok := peerTransfer(from, data, true)
+	if !ok || !t.accepted {
+		return
+	}
+	if t.done != t.offer.Size || hex.EncodeToString(t.sum.Sum(nil)) != t.offer.Sum {
+		statusLn(tr("%s arrived damaged and was discarded", t.offer.Name))
+		removeTransfer(t)
+		return
+	}
+	tmp := t.f.Name()
+	t.f.Close()
+	dest := freePath(filepath.Join(t.path, t.offer.Name))
+	if err := os.Rename(tmp, dest); err != nil {
+		statusLn(tr("Can't save %s: %v", t.offer.Name, err))
+		os.Remove(tmp)
+	} else {
+		statusLn(tr("Saved %s from %s to %s", t.offer.Name, nickName(from), dest))
+		previewImageFile(dest)
+	}
+	transfers.Lock()
+	delete(transfers.m, t.offer.ID)
+	transfers.Unlock()
+}
+
+// freePath is path, or path with a number added if that's taken.
+func freePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+func showTransfers() {
+	transfers.Lock()
+	defer transfers.Unlock()
+	if len(transfers.m) == 0 {
+		statusLn(T("No file transfers"))
+		return
+	}
+	l := make([]*transfer, 0, len(transfers.m))
+	for _, t := range transfers.m {
+		l = append(l, t)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].offer.ID < l[j].offer.ID })
+	for _, t := range l {
+		dir := tr("to %s", nickName(t.peer))
+		if t.incoming {
+			dir = tr("from %s", nickName(t.peer))
+		}
+		state := T("waiting")
+		if t.accepted {
+			state = fmt.Sprintf("%s/%s", formatSize(t.done), formatSize(t.offer.Size))
+		}
+		statusLn(fmt.Sprintf("%s %s (%s) %s, %s", t.offer.ID, t.offer.Name, formatSize(t.offer.Size), dir, state))
+	}
+}
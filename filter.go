@@ -0,0 +1,401 @@
+package sweetnothings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/**
+ * Inbound filters
+ *
+ * A filter file holds rules like
+ *
+ *	body matches "deploy" && channel == "#ops" -> notify
+ *	from == spammer -> drop
+ *
+ * separated by newlines or ';'. The first rule whose condition holds
+ * decides what happens to an incoming message. Conditions compare the
+ * fields body, from, nick, channel, network and kind with ==, !=, contains and
+ * matches (a regexp), combined with &&, || and !. Bare words that aren't
+ * fields are strings. Lines starting with '#' are comments.
+ */
+const (
+	filterShow   = "show"
+	filterNotify = "notify"
+	filterDrop   = "drop"
+)
+
+type filterVars map[string]string
+
+type filterExpr interface {
+	eval(v filterVars) bool
+}
+
+type filterOperand struct {
+	field   string
+	literal string
+}
+
+func (o filterOperand) value(v filterVars) string {
+	if len(o.field) > 0 {
+		return v[o.field]
+	}
+	return o.literal
+}
+
+// A lone operand holds when it's non-empty, e.g. "channel".
+func (o filterOperand) eval(v filterVars) bool {
+	return len(o.value(v)) > 0
+}
+
+type filterCompare struct {
+	op   string
+	l, r filterOperand
+	re   *regexp.Regexp
+}
+
+func (c filterCompare) eval(v filterVars) bool {
+	l := c.l.value(v)
+	switch c.op {
+	case "==":
+		return strings.EqualFold(l, c.r.value(v))
+	case "!=":
+		return !strings.EqualFold(l, c.r.value(v))
+	case "contains":
+		return strings.Contains(strings.ToLower(l), strings.ToLower(c.r.value(v)))
+	case "matches":
+		re := c.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(c.r.value(v)); err != nil {
+				return false
+			}
+		}
+		return re.MatchString(l)
+	}
+	return false
+}
+
+type filterAnd struct{ l, r filterExpr }
+
+func (a filterAnd) eval(v filterVars) bool { return a.l.eval(v) && a.r.eval(v) }
+
+type filterOr struct{ l, r filterExpr }
+
+func (o filterOr) eval(v filterVars) bool { return o.l.eval(v) || o.r.eval(v) }
+
+type filterNot struct{ e filterExpr }
+
+func (n filterNot) eval(v filterVars) bool { return !n.e.eval(v) }
+
+type filterRule struct {
+	text   string
+	cond   filterExpr
+	action string
+}
+
+var filterFields = map[string]bool{"body": true, "from": true, "nick": true, "channel": true, "kind": true, "network": true}
+
+type filterToken struct {
+	s      string
+	quoted bool
+}
+
+func lexFilter(line string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, errors.New(T("unterminated string"))
+			}
+			s, err := strconv.Unquote(line[i : j+1])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, filterToken{s: s, quoted: true})
+			i = j + 1
+		case strings.HasPrefix(line[i:], "&&"), strings.HasPrefix(line[i:], "||"),
+			strings.HasPrefix(line[i:], "=="), strings.HasPrefix(line[i:], "!="),
+			strings.HasPrefix(line[i:], "->"), strings.HasPrefix(line[i:], "=~"):
+			toks = append(toks, filterToken{s: line[i : i+2]})
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			toks = append(toks, filterToken{s: string(c)})
+			i++
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\"!()&|=", rune(line[j])) &&
+				!strings.HasPrefix(line[j:], "->") {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf(T("unexpected %q"), line[i:])
+			}
+			toks = append(toks, filterToken{s: line[i:j]})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.toks) {
+		return filterToken{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// accept consumes the next token if it's the operator s.
+func (p *filterParser) accept(s string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && t.s == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterExpr, error) {
+	l, err := p.and()
+	for err == nil && p.accept("||") {
+		var r filterExpr
+		if r, err = p.and(); err == nil {
+			l = filterOr{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *filterParser) and() (filterExpr, error) {
+	l, err := p.not()
+	for err == nil && p.accept("&&") {
+		var r filterExpr
+		if r, err = p.not(); err == nil {
+			l = filterAnd{l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *filterParser) not() (filterExpr, error) {
+	if p.accept("!") {
+		e, err := p.not()
+		return filterNot{e}, err
+	}
+	if p.accept("(") {
+		e, err := p.or()
+		if err == nil && !p.accept(")") {
+			err = errors.New(T("missing )"))
+		}
+		return e, err
+	}
+	return p.compare()
+}
+
+func (p *filterParser) operand() (filterOperand, error) {
+	t, ok := p.peek()
+	if !ok || (!t.quoted && (strings.ContainsAny(t.s, "!()&|=") || t.s == "->")) {
+		return filterOperand{}, errors.New(T("expected a field or string"))
+	}
+	p.pos++
+	if !t.quoted && filterFields[strings.ToLower(t.s)] {
+		return filterOperand{field: strings.ToLower(t.s)}, nil
+	}
+	return filterOperand{literal: t.s}, nil
+}
+
+func (p *filterParser) compare() (filterExpr, error) {
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.peek()
+	if !ok || t.quoted {
+		return l, nil
+	}
+	op := strings.ToLower(t.s)
+	if op == "=~" {
+		op = "matches"
+	}
+	switch op {
+	case "==", "!=", "contains", "matches":
+	default:
+		return l, nil
+	}
+	p.pos++
+	r, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	c := filterCompare{op: op, l: l, r: r}
+	if op == "matches" && len(r.field) == 0 {
+		if c.re, err = regexp.Compile(r.literal); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func parseFilterRule(text string) (filterRule, error) {
+	toks, err := lexFilter(text)
+	if err != nil {
+		return filterRule{}, err
+	}
+	p := &filterParser{toks: toks}
+	cond, err := p.or()
+	if err != nil {
+		return filterRule{}, err
+	}
+	if !p.accept("->") {
+		return filterRule{}, errors.New(T("expected -> action"))
+	}
+	t, ok := p.peek()
+	if !ok {
+		return filterRule{}, errors.New(T("expected -> action"))
+	}
+	action := strings.ToLower(t.s)
+	switch action {
+	case filterShow, filterNotify, filterDrop:
+	default:
+		return filterRule{}, fmt.Errorf(T("unknown action %q (want show, notify or drop)"), t.s)
+	}
+	if p.pos+1 != len(toks) {
+		return filterRule{}, fmt.Errorf(T("unexpected %q after action"), toks[p.pos+1].s)
+	}
+	return filterRule{text: strings.TrimSpace(text), cond: cond, action: action}, nil
+}
+
+// splitRules splits line at each ';' that isn't inside a string.
+func splitRules(line string) []string {
+	var rules []string
+	quoted, start := false, 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				rules = append(rules, line[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(rules, line[start:])
+}
+
+// parseFilters parses a whole rule file, reporting the first bad rule.
+func parseFilters(src string) ([]filterRule, error) {
+	var rules []filterRule
+	for n, line := range strings.Split(src, "\n") {
+		if strings.HasPrefix(strings.TrimLeftFunc(line, unicode.IsSpace), "#") {
+			continue
+		}
+		for _, text := range splitRules(line) {
+			if len(strings.TrimSpace(text)) == 0 {
+				continue
+			}
+			r, err := parseFilterRule(text)
+			if err != nil {
+				return nil, fmt.Errorf(T("line %d: %s: %v"), n+1, strings.TrimSpace(text), err)
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+var filters = struct {
+	path  string
+	rules []filterRule
+	sync.RWMutex
+}{}
+
+// loadFilters reads the rule file at path. A missing file means no rules.
+func loadFilters(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rules, err := parseFilters(string(b))
+	if err != nil {
+		return err
+	}
+	filters.Lock()
+	filters.path = path
+	filters.rules = rules
+	filters.Unlock()
+	return nil
+}
+
+// filterMessage returns what the first matching rule says to do with an
+// incoming message.
+func filterMessage(whisper SweetNothing) string {
+	filters.RLock()
+	defer filters.RUnlock()
+	if len(filters.rules) == 0 {
+		return filterShow
+	}
+	v := filterVars{
+		"body":    whisper.Body,
+		"from":    whisper.Addr,
+		"nick":    nickName(whisper.Addr),
+		"kind":    whisper.Kind,
+		"channel": whisper.Channel(),
+		"network": whisper.Net,
+	}
+	for _, r := range filters.rules {
+		if r.cond.eval(v) {
+			return r.action
+		}
+	}
+	return filterShow
+}
+
+func showFilters() {
+	filters.RLock()
+	defer filters.RUnlock()
+	if len(filters.rules) == 0 {
+		statusLn(tr("No filters (rules go in %s)", filters.path))
+		return
+	}
+	for i, r := range filters.rules {
+		statusLn(fmt.Sprintf("%d) %s", i+1, r.text))
+	}
+}
+
+func handleFilters(arg string) {
+	if arg == "reload" {
+		filters.RLock()
+		path := filters.path
+		filters.RUnlock()
+		if err := loadFilters(path); err != nil {
+			logger.Error(T("Error loading filters"), "event", "filters", "path", path, "err", err)
+			return
+		}
+	}
+	showFilters()
+}
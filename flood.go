@@ -0,0 +1,82 @@
+package sweetnothings
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Flood protection
+ *
+ * -relay-limit caps how many new messages a second we pass on for
+ * others across all peers, with relayLimitBurst seconds' worth to spend
+ * at once, so a spam storm dies out at us rather than going through us
+ * to everyone. Relays also make way for our own messages: they only take
+ * the first half of a peer's buffer, wait behind ours in its outbox, and
+ * are dropped rather than pushing ours out of a half-full one.
+ */
+
+// New messages a second we relay for others; 0 means no limit.
+var relayLimit float64
+
+const relayLimitBurst = 5
+
+var relayBucket = struct {
+	tokens float64
+	filled time.Time
+	warned time.Time
+	sync.Mutex
+}{}
+
+// allowRelay charges one relayed message against -relay-limit, reporting
+// whether it may go.
+func allowRelay() bool {
+	if relayLimit <= 0 {
+		return true
+	}
+	relayBucket.Lock()
+	now := time.Now()
+	if relayBucket.filled.IsZero() {
+		relayBucket.tokens = relayLimit * relayLimitBurst
+	}
+	relayBucket.tokens = min(relayBucket.tokens+now.Sub(relayBucket.filled).Seconds()*relayLimit, relayLimit*relayLimitBurst)
+	relayBucket.filled = now
+	allowed := relayBucket.tokens >= 1
+	if allowed {
+		relayBucket.tokens--
+	}
+	warn := !allowed && now.Sub(relayBucket.warned) >= rateMuteFor
+	if warn {
+		relayBucket.warned = now
+	}
+	relayBucket.Unlock()
+
+	if !allowed {
+		atomic.AddUint64(&stats.Throttled, 1)
+	}
+	if warn {
+		statusLn(T("Relaying more than -relay-limit; holding some messages back"))
+	}
+	return allowed
+}
+
+// sendRelayed is send for messages we're passing on for others.
+func sendRelayed(whisper SweetNothing, targets map[string]chan<- Frame) {
+	f := Frame{Type: msgFrame, Msg: &whisper}
+	for addr, ch := range targets {
+		if len(ch) < cap(ch)/2 {
+			select {
+			case ch <- f:
+				atomic.AddUint64(&stats.Relayed, 1)
+				continue
+			default:
+			}
+		}
+		if queued(addr) >= maxOutbox/2 {
+			atomic.AddUint64(&stats.Throttled, 1)
+			continue
+		}
+		enqueue(addr, f)
+	}
+}
@@ -0,0 +1,73 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/**
+ * Goodbyes
+ *
+ * /quit [note], Ctrl-C and SIGTERM tell every peer we're linked to that
+ * we're leaving before exiting, waiting up to goodbyeTimeout for the
+ * frames to go out. Peers drop their link to us, mark us offline and say
+ * we left, rather than finding out from a broken connection.
+ */
+
+const goodbyeTimeout = time.Second
+
+type goodbye struct {
+	Note string `json:",omitempty"`
+}
+
+func init() {
+	controlHandlers["leaving"] = handleLeaving
+}
+
+// watchExit says goodbye when we're interrupted or told to stop.
+func watchExit() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	quit("")
+}
+
+func quit(note string) {
+	f := controlFrame("leaving", goodbye{Note: note})
+	var wg sync.WaitGroup
+	for addr := range peers.Channels() {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			sendSoon(addr, f, goodbyeTimeout)
+		}(addr)
+	}
+	wg.Wait()
+	// Give the writers a moment to flush what they've taken.
+	time.Sleep(50 * time.Millisecond)
+	if history != nil {
+		history.Close()
+	}
+	saveOutbox()
+	os.Exit(0)
+}
+
+func handleLeaving(from string, data json.RawMessage) {
+	var g goodbye
+	if json.Unmarshal(data, &g) != nil {
+		return
+	}
+	noReconnect(from)
+	peers.Disconnect(from)
+	peerGone(from)
+	if note := strings.TrimSpace(excerpt(g.Note, 80)); len(note) > 0 {
+		statusLn(tr("%s left: %s", nickName(from), note))
+	} else {
+		statusLn(tr("%s left", nickName(from)))
+	}
+}
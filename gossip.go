@@ -0,0 +1,197 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	floodGossip  = "flood"
+	digestGossip = "digest"
+)
+
+// In flood mode every received message is pushed to (up to -fanout) peers.
+// In digest mode only a few peers get the full message right away; the rest
+// learn its ID from a digest and pull it if they're missing it.
+var gossipMode = floodGossip
+
+// Peers pushed to eagerly in digest mode when -fanout isn't set.
+const digestFanout = 2
+
+const digestInterval = time.Second
+
+// Recently seen messages are kept this long (up to recentCap) so they can be
+// served to peers that ask for them.
+const (
+	recentWindow = 5 * time.Minute
+	recentCap    = 5000
+)
+
+// How long to wait for a connection or room in a peer's queue when sending
+// or answering a want.
+const wantTimeout = 3 * time.Second
+
+type IDList struct {
+	IDs []string
+}
+
+type recentEntry struct {
+	seq     uint64
+	seen    time.Time
+	whisper SweetNothing
+}
+
+var recent = struct {
+	seq     uint64
+	entries []recentEntry
+	byID    map[string]int
+	cursors map[string]uint64
+	sync.Mutex
+}{
+	byID:    make(map[string]int),
+	cursors: make(map[string]uint64),
+}
+
+func init() {
+	controlHandlers["digest"] = handleDigest
+	controlHandlers["want"] = handleWant
+}
+
+func hasSeen(id string) bool {
+	return seenIds.Has(id)
+}
+
+// rememberMessage keeps whisper around to answer wants and announce in
+// digests.
+func rememberMessage(whisper SweetNothing) {
+	recent.Lock()
+	defer recent.Unlock()
+	now := time.Now()
+	drop := 0
+	for drop < len(recent.entries) &&
+		(len(recent.entries)-drop >= recentCap || now.Sub(recent.entries[drop].seen) > recentWindow) {
+		drop++
+	}
+	if drop > 0 {
+		recent.entries = append([]recentEntry(nil), recent.entries[drop:]...)
+		recent.byID = make(map[string]int, len(recent.entries))
+		for i, e := range recent.entries {
+			recent.byID[e.whisper.ID] = i
+		}
+	}
+	recent.seq++
+	recent.byID[whisper.ID] = len(recent.entries)
+	recent.entries = append(recent.entries, recentEntry{recent.seq, now, whisper})
+}
+
+// startDigests marks everything already seen as announced to addr, so a new
+// connection only gets digests for messages from here on.
+func startDigests(addr string) {
+	recent.Lock()
+	recent.cursors[addr] = recent.seq
+	recent.Unlock()
+}
+
+// digestCursor is how far digests to addr have got.
+func digestCursor(addr string) uint64 {
+	recent.Lock()
+	defer recent.Unlock()
+	return recent.cursors[addr]
+}
+
+// resumeDigests picks digests to addr up from an earlier connection's
+// cursor, so it hears about what it missed while disconnected.
+func resumeDigests(addr string, cursor uint64) {
+	recent.Lock()
+	if cursor < recent.cursors[addr] {
+		recent.cursors[addr] = cursor
+	}
+	recent.Unlock()
+}
+
+func stopDigests(addr string) {
+	recent.Lock()
+	delete(recent.cursors, addr)
+	recent.Unlock()
+}
+
+// Flooding to every peer leaves nothing for digests to repair.
+func digestsEnabled() bool {
+	return gossipMode == digestGossip || relayFanout > 0
+}
+
+// digestFrame lists the IDs seen since the last digest to addr. It reports
+// false when there is nothing new.
+func digestFrame(addr string) (Frame, bool) {
+	recent.Lock()
+	defer recent.Unlock()
+	cursor := recent.cursors[addr]
+	network := netOf(addr)
+	var ids []string
+	for i := len(recent.entries) - 1; i >= 0 && recent.entries[i].seq > cursor; i-- {
+		if recent.entries[i].whisper.Net == network {
+			ids = append(ids, recent.entries[i].whisper.ID)
+		}
+	}
+	recent.cursors[addr] = recent.seq
+	if len(ids) == 0 || !digestsEnabled() {
+		return Frame{}, false
+	}
+	return controlFrame("digest", IDList{ids}), true
+}
+
+func handleDigest(from string, data json.RawMessage) {
+	var d IDList
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+	var missing []string
+	for _, id := range d.IDs {
+		if !hasSeen(id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	go sendSoon(from, controlFrame("want", IDList{missing}), wantTimeout)
+}
+
+func handleWant(from string, data json.RawMessage) {
+	var w IDList
+	if err := json.Unmarshal(data, &w); err != nil {
+		return
+	}
+	ch := peers.Get(from)
+	if ch == nil {
+		return
+	}
+	for _, id := range w.IDs {
+		recent.Lock()
+		i, ok := recent.byID[id]
+		var whisper SweetNothing
+		if ok {
+			whisper = recent.entries[i].whisper
+		}
+		recent.Unlock()
+		if !ok || whisper.Net != netOf(from) {
+			continue
+		}
+		select {
+		case ch <- Frame{Type: msgFrame, Msg: &whisper}:
+		case <-time.After(wantTimeout):
+			return
+		}
+	}
+}
+
+func setGossipMode(mode string) error {
+	switch mode {
+	case floodGossip, digestGossip:
+		gossipMode = mode
+		return nil
+	}
+	return fmt.Errorf(T("unknown gossip mode %q"), mode)
+}
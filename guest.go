@@ -0,0 +1,41 @@
+package sweetnothings
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// In ephemeral mode nothing is read from or written to disk, and we go by
+// a throwaway guest name that other peers learn through the metadata
+// store.
+var ephemeral bool
+
+const guestPrefix = "guest/"
+
+func newGuestName() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return "guest-" + hex.EncodeToString(b)
+}
+
+// guestName returns the name addr announced if it's a guest.
+func guestName(addr string) (string, bool) {
+	if meta == nil {
+		return "", false
+	}
+	return meta.Get(guestPrefix + addr)
+}
+
+func announceGuest() {
+	name := newGuestName()
+	setMeta(guestPrefix+localInfo.Addr(), name)
+	statusLn(tr("Guest mode: nothing is saved, and peers see you as %s", name))
+}
+
+func watchGuests() {
+	meta.Watch(guestPrefix, func(e MetaEntry) {
+		if !isLocal(e.Origin) && !e.Deleted {
+			statusLn(tr("%s joined as a guest", nickName(e.Key[len(guestPrefix):])))
+		}
+	})
+}
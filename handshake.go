@@ -0,0 +1,184 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+ * Handshake
+ *
+ * The first frame on every link is a hello giving the range of protocol
+ * versions the writer speaks, its identity and the address it listens
+ * on, along with the name it goes by (-nick or /nick), its client
+ * version and the features it has. Peers are labeled with the name they
+ * offer unless we've given them one with /setnick. A reader whose range
+ * doesn't overlap, or who gets some other frame first, writes an
+ * incompatible frame back and drops the link, so both ends can say why
+ * instead of misreading each other's frames. Otherwise the link speaks
+ * the highest version both know.
+ */
+
+const (
+	protocolVersion    = 1
+	minProtocolVersion = 1
+)
+
+// clientVersion is set at build time with
+// -ldflags "-X github.com/harveyr/sweetnothings.clientVersion=1.2.3".
+var clientVersion = "dev"
+
+const maxNickLength = 32
+
+const (
+	helloFrame        = "hello"
+	incompatibleFrame = "incompatible"
+)
+
+type hello struct {
+	Version    int
+	MinVersion int
+	Node       string
+	Listen     string
+	Nick       string   `json:",omitempty"`
+	Client     string   `json:",omitempty"`
+	Features   []string `json:",omitempty"`
+}
+
+var handshakes = struct {
+	// The hello each peer last sent us, and the version we settled on.
+	m       map[string]hello
+	version map[string]int
+	sync.Mutex
+}{m: make(map[string]hello), version: make(map[string]int)}
+
+func helloFrameFor(addr string) Frame {
+	return controlFrame(helloFrame, hello{
+		Version:    protocolVersion,
+		MinVersion: minProtocolVersion,
+		Node:       fingerprint(identityPublic()),
+		Listen:     localAddr(netOf(addr)),
+		Nick:       ourNick(),
+		Client:     clientVersion,
+		Features:   localFeatures(),
+	})
+}
+
+// localFeatures lists what this node can do, so peers know what to send
+// it.
+func localFeatures() []string {
+	features := []string{"acks", "batch", "dm", "edits", "files", "gzip", "presence", "reactions", "receipts", "typing"}
+	for name := range wireCodecs {
+		features = append(features, name)
+	}
+	if relayMode {
+		features = append(features, "relay")
+	}
+	if rendezvousMode {
+		features = append(features, "rendezvous")
+	}
+	if e2eEnabled {
+		features = append(features, "e2e")
+	}
+	sort.Strings(features)
+	return features
+}
+
+// checkHello looks at the first frame on c and reports whether the link
+// can go on.
+func checkHello(c net.Conn, f Frame) bool {
+	if f.Type == incompatibleFrame {
+		var h hello
+		json.Unmarshal(f.Data, &h)
+		logger.Warn(T("Peer speaks protocol versions we don't; not connecting"), "event", "handshake", "peer", f.From, "versions", fmt.Sprintf("%d-%d", h.MinVersion, h.Version), "ours", fmt.Sprintf("%d-%d", minProtocolVersion, protocolVersion))
+		return false
+	}
+	var h hello
+	if f.Type != helloFrame || json.Unmarshal(f.Data, &h) != nil {
+		logger.Warn(T("Peer sent no handshake and is probably running an older version; dropping the connection"), "event", "handshake", "peer", c.RemoteAddr().String())
+		rejectLink(c, f.From)
+		return false
+	}
+	if h.Version < minProtocolVersion || h.MinVersion > protocolVersion {
+		logger.Warn(T("Peer speaks protocol versions we don't; dropping the connection"), "event", "handshake", "peer", f.From, "versions", fmt.Sprintf("%d-%d", h.MinVersion, h.Version), "ours", fmt.Sprintf("%d-%d", minProtocolVersion, protocolVersion))
+		rejectLink(c, f.From)
+		return false
+	}
+	h.Nick = cleanNick(h.Nick)
+	handshakes.Lock()
+	prev := handshakes.m[f.From]
+	handshakes.m[f.From] = h
+	handshakes.version[f.From] = min(h.Version, protocolVersion)
+	handshakes.Unlock()
+	if len(h.Nick) > 0 && h.Nick != prev.Nick {
+		statusLn(tr("%s goes by %s", f.From, h.Nick))
+	}
+	return true
+}
+
+// cleanNick keeps an offered name to one short line.
+func cleanNick(nick string) string {
+	return excerpt(strings.Join(strings.Fields(nick), " "), maxNickLength)
+}
+
+// rejectLink tells the other end of c why we're hanging up on it.
+func rejectLink(c net.Conn, addr string) {
+	f := helloFrameFor(addr)
+	f.Type = incompatibleFrame
+	f.From = localAddr(netOf(addr))
+	json.NewEncoder(c).Encode(f)
+}
+
+// linkVersion is the protocol version we speak with addr, or 0 if it
+// hasn't said hello.
+func linkVersion(addr string) int {
+	handshakes.Lock()
+	defer handshakes.Unlock()
+	return handshakes.version[addr]
+}
+
+// offeredName is the name addr asked to be shown as, if any.
+func offeredName(addr string) (string, bool) {
+	handshakes.Lock()
+	defer handshakes.Unlock()
+	h, ok := handshakes.m[addr]
+	return h.Nick, ok && len(h.Nick) > 0
+}
+
+// peerOffering finds the peer that goes by nick.
+func peerOffering(nick string) (string, bool) {
+	handshakes.Lock()
+	defer handshakes.Unlock()
+	for addr, h := range handshakes.m {
+		if h.Nick == nick {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+// peerHello is what addr told us about itself when it connected.
+func peerHello(addr string) (hello, bool) {
+	handshakes.Lock()
+	defer handshakes.Unlock()
+	h, ok := handshakes.m[addr]
+	return h, ok
+}
+
+// hasFeature reports whether addr said it can do feature.
+func hasFeature(addr string, feature string) bool {
+	h, ok := peerHello(addr)
+	if !ok {
+		return false
+	}
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
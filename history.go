@@ -0,0 +1,544 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Set by -dir to keep data somewhere other than ~/.sweetnothings.
+var dataRoot string
+
+// rootDir holds everything that isn't specific to a profile.
+func rootDir() string {
+	if len(dataRoot) > 0 {
+		return dataRoot
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(T("Unable to find home directory:"), err)
+	}
+	return filepath.Join(home, ".sweetnothings")
+}
+
+// dataDir is where the current profile keeps its history, metadata and
+// config.
+func dataDir() string {
+	if len(profile) > 0 {
+		return filepath.Join(rootDir(), "profiles", profile)
+	}
+	return rootDir()
+}
+
+// defaultHistoryPath is the history store in the profile. A history.jsonl
+// left by older versions is a valid store, so it's moved into place.
+func defaultHistoryPath() string {
+	path := filepath.Join(dataDir(), "history.db")
+	old := filepath.Join(dataDir(), "history.jsonl")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if os.Rename(old, path) == nil {
+			os.Rename(old+".idx", path+".idx")
+		}
+	}
+	return path
+}
+
+/**
+ * History
+ *
+ * The history store is a log: each line is a message, or a record of
+ * something done to the messages before it. A message whose ID is already
+ * stored replaces it in place (edits, deletions, receipts), a Drop line
+ * prunes messages (retention) and a Sort line puts them in timestamp order
+ * (imports). Opening the store replays the log, so changes cost one
+ * appended line instead of rewriting the file. Once the log holds more
+ * superseded lines than live messages it's rewritten as one line per
+ * message, which is also what an old plain JSONL history looks like.
+ */
+type History struct {
+	path string
+	f    *os.File
+	msgs []SweetNothing
+	ids  map[string]int
+	// Lines in the log that no longer describe a live message.
+	garbage int
+	mu      sync.RWMutex
+}
+
+// Don't bother compacting the log over fewer superseded lines than this.
+const historyMinGarbage = 1000
+
+// historyLine is one line of the log.
+type historyLine struct {
+	SweetNothing
+	Drop []string `json:",omitempty"`
+	Sort bool     `json:",omitempty"`
+}
+
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &History{path: path, f: f, ids: make(map[string]int)}
+	if err := h.replay(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := h.settle(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// eachLine calls fn with each non-blank line of r, however long.
+func eachLine(r io.Reader, fn func(line []byte)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// replay applies the log in r, skipping lines that don't parse.
+func (h *History) replay(r io.Reader) error {
+	return eachLine(r, func(line []byte) {
+		var l historyLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			logger.Warn(T("Skipping bad history line"), "event", "history", "err", err)
+			return
+		}
+		switch {
+		case len(l.Drop) > 0:
+			h.drop(l.Drop)
+			h.garbage += len(l.Drop) + 1
+		case l.Sort:
+			h.sort()
+			h.garbage++
+		default:
+			if i, ok := h.ids[l.ID]; ok {
+				h.msgs[i] = l.SweetNothing
+				h.garbage++
+			} else {
+				h.insert(l.SweetNothing)
+			}
+		}
+	})
+}
+
+// readMessages decodes one JSON message per line, skipping lines that
+// don't parse.
+func readMessages(r io.Reader) ([]SweetNothing, error) {
+	var msgs []SweetNothing
+	err := eachLine(r, func(line []byte) {
+		var whisper SweetNothing
+		if err := json.Unmarshal(line, &whisper); err != nil {
+			logger.Warn(T("Skipping bad history line"), "event", "history", "err", err)
+			return
+		}
+		msgs = append(msgs, whisper)
+	})
+	return msgs, err
+}
+
+func (h *History) insert(whisper SweetNothing) bool {
+	if _, ok := h.ids[whisper.ID]; ok {
+		return false
+	}
+	h.ids[whisper.ID] = len(h.msgs)
+	h.msgs = append(h.msgs, whisper)
+	return true
+}
+
+// reindex rebuilds the ID lookup after messages move. Callers must hold
+// h.mu.
+func (h *History) reindex() {
+	h.ids = make(map[string]int, len(h.msgs))
+	for i, whisper := range h.msgs {
+		h.ids[whisper.ID] = i
+	}
+}
+
+func (h *History) sort() {
+	sort.SliceStable(h.msgs, func(i, j int) bool {
+		return h.msgs[i].Timestamp.Before(h.msgs[j].Timestamp)
+	})
+	h.reindex()
+}
+
+// drop removes the messages with the given IDs. Callers must hold h.mu.
+func (h *History) drop(ids []string) {
+	gone := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		gone[id] = true
+	}
+	kept := h.msgs[:0]
+	for _, whisper := range h.msgs {
+		if !gone[whisper.ID] {
+			kept = append(kept, whisper)
+		}
+	}
+	h.msgs = kept
+	h.reindex()
+}
+
+// log appends lines to the store. Callers must hold h.mu.
+func (h *History) log(lines ...historyLine) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	_, err := h.f.Write(buf.Bytes())
+	return err
+}
+
+// settle compacts the log once it's mostly superseded lines. Callers must
+// hold h.mu.
+func (h *History) settle() error {
+	if h.garbage < historyMinGarbage || h.garbage < len(h.msgs) {
+		return nil
+	}
+	return h.rewrite()
+}
+
+// Append stores whisper unless a message with the same ID is already
+// archived. It reports whether the message was new.
+func (h *History) Append(whisper SweetNothing) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.insert(whisper) {
+		return false, nil
+	}
+	return true, h.log(historyLine{SweetNothing: whisper})
+}
+
+// Merge adds any of msgs not already archived, then re-sorts the archive by
+// timestamp so imported messages land in chronological order. It returns
+// the messages that were added.
+func (h *History) Merge(msgs []SweetNothing) ([]SweetNothing, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var added []SweetNothing
+	var lines []historyLine
+	for _, whisper := range msgs {
+		if h.insert(whisper) {
+			added = append(added, whisper)
+			lines = append(lines, historyLine{SweetNothing: whisper})
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	h.sort()
+	h.garbage++
+	if err := h.log(append(lines, historyLine{Sort: true})...); err != nil {
+		return added, err
+	}
+	return added, h.settle()
+}
+
+// rewrite replaces the log with one line per message. Callers must hold
+// h.mu.
+func (h *History) rewrite() error {
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, whisper := range h.msgs {
+		if err := enc.Encode(whisper); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+
+	f, err = os.OpenFile(h.path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	h.f.Close()
+	h.f = f
+	h.garbage = 0
+	return nil
+}
+
+// Update changes the archived message with the given ID in place. It
+// reports whether there was such a message.
+func (h *History) Update(id string, change func(*SweetNothing)) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i, ok := h.ids[id]
+	if !ok {
+		return false, nil
+	}
+	change(&h.msgs[i])
+	h.garbage++
+	if err := h.log(historyLine{SweetNothing: h.msgs[i]}); err != nil {
+		return true, err
+	}
+	return true, h.settle()
+}
+
+func (h *History) Get(id string) (SweetNothing, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i, ok := h.ids[id]
+	if !ok {
+		return SweetNothing{}, false
+	}
+	return h.msgs[i], true
+}
+
+// FindPrefix returns the newest archived message whose ID starts with prefix.
+func (h *History) FindPrefix(prefix string) (SweetNothing, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := len(h.msgs) - 1; i >= 0; i-- {
+		if strings.HasPrefix(h.msgs[i].ID, prefix) {
+			return h.msgs[i], true
+		}
+	}
+	return SweetNothing{}, false
+}
+
+// Around returns the message with the given ID and up to n archived
+// on either side of it, with its position in the result.
+func (h *History) Around(id string, n int) ([]SweetNothing, int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i, ok := h.ids[id]
+	if !ok {
+		return nil, -1
+	}
+	from, to := max(0, i-n), min(len(h.msgs), i+n+1)
+	l := make([]SweetNothing, to-from)
+	copy(l, h.msgs[from:to])
+	return l, i - from
+}
+
+// Lookup returns the archived messages with the given IDs in arrival order.
+func (h *History) Lookup(ids []string) []SweetNothing {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	pos := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if i, ok := h.ids[id]; ok {
+			pos = append(pos, i)
+		}
+	}
+	sort.Ints(pos)
+	l := make([]SweetNothing, len(pos))
+	for j, i := range pos {
+		l[j] = h.msgs[i]
+	}
+	return l
+}
+
+func (h *History) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.msgs)
+}
+
+// Since returns every message at or after position i, in arrival order.
+func (h *History) Since(i int) []SweetNothing {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if i >= len(h.msgs) {
+		return nil
+	}
+	l := make([]SweetNothing, len(h.msgs)-i)
+	copy(l, h.msgs[i:])
+	return l
+}
+
+func (h *History) Close() error {
+	return h.f.Close()
+}
+
+var history *History
+
+func recordHistory(whisper SweetNothing) {
+	if history == nil {
+		return
+	}
+	isNew, err := history.Append(whisper)
+	if err != nil {
+		logger.Error(T("Error writing history"), "event", "history", "id", whisper.ID, "err", err)
+	}
+	if isNew && searchIndex != nil {
+		searchIndex.Add(whisper)
+	}
+}
+
+func openHistory(path string) {
+	h, err := OpenHistory(path)
+	if err != nil {
+		log.Fatal(T("Unable to open history:"), err)
+	}
+	history = h
+	for _, whisper := range history.Since(0) {
+		observeClock(whisper.Clock)
+	}
+	replayPolls(history.Since(0))
+	replayReactions(history.Since(0))
+	replayAmendments(history.Since(0))
+
+	searchIndex = LoadSearchIndex(path + ".idx")
+	if n := searchIndex.Catchup(history); n > 0 {
+		statusLn(tr("Indexed %d new messages", n))
+	}
+}
+
+func reindexHistory() {
+	if history == nil {
+		statusLn(tr("History is disabled"))
+		return
+	}
+	n := searchIndex.Rebuild(history)
+	statusLn(tr("Rebuilt search index over %d messages", n))
+}
+
+func importHistory(path string) {
+	if history == nil {
+		statusLn(tr("History is disabled"))
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		logger.Error(T("Error opening file"), "event", "import", "path", path, "err", err)
+		return
+	}
+	msgs, err := readMessages(f)
+	f.Close()
+	if err != nil {
+		logger.Error(T("Error reading file"), "event", "import", "path", path, "err", err)
+		return
+	}
+
+	added, err := history.Merge(msgs)
+	if err != nil {
+		logger.Error(T("Error writing history"), "event", "import", "err", err)
+	}
+	for _, whisper := range added {
+		SeenId(whisper.ID)
+	}
+	if len(added) > 0 {
+		searchIndex.Rebuild(history)
+	}
+	statusLn(tr("Imported %d of %d messages from %s", len(added), len(msgs), path))
+}
+
+// Messages /history shows at a time.
+const historyPage = 20
+
+// historyPager remembers where the last page of /history started, so the
+// next "/history more" carries on before it.
+var historyPager = struct {
+	start int
+	n     int
+	sync.Mutex
+}{}
+
+// showHistory handles /history [n|more].
+func showHistory(arg string) {
+	if history == nil {
+		statusLn(tr("History is disabled"))
+		return
+	}
+	msgs := history.Since(0)
+	historyPager.Lock()
+	defer historyPager.Unlock()
+	switch arg {
+	case "more":
+		if historyPager.n == 0 {
+			historyPager.start, historyPager.n = len(msgs), historyPage
+		}
+	case "":
+		historyPager.start, historyPager.n = len(msgs), historyPage
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			statusLn(T("Usage: /history [n|more]"))
+			return
+		}
+		historyPager.start, historyPager.n = len(msgs), n
+	}
+
+	var page []SweetNothing
+	i := min(historyPager.start, len(msgs)) - 1
+	for ; i >= 0 && len(page) < historyPager.n; i-- {
+		whisper := msgs[i]
+		if (len(whisper.Kind) == 0 || whisper.Kind == dmKind) && !whisper.Deleted && !expired(whisper, time.Now()) && inRoom(whisper.Room) {
+			page = append(page, whisper)
+		}
+	}
+	historyPager.start = i + 1
+	if len(page) == 0 {
+		statusLn(T("No earlier messages"))
+		return
+	}
+	for j := len(page) - 1; j >= 0; j-- {
+		fmt.Fprint(stdout, wrapColor(historyStamp(page[j].Timestamp), "blue")+" ")
+		if page[j].Kind == dmKind {
+			showDM(page[j])
+		} else {
+			showMessage(page[j])
+		}
+	}
+	if historyPager.start > 0 {
+		statusLn(T("/history more for earlier messages"))
+	}
+}
+
+// historyStamp dates a replayed message only as precisely as it needs:
+// the time today, the weekday this week, the full date before that.
+func historyStamp(t time.Time) string {
+	t = t.Local()
+	now := time.Now()
+	switch {
+	case t.YearDay() == now.YearDay() && t.Year() == now.Year():
+		return t.Format("15:04")
+	case now.Sub(t) < 6*24*time.Hour:
+		return t.Format("Mon 15:04")
+	}
+	return t.Format("2006-01-02 15:04")
+}
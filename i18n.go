@@ -0,0 +1,103 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * Message catalog
+ *
+ * UI strings are looked up by their English format string, so anything
+ * missing from a catalog falls back to English. Message bodies are never
+ * translated here; see translate.go for that.
+ */
+var catalog map[string]string
+
+// T returns the current locale's version of the English format string s.
+func T(s string) string {
+	if t, ok := catalog[s]; ok {
+		return t
+	}
+	return s
+}
+
+// tr formats a translated UI string.
+func tr(format string, args ...interface{}) string {
+	if len(args) == 0 {
+		return T(format)
+	}
+	return fmt.Sprintf(T(format), args...)
+}
+
+// envLocale picks the message locale from the usual POSIX variables.
+func envLocale() string {
+	for _, v := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if l := os.Getenv(v); len(l) > 0 {
+			return l
+		}
+	}
+	return ""
+}
+
+// localeNames turns a locale like "pt_BR.UTF-8" into the catalog names to
+// try, most specific first: "pt_br", "pt".
+func localeNames(locale string) []string {
+	l := strings.ToLower(locale)
+	if i := strings.IndexAny(l, ".@"); i >= 0 {
+		l = l[:i]
+	}
+	l = strings.Replace(l, "-", "_", -1)
+	if len(l) == 0 || l == "c" || l == "posix" {
+		return nil
+	}
+	names := []string{l}
+	if i := strings.Index(l, "_"); i > 0 {
+		names = append(names, l[:i])
+	}
+	return names
+}
+
+// setupLocale selects the catalog for locale, or the environment's locale
+// if it's empty. A JSON file in ~/.sweetnothings/locales/<name>.json adds
+// to or overrides the built-in catalog of the same name.
+func setupLocale(locale string) {
+	if len(locale) == 0 {
+		locale = envLocale()
+	}
+	catalog = nil
+	for _, name := range localeNames(locale) {
+		c := make(map[string]string)
+		found := false
+		if b, ok := builtinCatalogs[name]; ok {
+			for k, v := range b {
+				c[k] = v
+			}
+			found = true
+		}
+		path := filepath.Join(rootDir(), "locales", name+".json")
+		if b, err := os.ReadFile(path); err == nil {
+			if err := json.Unmarshal(b, &c); err != nil {
+				logger.Error(T("Error reading file"), "event", "locale", "path", path, "err", err)
+			}
+			found = true
+		}
+		if found {
+			catalog = c
+			return
+		}
+	}
+}
+
+// localizedUsage prints flag help in the chosen locale.
+func localizedUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), T("Usage of %s:\n"), os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		f.Usage = T(f.Usage)
+	})
+	flag.PrintDefaults()
+}
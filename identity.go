@@ -0,0 +1,136 @@
+package sweetnothings
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/**
+ * Identities
+ *
+ * Every node has a persistent Ed25519 key and signs each message it
+ * writes, carrying the public key along. An address must keep using the
+ * key we first saw from it (see trust.go), so nobody can put words in
+ * someone else's mouth by copying their Addr. Messages from nodes that
+ * predate signing are still shown, just without a fingerprint, but once
+ * an address has a pinned key or its link said hello with one, its
+ * messages have to be signed.
+ */
+
+var identityKey ed25519.PrivateKey
+
+// loadIdentity reads our signing key from the profile, creating it on
+// first run.
+func loadIdentity() error {
+	if ephemeral {
+		_, identityKey, _ = ed25519.GenerateKey(rand.Reader)
+		return nil
+	}
+	path := filepath.Join(dataDir(), "identity.key")
+	seed, err := os.ReadFile(path)
+	if err == nil {
+		if len(seed) != ed25519.SeedSize {
+			return errors.New(T("identity key is the wrong size"))
+		}
+		identityKey = ed25519.NewKeyFromSeed(seed)
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if _, identityKey, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		return err
+	}
+	os.MkdirAll(dataDir(), 0700)
+	return os.WriteFile(path, identityKey.Seed(), 0600)
+}
+
+func identityPublic() ed25519.PublicKey {
+	return identityKey.Public().(ed25519.PublicKey)
+}
+
+// The parts of a message that its author vouches for. Relays add to Path
+// and receivers set Net, so those aren't covered.
+type signedFields struct {
+	ID        string
+	Addr      string
+	Body      string
+	Timestamp time.Time
+	Kind      string
+	Ref       string
+	Options   []string
+	Sealed    *Sealed
+	Room      string        `json:",omitempty"`
+	To        string        `json:",omitempty"`
+	Clock     uint64        `json:",omitempty"`
+	TTL       time.Duration `json:",omitempty"`
+}
+
+func signingBytes(whisper SweetNothing) []byte {
+	b, _ := json.Marshal(signedFields{
+		whisper.ID, whisper.Addr, whisper.Body, whisper.Timestamp,
+		whisper.Kind, whisper.Ref, whisper.Options, whisper.Sealed,
+		whisper.Room, whisper.To, whisper.Clock, whisper.TTL,
+	})
+	return b
+}
+
+func signMessage(whisper SweetNothing) SweetNothing {
+	whisper.Key = identityPublic()
+	whisper.Sig = ed25519.Sign(identityKey, signingBytes(whisper))
+	return whisper
+}
+
+// verifyMessage checks a message's signature and that its author is using
+// the same key as before.
+func verifyMessage(whisper SweetNothing) error {
+	if whisper.Sig == nil {
+		if signs(whisper.Addr) {
+			return errors.New(T("unsigned message from an address that signs"))
+		}
+		return nil
+	}
+	if len(whisper.Key) != ed25519.PublicKeySize || !ed25519.Verify(whisper.Key, signingBytes(whisper), whisper.Sig) {
+		return errors.New(T("bad signature"))
+	}
+	return checkKnownKey(whisper.Addr, whisper.Key)
+}
+
+// signs reports whether addr is known to sign its messages, either because
+// we've pinned its key or because it gave one when it said hello.
+func signs(addr string) bool {
+	knownKeys.Lock()
+	_, pinned := knownKeys.m[addr]
+	knownKeys.Unlock()
+	if pinned {
+		return true
+	}
+	h, ok := peerHello(addr)
+	return ok && len(h.Node) > 0
+}
+
+func shortFingerprint(key []byte) string {
+	return fingerprint(key)[:8]
+}
+
+// identityFingerprint is the fingerprint of addr's signing key, if it has
+// sent us anything signed.
+func identityFingerprint(addr string) string {
+	if identityKey == nil {
+		return ""
+	}
+	if isLocal(addr) {
+		return shortFingerprint(identityPublic())
+	}
+	knownKeys.Lock()
+	defer knownKeys.Unlock()
+	if k, ok := knownKeys.m[addr]; ok {
+		return shortFingerprint(k.Key)
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package sweetnothings
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * Message IDs
+ *
+ * IDs are ULIDs: 48 bits of milliseconds since the epoch then 80 random
+ * bits, in Crockford's base32, so they sort by time and a prefix typed
+ * for /react or /vote narrows to recent messages first. IDs made in the
+ * same millisecond count up from the first one's random bits to keep that
+ * order. The origin node's fingerprint follows after a dash, so two nodes
+ * can't collide even in principle and an ID says where it came from.
+ */
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ulids = struct {
+	ms   uint64
+	last [10]byte
+	sync.Mutex
+}{}
+
+func uniqueId() string {
+	id := newULID(time.Now())
+	if identityKey != nil {
+		id += "-" + fingerprint(identityPublic())[:8]
+	}
+	return id
+}
+
+func newULID(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+	ulids.Lock()
+	var r [10]byte
+	if ms == ulids.ms {
+		r = ulids.last
+		for i := len(r) - 1; i >= 0; i-- {
+			r[i]++
+			if r[i] != 0 {
+				break
+			}
+		}
+	} else {
+		rand.Read(r[:])
+	}
+	ulids.ms, ulids.last = ms, r
+	ulids.Unlock()
+
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(b[6:], r[:])
+	return encodeULID(b)
+}
+
+// encodeULID writes 128 bits as 26 base32 digits, the first taking only
+// the top 3 bits.
+func encodeULID(b [16]byte) string {
+	var out [26]byte
+	for i := range out {
+		// Bit offset of this digit in a 130-bit number with two leading
+		// zeros.
+		bit := 5*i - 2
+		v := 0
+		for j := 0; j < 5; j++ {
+			if n := bit + j; n >= 0 && b[n/8]&(0x80>>(n%8)) != 0 {
+				v |= 0x10 >> j
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out[:])
+}
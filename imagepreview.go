@@ -0,0 +1,257 @@
+package sweetnothings
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/**
+ * Inline images
+ *
+ * In terminals that can show pictures (iTerm2 and WezTerm, kitty and
+ * Ghostty, or a sixel terminal named in $TERM) image files we've been
+ * sent are drawn under their notice; -inline-images=false turns that off.
+ * With -image-links, images linked from messages are fetched and drawn
+ * under the message too. Like -link-previews that's off by default, since
+ * fetching tells whoever posted the link who's reading. Images are shrunk
+ * to fit maxPreviewWidth by maxPreviewHeight pixels, and those over
+ * maxPreviewBytes aren't shown at all. Each terminal gets the protocol it
+ * speaks: ours if we're in the foreground, and whatever `sweetnothings
+ * attach` found for each attached one.
+ */
+
+var inlineImages = true
+
+var imageLinks bool
+
+// The terminal our output goes straight to, if any. Nodes in a daemon or
+// embedded in another program have none.
+var terminalOut *os.File
+
+const (
+	maxPreviewBytes  = 5 * 1024 * 1024
+	maxPreviewWidth  = 480
+	maxPreviewHeight = 320
+)
+
+const (
+	graphicsNone = iota
+	graphicsITerm
+	graphicsKitty
+	graphicsSixel
+)
+
+// terminalGraphics guesses from the environment which image protocol the
+// terminal on f speaks, if any.
+func terminalGraphics(f *os.File) int {
+	if !inlineImages || accessible || f == nil {
+		return graphicsNone
+	}
+	if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return graphicsNone
+	}
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return graphicsITerm
+	case term == "xterm-kitty" || len(os.Getenv("KITTY_WINDOW_ID")) > 0 || program == "ghostty":
+		return graphicsKitty
+	case strings.Contains(term, "sixel") || term == "mlterm" || strings.HasPrefix(term, "foot"):
+		return graphicsSixel
+	}
+	return graphicsNone
+}
+
+// canDrawImages reports whether any terminal we write to can show images.
+func canDrawImages() bool {
+	return inlineImages && !accessible && (terminalGraphics(terminalOut) != graphicsNone || attachedGraphics())
+}
+
+// previewImageURLs draws the images a message links to.
+func previewImageURLs(body string) {
+	if !canDrawImages() {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, u := range urlPattern.FindAllString(body, -1) {
+		if !isImageURL(u) {
+			continue
+		}
+		resp, err := client.Get(u)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode == http.StatusOK && resp.ContentLength <= maxPreviewBytes {
+			previewImage(resp.Body)
+		}
+		resp.Body.Close()
+	}
+}
+
+// previewImageFile draws a saved file if it's an image.
+func previewImageFile(path string) {
+	if !canDrawImages() || !isImageURL(filepath.Base(path)) {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	previewImage(f)
+}
+
+func previewImage(r io.Reader) {
+	b, err := io.ReadAll(io.LimitReader(r, maxPreviewBytes+1))
+	if err != nil || len(b) > maxPreviewBytes {
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	img = shrink(img, maxPreviewWidth, maxPreviewHeight)
+	drawn := make(map[int][]byte)
+	render := func(graphics int) []byte {
+		if b, ok := drawn[graphics]; ok {
+			return b
+		}
+		var out bytes.Buffer
+		switch graphics {
+		case graphicsITerm:
+			writeITermImage(&out, img)
+		case graphicsKitty:
+			writeKittyImage(&out, img)
+		case graphicsSixel:
+			writeSixel(&out, img)
+		}
+		out.WriteString("\n")
+		drawn[graphics] = out.Bytes()
+		return drawn[graphics]
+	}
+	if graphics := terminalGraphics(terminalOut); graphics != graphicsNone {
+		terminalOut.Write(render(graphics))
+	}
+	writeAttachedImage(render)
+}
+
+// shrink scales img down, nearest neighbor, to fit in w by h.
+func shrink(img image.Image, w int, h int) image.Image {
+	b := img.Bounds()
+	scale := 1.0
+	if sw := float64(w) / float64(b.Dx()); sw < scale {
+		scale = sw
+	}
+	if sh := float64(h) / float64(b.Dy()); sh < scale {
+		scale = sh
+	}
+	if scale == 1.0 {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, int(float64(b.Dx())*scale)), max(1, int(float64(b.Dy())*scale))))
+	for y := 0; y < dst.Bounds().Dy(); y++ {
+		for x := 0; x < dst.Bounds().Dx(); x++ {
+			dst.Set(x, y, img.At(b.Min.X+int(float64(x)/scale), b.Min.Y+int(float64(y)/scale)))
+		}
+	}
+	return dst
+}
+
+func pngBytes(img image.Image) []byte {
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+}
+
+// writeITermImage uses iTerm2's inline images protocol.
+func writeITermImage(w io.Writer, img image.Image) {
+	data := pngBytes(img)
+	fmt.Fprintf(w, "\033]1337;File=inline=1;size=%d;preserveAspectRatio=1:%s\a", len(data), base64.StdEncoding.EncodeToString(data))
+}
+
+// writeKittyImage uses kitty's graphics protocol, which wants the data in
+// chunks of at most 4096 bytes.
+func writeKittyImage(w io.Writer, img image.Image) {
+	data := base64.StdEncoding.EncodeToString(pngBytes(img))
+	for first := true; len(data) > 0; first = false {
+		n := min(4096, len(data))
+		more := 0
+		if n < len(data) {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(w, "\033_Gf=100,a=T,m=%d;%s\033\\", more, data[:n])
+		} else {
+			fmt.Fprintf(w, "\033_Gm=%d;%s\033\\", more, data[:n])
+		}
+		data = data[n:]
+	}
+}
+
+// writeSixel draws img as sixels in the web-safe palette.
+func writeSixel(w io.Writer, img image.Image) {
+	b := img.Bounds()
+	p := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.WebSafe)
+	draw.FloydSteinberg.Draw(p, p.Bounds(), img, b.Min)
+	width, height := p.Bounds().Dx(), p.Bounds().Dy()
+
+	fmt.Fprintf(w, "\033Pq\"1;1;%d;%d", width, height)
+	for i, c := range p.Palette {
+		r, g, bl, _ := c.RGBA()
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+	row := make([]byte, width)
+	for band := 0; band < height; band += 6 {
+		used := make(map[uint8]bool)
+		for y := band; y < band+6 && y < height; y++ {
+			for x := 0; x < width; x++ {
+				used[p.ColorIndexAt(x, y)] = true
+			}
+		}
+		for c := range used {
+			for x := 0; x < width; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && band+dy < height; dy++ {
+					if p.ColorIndexAt(x, band+dy) == c {
+						bits |= 1 << dy
+					}
+				}
+				row[x] = 63 + bits
+			}
+			fmt.Fprintf(w, "#%d", c)
+			writeSixelRow(w, row)
+			io.WriteString(w, "$")
+		}
+		io.WriteString(w, "-")
+	}
+	io.WriteString(w, "\033\\")
+}
+
+// writeSixelRow writes a band of sixels with runs compressed.
+func writeSixelRow(w io.Writer, row []byte) {
+	for i := 0; i < len(row); {
+		j := i
+		for j < len(row) && row[j] == row[i] {
+			j++
+		}
+		if n := j - i; n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, row[i])
+		} else {
+			w.Write(row[i:j])
+		}
+		i = j
+	}
+}
@@ -0,0 +1,204 @@
+package sweetnothings
+
+import (
+	"encoding/gob"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Snapshot the index to disk after this many incremental additions. Anything
+// added since the last snapshot is re-indexed from history on startup.
+const indexSaveEvery = 100
+
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	terms := words[:0]
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+/**
+ * SearchIndex
+ */
+type SearchIndex struct {
+	path    string
+	Count   int
+	Terms   map[string][]string
+	pending int
+	mu      sync.RWMutex
+}
+
+func newSearchIndex(path string) *SearchIndex {
+	return &SearchIndex{path: path, Terms: make(map[string][]string)}
+}
+
+// LoadSearchIndex reads the index snapshot at path, starting from an empty
+// index if there is none or it can't be decoded.
+func LoadSearchIndex(path string) *SearchIndex {
+	idx := newSearchIndex(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return idx
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(idx); err != nil {
+		logger.Warn(T("Discarding unreadable search index"), "event", "index", "path", path, "err", err)
+		return newSearchIndex(path)
+	}
+	return idx
+}
+
+func (idx *SearchIndex) add(whisper SweetNothing) {
+	for _, t := range tokenize(whisper.Body) {
+		idx.Terms[t] = append(idx.Terms[t], whisper.ID)
+	}
+	idx.Count++
+}
+
+// Add indexes a message that was just appended to history.
+func (idx *SearchIndex) Add(whisper SweetNothing) {
+	idx.mu.Lock()
+	idx.add(whisper)
+	idx.pending++
+	save := idx.pending >= indexSaveEvery
+	idx.mu.Unlock()
+	if save {
+		idx.Save()
+	}
+}
+
+// Reindex adds the words of a message whose body changed after it was
+// indexed. Its old words still find it until the next /reindex.
+func (idx *SearchIndex) Reindex(whisper SweetNothing) {
+	idx.mu.Lock()
+	for _, t := range tokenize(whisper.Body) {
+		idx.Terms[t] = append(idx.Terms[t], whisper.ID)
+	}
+	idx.pending++
+	idx.mu.Unlock()
+}
+
+// Catchup indexes any history messages newer than the last snapshot and
+// returns how many there were.
+func (idx *SearchIndex) Catchup(h *History) int {
+	idx.mu.Lock()
+	if idx.Count > h.Len() {
+		// History shrank underneath us; start over.
+		idx.Count = 0
+		idx.Terms = make(map[string][]string)
+	}
+	tail := h.Since(idx.Count)
+	for _, whisper := range tail {
+		idx.add(whisper)
+	}
+	idx.mu.Unlock()
+	if len(tail) > 0 {
+		idx.Save()
+	}
+	return len(tail)
+}
+
+// Rebuild discards the index and re-indexes all of history.
+func (idx *SearchIndex) Rebuild(h *History) int {
+	idx.mu.Lock()
+	idx.Count = 0
+	idx.Terms = make(map[string][]string)
+	idx.mu.Unlock()
+	return idx.Catchup(h)
+}
+
+// Search returns the IDs of messages containing every term in query. A term
+// ending in '*' matches any word with that prefix.
+func (idx *SearchIndex) Search(query string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var sets []map[string]bool
+	for _, w := range strings.Fields(query) {
+		terms := tokenize(w)
+		if len(terms) == 0 {
+			continue
+		}
+		if strings.HasSuffix(w, "*") {
+			last := terms[len(terms)-1]
+			terms = terms[:len(terms)-1]
+			sets = append(sets, idx.prefixSet(last))
+		}
+		for _, t := range terms {
+			sets = append(sets, toSet(idx.Terms[t]))
+		}
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for id := range sets[0] {
+		ok := true
+		for _, set := range sets[1:] {
+			if !set[id] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func (idx *SearchIndex) prefixSet(prefix string) map[string]bool {
+	set := make(map[string]bool)
+	for w, ids := range idx.Terms {
+		if !strings.HasPrefix(w, prefix) {
+			continue
+		}
+		for _, id := range ids {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+// Save writes an index snapshot, replacing the previous one atomically.
+func (idx *SearchIndex) Save() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	tmp := idx.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		logger.Error(T("Error saving search index"), "event", "index", "path", idx.path, "err", err)
+		return
+	}
+	err = gob.NewEncoder(f).Encode(idx)
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmp, idx.path)
+	}
+	if err != nil {
+		logger.Error(T("Error saving search index"), "event", "index", "path", idx.path, "err", err)
+		return
+	}
+	idx.pending = 0
+}
+
+var searchIndex *SearchIndex
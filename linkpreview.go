@@ -0,0 +1,82 @@
+package sweetnothings
+
+import (
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/**
+ * Link previews
+ *
+ * With -link-previews, pages linked from messages we receive are fetched
+ * and their titles shown dimmed under the message. It's off by default
+ * since fetching tells the site who's reading. Only the first
+ * maxPreviewPage bytes of an HTML page are read, and a page that takes
+ * longer than previewTimeout is skipped. At most maxPreviewLinks are
+ * fetched per message.
+ */
+
+var linkPreviews bool
+
+const (
+	maxPreviewPage  = 256 * 1024
+	maxPreviewLinks = 3
+	previewTimeout  = 5 * time.Second
+)
+
+var (
+	ogTitlePattern = regexp.MustCompile(`(?is)<meta[^>]+property=["']og:title["'][^>]+content=["']([^"']*)["']`)
+	titlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// previewLinks shows the titles of the pages body links to.
+func previewLinks(body string) {
+	seen := make(map[string]bool)
+	client := &http.Client{Timeout: previewTimeout}
+	for _, u := range urlPattern.FindAllString(body, -1) {
+		u = strings.TrimRight(u, ".,;:!?)'")
+		if seen[u] || isImageURL(u) {
+			continue
+		}
+		seen[u] = true
+		if len(seen) > maxPreviewLinks {
+			return
+		}
+		if title := pageTitle(client, u); len(title) > 0 {
+			noteLn(T("Link"), "↪ ", excerpt(title, 100), "dim")
+		}
+	}
+}
+
+// pageTitle fetches u and returns its title, or "" if it isn't an HTML
+// page with one.
+func pageTitle(client *http.Client, u string) string {
+	resp, err := client.Get(u)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	if t, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || t != "text/html" {
+		return ""
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPreviewPage))
+	if err != nil && len(page) == 0 {
+		return ""
+	}
+	m := ogTitlePattern.FindSubmatch(page)
+	if m == nil {
+		m = titlePattern.FindSubmatch(page)
+	}
+	if m == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+}
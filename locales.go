@@ -0,0 +1,850 @@
+package sweetnothings
+
+// Built-in catalogs, keyed by the English format string. Each translation
+// must keep the original's format verbs in the same order.
+var builtinCatalogs = map[string]map[string]string{
+	"es": {
+		"you":                                       "tú",
+		"Usage: /ask <text>":                        "Uso: /ask <texto>",
+		"Asked %d peers to acknowledge %s":          "Se pidió a %d pares que confirmen %s",
+		"asking for acknowledgment: %s":             "pide confirmación: %s",
+		"ACK?":                                      "¿OK?",
+		"To acknowledge":                            "Para confirmar",
+		"Nothing to acknowledge":                    "Nada que confirmar",
+		"Acknowledged %s: %s":                       "Confirmado %s: %s",
+		"%s acknowledged \"%s\" (%d/%d)":            "%s confirmó \"%s\" (%d/%d)",
+		"You haven't asked anything":                "No has preguntado nada",
+		"%s \"%s\" acked: %s; waiting on: %s":       "%s \"%s\" confirmado por: %s; esperando a: %s",
+		"nobody":                                    "nadie",
+		"%s isn't pinned":                           "%s no está fijado",
+		"Nothing pinned":                            "Nada fijado",
+		"%s unpinned %s":                            "%s desfijó %s",
+		"%s pinned %s":                              "%s fijó %s",
+		"unknown gossip mode %q":                    "modo de difusión desconocido %q",
+		"Unable to find home directory:":            "No se encuentra el directorio personal:",
+		"Skipping bad history line":                 "Omitiendo línea de historial dañada",
+		"Error writing history":                     "Error al escribir el historial",
+		"Unable to open history:":                   "No se puede abrir el historial:",
+		"Indexed %d new messages":                   "Indexados %d mensajes nuevos",
+		"History is disabled":                       "El historial está desactivado",
+		"Rebuilt search index over %d messages":     "Índice de búsqueda reconstruido con %d mensajes",
+		"Error opening file":                        "Error al abrir el archivo",
+		"Error reading file":                        "Error al leer el archivo",
+		"Imported %d of %d messages from %s":        "Importados %d de %d mensajes desde %s",
+		"Usage of %s:\n":                            "Uso de %s:\n",
+		"Discarding unreadable search index":        "Descartando índice de búsqueda ilegible",
+		"Error saving search index":                 "Error al guardar el índice de búsqueda",
+		"Dropped direct link to distant peer %s":    "Cerrado el enlace directo con el par lejano %s",
+		"Discarding unreadable metadata":            "Descartando metadatos ilegibles",
+		"Error saving metadata":                     "Error al guardar los metadatos",
+		"Topic: %s":                                 "Tema: %s",
+		"No topic set":                              "No hay tema",
+		"%s set the topic: %s":                      "%s cambió el tema: %s",
+		"%s has %d lines":                           "%s tiene %d líneas",
+		"%s has no line %d":                         "%s no tiene línea %d",
+		"Note %s is empty":                          "La nota %s está vacía",
+		"Note %s, %d lines":                         "Nota %s, %d líneas",
+		"Line %d: %s":                               "Línea %d: %s",
+		"No notes yet; try /note <name> add <text>": "Aún no hay notas; prueba /note <nombre> add <texto>",
+		"Notes: %s":                                 "Notas: %s",
+		"usage: /note %s %s <line> ...":             "uso: /note %s %s <línea> ...",
+		"bad line number %q":                        "número de línea no válido %q",
+		"unknown note command %q":                   "orden de nota desconocida %q",
+		"%s edited note %s":                         "%s editó la nota %s",
+		"poll: %s":                                  "encuesta: %s",
+		"POLL":                                      "ENCUESTA",
+		"Option %d":                                 "Opción %d",
+		"To vote":                                   "Para votar",
+		"Poll results":                              "Resultados",
+		"Usage: /poll \"question\" \"option\" \"option\" ...": "Uso: /poll \"pregunta\" \"opción\" \"opción\" ...",
+		"No poll %s":                                      "No existe la encuesta %s",
+		"Pick an option from 1 to %d":                     "Elige una opción del 1 al %d",
+		"Discarding unreadable reminders":                 "Descartando recordatorios ilegibles",
+		"Error saving reminders":                          "Error al guardar los recordatorios",
+		"Usage: /remind me|#channel in <duration> <text>": "Uso: /remind me|#canal in <duración> <texto>",
+		"Bad duration %q (try 30m, 2h, 1d)":               "Duración no válida %q (prueba 30m, 2h, 1d)",
+		"Will remind %s at %s":                            "Se recordará a %s el %s",
+		"No reminders":                                    "No hay recordatorios",
+		"No reminder %s":                                  "No existe el recordatorio %s",
+		"Cancelled reminder: %s":                          "Recordatorio cancelado: %s",
+		" (due %s)":                                       " (para %s)",
+		"Reminder%s: %s":                                  "Recordatorio%s: %s",
+		"[Reminder%s] %s":                                 "[Recordatorio%s] %s",
+		"Error compacting history":                        "Error al compactar el historial",
+		"Error archiving history":                         "Error al archivar el historial",
+		"Compacted history: pruned %d messages":           "Historial compactado: %d mensajes eliminados",
+		"Status: %s":                                      "Estado: %s",
+		"Unable to get hostname:":                         "No se puede obtener el nombre del equipo:",
+		"Unable to determine local ip:":                   "No se puede determinar la IP local:",
+		"%s nicknamed %s":                                 "%s ahora se llama %s",
+		"Closed connection to %s":                         "Conexión con %s cerrada",
+		"Dialing %s":                                      "Conectando con %s",
+		"Error dialing":                                   "Error al conectar",
+		"Connected to %s":                                 "Conectado a %s",
+		"Error encoding message":                          "Error al codificar el mensaje",
+		"Nothing to export with history disabled":         "No hay nada que exportar con el historial desactivado",
+		"Unable to export history:":                       "No se puede exportar el historial:",
+		"Exported %d messages to %s":                      "Exportados %d mensajes a %s",
+		"Invalid listen port (%s)":                        "Puerto de escucha no válido (%s)",
+		"Dashboard on http://%s/":                         "Panel en http://%s/",
+		"Local address: %s":                               "Dirección local: %s",
+		"Listening on %s":                                 "Escuchando en %s",
+		"Error on accept":                                 "Error al aceptar",
+		"Listen port":                                     "Puerto de escucha",
+		"Write history to an HTML page and exit":          "Escribir el historial en una página HTML y salir",
+		"Prune history older than this many days (0 keeps everything)":                                            "Borrar el historial con más de estos días (0 lo conserva todo)",
+		"Keep a room's history to its own limits, e.g. \"#ops=7d,50mb\" (\"#\" is the main room; repeatable)":     "Limitar el historial de una sala por separado, p. ej. \"#ops=7d,50mb\" (\"#\" es la sala principal; repetible)",
+		"want #room=<days>d,<size>mb, not %q":                                                                     "se esperaba #sala=<días>d,<tamaño>mb, no %q",
+		"bad size %q":                                                                                             "tamaño no válido %q",
+		"bad age %q":                                                                                              "antigüedad no válida %q",
+		"Usage: /ephemeral <duration> <text>":                                                                     "Uso: /ephemeral <duración> <texto>",
+		"Prune the oldest history beyond this many megabytes (0 for no limit)":                                    "Borrar el historial más antiguo que supere estos megabytes (0 sin límite)",
+		"Append pruned history to this file instead of discarding it":                                             "Añadir el historial borrado a este archivo en lugar de descartarlo",
+		"Serve a web stats dashboard on this address (e.g. localhost:8080)":                                       "Servir un panel web de estadísticas en esta dirección (p. ej. localhost:8080)",
+		"Peers tracked individually in metrics before the rest are grouped as \"other\"":                          "Pares con métricas propias antes de agrupar el resto como \"other\"",
+		"Record the relay path of each message for /trace":                                                        "Registrar la ruta de cada mensaje para /trace",
+		"Relay each message to at most this many peers (0 relays to all)":                                         "Reenviar cada mensaje a lo sumo a estos pares (0 a todos)",
+		"Direct connections to keep to distant peers, reaching the rest through relays (-1 for no limit)":         "Conexiones directas a mantener con pares lejanos; el resto se alcanza por reenvío (-1 sin límite)",
+		"Relay strategy: \"flood\" pushes every message, \"digest\" pushes to a few peers and lets the rest pull": "Estrategia de reenvío: \"flood\" envía cada mensaje, \"digest\" lo envía a unos pocos pares y el resto lo pide",
+		"Shell command that translates stdin to stdout, e.g. \"trans -b :en\"":                                    "Orden de shell que traduce stdin a stdout, p. ej. \"trans -b :en\"",
+		"LibreTranslate-compatible endpoint for translating incoming messages":                                    "Servicio compatible con LibreTranslate para traducir los mensajes entrantes",
+		"Language to translate incoming messages into":                                                            "Idioma al que traducir los mensajes entrantes",
+		"Comma-separated languages to translate from (default: any)":                                              "Idiomas de origen separados por comas (por defecto: cualquiera)",
+		"Speak incoming messages by piping them to this command, e.g. \"espeak --stdin\"":                         "Leer en voz alta los mensajes entrantes con esta orden, p. ej. \"espeak --stdin\"",
+		"Screen-reader-friendly output: no color or decoration":                                                   "Salida apta para lectores de pantalla: sin color ni adornos",
+		"Language for prompts and help, e.g. \"de\" or \"es\" (default: from $LANG)":                              "Idioma de los avisos y la ayuda, p. ej. \"de\" o \"es\" (por defecto: según $LANG)",
+		"Error writing file":                                "Error al escribir el archivo",
+		"Wrote topology (%d nodes, %d edges) to %s":         "Topología escrita (%d nodos, %d enlaces) en %s",
+		"No message %s":                                     "No existe el mensaje %s",
+		"No path recorded for %s (start peers with -trace)": "No hay ruta registrada para %s (inicia los pares con -trace)",
+		"%s: %s (%d hops)":                                  "%s: %s (%d saltos)",
+		"translated":                                        "traducido",
+		"Translation":                                       "Traducción",
+		"Translation from %s":                               "Traducción del %s",
+		"Error running TTS command":                         "Error al ejecutar la orden de voz",
+		"%s says: %s":                                       "%s dice: %s",
+		"Speech is off (start with -tts-cmd)":               "La voz está desactivada (inicia con -tts-cmd)",
+		"Speech muted":                                      "Voz silenciada",
+		"Speech unmuted":                                    "Voz activada",
+		"No peers":                                          "No hay pares",
+		"rtt n/a":                                           "rtt n/d",
+		"rtt min/avg/p95 %v/%v/%v":                          "rtt mín/media/p95 %v/%v/%v",
+		"Error encoding frame":                              "Error al codificar la trama",
+		"Ignoring unknown frame":                            "Ignorando trama desconocida",
+		"expected #channel=template, got %q":                "se esperaba #canal=plantilla, se recibió %q",
+		"Error rendering message":                           "Error al mostrar el mensaje",
+		"Go template for chat lines, e.g. '{{time \"15:04\" .Timestamp}} {{.Nick}}: {{.Body}}'; prefix with #channel= to set one channel's (repeatable)": "Plantilla Go para las líneas de chat, p. ej. '{{time \"15:04\" .Timestamp}} {{.Nick}}: {{.Body}}'; con el prefijo #canal= se aplica a un canal (repetible)",
+		"unterminated string":        "cadena sin terminar",
+		"unexpected %q":              "%q inesperado",
+		"missing )":                  "falta )",
+		"expected a field or string": "se esperaba un campo o una cadena",
+		"expected -> action":         "se esperaba -> acción",
+		"unknown action %q (want show, notify or drop)": "acción desconocida %q (show, notify o drop)",
+		"unexpected %q after action":                    "%q inesperado tras la acción",
+		"line %d: %s: %v":                               "línea %d: %s: %v",
+		"No filters (rules go in %s)":                   "No hay filtros (las reglas van en %s)",
+		"Error loading filters":                         "Error al cargar los filtros",
+		"Unable to load filters:":                       "No se pueden cargar los filtros:",
+		"unknown middleware %q":                         "middleware desconocido %q",
+		"Not sent: %v":                                  "No enviado: %v",
+		"expected #channel=text, got %q":                "se esperaba #canal=texto, se recibió %q",
+		"empty signature":                               "firma vacía",
+		"Add a step to the outgoing message pipeline: emoji, capitalize, redact[=regexp], signature=[#channel=]text (repeatable, applied in order)": "Añadir un paso al procesado de mensajes salientes: emoji, capitalize, redact[=regexp], signature=[#canal=]texto (repetible, en orden)",
+		"Use a separate named profile with its own history, settings and peers":                                                                     "Usar un perfil con nombre propio, con su historial, ajustes y pares",
+		"Message history store (default: history.db in the profile; empty to disable)":                                                              "Almacén de historial (por defecto: history.db en el perfil; vacío para desactivar)",
+		"File of inbound filter rules, e.g. 'from == spammer -> drop' (default: filters in the profile)":                                            "Archivo de reglas de filtrado de entrada, p. ej. 'from == spammer -> drop' (por defecto: filters en el perfil)",
+		"Invalid profile name (%s)":      "Nombre de perfil no válido (%s)",
+		"Unable to load profile:":        "No se puede cargar el perfil:",
+		"Profile: %s":                    "Perfil: %s",
+		"expected name=port, got %q":     "se esperaba nombre=puerto, se recibió %q",
+		"Joined network %s as %s":        "Unido a la red %s como %s",
+		"No network %s":                  "No existe la red %s",
+		"Talking on the primary network": "Hablando en la red principal",
+		"Talking on network %s":          "Hablando en la red %s",
+		"primary":                        "principal",
+		"%s on %s, %d peers":             "%s en %s, %d pares",
+		"Also join the mesh named name on this port, as name=port (repeatable)":               "Unirse también a la red llamada nombre en este puerto, como nombre=puerto (repetible)",
+		"Join as a throwaway guest, keeping everything in memory and writing nothing to disk": "Entrar como invitado temporal, todo en memoria y sin escribir nada en disco",
+		"Guest mode: nothing is saved, and peers see you as %s":                               "Modo invitado: no se guarda nada y los pares te ven como %s",
+		"%s joined as a guest":                      "%s se unió como invitado",
+		"Unable to read upgrade state:":             "No se pudo leer el estado de la actualización:",
+		"the new process exited before taking over": "el nuevo proceso terminó antes de tomar el relevo",
+		"timed out waiting for the new process":     "se agotó el tiempo esperando al nuevo proceso",
+		"Took over from the previous process":       "Relevo tomado del proceso anterior",
+		"Upgrading: starting %s":                    "Actualizando: iniciando %s",
+		"Handed over to process %d":                 "Relevo entregado al proceso %d",
+		"Error upgrading":                           "Error al actualizar",
+		"Installed task %s":                         "Tarea %s instalada",
+		"Installed %s":                              "Instalado %s",
+		"Data in %s, log in %s":                     "Datos en %s, registro en %s",
+		"Removed %s":                                "Eliminado %s",
+		"Usage: sweetnothings service install [flags] | start | stop | uninstall": "Uso: sweetnothings service install [opciones] | start | stop | uninstall",
+		"Error starting LAN discovery":                                            "Error al iniciar el descubrimiento en la red local",
+		"Error reading LAN discovery":                                             "Error al leer el descubrimiento en la red local",
+		"Looking for peers on the local network":                                  "Buscando pares en la red local",
+		"Found %s on the local network":                                           "Encontrado %s en la red local",
+		"Error sending beacons":                                                   "Error al enviar balizas",
+		"Error reading beacons":                                                   "Error al leer balizas",
+		"Sending beacons, but not listening for them: %s":                         "Enviando balizas, pero sin escucharlas: %s",
+		"Listening for beacons on UDP port %d":                                    "Escuchando balizas en el puerto UDP %d",
+		"Heard a beacon from %s":                                                  "Baliza recibida de %s",
+		"Error starting DHT":                                                      "Error al iniciar la DHT",
+		"Error joining DHT":                                                       "Error al unirse a la DHT",
+		"DHT node on UDP port %d":                                                 "Nodo DHT en el puerto UDP %d",
+		"%s registered, introducing %d peers":                                     "%s se registró, presentando %d pares",
+		"%s introduced %d peers":                                                  "%s presentó %d pares",
+		"Rendezvous mode: introducing peers only":                                 "Modo punto de encuentro: solo se presentan pares",
+		"-cert and -key go together":                                              "-cert y -key van juntos",
+		"no certificates found in the CA file":                                    "no se encontraron certificados en el archivo de la CA",
+		"Generated a self-signed certificate in %s":                               "Se generó un certificado autofirmado en %s",
+		"Unable to set up TLS:":                                                   "No se pudo configurar TLS:",
+		"Pick one of -tls and -noise":                                             "Elige -tls o -noise, no ambos",
+		"Unable to load the node key:":                                            "No se pudo cargar la clave del nodo:",
+		"Node key %s":                                                             "Clave del nodo %s",
+		"[encrypted for others]":                                                  "[cifrado para otros]",
+		"identity key is the wrong size":                                          "la clave de identidad tiene un tamaño incorrecto",
+		"bad signature":                                                           "firma no válida",
+		"unsigned message from an address that signs":                             "mensaje sin firmar de una dirección que firma",
+		"Rejected message":                                                        "Mensaje rechazado",
+		"Unable to load the identity key:":                                        "No se pudo cargar la clave de identidad:",
+		"Identity %s":                                                             "Identidad %s",
+		"Discarding unreadable known keys":                                        "Descartando claves conocidas ilegibles",
+		"Error saving known keys":                                                 "Error al guardar las claves conocidas",
+		"WARNING: %s is signing with a new key %s instead of %s. Someone may be impersonating them, so their messages are being dropped.": "ADVERTENCIA: %s firma con una clave nueva %s en lugar de %s. Puede que alguien se esté haciendo pasar por esa persona, así que sus mensajes se descartan.",
+		"If they really changed keys, confirm the new fingerprint with them and run /verify %s %s":                                        "Si de verdad cambió de clave, confirma la nueva huella con esa persona y ejecuta /verify %s %s",
+		"Give the whole fingerprint, %d characters, to accept a changed key":                                                              "Da la huella completa, %d caracteres, para aceptar una clave cambiada",
+		"Warning: %s": "Advertencia: %s",
+		"Give at least the first 8 characters of the fingerprint": "Indica al menos los primeros 8 caracteres de la huella",
+		"No key known for %s": "No se conoce ninguna clave de %s",
+		"Verified %s as %s":   "%s verificado como %s",
+		"Accepted the new key for %s and verified it as %s":                "Se aceptó la nueva clave de %s y se verificó como %s",
+		"%s doesn't match the key %s uses (%s)":                            "%s no coincide con la clave que usa %s (%s)",
+		"No known keys":                                                    "No hay claves conocidas",
+		"unverified":                                                       "sin verificar",
+		"verified":                                                         "verificado",
+		"KEY CHANGED":                                                      "CLAVE CAMBIADA",
+		"WebSocket connection from %s":                                     "Conexión WebSocket desde %s",
+		"WebSocket endpoint on %s://%s:%s/":                                "Punto de acceso WebSocket en %s://%s:%s/",
+		"Error serving WebSockets":                                         "Error al servir WebSockets",
+		"Pick one of -quic and -noise":                                     "Elige entre -quic y -noise",
+		"This build has no QUIC support; rebuild with -tags quic":          "Esta compilación no admite QUIC; vuelve a compilar con -tags quic",
+		"Listening for QUIC on udp %s":                                     "Escuchando QUIC en udp %s",
+		"nothing to send":                                                  "no hay nada que enviar",
+		"not sent":                                                         "no enviado",
+		"no address to dial":                                               "no hay dirección a la que llamar",
+		"nothing to run":                                                   "no hay nada que ejecutar",
+		"unknown command %q":                                               "comando desconocido %q",
+		"Another instance is using %s; no control socket":                  "Otra instancia está usando %s; sin socket de control",
+		"Error opening control socket":                                     "Error al abrir el socket de control",
+		"Refused a control connection from another user":                   "Se rechazó una conexión de control de otro usuario",
+		"Control command failed":                                           "Falló un comando de control",
+		"Usage: /dial <addr>":                                              "Uso: /dial <dirección>",
+		"Control socket at %s":                                             "Socket de control en %s",
+		"Error on control socket":                                          "Error en el socket de control",
+		"unsupported proxy %q; only socks5:// is":                          "proxy no admitido %q; solo se admite socks5://",
+		"QUIC runs over UDP, which -proxy can't carry":                     "QUIC usa UDP, que -proxy no puede transportar",
+		"the router mapped port %d instead of %d":                          "el router asignó el puerto %d en lugar de %d",
+		"%s isn't a private address; not mapping ports":                    "%s no es una dirección privada; no se redirigen puertos",
+		"No port mapping: %v":                                              "Sin redirección de puertos: %v",
+		"Mapped our ports with %s; peers can reach us at %s":               "Puertos redirigidos con %s; los pares pueden encontrarnos en %s",
+		"Couldn't renew port mapping: %v":                                  "No se pudo renovar la redirección de puertos: %v",
+		"Reaching %s over the link it made to us":                          "Llegando a %s por el enlace que abrió hacia nosotros",
+		"Asking %d peers to help us reach %s":                              "Pidiendo a %d pares que nos ayuden a llegar a %s",
+		"Helping %s and %s connect directly":                               "Ayudando a %s y %s a conectarse directamente",
+		"Punched through to %s":                                            "Conexión directa abierta con %s",
+		"Couldn't punch through to %s; messages still reach it through %s": "No se pudo abrir una conexión directa con %s; los mensajes siguen llegando a través de %s",
+		"%s is a relay":                                                    "%s es un relé",
+		"No relays":                                                        "No hay relés",
+		"Relay %s":                                                         "Relé %s",
+		"Nothing relayed yet":                                              "Todavía no se ha retransmitido nada",
+		"forwarded %d bytes in %d frames, delivered %d bytes, dropped %d, since %s": "reenviados %d bytes en %d tramas, entregados %d bytes, descartados %d, desde las %s",
+		"Discarding unreadable rooms": "Descartando salas ilegibles",
+		"Error saving rooms":          "Error al guardar las salas",
+		"Joined %s":                   "Te has unido a %s",
+		"Talking in %s":               "Hablando en %s",
+		"Not in %s":                   "No estás en %s",
+		"Left %s":                     "Has salido de %s",
+		"the main room":               "la sala principal",
+		"Usage: /msg <peer> <text>":   "Uso: /msg <par> <texto>",
+		"No key for %s yet, so we can't message them privately": "Todavía no tenemos la clave de %s, así que no podemos enviarle mensajes privados",
+		"Couldn't reach %s; message not sent":                   "No se pudo contactar con %s; mensaje no enviado",
+		"Unreadable private message":                            "Mensaje privado ilegible",
+		"from %s":                                               "de %s",
+		"to %s":                                                 "para %s",
+		"Private message %s":                                    "Mensaje privado %s",
+		"DM":                                                    "MP",
+		"Unknown emoji %s":                                      "Emoji desconocido %s",
+		"Reactions":                                             "Reacciones",
+		"Usage: /react <id> :emoji:":                            "Uso: /react <id> :emoji:",
+		"You can only change your own messages":                 "Solo puedes cambiar tus propios mensajes",
+		"%s was deleted":                                        "%s se eliminó",
+		"Usage: /edit <id> <new text>":                          "Uso: /edit <id> <texto nuevo>",
+		"Deleted":                                               "Eliminado",
+		"%s deleted a message from %s":                          "%s eliminó un mensaje de las %s",
+		"(edited)":                                              "(editado)",
+		"mentions you: %s":                                      "te menciona: %s",
+		"Usage: /emoji <query>":                                 "Uso: /emoji <búsqueda>",
+		"No emoji matching %s":                                  "Ningún emoji coincide con %s",
+		"%s: %d%% (%s of %s)":                                   "%s: %d%% (%s de %s)",
+		"Usage: /sendfile <peer> <path>":                        "Uso: /sendfile <par> <ruta>",
+		"Can't send %s: %v":                                     "No se puede enviar %s: %v",
+		"Can't send %s: not a file":                             "No se puede enviar %s: no es un archivo",
+		"Couldn't reach %s to offer %s":                         "No se pudo contactar con %s para ofrecerle %s",
+		"Offered %s (%s) to %s; waiting for them to accept": "Ofrecido %s (%s) a %s; esperando a que lo acepte",
+		"%s wants to send you %s (%s)":                      "%s quiere enviarte %s (%s)",
+		"To accept":                                         "Para aceptar",
+		"No file offer %s":                                  "No hay oferta de archivo %s",
+		"Can't save to %s: %v":                              "No se puede guardar en %s: %v",
+		"Couldn't reach %s to accept %s":                    "No se pudo contactar con %s para aceptar %s",
+		"Receiving %s into %s":                              "Recibiendo %s en %s",
+		"Declined %s":                                       "Rechazado %s",
+		"No transfer %s":                                    "No hay transferencia %s",
+		"Cancelled the transfer of %s":                      "Cancelada la transferencia de %s",
+		"%s accepted %s":                                    "%s aceptó %s",
+		"%s declined %s":                                    "%s rechazó %s",
+		"%s cancelled the transfer of %s":                   "%s canceló la transferencia de %s",
+		"Lost touch with %s while sending %s":               "Se perdió el contacto con %s mientras se enviaba %s",
+		"Sent %s to %s":                                     "Enviado %s a %s",
+		"Can't save %s: %v":                                 "No se puede guardar %s: %v",
+		"%s arrived damaged and was discarded":              "%s llegó dañado y se descartó",
+		"Saved %s from %s to %s":                            "Guardado %s de %s en %s",
+		"No file transfers":                                 "No hay transferencias de archivos",
+		"waiting":                                           "esperando",
+		"Link":                                              "Enlace",
+		"%s is typing…":                                     "%s está escribiendo…",
+		"No receipts for %s":                                "No hay acuses para %s",
+		"%s delivered to %d":                                "%s entregado a %d",
+		"Delivered":                                         "Entregado",
+		"Read":                                              "Leído",
+		"%s read at %s":                                     "%s lo leyó a las %s",
+		"You're away":                                       "Estás ausente",
+		"You're back":                                       "Has vuelto",
+		"%s is away: %s":                                    "%s está ausente: %s",
+		"%s is away":                                        "%s está ausente",
+		"%s is back":                                        "%s ha vuelto",
+		"online":                                            "conectado",
+		"away":                                              "ausente",
+		"offline":                                           "desconectado",
+		"Haven't seen %s":                                   "No he visto a %s",
+		"%s is %s, last seen %s ago":                        "%s está %s, visto por última vez hace %s",
+		"idle":                                              "inactivo",
+		"outbound":                                          "saliente",
+		"inbound":                                           "entrante",
+		"Connection":                                        "Conexión",
+		"%s %s since %s (%v), %d messages in, %d out, %s": "%s %s desde las %s (%v), %d mensajes recibidos, %d enviados, %s",
+		"%s left: %s": "%s se fue: %s",
+		"%s left":     "%s se fue",
+		"Peer speaks protocol versions we don't; not connecting":                                   "El par habla versiones de protocolo que no hablamos; no se conecta",
+		"Peer sent no handshake and is probably running an older version; dropping the connection": "El par no envió saludo inicial y probablemente usa una versión anterior; se cierra la conexión",
+		"Peer speaks protocol versions we don't; dropping the connection":                          "El par habla versiones de protocolo que no hablamos; se cierra la conexión",
+		"Usage: /export <file> [#room] [from] [to] [private]":                                      "Uso: /export <archivo> [#sala] [desde] [hasta] [private]",
+		"%s goes by %s":                               "%s se hace llamar %s",
+		"Client":                                      "Cliente",
+		"version %s, protocol %d, features: %s":       "versión %s, protocolo %d, funciones: %s",
+		"You go by %s":                                "Te haces llamar %s",
+		"Usage: /nick <name>":                         "Uso: /nick <nombre>",
+		"Error saving profile":                        "Error al guardar el perfil",
+		"You now go by %s":                            "Ahora te haces llamar %s",
+		"%s now goes by %s":                           "%s ahora se hace llamar %s",
+		"Usage: /backfill [n]":                        "Uso: /backfill [n]",
+		"Asking %s for earlier messages":              "Pidiendo a %s mensajes anteriores",
+		"%d earlier messages from %s:":                "%d mensajes anteriores de %s:",
+		"End of earlier messages":                     "Fin de los mensajes anteriores",
+		"Nothing from %s that we haven't seen":        "Nada de %s que no hayamos visto",
+		"Usage: /history [n|more]":                    "Uso: /history [n|more]",
+		"No earlier messages":                         "No hay mensajes anteriores",
+		"/history more for earlier messages":          "/history more para ver mensajes anteriores",
+		"Usage: /search <terms>":                      "Uso: /search <términos>",
+		"Nothing matches %q":                          "Nada coincide con %q",
+		"%d messages match %q; showing the latest %d": "%d mensajes coinciden con %q; se muestran los %d más recientes",
+		"%d messages match %q":                        "%d mensajes coinciden con %q",
+		"%q isn't a date like 2006-01-02":             "%q no es una fecha como 2006-01-02",
+		"unknown export format %q":                    "formato de exportación desconocido %q",
+		"Unable to export history: %v":                "No se puede exportar el historial: %v",
+		"Usage: sweetnothings export [flags] <file>":  "Uso: sweetnothings export [opciones] <archivo>",
+		"Unable to open log file:":                    "No se puede abrir el archivo de registro:",
+		"Error serving metrics":                       "Error al servir las métricas",
+		"Metrics on http://%s/metrics":                "Métricas en http://%s/metrics",
+		"Up %v, %d peers":                             "Activo desde hace %v, %d pares",
+		"Messages":                                    "Mensajes",
+		"%d sent, %d received, %d relayed, %d duplicates suppressed, %d dropped": "%d enviados, %d recibidos, %d retransmitidos, %d duplicados suprimidos, %d descartados",
+		"Dedup": "Duplicados",
+		"%d message IDs remembered, %d failed dials":                                    "%d ID de mensajes recordados, %d conexiones fallidas",
+		"%s: %d/%d messages in/out, %s in (%s/s), %s out (%s/s), %d queued, %d dropped": "%s: %d/%d mensajes entrantes/salientes, %s entrantes (%s/s), %s salientes (%s/s), %d en cola, %d descartados",
+		"Peer":                  "Par",
+		"Lost %s; reconnecting": "Se perdió %s; reconectando",
+		"Gave up reconnecting to %s after %d tries":                    "Se dejó de reconectar con %s tras %d intentos",
+		"Stopped reconnecting to %s":                                   "Se dejó de reconectar con %s",
+		"Won't reconnect to %s if its link drops":                      "No se reconectará con %s si se cae el enlace",
+		"Usage: /forget <peer>":                                        "Uso: /forget <par>",
+		"%s stopped answering; dropping the link":                      "%s dejó de responder; se cierra el enlace",
+		"Discarding unreadable outbox":                                 "Descartando bandeja de salida ilegible",
+		"Error saving outbox":                                          "Error al guardar la bandeja de salida",
+		"Sending %s %d messages that waited for it":                    "Enviando a %s %d mensajes que lo esperaban",
+		"Discarding unreadable peer list":                              "Descartando lista de pares ilegible",
+		"Error saving peer list":                                       "Error al guardar la lista de pares",
+		"Redialing %d peers from last time":                            "Volviendo a conectar con %d pares de la última vez",
+		"-drop-policy must be %q or %q":                                "-drop-policy debe ser %q o %q",
+		"unknown compression %q":                                       "compresión desconocida %q",
+		"Can't read compressed link; dropping the connection":          "No se puede leer el enlace comprimido; cerrando la conexión",
+		"unknown encoding %q":                                          "codificación desconocida %q",
+		"Can't read the link's encoding; dropping the connection":      "No se puede leer la codificación del enlace; cerrando la conexión",
+		"compression must start before the encoding changes":           "la compresión debe empezar antes de cambiar la codificación",
+		"-encoding must be one of %s":                                  "-encoding debe ser uno de %s",
+		"Skipping a frame that won't decode":                           "Se omite un marco que no se puede decodificar",
+		"Skipping a frame longer than -max-frame":                      "Se omite un marco más largo que -max-frame",
+		"%s is sending too fast; muted for %v":                         "%s envía demasiado rápido; silenciado durante %v",
+		"%s is sending too fast; dropping some of its messages":        "%s envía demasiado rápido; se descartan algunos de sus mensajes",
+		"-rate-action must be %q or %q":                                "-rate-action debe ser %q o %q",
+		"Limits":                                                       "Límites",
+		"%d messages over -peer-rate dropped, %d relays throttled":     "%d mensajes por encima de -peer-rate descartados, %d reenvíos frenados",
+		"Relaying more than -relay-limit; holding some messages back":  "Reenviando más de -relay-limit; se retienen algunos mensajes",
+		"Not ignoring anyone":                                          "No ignoras a nadie",
+		"Ignoring":                                                     "Ignorado",
+		"Not blocking anyone":                                          "No bloqueas a nadie",
+		"Blocked":                                                      "Bloqueado",
+		"Ignoring %s; their messages are still relayed":                "Ignorando a %s; sus mensajes se siguen reenviando",
+		"No longer ignoring %s":                                        "Ya no ignoras a %s",
+		"Blocked %s":                                                   "%s bloqueado",
+		"Unblocked %s":                                                 "%s desbloqueado",
+		"Refusing a connection the access lists don't allow":           "Se rechaza una conexión que las listas de acceso no permiten",
+		"Not dialing a peer the access lists don't allow":              "No se marca a un par que las listas de acceso no permiten",
+		"message is %d bytes, over -max-body of %d":                    "el mensaje tiene %d bytes, más que -max-body de %d",
+		"Cut the message to %d bytes to fit -max-body":                 "Mensaje recortado a %d bytes para caber en -max-body",
+		"Message over -max-body":                                       "Mensaje más largo que -max-body",
+		"-body-action must be %q or %q":                                "-body-action debe ser %q o %q",
+		"a node has already run in this process":                       "ya se ejecutó un nodo en este proceso",
+		"No node to attach to:":                                        "No hay ningún nodo al que conectarse:",
+		"Attached to %s; Ctrl-D detaches and /quit stops the node":     "Conectado a %s; Ctrl-D se desconecta y /quit detiene el nodo",
+		"Detached; the node is still running":                          "Desconectado; el nodo sigue en marcha",
+		"The node stopped":                                             "El nodo se detuvo",
+		"The daemon didn't start":                                      "El demonio no arrancó",
+		"Started the daemon (pid %d); sweetnothings attach to use it":  "Demonio iniciado (pid %d); usa sweetnothings attach para conectarte",
+		"The daemon (pid %d) is still starting":                        "El demonio (pid %d) todavía está arrancando",
+		"No daemon mode on Windows; use sweetnothings service install": "No hay modo demonio en Windows; usa sweetnothings service install",
+		"A daemon needs a control socket to attach to":                 "Un demonio necesita un socket de control al que conectarse",
+		"A node is already running on %s":                              "Ya hay un nodo en marcha en %s",
+	},
+	"de": {
+		"you":                                       "du",
+		"Usage: /ask <text>":                        "Verwendung: /ask <Text>",
+		"Asked %d peers to acknowledge %s":          "%d Peers um Bestätigung von %s gebeten",
+		"asking for acknowledgment: %s":             "bittet um Bestätigung: %s",
+		"ACK?":                                      "OK?",
+		"To acknowledge":                            "Zum Bestätigen",
+		"Nothing to acknowledge":                    "Nichts zu bestätigen",
+		"Acknowledged %s: %s":                       "Bestätigt %s: %s",
+		"%s acknowledged \"%s\" (%d/%d)":            "%s hat \"%s\" bestätigt (%d/%d)",
+		"You haven't asked anything":                "Du hast nichts gefragt",
+		"%s \"%s\" acked: %s; waiting on: %s":       "%s \"%s\" bestätigt von: %s; ausstehend: %s",
+		"nobody":                                    "niemand",
+		"%s isn't pinned":                           "%s ist nicht angeheftet",
+		"Nothing pinned":                            "Nichts angeheftet",
+		"%s unpinned %s":                            "%s hat %s losgelöst",
+		"%s pinned %s":                              "%s hat %s angeheftet",
+		"unknown gossip mode %q":                    "unbekannter Gossip-Modus %q",
+		"Unable to find home directory:":            "Home-Verzeichnis nicht gefunden:",
+		"Skipping bad history line":                 "Überspringe fehlerhafte Verlaufszeile",
+		"Error writing history":                     "Fehler beim Schreiben des Verlaufs",
+		"Unable to open history:":                   "Verlauf kann nicht geöffnet werden:",
+		"Indexed %d new messages":                   "%d neue Nachrichten indiziert",
+		"History is disabled":                       "Der Verlauf ist deaktiviert",
+		"Rebuilt search index over %d messages":     "Suchindex über %d Nachrichten neu aufgebaut",
+		"Error opening file":                        "Fehler beim Öffnen der Datei",
+		"Error reading file":                        "Fehler beim Lesen der Datei",
+		"Imported %d of %d messages from %s":        "%d von %d Nachrichten aus %s importiert",
+		"Usage of %s:\n":                            "Verwendung von %s:\n",
+		"Discarding unreadable search index":        "Verwerfe unlesbaren Suchindex",
+		"Error saving search index":                 "Fehler beim Speichern des Suchindex",
+		"Dropped direct link to distant peer %s":    "Direkte Verbindung zum entfernten Peer %s getrennt",
+		"Discarding unreadable metadata":            "Verwerfe unlesbare Metadaten",
+		"Error saving metadata":                     "Fehler beim Speichern der Metadaten",
+		"Topic: %s":                                 "Thema: %s",
+		"No topic set":                              "Kein Thema gesetzt",
+		"%s set the topic: %s":                      "%s hat das Thema gesetzt: %s",
+		"%s has %d lines":                           "%s hat %d Zeilen",
+		"%s has no line %d":                         "%s hat keine Zeile %d",
+		"Note %s is empty":                          "Notiz %s ist leer",
+		"Note %s, %d lines":                         "Notiz %s, %d Zeilen",
+		"Line %d: %s":                               "Zeile %d: %s",
+		"No notes yet; try /note <name> add <text>": "Noch keine Notizen; versuch /note <Name> add <Text>",
+		"Notes: %s":                                 "Notizen: %s",
+		"usage: /note %s %s <line> ...":             "Verwendung: /note %s %s <Zeile> ...",
+		"bad line number %q":                        "ungültige Zeilennummer %q",
+		"unknown note command %q":                   "unbekannter Notizbefehl %q",
+		"%s edited note %s":                         "%s hat Notiz %s bearbeitet",
+		"poll: %s":                                  "Umfrage: %s",
+		"POLL":                                      "UMFRAGE",
+		"Option %d":                                 "Option %d",
+		"To vote":                                   "Zum Abstimmen",
+		"Poll results":                              "Ergebnis",
+		"Usage: /poll \"question\" \"option\" \"option\" ...": "Verwendung: /poll \"Frage\" \"Option\" \"Option\" ...",
+		"No poll %s":                                      "Keine Umfrage %s",
+		"Pick an option from 1 to %d":                     "Wähle eine Option von 1 bis %d",
+		"Discarding unreadable reminders":                 "Verwerfe unlesbare Erinnerungen",
+		"Error saving reminders":                          "Fehler beim Speichern der Erinnerungen",
+		"Usage: /remind me|#channel in <duration> <text>": "Verwendung: /remind me|#Kanal in <Dauer> <Text>",
+		"Bad duration %q (try 30m, 2h, 1d)":               "Ungültige Dauer %q (z.B. 30m, 2h, 1d)",
+		"Will remind %s at %s":                            "Erinnere %s um %s",
+		"No reminders":                                    "Keine Erinnerungen",
+		"No reminder %s":                                  "Keine Erinnerung %s",
+		"Cancelled reminder: %s":                          "Erinnerung gelöscht: %s",
+		" (due %s)":                                       " (fällig %s)",
+		"Reminder%s: %s":                                  "Erinnerung%s: %s",
+		"[Reminder%s] %s":                                 "[Erinnerung%s] %s",
+		"Error compacting history":                        "Fehler beim Verdichten des Verlaufs",
+		"Error archiving history":                         "Fehler beim Archivieren des Verlaufs",
+		"Compacted history: pruned %d messages":           "Verlauf verdichtet: %d Nachrichten entfernt",
+		"Status: %s":                                      "Status: %s",
+		"Unable to get hostname:":                         "Hostname nicht verfügbar:",
+		"Unable to determine local ip:":                   "Lokale IP nicht ermittelbar:",
+		"%s nicknamed %s":                                 "%s heißt jetzt %s",
+		"Closed connection to %s":                         "Verbindung zu %s geschlossen",
+		"Dialing %s":                                      "Verbinde mit %s",
+		"Error dialing":                                   "Fehler beim Verbinden",
+		"Connected to %s":                                 "Verbunden mit %s",
+		"Error encoding message":                          "Fehler beim Kodieren der Nachricht",
+		"Nothing to export with history disabled":         "Bei deaktiviertem Verlauf gibt es nichts zu exportieren",
+		"Unable to export history:":                       "Verlauf kann nicht exportiert werden:",
+		"Exported %d messages to %s":                      "%d Nachrichten nach %s exportiert",
+		"Invalid listen port (%s)":                        "Ungültiger Port (%s)",
+		"Dashboard on http://%s/":                         "Dashboard unter http://%s/",
+		"Local address: %s":                               "Lokale Adresse: %s",
+		"Listening on %s":                                 "Lausche auf %s",
+		"Error on accept":                                 "Fehler beim Annehmen",
+		"Listen port":                                     "Port zum Lauschen",
+		"Write history to an HTML page and exit":          "Verlauf als HTML-Seite schreiben und beenden",
+		"Prune history older than this many days (0 keeps everything)":                                            "Verlauf älter als so viele Tage entfernen (0 behält alles)",
+		"Keep a room's history to its own limits, e.g. \"#ops=7d,50mb\" (\"#\" is the main room; repeatable)":     "Verlauf eines Raums eigens begrenzen, z.B. \"#ops=7d,50mb\" (\"#\" ist der Hauptraum; wiederholbar)",
+		"want #room=<days>d,<size>mb, not %q":                                                                     "erwartet #Raum=<Tage>d,<Größe>mb, nicht %q",
+		"bad size %q":                                                                                             "ungültige Größe %q",
+		"bad age %q":                                                                                              "ungültiges Alter %q",
+		"Usage: /ephemeral <duration> <text>":                                                                     "Verwendung: /ephemeral <Dauer> <Text>",
+		"Prune the oldest history beyond this many megabytes (0 for no limit)":                                    "Ältesten Verlauf über so viele Megabyte hinaus entfernen (0 ohne Grenze)",
+		"Append pruned history to this file instead of discarding it":                                             "Entfernten Verlauf an diese Datei anhängen statt ihn zu verwerfen",
+		"Serve a web stats dashboard on this address (e.g. localhost:8080)":                                       "Web-Statistik-Dashboard unter dieser Adresse anbieten (z.B. localhost:8080)",
+		"Peers tracked individually in metrics before the rest are grouped as \"other\"":                          "Peers mit eigenen Metriken, bevor der Rest als \"other\" zusammengefasst wird",
+		"Record the relay path of each message for /trace":                                                        "Weiterleitungspfad jeder Nachricht für /trace aufzeichnen",
+		"Relay each message to at most this many peers (0 relays to all)":                                         "Jede Nachricht an höchstens so viele Peers weiterleiten (0 an alle)",
+		"Direct connections to keep to distant peers, reaching the rest through relays (-1 for no limit)":         "Direkte Verbindungen zu entfernten Peers; der Rest wird über Weiterleitung erreicht (-1 ohne Grenze)",
+		"Relay strategy: \"flood\" pushes every message, \"digest\" pushes to a few peers and lets the rest pull": "Weiterleitung: \"flood\" schickt jede Nachricht, \"digest\" schickt an wenige Peers und der Rest holt sie ab",
+		"Shell command that translates stdin to stdout, e.g. \"trans -b :en\"":                                    "Shell-Befehl, der stdin nach stdout übersetzt, z.B. \"trans -b :en\"",
+		"LibreTranslate-compatible endpoint for translating incoming messages":                                    "LibreTranslate-kompatibler Dienst zum Übersetzen eingehender Nachrichten",
+		"Language to translate incoming messages into":                                                            "Sprache, in die eingehende Nachrichten übersetzt werden",
+		"Comma-separated languages to translate from (default: any)":                                              "Kommagetrennte Ausgangssprachen (Standard: alle)",
+		"Speak incoming messages by piping them to this command, e.g. \"espeak --stdin\"":                         "Eingehende Nachrichten über diesen Befehl vorlesen, z.B. \"espeak --stdin\"",
+		"Screen-reader-friendly output: no color or decoration":                                                   "Screenreader-freundliche Ausgabe: keine Farben oder Verzierungen",
+		"Language for prompts and help, e.g. \"de\" or \"es\" (default: from $LANG)":                              "Sprache für Meldungen und Hilfe, z.B. \"de\" oder \"es\" (Standard: aus $LANG)",
+		"Error writing file":                                "Fehler beim Schreiben der Datei",
+		"Wrote topology (%d nodes, %d edges) to %s":         "Topologie (%d Knoten, %d Kanten) nach %s geschrieben",
+		"No message %s":                                     "Keine Nachricht %s",
+		"No path recorded for %s (start peers with -trace)": "Kein Pfad für %s aufgezeichnet (Peers mit -trace starten)",
+		"%s: %s (%d hops)":                                  "%s: %s (%d Hops)",
+		"translated":                                        "übersetzt",
+		"Translation":                                       "Übersetzung",
+		"Translation from %s":                               "Übersetzung aus %s",
+		"Error running TTS command":                         "Fehler beim Ausführen des Sprachbefehls",
+		"%s says: %s":                                       "%s sagt: %s",
+		"Speech is off (start with -tts-cmd)":               "Sprachausgabe ist aus (mit -tts-cmd starten)",
+		"Speech muted":                                      "Sprachausgabe stumm",
+		"Speech unmuted":                                    "Sprachausgabe an",
+		"No peers":                                          "Keine Peers",
+		"rtt n/a":                                           "RTT n/v",
+		"rtt min/avg/p95 %v/%v/%v":                          "RTT min/mittel/p95 %v/%v/%v",
+		"Error encoding frame":                              "Fehler beim Kodieren des Frames",
+		"Ignoring unknown frame":                            "Ignoriere unbekannten Frame",
+		"expected #channel=template, got %q":                "#Kanal=Vorlage erwartet, %q erhalten",
+		"Error rendering message":                           "Fehler beim Darstellen der Nachricht",
+		"Go template for chat lines, e.g. '{{time \"15:04\" .Timestamp}} {{.Nick}}: {{.Body}}'; prefix with #channel= to set one channel's (repeatable)": "Go-Vorlage für Chatzeilen, z.B. '{{time \"15:04\" .Timestamp}} {{.Nick}}: {{.Body}}'; mit #Kanal= davor nur für einen Kanal (wiederholbar)",
+		"unterminated string":        "nicht abgeschlossene Zeichenkette",
+		"unexpected %q":              "unerwartetes %q",
+		"missing )":                  "fehlende )",
+		"expected a field or string": "Feld oder Zeichenkette erwartet",
+		"expected -> action":         "-> Aktion erwartet",
+		"unknown action %q (want show, notify or drop)": "unbekannte Aktion %q (show, notify oder drop)",
+		"unexpected %q after action":                    "unerwartetes %q nach der Aktion",
+		"line %d: %s: %v":                               "Zeile %d: %s: %v",
+		"No filters (rules go in %s)":                   "Keine Filter (Regeln gehören nach %s)",
+		"Error loading filters":                         "Fehler beim Laden der Filter",
+		"Unable to load filters:":                       "Filter können nicht geladen werden:",
+		"unknown middleware %q":                         "unbekannte Middleware %q",
+		"Not sent: %v":                                  "Nicht gesendet: %v",
+		"expected #channel=text, got %q":                "#Kanal=Text erwartet, %q erhalten",
+		"empty signature":                               "leere Signatur",
+		"Add a step to the outgoing message pipeline: emoji, capitalize, redact[=regexp], signature=[#channel=]text (repeatable, applied in order)": "Schritt zur Verarbeitung ausgehender Nachrichten hinzufügen: emoji, capitalize, redact[=Regexp], signature=[#Kanal=]Text (wiederholbar, in Reihenfolge)",
+		"Use a separate named profile with its own history, settings and peers":                                                                     "Ein benanntes Profil mit eigenem Verlauf, eigenen Einstellungen und Peers verwenden",
+		"Message history store (default: history.db in the profile; empty to disable)":                                                              "Verlaufsspeicher (Standard: history.db im Profil; leer zum Deaktivieren)",
+		"File of inbound filter rules, e.g. 'from == spammer -> drop' (default: filters in the profile)":                                            "Datei mit Eingangsfiltern, z.B. 'from == spammer -> drop' (Standard: filters im Profil)",
+		"Invalid profile name (%s)":      "Ungültiger Profilname (%s)",
+		"Unable to load profile:":        "Profil kann nicht geladen werden:",
+		"Profile: %s":                    "Profil: %s",
+		"expected name=port, got %q":     "Name=Port erwartet, %q erhalten",
+		"Joined network %s as %s":        "Netz %s als %s beigetreten",
+		"No network %s":                  "Kein Netz %s",
+		"Talking on the primary network": "Sprichst im Hauptnetz",
+		"Talking on network %s":          "Sprichst im Netz %s",
+		"primary":                        "Hauptnetz",
+		"%s on %s, %d peers":             "%s auf %s, %d Peers",
+		"Also join the mesh named name on this port, as name=port (repeatable)":               "Zusätzlich dem Netz namens Name auf diesem Port beitreten, als Name=Port (wiederholbar)",
+		"Join as a throwaway guest, keeping everything in memory and writing nothing to disk": "Als Wegwerf-Gast teilnehmen, alles nur im Speicher, nichts auf die Platte schreiben",
+		"Guest mode: nothing is saved, and peers see you as %s":                               "Gastmodus: nichts wird gespeichert, Peers sehen dich als %s",
+		"%s joined as a guest":                      "%s ist als Gast dabei",
+		"Unable to read upgrade state:":             "Upgrade-Zustand konnte nicht gelesen werden:",
+		"the new process exited before taking over": "der neue Prozess wurde vor der Übernahme beendet",
+		"timed out waiting for the new process":     "Zeitüberschreitung beim Warten auf den neuen Prozess",
+		"Took over from the previous process":       "Vom vorherigen Prozess übernommen",
+		"Upgrading: starting %s":                    "Upgrade: starte %s",
+		"Handed over to process %d":                 "An Prozess %d übergeben",
+		"Error upgrading":                           "Fehler beim Upgrade",
+		"Installed task %s":                         "Aufgabe %s installiert",
+		"Installed %s":                              "%s installiert",
+		"Data in %s, log in %s":                     "Daten in %s, Protokoll in %s",
+		"Removed %s":                                "%s entfernt",
+		"Usage: sweetnothings service install [flags] | start | stop | uninstall": "Aufruf: sweetnothings service install [Optionen] | start | stop | uninstall",
+		"Error starting LAN discovery":                                            "Fehler beim Starten der LAN-Suche",
+		"Error reading LAN discovery":                                             "Fehler beim Lesen der LAN-Suche",
+		"Looking for peers on the local network":                                  "Suche nach Peers im lokalen Netzwerk",
+		"Found %s on the local network":                                           "%s im lokalen Netzwerk gefunden",
+		"Error sending beacons":                                                   "Fehler beim Senden von Beacons",
+		"Error reading beacons":                                                   "Fehler beim Lesen von Beacons",
+		"Sending beacons, but not listening for them: %s":                         "Sende Beacons, höre aber nicht auf sie: %s",
+		"Listening for beacons on UDP port %d":                                    "Warte auf Beacons auf UDP-Port %d",
+		"Heard a beacon from %s":                                                  "Beacon von %s empfangen",
+		"Error starting DHT":                                                      "Fehler beim Starten der DHT",
+		"Error joining DHT":                                                       "Fehler beim Beitritt zur DHT",
+		"DHT node on UDP port %d":                                                 "DHT-Knoten auf UDP-Port %d",
+		"%s registered, introducing %d peers":                                     "%s hat sich registriert, stelle %d Peers vor",
+		"%s introduced %d peers":                                                  "%s hat %d Peers vorgestellt",
+		"Rendezvous mode: introducing peers only":                                 "Rendezvous-Modus: stelle nur Peers vor",
+		"-cert and -key go together":                                              "-cert und -key gehören zusammen",
+		"no certificates found in the CA file":                                    "keine Zertifikate in der CA-Datei gefunden",
+		"Generated a self-signed certificate in %s":                               "Selbstsigniertes Zertifikat in %s erzeugt",
+		"Unable to set up TLS:":                                                   "TLS konnte nicht eingerichtet werden:",
+		"Pick one of -tls and -noise":                                             "Entweder -tls oder -noise, nicht beides",
+		"Unable to load the node key:":                                            "Knotenschlüssel konnte nicht geladen werden:",
+		"Node key %s":                                                             "Knotenschlüssel %s",
+		"[encrypted for others]":                                                  "[für andere verschlüsselt]",
+		"identity key is the wrong size":                                          "der Identitätsschlüssel hat die falsche Größe",
+		"bad signature":                                                           "ungültige Signatur",
+		"unsigned message from an address that signs":                             "unsignierte Nachricht von einer Adresse, die signiert",
+		"Rejected message":                                                        "Nachricht abgelehnt",
+		"Unable to load the identity key:":                                        "Identitätsschlüssel konnte nicht geladen werden:",
+		"Identity %s":                                                             "Identität %s",
+		"Discarding unreadable known keys":                                        "Unlesbare bekannte Schlüssel verworfen",
+		"Error saving known keys":                                                 "Fehler beim Speichern der bekannten Schlüssel",
+		"WARNING: %s is signing with a new key %s instead of %s. Someone may be impersonating them, so their messages are being dropped.": "WARNUNG: %s signiert mit einem neuen Schlüssel %s statt %s. Möglicherweise gibt sich jemand als diese Person aus, deshalb werden ihre Nachrichten verworfen.",
+		"If they really changed keys, confirm the new fingerprint with them and run /verify %s %s":                                        "Falls der Schlüssel wirklich gewechselt wurde, bestätige den neuen Fingerabdruck direkt und führe /verify %s %s aus",
+		"Give the whole fingerprint, %d characters, to accept a changed key":                                                              "Gib den ganzen Fingerabdruck an, %d Zeichen, um einen geänderten Schlüssel anzunehmen",
+		"Warning: %s": "Warnung: %s",
+		"Give at least the first 8 characters of the fingerprint": "Gib mindestens die ersten 8 Zeichen des Fingerabdrucks an",
+		"No key known for %s": "Kein Schlüssel für %s bekannt",
+		"Verified %s as %s":   "%s als %s verifiziert",
+		"Accepted the new key for %s and verified it as %s":                "Neuer Schlüssel für %s akzeptiert und als %s verifiziert",
+		"%s doesn't match the key %s uses (%s)":                            "%s passt nicht zum Schlüssel von %s (%s)",
+		"No known keys":                                                    "Keine bekannten Schlüssel",
+		"unverified":                                                       "nicht verifiziert",
+		"verified":                                                         "verifiziert",
+		"KEY CHANGED":                                                      "SCHLÜSSEL GEÄNDERT",
+		"WebSocket connection from %s":                                     "WebSocket-Verbindung von %s",
+		"WebSocket endpoint on %s://%s:%s/":                                "WebSocket-Endpunkt unter %s://%s:%s/",
+		"Error serving WebSockets":                                         "Fehler beim Bereitstellen von WebSockets",
+		"Pick one of -quic and -noise":                                     "Wähle entweder -quic oder -noise",
+		"This build has no QUIC support; rebuild with -tags quic":          "Dieser Build unterstützt kein QUIC; mit -tags quic neu bauen",
+		"Listening for QUIC on udp %s":                                     "Warte auf QUIC über udp %s",
+		"nothing to send":                                                  "nichts zu senden",
+		"not sent":                                                         "nicht gesendet",
+		"no address to dial":                                               "keine Adresse zum Verbinden",
+		"nothing to run":                                                   "nichts auszuführen",
+		"unknown command %q":                                               "unbekannter Befehl %q",
+		"Another instance is using %s; no control socket":                  "Eine andere Instanz verwendet %s; kein Steuer-Socket",
+		"Error opening control socket":                                     "Fehler beim Öffnen des Steuer-Sockets",
+		"Refused a control connection from another user":                   "Steuerverbindung eines anderen Benutzers abgelehnt",
+		"Control command failed":                                           "Steuerbefehl fehlgeschlagen",
+		"Usage: /dial <addr>":                                              "Verwendung: /dial <Adresse>",
+		"Control socket at %s":                                             "Steuer-Socket unter %s",
+		"Error on control socket":                                          "Fehler am Steuer-Socket",
+		"unsupported proxy %q; only socks5:// is":                          "nicht unterstützter Proxy %q; nur socks5:// geht",
+		"QUIC runs over UDP, which -proxy can't carry":                     "QUIC läuft über UDP, das -proxy nicht weiterleiten kann",
+		"the router mapped port %d instead of %d":                          "der Router hat Port %d statt %d weitergeleitet",
+		"%s isn't a private address; not mapping ports":                    "%s ist keine private Adresse; keine Portweiterleitung",
+		"No port mapping: %v":                                              "Keine Portweiterleitung: %v",
+		"Mapped our ports with %s; peers can reach us at %s":               "Ports per %s weitergeleitet; Peers erreichen uns unter %s",
+		"Couldn't renew port mapping: %v":                                  "Portweiterleitung konnte nicht erneuert werden: %v",
+		"Reaching %s over the link it made to us":                          "Erreiche %s über die Verbindung, die es zu uns aufgebaut hat",
+		"Asking %d peers to help us reach %s":                              "Bitte %d Peers, uns beim Erreichen von %s zu helfen",
+		"Helping %s and %s connect directly":                               "Helfe %s und %s, sich direkt zu verbinden",
+		"Punched through to %s":                                            "Direkte Verbindung zu %s durchgestellt",
+		"Couldn't punch through to %s; messages still reach it through %s": "Keine direkte Verbindung zu %s möglich; Nachrichten erreichen es weiterhin über %s",
+		"%s is a relay":                                                    "%s ist ein Relay",
+		"No relays":                                                        "Keine Relays",
+		"Relay %s":                                                         "Relay %s",
+		"Nothing relayed yet":                                              "Noch nichts weitergeleitet",
+		"forwarded %d bytes in %d frames, delivered %d bytes, dropped %d, since %s": "%d Bytes in %d Frames weitergeleitet, %d Bytes zugestellt, %d verworfen, seit %s",
+		"Discarding unreadable rooms": "Unlesbare Räume werden verworfen",
+		"Error saving rooms":          "Fehler beim Speichern der Räume",
+		"Joined %s":                   "%s beigetreten",
+		"Talking in %s":               "Du sprichst in %s",
+		"Not in %s":                   "Nicht in %s",
+		"Left %s":                     "%s verlassen",
+		"the main room":               "dem Hauptraum",
+		"Usage: /msg <peer> <text>":   "Verwendung: /msg <Peer> <Text>",
+		"No key for %s yet, so we can't message them privately": "Noch kein Schlüssel für %s, daher keine privaten Nachrichten möglich",
+		"Couldn't reach %s; message not sent":                   "%s nicht erreichbar; Nachricht nicht gesendet",
+		"Unreadable private message":                            "Unlesbare private Nachricht",
+		"from %s":                                               "von %s",
+		"to %s":                                                 "an %s",
+		"Private message %s":                                    "Private Nachricht %s",
+		"DM":                                                    "PN",
+		"Unknown emoji %s":                                      "Unbekanntes Emoji %s",
+		"Reactions":                                             "Reaktionen",
+		"Usage: /react <id> :emoji:":                            "Verwendung: /react <ID> :emoji:",
+		"You can only change your own messages":                 "Du kannst nur deine eigenen Nachrichten ändern",
+		"%s was deleted":                                        "%s wurde gelöscht",
+		"Usage: /edit <id> <new text>":                          "Verwendung: /edit <ID> <neuer Text>",
+		"Deleted":                                               "Gelöscht",
+		"%s deleted a message from %s":                          "%s hat eine Nachricht von %s gelöscht",
+		"(edited)":                                              "(bearbeitet)",
+		"mentions you: %s":                                      "erwähnt dich: %s",
+		"Usage: /emoji <query>":                                 "Verwendung: /emoji <Suche>",
+		"No emoji matching %s":                                  "Kein Emoji passt zu %s",
+		"%s: %d%% (%s of %s)":                                   "%s: %d%% (%s von %s)",
+		"Usage: /sendfile <peer> <path>":                        "Verwendung: /sendfile <Peer> <Pfad>",
+		"Can't send %s: %v":                                     "%s kann nicht gesendet werden: %v",
+		"Can't send %s: not a file":                             "%s kann nicht gesendet werden: keine Datei",
+		"Couldn't reach %s to offer %s":                         "%s nicht erreichbar, um %s anzubieten",
+		"Offered %s (%s) to %s; waiting for them to accept": "%s (%s) an %s angeboten; warte auf Annahme",
+		"%s wants to send you %s (%s)":                      "%s möchte dir %s (%s) senden",
+		"To accept":                                         "Zum Annehmen",
+		"No file offer %s":                                  "Kein Dateiangebot %s",
+		"Can't save to %s: %v":                              "Speichern in %s nicht möglich: %v",
+		"Couldn't reach %s to accept %s":                    "%s nicht erreichbar, um %s anzunehmen",
+		"Receiving %s into %s":                              "Empfange %s nach %s",
+		"Declined %s":                                       "%s abgelehnt",
+		"No transfer %s":                                    "Keine Übertragung %s",
+		"Cancelled the transfer of %s":                      "Übertragung von %s abgebrochen",
+		"%s accepted %s":                                    "%s hat %s angenommen",
+		"%s declined %s":                                    "%s hat %s abgelehnt",
+		"%s cancelled the transfer of %s":                   "%s hat die Übertragung von %s abgebrochen",
+		"Lost touch with %s while sending %s":               "Verbindung zu %s beim Senden von %s verloren",
+		"Sent %s to %s":                                     "%s an %s gesendet",
+		"Can't save %s: %v":                                 "%s kann nicht gespeichert werden: %v",
+		"%s arrived damaged and was discarded":              "%s kam beschädigt an und wurde verworfen",
+		"Saved %s from %s to %s":                            "%s von %s unter %s gespeichert",
+		"No file transfers":                                 "Keine Dateiübertragungen",
+		"waiting":                                           "wartet",
+		"Link":                                              "Link",
+		"%s is typing…":                                     "%s schreibt…",
+		"No receipts for %s":                                "Keine Bestätigungen für %s",
+		"%s delivered to %d":                                "%s an %d zugestellt",
+		"Delivered":                                         "Zugestellt",
+		"Read":                                              "Gelesen",
+		"%s read at %s":                                     "%s hat es um %s gelesen",
+		"You're away":                                       "Du bist abwesend",
+		"You're back":                                       "Du bist zurück",
+		"%s is away: %s":                                    "%s ist abwesend: %s",
+		"%s is away":                                        "%s ist abwesend",
+		"%s is back":                                        "%s ist zurück",
+		"online":                                            "online",
+		"away":                                              "abwesend",
+		"offline":                                           "offline",
+		"Haven't seen %s":                                   "%s wurde noch nicht gesehen",
+		"%s is %s, last seen %s ago":                        "%s ist %s, zuletzt gesehen vor %s",
+		"idle":                                              "untätig",
+		"outbound":                                          "ausgehend",
+		"inbound":                                           "eingehend",
+		"Connection":                                        "Verbindung",
+		"%s %s since %s (%v), %d messages in, %d out, %s": "%s %s seit %s (%v), %d Nachrichten empfangen, %d gesendet, %s",
+		"%s left: %s": "%s ist gegangen: %s",
+		"%s left":     "%s ist gegangen",
+		"Peer speaks protocol versions we don't; not connecting":                                   "Peer spricht Protokollversionen, die wir nicht sprechen; keine Verbindung",
+		"Peer sent no handshake and is probably running an older version; dropping the connection": "Peer hat keinen Handshake gesendet und läuft wohl mit einer älteren Version; Verbindung wird getrennt",
+		"Peer speaks protocol versions we don't; dropping the connection":                          "Peer spricht Protokollversionen, die wir nicht sprechen; Verbindung wird getrennt",
+		"Usage: /export <file> [#room] [from] [to] [private]":                                      "Verwendung: /export <Datei> [#Raum] [von] [bis] [private]",
+		"%s goes by %s":                               "%s nennt sich %s",
+		"Client":                                      "Client",
+		"version %s, protocol %d, features: %s":       "Version %s, Protokoll %d, Funktionen: %s",
+		"You go by %s":                                "Du nennst dich %s",
+		"Usage: /nick <name>":                         "Verwendung: /nick <Name>",
+		"Error saving profile":                        "Fehler beim Speichern des Profils",
+		"You now go by %s":                            "Du nennst dich jetzt %s",
+		"%s now goes by %s":                           "%s nennt sich jetzt %s",
+		"Usage: /backfill [n]":                        "Verwendung: /backfill [n]",
+		"Asking %s for earlier messages":              "Frage %s nach früheren Nachrichten",
+		"%d earlier messages from %s:":                "%d frühere Nachrichten von %s:",
+		"End of earlier messages":                     "Ende der früheren Nachrichten",
+		"Nothing from %s that we haven't seen":        "Nichts von %s, das wir nicht schon gesehen haben",
+		"Usage: /history [n|more]":                    "Verwendung: /history [n|more]",
+		"No earlier messages":                         "Keine früheren Nachrichten",
+		"/history more for earlier messages":          "/history more für frühere Nachrichten",
+		"Usage: /search <terms>":                      "Verwendung: /search <Begriffe>",
+		"Nothing matches %q":                          "Nichts passt zu %q",
+		"%d messages match %q; showing the latest %d": "%d Nachrichten passen zu %q; die neuesten %d werden gezeigt",
+		"%d messages match %q":                        "%d Nachrichten passen zu %q",
+		"%q isn't a date like 2006-01-02":             "%q ist kein Datum wie 2006-01-02",
+		"unknown export format %q":                    "unbekanntes Exportformat %q",
+		"Unable to export history: %v":                "Verlauf kann nicht exportiert werden: %v",
+		"Usage: sweetnothings export [flags] <file>":  "Verwendung: sweetnothings export [Optionen] <Datei>",
+		"Unable to open log file:":                    "Logdatei kann nicht geöffnet werden:",
+		"Error serving metrics":                       "Fehler beim Bereitstellen der Metriken",
+		"Metrics on http://%s/metrics":                "Metriken unter http://%s/metrics",
+		"Up %v, %d peers":                             "Seit %v aktiv, %d Peers",
+		"Messages":                                    "Nachrichten",
+		"%d sent, %d received, %d relayed, %d duplicates suppressed, %d dropped": "%d gesendet, %d empfangen, %d weitergeleitet, %d Duplikate unterdrückt, %d verworfen",
+		"Dedup": "Duplikate",
+		"%d message IDs remembered, %d failed dials":                                    "%d Nachrichten-IDs gemerkt, %d fehlgeschlagene Verbindungsversuche",
+		"%s: %d/%d messages in/out, %s in (%s/s), %s out (%s/s), %d queued, %d dropped": "%s: %d/%d Nachrichten ein/aus, %s ein (%s/s), %s aus (%s/s), %d in der Warteschlange, %d verworfen",
+		"Peer":                  "Peer",
+		"Lost %s; reconnecting": "%s verloren; verbinde neu",
+		"Gave up reconnecting to %s after %d tries":                    "Neuverbindung mit %s nach %d Versuchen aufgegeben",
+		"Stopped reconnecting to %s":                                   "Keine Neuverbindung mehr mit %s",
+		"Won't reconnect to %s if its link drops":                      "Keine Neuverbindung mit %s, falls die Verbindung abbricht",
+		"Usage: /forget <peer>":                                        "Verwendung: /forget <Peer>",
+		"%s stopped answering; dropping the link":                      "%s antwortet nicht mehr; Verbindung wird getrennt",
+		"Discarding unreadable outbox":                                 "Verwerfe unlesbaren Postausgang",
+		"Error saving outbox":                                          "Fehler beim Speichern des Postausgangs",
+		"Sending %s %d messages that waited for it":                    "Sende %s %d Nachrichten, die darauf gewartet haben",
+		"Discarding unreadable peer list":                              "Verwerfe unlesbare Peer-Liste",
+		"Error saving peer list":                                       "Fehler beim Speichern der Peer-Liste",
+		"Redialing %d peers from last time":                            "Verbinde erneut mit %d Peers vom letzten Mal",
+		"-drop-policy must be %q or %q":                                "-drop-policy muss %q oder %q sein",
+		"unknown compression %q":                                       "unbekannte Komprimierung %q",
+		"Can't read compressed link; dropping the connection":          "Komprimierte Verbindung nicht lesbar; Verbindung wird getrennt",
+		"unknown encoding %q":                                          "unbekannte Kodierung %q",
+		"Can't read the link's encoding; dropping the connection":      "Kodierung der Verbindung nicht lesbar; Verbindung wird getrennt",
+		"compression must start before the encoding changes":           "die Komprimierung muss vor dem Wechsel der Kodierung beginnen",
+		"-encoding must be one of %s":                                  "-encoding muss eines von %s sein",
+		"Skipping a frame that won't decode":                           "Rahmen, der sich nicht dekodieren lässt, wird übersprungen",
+		"Skipping a frame longer than -max-frame":                      "Rahmen länger als -max-frame wird übersprungen",
+		"%s is sending too fast; muted for %v":                         "%s sendet zu schnell; für %v stummgeschaltet",
+		"%s is sending too fast; dropping some of its messages":        "%s sendet zu schnell; einige Nachrichten werden verworfen",
+		"-rate-action must be %q or %q":                                "-rate-action muss %q oder %q sein",
+		"Limits":                                                       "Grenzen",
+		"%d messages over -peer-rate dropped, %d relays throttled":     "%d Nachrichten über -peer-rate verworfen, %d Weiterleitungen gedrosselt",
+		"Relaying more than -relay-limit; holding some messages back":  "Mehr Weiterleitungen als -relay-limit; einige Nachrichten werden zurückgehalten",
+		"Not ignoring anyone":                                          "Du ignorierst niemanden",
+		"Ignoring":                                                     "Ignoriert",
+		"Not blocking anyone":                                          "Du blockierst niemanden",
+		"Blocked":                                                      "Blockiert",
+		"Ignoring %s; their messages are still relayed":                "%s wird ignoriert; Nachrichten werden weiter weitergeleitet",
+		"No longer ignoring %s":                                        "%s wird nicht mehr ignoriert",
+		"Blocked %s":                                                   "%s blockiert",
+		"Unblocked %s":                                                 "%s nicht mehr blockiert",
+		"Refusing a connection the access lists don't allow":           "Verbindung wird abgelehnt, die Zugriffslisten erlauben sie nicht",
+		"Not dialing a peer the access lists don't allow":              "Peer wird nicht angewählt, die Zugriffslisten erlauben ihn nicht",
+		"message is %d bytes, over -max-body of %d":                    "die Nachricht hat %d Bytes, mehr als -max-body von %d",
+		"Cut the message to %d bytes to fit -max-body":                 "Nachricht auf %d Bytes gekürzt, um in -max-body zu passen",
+		"Message over -max-body":                                       "Nachricht länger als -max-body",
+		"-body-action must be %q or %q":                                "-body-action muss %q oder %q sein",
+		"a node has already run in this process":                       "in diesem Prozess lief schon ein Knoten",
+		"No node to attach to:":                                        "Kein Knoten zum Verbinden:",
+		"Attached to %s; Ctrl-D detaches and /quit stops the node":     "Mit %s verbunden; Strg-D trennt, /quit beendet den Knoten",
+		"Detached; the node is still running":                          "Getrennt; der Knoten läuft weiter",
+		"The node stopped":                                             "Der Knoten wurde beendet",
+		"The daemon didn't start":                                      "Der Daemon ist nicht gestartet",
+		"Started the daemon (pid %d); sweetnothings attach to use it":  "Daemon gestartet (PID %d); mit sweetnothings attach verbinden",
+		"The daemon (pid %d) is still starting":                        "Der Daemon (PID %d) startet noch",
+		"No daemon mode on Windows; use sweetnothings service install": "Unter Windows gibt es keinen Daemon-Modus; sweetnothings service install verwenden",
+		"A daemon needs a control socket to attach to":                 "Ein Daemon braucht einen Steuer-Socket zum Verbinden",
+		"A node is already running on %s":                              "Auf %s läuft schon ein Knoten",
+	},
+}
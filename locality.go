@@ -0,0 +1,126 @@
+package sweetnothings
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Maximum number of direct connections to distant peers; negative means no
+// limit. Distant peers beyond it are reached through relays.
+var maxDistant = -1
+
+// Peers answering pings faster than this count as nearby regardless of
+// address.
+const nearbyRTT = 20 * time.Millisecond
+
+const pruneEvery = time.Minute
+
+// Peers the user dialed by hand are never pruned.
+var pinned = struct {
+	m map[string]bool
+	sync.Mutex
+}{m: make(map[string]bool)}
+
+func pinPeer(addr string) {
+	pinned.Lock()
+	pinned.m[addr] = true
+	pinned.Unlock()
+}
+
+func isPinned(addr string) bool {
+	pinned.Lock()
+	defer pinned.Unlock()
+	return pinned.m[addr]
+}
+
+func hostIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return nil
+	}
+	return ips[0]
+}
+
+func sameSubnet(a, b net.IP) bool {
+	if a4, b4 := a.To4(), b.To4(); a4 != nil && b4 != nil {
+		mask := net.CIDRMask(24, 32)
+		return a4.Mask(mask).Equal(b4.Mask(mask))
+	}
+	mask := net.CIDRMask(64, 128)
+	return a.Mask(mask).Equal(b.Mask(mask))
+}
+
+// isNearby reports whether addr is on our subnet or answers pings quickly.
+func isNearby(addr string) bool {
+	if r, ok := peerRTT(addr); ok && r.Avg < nearbyRTT {
+		return true
+	}
+	ip := hostIP(addr)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	local := net.ParseIP(localInfo.IP())
+	return local != nil && sameSubnet(ip, local)
+}
+
+func distantPeers() []string {
+	var l []string
+	for addr := range peers.Channels() {
+		if !isNearby(addr) {
+			l = append(l, addr)
+		}
+	}
+	return l
+}
+
+// autoDial connects back to a peer we heard from, unless it is distant and
+// we already hold our quota of distant connections, or we're already
+// redialing it.
+func autoDial(addr string) {
+	if redialing(addr) {
+		return
+	}
+	if maxDistant >= 0 && peers.Get(addr) == nil && !isNearby(addr) &&
+		len(distantPeers()) >= maxDistant {
+		return
+	}
+	dial(addr)
+}
+
+// pruneDistant closes the slowest distant connections beyond the quota.
+func pruneDistant() {
+	var l []string
+	for _, addr := range distantPeers() {
+		if !isPinned(addr) {
+			l = append(l, addr)
+		}
+	}
+	if len(l) <= maxDistant {
+		return
+	}
+	sort.Slice(l, func(i, j int) bool { return relayScore(l[i]) > relayScore(l[j]) })
+	for _, addr := range l[:len(l)-maxDistant] {
+		noReconnect(addr)
+		if peers.Disconnect(addr) {
+			statusLn(tr("Dropped direct link to distant peer %s", addr))
+		}
+	}
+}
+
+func startLocalityPruner() {
+	for range time.Tick(pruneEvery) {
+		pruneDistant()
+	}
+}
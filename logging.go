@@ -0,0 +1,137 @@
+package sweetnothings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+/**
+ * Logging
+ *
+ * Errors and diagnostics go through logger, a log/slog logger carrying
+ * fields such as the event, peer and message ID alongside the message so
+ * they can be filtered. In the terminal they print as a bracketed line
+ * with the fields after it. With -logfile they go to that file instead as
+ * logfmt lines, or JSON with -log-format json, leaving the terminal to the
+ * chat; status lines still show in the terminal, since many answer
+ * commands, and are copied to the file. -log-level hides anything less
+ * severe, down to debug for the chattiest.
+ */
+
+var (
+	logPath   string
+	logFormat = "text"
+	logLevel  slog.LevelVar
+)
+
+var logger = slog.New(&termHandler{w: os.Stderr, level: &logLevel})
+
+var logFile = struct {
+	open bool
+	sync.Mutex
+}{}
+
+// levelFlag is -log-level.
+type levelFlag struct{}
+
+func (levelFlag) String() string { return strings.ToLower(logLevel.Level().String()) }
+
+func (levelFlag) Set(s string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return fmt.Errorf("want debug, info, warn or error")
+	}
+	logLevel.Set(l)
+	return nil
+}
+
+// openLogFile sends the log to path from here on.
+func openLogFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	switch logFormat {
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(f, opts))
+	case "text":
+		logger = slog.New(slog.NewTextHandler(f, opts))
+	default:
+		f.Close()
+		return fmt.Errorf("-log-format must be text or json")
+	}
+	logFile.Lock()
+	logFile.open = true
+	logFile.Unlock()
+	return nil
+}
+
+func loggingToFile() bool {
+	logFile.Lock()
+	defer logFile.Unlock()
+	return logFile.open
+}
+
+// logStatus copies a status line to the log file, if there is one.
+func logStatus(s string) {
+	if loggingToFile() {
+		logger.Info(s, "event", "status")
+	}
+}
+
+// termHandler writes records for a person reading along: the time, the
+// message in brackets, then the fields, with any error last.
+type termHandler struct {
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	mu    sync.Mutex
+}
+
+func (h *termHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *termHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	fmt.Fprintf(&b, "[%s]", r.Message)
+	var errText string
+	field := func(a slog.Attr) bool {
+		switch {
+		case a.Key == "event":
+		case a.Key == "err":
+			errText = a.Value.String()
+		default:
+			fmt.Fprintf(&b, " %s=%s", a.Key, a.Value)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		field(a)
+	}
+	r.Attrs(field)
+	if len(errText) > 0 {
+		b.WriteString(" " + errText)
+	}
+	b.WriteString("\n")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *termHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &termHandler{w: h.w, level: h.level, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+// Groups are flattened; nothing here uses them.
+func (h *termHandler) WithGroup(string) slog.Handler {
+	return h
+}
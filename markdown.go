@@ -0,0 +1,74 @@
+package sweetnothings
+
+import (
+	"regexp"
+	"strings"
+)
+
+/**
+ * Markdown
+ *
+ * Chat is shown with basic Markdown turned into terminal styling:
+ * **bold**, *italics*, `code`, ```code blocks``` and [links](url). In
+ * accessible mode the markup is just dropped. -markdown=false shows
+ * messages as they were typed.
+ */
+
+var markdownEnabled = true
+
+var (
+	mdCodeBlock = regexp.MustCompile("(?s)```([a-zA-Z0-9_+-]*\n)?(.*?)```")
+	mdCode      = regexp.MustCompile("`([^`]+)`")
+	mdLink      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic    = regexp.MustCompile(`\*([^*\s][^*]*)\*|(?:^|\b)_([^_\s][^_]*)_(?:\b|$)`)
+)
+
+// renderMarkdown styles body for the terminal.
+func renderMarkdown(body string) string {
+	if !markdownEnabled {
+		return body
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range mdCodeBlock.FindAllStringSubmatchIndex(body, -1) {
+		b.WriteString(renderInline(body[last:m[0]]))
+		code := strings.TrimSuffix(body[m[4]:m[5]], "\n")
+		for _, line := range strings.Split(code, "\n") {
+			b.WriteString("\n    " + wrapColor(line, "code"))
+		}
+		b.WriteString("\n")
+		last = m[1]
+	}
+	b.WriteString(renderInline(body[last:]))
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// renderInline styles a run of text outside code blocks, leaving the
+// inside of `code` alone.
+func renderInline(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range mdCode.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(renderSpans(s[last:m[0]]))
+		b.WriteString(wrapColor(s[m[2]:m[3]], "code"))
+		last = m[1]
+	}
+	b.WriteString(renderSpans(s[last:]))
+	return b.String()
+}
+
+func renderSpans(s string) string {
+	s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+		p := mdLink.FindStringSubmatch(m)
+		return wrapColor(p[1], "underline") + " (" + p[2] + ")"
+	})
+	s = mdBold.ReplaceAllStringFunc(s, func(m string) string {
+		p := mdBold.FindStringSubmatch(m)
+		return bold(p[1] + p[2])
+	})
+	return mdItalic.ReplaceAllStringFunc(s, func(m string) string {
+		p := mdItalic.FindStringSubmatch(m)
+		return wrapColor(p[1]+p[2], "italic")
+	})
+}
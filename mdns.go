@@ -0,0 +1,286 @@
+package sweetnothings
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * LAN discovery
+ *
+ * With -mdns we advertise ourselves over multicast DNS as a DNS-SD service
+ * (_sweetnothings._tcp.local) and dial any other instance that answers.
+ * Only the primary network is advertised. This is just enough of RFC 6762
+ * and 6763 to find each other: PTR queries, and answers carrying the SRV
+ * and A records.
+ */
+
+var mdnsEnabled bool
+
+const mdnsService = "_sweetnothings._tcp.local."
+
+const mdnsQueryInterval = time.Minute
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const (
+	dnsTypeA    = 1
+	dnsTypePTR  = 12
+	dnsTypeAAAA = 28
+	dnsTypeSRV  = 33
+	dnsClassIN  = 1
+	// Set on answers to say they replace anything cached.
+	dnsCacheFlush = 0x8000
+	dnsTTL        = 120
+)
+
+type dnsRecord struct {
+	Name string
+	Type uint16
+	Data []byte
+}
+
+func mdnsInstance() string {
+	return "sweetnothings-" + strings.NewReplacer(".", "-", ":", "-").Replace(localInfo.Addr()) + "." + mdnsService
+}
+
+func mdnsHost() string {
+	return "sweetnothings-" + strings.ReplaceAll(localInfo.IP(), ".", "-") + ".local."
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// readName decodes the name at off, following compression pointers, and
+// returns it along with the offset just past it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for hops := 0; hops < 32; hops++ {
+		if off >= len(msg) {
+			return "", 0, errors.New("short name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("short pointer")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("short label")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+	return "", 0, errors.New("too many pointers")
+}
+
+func dnsMessage(response bool, questions []dnsRecord, answers []dnsRecord) []byte {
+	b := make([]byte, 12)
+	if response {
+		binary.BigEndian.PutUint16(b[2:], 0x8400)
+	}
+	binary.BigEndian.PutUint16(b[4:], uint16(len(questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(answers)))
+	for _, q := range questions {
+		b = appendName(b, q.Name)
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, dnsClassIN)
+	}
+	for _, a := range answers {
+		b = appendName(b, a.Name)
+		b = binary.BigEndian.AppendUint16(b, a.Type)
+		class := uint16(dnsClassIN)
+		if a.Type != dnsTypePTR {
+			class |= dnsCacheFlush
+		}
+		b = binary.BigEndian.AppendUint16(b, class)
+		b = binary.BigEndian.AppendUint32(b, dnsTTL)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.Data)))
+		b = append(b, a.Data...)
+	}
+	return b
+}
+
+// parseDNS returns a message's questions and its answer, authority and
+// additional records together. Names inside PTR and SRV data are expanded.
+func parseDNS(msg []byte) (response bool, questions []dnsRecord, records []dnsRecord, err error) {
+	if len(msg) < 12 {
+		return false, nil, nil, errors.New("short message")
+	}
+	response = msg[2]&0x80 != 0
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	off := 12
+	for i := 0; i < qd; i++ {
+		var name string
+		if name, off, err = readName(msg, off); err != nil {
+			return
+		}
+		if off+4 > len(msg) {
+			return response, nil, nil, errors.New("short question")
+		}
+		questions = append(questions, dnsRecord{Name: name, Type: binary.BigEndian.Uint16(msg[off:])})
+		off += 4
+	}
+	for i := 0; i < rr; i++ {
+		var name string
+		if name, off, err = readName(msg, off); err != nil {
+			return
+		}
+		if off+10 > len(msg) {
+			return response, questions, nil, errors.New("short record")
+		}
+		r := dnsRecord{Name: name, Type: binary.BigEndian.Uint16(msg[off:])}
+		n := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+n > len(msg) {
+			return response, questions, nil, errors.New("short record data")
+		}
+		switch r.Type {
+		case dnsTypePTR:
+			target, _, err := readName(msg, off)
+			if err != nil {
+				return response, questions, nil, err
+			}
+			r.Data = []byte(target)
+		case dnsTypeSRV:
+			if n < 7 {
+				return response, questions, nil, errors.New("short SRV")
+			}
+			target, _, err := readName(msg, off+6)
+			if err != nil {
+				return response, questions, nil, err
+			}
+			r.Data = append(append([]byte{}, msg[off:off+6]...), target...)
+		default:
+			r.Data = msg[off : off+n]
+		}
+		records = append(records, r)
+		off += n
+	}
+	return
+}
+
+// mdnsAnswers describes us: the service points at our instance, which
+// lives on our host and port.
+func mdnsAnswers() []dnsRecord {
+	port, _ := strconv.Atoi(localInfo.ListenPort)
+	srv := make([]byte, 6)
+	binary.BigEndian.PutUint16(srv[4:], uint16(port))
+	answers := []dnsRecord{
+		{Name: mdnsService, Type: dnsTypePTR, Data: appendName(nil, mdnsInstance())},
+		{Name: mdnsInstance(), Type: dnsTypeSRV, Data: appendName(srv, mdnsHost())},
+	}
+	if ip := net.ParseIP(localInfo.IP()); ip.To4() != nil {
+		answers = append(answers, dnsRecord{Name: mdnsHost(), Type: dnsTypeA, Data: ip.To4()})
+	} else if ip != nil {
+		answers = append(answers, dnsRecord{Name: mdnsHost(), Type: dnsTypeAAAA, Data: ip.To16()})
+	}
+	return answers
+}
+
+// mdnsPeers picks the addresses of other instances out of a response.
+func mdnsPeers(records []dnsRecord, from net.IP) []string {
+	hosts := make(map[string]net.IP)
+	for _, r := range records {
+		if (r.Type == dnsTypeA && len(r.Data) == 4) || (r.Type == dnsTypeAAAA && len(r.Data) == 16) {
+			hosts[strings.ToLower(r.Name)] = net.IP(r.Data)
+		}
+	}
+	var addrs []string
+	for _, r := range records {
+		name := strings.ToLower(r.Name)
+		if r.Type != dnsTypeSRV || !strings.HasSuffix(name, mdnsService) || name == strings.ToLower(mdnsInstance()) {
+			continue
+		}
+		port := binary.BigEndian.Uint16(r.Data[4:])
+		ip, ok := hosts[strings.ToLower(string(r.Data[6:]))]
+		// A host that only knows itself as loopback is still reachable
+		// at the address its packet came from.
+		if !ok || (ip.IsLoopback() && !from.IsLoopback()) {
+			ip = from
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.String(), fmt.Sprint(port)))
+	}
+	return addrs
+}
+
+func startDiscovery() {
+	c, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		logger.Error(T("Error starting LAN discovery"), "event", "mdns", "err", err)
+		return
+	}
+	// The listening socket doesn't loop our own packets back, which would
+	// hide other instances on this host, so send from another one.
+	out, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		logger.Error(T("Error starting LAN discovery"), "event", "mdns", "err", err)
+		return
+	}
+	statusLn(tr("Looking for peers on the local network"))
+	query := dnsMessage(false, []dnsRecord{{Name: mdnsService, Type: dnsTypePTR}}, nil)
+	go func() {
+		// Announce ourselves, then ask who else is around, now and then.
+		out.WriteToUDP(dnsMessage(true, nil, mdnsAnswers()), mdnsGroup)
+		for {
+			out.WriteToUDP(query, mdnsGroup)
+			time.Sleep(mdnsQueryInterval)
+		}
+	}()
+
+	found := make(map[string]bool)
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := c.ReadFromUDP(buf)
+		if err != nil {
+			logger.Error(T("Error reading LAN discovery"), "event", "mdns", "err", err)
+			return
+		}
+		response, questions, records, err := parseDNS(buf[:n])
+		if err != nil {
+			continue
+		}
+		if !response {
+			for _, q := range questions {
+				if q.Type == dnsTypePTR && strings.EqualFold(q.Name, mdnsService) {
+					out.WriteToUDP(dnsMessage(true, nil, mdnsAnswers()), mdnsGroup)
+					break
+				}
+			}
+			continue
+		}
+		for _, addr := range mdnsPeers(records, from.IP) {
+			if isLocal(addr) || peers.Get(addr) != nil {
+				continue
+			}
+			if !found[addr] {
+				found[addr] = true
+				statusLn(tr("Found %s on the local network", addr))
+			}
+			go autoDial(addr)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/**
+ * Mentions
+ *
+ * "@name" in a message mentions whoever name refers to for the reader:
+ * a nickname set with /setnick, a guest name or an address. A message
+ * that mentions us is highlighted, and rings the bell with
+ * -mention-bell. Besides the name we go by (-nick), -mention lists any
+ * others people use for us.
+ */
+
+var mentionNames []string
+
+var mentionBell bool
+
+// An @ inside a word, as in an email address, isn't a mention.
+var mentionPattern = regexp.MustCompile(`(?:^|[\s(])@([^\s@,;!?()"']+)`)
+
+// mentioned returns the names a body mentions, without the @.
+func mentioned(body string) []string {
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		if name := strings.TrimRight(m[1], ".:"); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// mentionsUs reports whether whisper mentions us by one of our names or
+// anything that resolves to one of our addresses.
+func mentionsUs(whisper SweetNothing) bool {
+	if isLocal(whisper.Addr) {
+		return false
+	}
+	for _, name := range mentioned(whisper.Body) {
+		for _, ours := range ourNames() {
+			if strings.EqualFold(name, ours) {
+				return true
+			}
+		}
+		if isLocal(dialAddr(peerFor(name))) {
+			return true
+		}
+	}
+	return false
+}
+
+func ourNames() []string {
+	names := mentionNames
+	if nick := ourNick(); len(nick) > 0 {
+		names = append([]string{nick}, names...)
+	}
+	if ephemeral && meta != nil {
+		if g, ok := meta.Get(guestPrefix + localInfo.Addr()); ok {
+			names = append([]string{g}, names...)
+		}
+	}
+	return names
+}
+
+// highlightMention marks a chat line that mentions us.
+func highlightMention(body string) string {
+	if accessible {
+		return tr("mentions you: %s", body)
+	}
+	return fmt.Sprintf("%s %s", wrapColor("@", "yellow"), wrapColor(body, "yellow"))
+}
@@ -0,0 +1,210 @@
+package sweetnothings
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+ * Networks
+ *
+ * Besides the primary mesh on -p, each -mesh name=port joins another,
+ * independent mesh on its own port. A peer belongs to the network we met
+ * it on: the listener it dialed, or the network we dialed it from.
+ * Messages are tagged with their network and only relayed within it.
+ * The primary network has no name.
+ */
+var networks = make(map[string]string)
+
+var peerNets = struct {
+	m map[string]string
+	sync.RWMutex
+}{m: make(map[string]string)}
+
+// The network that what we type is sent to.
+var currentNet = struct {
+	name string
+	sync.RWMutex
+}{}
+
+// networkFlag collects -mesh name=port values.
+type networkFlag struct{}
+
+func (networkFlag) String() string { return "" }
+
+func (networkFlag) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i <= 0 || i == len(v)-1 {
+		return fmt.Errorf(T("expected name=port, got %q"), v)
+	}
+	networks[v[:i]] = v[i+1:]
+	return nil
+}
+
+func netOf(addr string) string {
+	peerNets.RLock()
+	defer peerNets.RUnlock()
+	return peerNets.m[addr]
+}
+
+func setNet(addr string, network string) {
+	if len(addr) == 0 {
+		return
+	}
+	peerNets.Lock()
+	defer peerNets.Unlock()
+	if len(network) == 0 {
+		delete(peerNets.m, addr)
+	} else {
+		peerNets.m[addr] = network
+	}
+}
+
+func currentNetwork() string {
+	currentNet.RLock()
+	defer currentNet.RUnlock()
+	return currentNet.name
+}
+
+// localAddr is our address as seen by peers on network.
+func localAddr(network string) string {
+	if len(network) == 0 {
+		return localInfo.Addr()
+	}
+	return net.JoinHostPort(localInfo.IP(), networks[network])
+}
+
+// dialAddr tidies up an address typed to /dial: IPv6 literals get the
+// brackets host:port needs, so "::1:9000" and "[::1]:9000" are the same
+// peer. The last colon is taken to start the port.
+func dialAddr(addr string) string {
+	if isWebSocket(addr) {
+		return addr
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr[:i], "[]"), addr[i+1:])
+}
+
+// isLocal reports whether addr is our address on any network.
+func isLocal(addr string) bool {
+	if addr == localInfo.Addr() {
+		return true
+	}
+	for network := range networks {
+		if addr == localAddr(network) {
+			return true
+		}
+	}
+	return false
+}
+
+// netPeers returns the connections to peers on network.
+func netPeers(network string) map[string]chan<- Frame {
+	targets := peers.Channels()
+	if len(networks) == 0 {
+		return targets
+	}
+	for addr := range targets {
+		if netOf(addr) != network {
+			delete(targets, addr)
+		}
+	}
+	return targets
+}
+
+// whoLabel is nickName qualified with the network for peers outside the
+// primary one and followed by the fingerprint of their signing key, e.g.
+// "family/alice 1f0c9a3e".
+func whoLabel(addr string) string {
+	label := nickName(addr)
+	if network := netOf(addr); len(network) > 0 {
+		label = network + "/" + label
+	}
+	if fp := identityFingerprint(addr); len(fp) > 0 {
+		label += " " + fp
+		if keyVerified(addr) {
+			label += verifiedMark()
+		}
+	}
+	return label
+}
+
+// serve accepts connections on l for network until it fails.
+func serve(l net.Listener, network string) {
+	for {
+		con, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Error(T("Error on accept"), "event", "accept", "net", network, "err", err)
+			continue
+		}
+		go serveIncoming(con, network)
+	}
+}
+
+// listenNetworks starts a listener for each -mesh.
+func listenNetworks() {
+	for network, port := range networks {
+		l, err := listen(network, port)
+		if err != nil {
+			log.Fatal(err)
+		}
+		setNet(localAddr(network), network)
+		statusLn(tr("Joined network %s as %s", network, localAddr(network)))
+		go serve(l, network)
+	}
+}
+
+// switchNetwork picks which network what we type goes to, or lists them.
+func switchNetwork(name string) {
+	if len(name) == 0 {
+		showNetworks()
+		return
+	}
+	if name == "-" || name == "primary" {
+		name = ""
+	} else if _, ok := networks[name]; !ok {
+		statusLn(tr("No network %s", name))
+		return
+	}
+	currentNet.Lock()
+	currentNet.name = name
+	currentNet.Unlock()
+	if len(name) == 0 {
+		statusLn(tr("Talking on the primary network"))
+	} else {
+		statusLn(tr("Talking on network %s", name))
+	}
+}
+
+func showNetworks() {
+	names := []string{""}
+	for network := range networks {
+		names = append(names, network)
+	}
+	sort.Strings(names)
+	current := currentNetwork()
+	for _, network := range names {
+		label := network
+		if len(label) == 0 {
+			label = T("primary")
+		}
+		if network == current {
+			label += " *"
+		}
+		statusLn(tr("%s on %s, %d peers", label, localAddr(network), len(netPeers(network))))
+	}
+}
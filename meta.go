@@ -0,0 +1,353 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metaSyncTimeout = 5 * time.Second
+
+// MetaEntry is one replicated key, e.g. "topic". Each key is a
+// last-writer-wins register: the highest version wins and concurrent
+// versions are ordered by origin address, so every node settles on the same
+// value. A deleted entry is a tombstone and beats any value for its key.
+type MetaEntry struct {
+	Key     string
+	Value   string
+	Version uint64
+	Origin  string
+	Deleted bool   `json:",omitempty"`
+	Seq     uint64 `json:"-"`
+}
+
+func (e MetaEntry) newer(o MetaEntry) bool {
+	if e.Deleted != o.Deleted {
+		return e.Deleted
+	}
+	if e.Version != o.Version {
+		return e.Version > o.Version
+	}
+	return e.Origin > o.Origin
+}
+
+// MetaDelta carries the entries a store changed after sequence Since, up to
+// and including Seq.
+type MetaDelta struct {
+	Since   uint64
+	Seq     uint64
+	Entries []MetaEntry
+}
+
+type metaRequest struct {
+	Since uint64
+}
+
+/**
+ * MetaStore
+ */
+type MetaStore struct {
+	path    string
+	clock   uint64
+	seq     uint64
+	entries map[string]MetaEntry
+	// Highest sequence of each peer's store we've merged.
+	synced   map[string]uint64
+	watchers map[string]func(MetaEntry)
+	mu       sync.Mutex
+}
+
+type metaFile struct {
+	Clock   uint64
+	Seq     uint64
+	Entries []metaFileEntry
+	Synced  map[string]uint64
+}
+
+type metaFileEntry struct {
+	MetaEntry
+	Seq uint64
+}
+
+func NewMetaStore(path string) *MetaStore {
+	m := &MetaStore{
+		path:     path,
+		entries:  make(map[string]MetaEntry),
+		synced:   make(map[string]uint64),
+		watchers: make(map[string]func(MetaEntry)),
+	}
+	if len(path) == 0 {
+		return m
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m
+	}
+	var f metaFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		logger.Warn(T("Discarding unreadable metadata"), "event", "meta", "err", err)
+		return m
+	}
+	m.clock, m.seq = f.Clock, f.Seq
+	for _, e := range f.Entries {
+		e.MetaEntry.Seq = e.Seq
+		m.entries[e.Key] = e.MetaEntry
+	}
+	if f.Synced != nil {
+		m.synced = f.Synced
+	}
+	return m
+}
+
+// save must be called with m.mu held.
+func (m *MetaStore) save() {
+	if len(m.path) == 0 {
+		return
+	}
+	f := metaFile{Clock: m.clock, Seq: m.seq, Synced: m.synced}
+	for _, e := range m.entries {
+		f.Entries = append(f.Entries, metaFileEntry{e, e.Seq})
+	}
+	b, err := json.Marshal(f)
+	if err == nil {
+		os.MkdirAll(filepath.Dir(m.path), 0700)
+		tmp := m.path + ".tmp"
+		if err = os.WriteFile(tmp, b, 0600); err == nil {
+			err = os.Rename(tmp, m.path)
+		}
+	}
+	if err != nil {
+		logger.Error(T("Error saving metadata"), "event", "meta", "path", m.path, "err", err)
+	}
+}
+
+// Watch calls fn whenever a key with the given prefix changes.
+func (m *MetaStore) Watch(prefix string, fn func(MetaEntry)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchers[prefix] = fn
+}
+
+// Clock returns the highest version this store has seen.
+func (m *MetaStore) Clock() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock
+}
+
+func (m *MetaStore) Get(key string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if e.Deleted {
+		return "", false
+	}
+	return e.Value, ok
+}
+
+// Prefix returns all live entries whose key starts with prefix.
+func (m *MetaStore) Prefix(prefix string) []MetaEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var l []MetaEntry
+	for k, e := range m.entries {
+		if strings.HasPrefix(k, prefix) && !e.Deleted {
+			l = append(l, e)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Key < l[j].Key })
+	return l
+}
+
+// apply stores e if it beats what we have, and must be called with m.mu
+// held. It returns the stored entry and whether anything changed.
+func (m *MetaStore) apply(e MetaEntry) (MetaEntry, bool) {
+	if e.Version > m.clock {
+		m.clock = e.Version
+	}
+	if cur, ok := m.entries[e.Key]; ok && !e.newer(cur) {
+		return cur, false
+	}
+	m.seq++
+	e.Seq = m.seq
+	m.entries[e.Key] = e
+	return e, true
+}
+
+func (m *MetaStore) notify(changed []MetaEntry) {
+	m.mu.Lock()
+	var calls []func()
+	for _, e := range changed {
+		for prefix, fn := range m.watchers {
+			if strings.HasPrefix(e.Key, prefix) {
+				e, fn := e, fn
+				calls = append(calls, func() { fn(e) })
+			}
+		}
+	}
+	m.mu.Unlock()
+	for _, call := range calls {
+		call()
+	}
+}
+
+// Set records a local change and returns the delta to announce.
+func (m *MetaStore) Set(key string, value string) MetaDelta {
+	return m.write(MetaEntry{Key: key, Value: value})
+}
+
+// Delete tombstones key and returns the delta to announce.
+func (m *MetaStore) Delete(key string) MetaDelta {
+	return m.write(MetaEntry{Key: key, Deleted: true})
+}
+
+func (m *MetaStore) write(e MetaEntry) MetaDelta {
+	m.mu.Lock()
+	m.clock++
+	e.Version = m.clock
+	e.Origin = localInfo.Addr()
+	e, ok := m.apply(e)
+	if !ok {
+		m.mu.Unlock()
+		return MetaDelta{}
+	}
+	m.save()
+	m.mu.Unlock()
+	m.notify([]MetaEntry{e})
+	return MetaDelta{Since: e.Seq - 1, Seq: e.Seq, Entries: []MetaEntry{e}}
+}
+
+// Delta returns everything changed after since.
+func (m *MetaStore) Delta(since uint64) MetaDelta {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := MetaDelta{Since: since, Seq: m.seq}
+	for _, e := range m.entries {
+		if e.Seq > since {
+			d.Entries = append(d.Entries, e)
+		}
+	}
+	sort.Slice(d.Entries, func(i, j int) bool { return d.Entries[i].Seq < d.Entries[j].Seq })
+	return d
+}
+
+func (m *MetaStore) Synced(peer string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.synced[peer]
+}
+
+// Unsync forgets peer's watermark so the next request fetches everything,
+// e.g. when it has restarted and its sequence numbers start over.
+func (m *MetaStore) Unsync(peer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.synced, peer)
+	m.save()
+}
+
+// Merge applies a delta from peer and returns the entries that changed here.
+// The peer's watermark only advances when the delta picks up where the last
+// one left off, so a gap gets re-requested on the next connect.
+func (m *MetaStore) Merge(peer string, d MetaDelta) []MetaEntry {
+	m.mu.Lock()
+	var changed []MetaEntry
+	for _, e := range d.Entries {
+		if e2, ok := m.apply(e); ok {
+			changed = append(changed, e2)
+		}
+	}
+	if d.Since <= m.synced[peer] && d.Seq > m.synced[peer] {
+		m.synced[peer] = d.Seq
+	}
+	m.save()
+	m.mu.Unlock()
+	m.notify(changed)
+	return changed
+}
+
+var meta *MetaStore
+
+func init() {
+	controlHandlers["meta-req"] = handleMetaRequest
+	controlHandlers["meta"] = handleMetaDelta
+}
+
+// requestMeta asks a newly connected peer for whatever changed since we last
+// synced with it. Metadata (topic, pins, notes) is only shared on the
+// primary network.
+func requestMeta(addr string) {
+	if len(netOf(addr)) > 0 {
+		return
+	}
+	sendSoon(addr, controlFrame("meta-req", metaRequest{meta.Synced(addr)}), metaSyncTimeout)
+}
+
+func handleMetaRequest(from string, data json.RawMessage) {
+	var r metaRequest
+	if len(netOf(from)) > 0 {
+		return
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return
+	}
+	go sendSoon(from, controlFrame("meta", meta.Delta(r.Since)), metaSyncTimeout)
+}
+
+func handleMetaDelta(from string, data json.RawMessage) {
+	var d MetaDelta
+	if len(netOf(from)) > 0 {
+		return
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+	changed := meta.Merge(from, d)
+	if len(changed) == 0 {
+		return
+	}
+	// Pass what was news to us along to everyone else. Our own sequence
+	// numbers describe the forwarded delta.
+	fwd := MetaDelta{Since: changed[0].Seq - 1, Seq: changed[len(changed)-1].Seq, Entries: changed}
+	for addr := range netPeers("") {
+		if addr != from {
+			go sendSoon(addr, controlFrame("meta", fwd), metaSyncTimeout)
+		}
+	}
+}
+
+// setMeta changes a key locally and pushes it to connected peers.
+func setMeta(key string, value string) {
+	announceMeta(meta.Set(key, value))
+}
+
+func deleteMeta(key string) {
+	announceMeta(meta.Delete(key))
+}
+
+func announceMeta(d MetaDelta) {
+	if len(d.Entries) == 0 {
+		return
+	}
+	for addr := range netPeers("") {
+		go sendSoon(addr, controlFrame("meta", d), metaSyncTimeout)
+	}
+}
+
+func showTopic() {
+	if topic, ok := meta.Get("topic"); ok && len(topic) > 0 {
+		statusLn(tr("Topic: %s", topic))
+	} else {
+		statusLn(tr("No topic set"))
+	}
+}
+
+func watchTopic() {
+	meta.Watch("topic", func(e MetaEntry) {
+		statusLn(tr("%s set the topic: %s", nickName(e.Origin), e.Value))
+	})
+}
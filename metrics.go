@@ -0,0 +1,149 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Metrics
+ *
+ * -metrics-addr serves /metrics in the Prometheus text format, for
+ * monitoring long-running nodes. The dashboard serves it too. Per-peer
+ * series are labeled with the fingerprint of the peer's pinned key, or
+ * its address until we have one, and its nickname; per-room series with
+ * the room, the main one being "". Peers and rooms beyond
+ * -metrics-max-peers are grouped as "other".
+ */
+
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handleMetrics)
+	logger.Error(T("Error serving metrics"), "event", "metrics", "err", http.ListenAndServe(addr, mux))
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
+
+func writeMetrics(w io.Writer) {
+	counter := func(name string, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	gauge := func(name string, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	counter("sweetnothings_messages_sent_total", "Messages we wrote.", atomic.LoadUint64(&stats.Sent))
+	counter("sweetnothings_messages_received_total", "New messages received.", atomic.LoadUint64(&stats.Received))
+	counter("sweetnothings_messages_duplicate_total", "Messages received that we'd already seen.", atomic.LoadUint64(&stats.Duplicates))
+	counter("sweetnothings_messages_relayed_total", "Messages passed on to a peer.", atomic.LoadUint64(&stats.Relayed))
+	counter("sweetnothings_messages_dropped_total", "Messages dropped because a peer's queue was full.", atomic.LoadUint64(&stats.Dropped))
+	counter("sweetnothings_messages_limited_total", "Messages dropped for being over -peer-rate.", atomic.LoadUint64(&stats.Limited))
+	counter("sweetnothings_relays_throttled_total", "Relays held back by -relay-limit or to make way for our own messages.", atomic.LoadUint64(&stats.Throttled))
+	counter("sweetnothings_dial_failures_total", "Dials that failed.", atomic.LoadUint64(&stats.DialFailures))
+	gauge("sweetnothings_peers", "Peers linked to now.", float64(len(peers.Channels())))
+	gauge("sweetnothings_start_time_seconds", "When the node started, in seconds since the epoch.", float64(stats.Started.UnixNano())/float64(time.Second))
+
+	// Several addresses can share a key, so their counters add up.
+	byPeer := make(map[string]PeerStats)
+	for addr, ps := range stats.Peers() {
+		l := peerMetricLabels(addr)
+		sum := byPeer[l]
+		sum.BytesIn += ps.BytesIn
+		sum.BytesOut += ps.BytesOut
+		sum.MessagesIn += ps.MessagesIn
+		sum.MessagesOut += ps.MessagesOut
+		sum.Dropped += ps.Dropped
+		byPeer[l] = sum
+	}
+	labels := make([]string, 0, len(byPeer))
+	for l := range byPeer {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	series := []struct {
+		name string
+		help string
+		get  func(PeerStats) uint64
+	}{
+		{"sweetnothings_peer_bytes_received_total", "Bytes read from a peer.", func(ps PeerStats) uint64 { return ps.BytesIn }},
+		{"sweetnothings_peer_bytes_sent_total", "Bytes written to a peer.", func(ps PeerStats) uint64 { return ps.BytesOut }},
+		{"sweetnothings_peer_messages_received_total", "Messages a peer wrote.", func(ps PeerStats) uint64 { return ps.MessagesIn }},
+		{"sweetnothings_peer_messages_sent_total", "Messages written to a peer.", func(ps PeerStats) uint64 { return ps.MessagesOut }},
+		{"sweetnothings_peer_messages_dropped_total", "Messages dropped for a peer.", func(ps PeerStats) uint64 { return ps.Dropped }},
+	}
+	for _, s := range series {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", s.name, s.help, s.name)
+		for _, l := range labels {
+			fmt.Fprintf(w, "%s{%s} %d\n", s.name, l, s.get(byPeer[l]))
+		}
+	}
+
+	// The average over the samples /peers shows min/avg/p95 of; the slowest
+	// address when several share a label.
+	rtt := make(map[string]time.Duration)
+	for addr := range stats.Peers() {
+		if r, ok := peerRTT(addr); ok {
+			l := peerMetricLabels(addr)
+			rtt[l] = max(rtt[l], r.Avg)
+		}
+	}
+	fmt.Fprintf(w, "# HELP sweetnothings_peer_rtt_seconds Average round-trip time to a peer over recent pings.\n# TYPE sweetnothings_peer_rtt_seconds gauge\n")
+	for _, l := range labels {
+		if d, ok := rtt[l]; ok {
+			fmt.Fprintf(w, "sweetnothings_peer_rtt_seconds{%s} %s\n", l, strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+		}
+	}
+
+	byRoom := stats.Rooms()
+	rooms := make([]string, 0, len(byRoom))
+	for room := range byRoom {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	roomSeries := []struct {
+		name string
+		help string
+		get  func(RoomStats) uint64
+	}{
+		{"sweetnothings_room_messages_received_total", "New messages received in a room.", func(rs RoomStats) uint64 { return rs.MessagesIn }},
+		{"sweetnothings_room_messages_sent_total", "Messages we wrote in a room.", func(rs RoomStats) uint64 { return rs.MessagesOut }},
+	}
+	for _, s := range roomSeries {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", s.name, s.help, s.name)
+		for _, room := range rooms {
+			fmt.Fprintf(w, "%s{room=\"%s\"} %d\n", s.name, metricLabel(room), s.get(byRoom[room]))
+		}
+	}
+}
+
+// peerMetricLabels labels addr's series by who it is rather than where:
+// the fingerprint of its pinned key if we have one, and its nickname.
+func peerMetricLabels(addr string) string {
+	if addr == otherLabel {
+		return `peer="other",nick=""`
+	}
+	peer := addr
+	knownKeys.Lock()
+	if k, ok := knownKeys.m[addr]; ok {
+		peer = fingerprint(k.Key)
+	}
+	knownKeys.Unlock()
+	nick := ""
+	if n := nickName(addr); n != addr {
+		nick = n
+	}
+	return fmt.Sprintf(`peer="%s",nick="%s"`, metricLabel(peer), metricLabel(nick))
+}
+
+// metricLabel escapes a label value.
+func metricLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
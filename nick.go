@@ -0,0 +1,82 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+/**
+ * Nicknames
+ *
+ * /nick <name> changes the name we go by: peers we're linked to are told
+ * with a nick frame, and anyone who connects later hears it in our
+ * hello. It's kept in the profile's config.json for next time. /setnick
+ * still gives others names of our choosing, which win over theirs.
+ */
+
+// offeredNick is the name we ask peers to show us as.
+var offeredNick string
+
+var nickMu sync.Mutex
+
+type nickChange struct {
+	Nick string
+}
+
+func init() {
+	controlHandlers["nick"] = handleNick
+}
+
+func ourNick() string {
+	nickMu.Lock()
+	defer nickMu.Unlock()
+	return offeredNick
+}
+
+func changeNick(name string) {
+	name = cleanNick(name)
+	if len(name) == 0 {
+		if nick := ourNick(); len(nick) > 0 {
+			statusLn(tr("You go by %s", nick))
+		} else {
+			statusLn(T("Usage: /nick <name>"))
+		}
+		return
+	}
+	nickMu.Lock()
+	offeredNick = name
+	nickMu.Unlock()
+	if !ephemeral {
+		profileConfig.Nick = name
+		if err := saveProfile(); err != nil {
+			logger.Error(T("Error saving profile"), "event", "nick", "err", err)
+		}
+	}
+	f := controlFrame("nick", nickChange{Nick: name})
+	for addr := range peers.Channels() {
+		go sendSoon(addr, f, sessionTimeout)
+	}
+	statusLn(tr("You now go by %s", name))
+}
+
+func handleNick(from string, data json.RawMessage) {
+	var n nickChange
+	if json.Unmarshal(data, &n) != nil {
+		return
+	}
+	if n.Nick = cleanNick(n.Nick); len(n.Nick) == 0 {
+		return
+	}
+	was := nickName(from)
+	handshakes.Lock()
+	h, ok := handshakes.m[from]
+	changed := ok && h.Nick != n.Nick
+	if changed {
+		h.Nick = n.Nick
+		handshakes.m[from] = h
+	}
+	handshakes.Unlock()
+	if changed {
+		statusLn(tr("%s now goes by %s", was, n.Nick))
+	}
+}
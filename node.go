@@ -0,0 +1,247 @@
+package sweetnothings
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Embedding
+ *
+ * Other Go programs can run a node in-process instead of the command:
+ *
+ *	n, err := sweetnothings.Start(sweetnothings.Config{Port: "9001", Nick: "bot"})
+ *	msgs, cancel := n.Subscribe()
+ *	n.Dial("localhost:9002")
+ *	n.Send("hello")
+ *
+ * A node's state is kept package-wide, as the command keeps it, so a
+ * process runs one node, once; Start fails after that, even once the
+ * node is closed, as Close drops its links but not the background work
+ * (pings, reminders, compaction) that goes on until the process exits.
+ * Settings Config doesn't cover keep their defaults. cmd/sweetnothings
+ * is the command.
+ */
+
+// Config is what Start needs to know about the node.
+type Config struct {
+	// Port is the port to listen on, or empty for the profile's.
+	Port string
+
+	// Dir is where to keep the profile, as -dir does; empty means
+	// ~/.sweetnothings. With Ephemeral nothing is kept at all.
+	Dir       string
+	Ephemeral bool
+
+	// Nick is the name to ask peers to show us as, and Peers are dialed
+	// once we're listening.
+	Nick  string
+	Peers []string
+
+	// Output gets the lines the command would print to the terminal; nil
+	// discards them.
+	Output io.Writer
+}
+
+// A Message is a chat message the node showed.
+type Message struct {
+	ID   string
+	From string
+	Nick string
+	Room string
+	Body string
+	Time time.Time
+}
+
+// A Peer is a node we have a link to.
+type Peer struct {
+	Addr      string
+	Nick      string
+	Transport string
+	Inbound   bool
+	Since     time.Time
+}
+
+// A Node is the running node Start returns.
+type Node struct {
+	l net.Listener
+}
+
+var started atomic.Bool
+
+// Start brings up a node as Config describes and starts serving peers.
+// Only one node can run in a process: Start returns an error if one has
+// already started, closed or not. If Start itself fails before the node
+// is listening, it can be tried again.
+func Start(c Config) (n *Node, err error) {
+	if started.Swap(true) {
+		return nil, errors.New(T("a node has already run in this process"))
+	}
+	begun := false
+	defer func() {
+		if err != nil && !begun {
+			started.Store(false)
+		}
+	}()
+
+	stdout = io.Discard
+	if c.Output != nil {
+		stdout = c.Output
+	}
+	dataRoot, ephemeral = c.Dir, c.Ephemeral
+	setupLocale("")
+	if !ephemeral {
+		if err := loadProfile(); err != nil {
+			return nil, fmt.Errorf("%s %w", T("Unable to load profile:"), err)
+		}
+	}
+	port := c.Port
+	if len(port) == 0 {
+		port = profileConfig.Port
+	}
+	if len(port) < 4 {
+		return nil, fmt.Errorf(T("Invalid listen port (%s)"), port)
+	}
+	offeredNick = cleanNick(c.Nick)
+	if len(offeredNick) == 0 {
+		offeredNick = cleanNick(profileConfig.Nick)
+	}
+	loadShunned()
+	if err := loadNodeKey(); err != nil {
+		return nil, fmt.Errorf("%s %w", T("Unable to load the node key:"), err)
+	}
+	if err := loadIdentity(); err != nil {
+		return nil, fmt.Errorf("%s %w", T("Unable to load the identity key:"), err)
+	}
+	if !ephemeral {
+		loadKnownKeys(filepath.Join(dataDir(), "known_keys.json"))
+	}
+
+	localInfo.ListenPort = port
+	// startNode sets off background work even when it fails to listen,
+	// so from here on Start is spent either way.
+	begun = true
+	l, err := startNode()
+	if err != nil {
+		return nil, err
+	}
+	go serve(l, "")
+	n = &Node{l: l}
+	for _, addr := range c.Peers {
+		n.Dial(addr)
+	}
+	return n, nil
+}
+
+// Addr is the address peers reach the node at.
+func (n *Node) Addr() string {
+	return localInfo.Addr()
+}
+
+// Dial links to addr in the background, redialing it if the link drops,
+// as /dial does.
+func (n *Node) Dial(addr string) {
+	addr = dialAddr(addr)
+	setNet(addr, currentNetwork())
+	pinPeer(addr)
+	go dial(addr)
+}
+
+// Send says body in the main room, whatever room is open at the node's
+// prompt, through the -outgoing pipeline and -max-body as if it were
+// typed.
+func (n *Node) Send(body string) (Message, error) {
+	whisper, err := prepareText(SweetNothing{Body: body})
+	if err != nil {
+		return Message{}, err
+	}
+	return newMessage(publish(whisper)), nil
+}
+
+// Subscribe returns a channel of the chat messages the node shows from
+// now on, and a function to stop. Messages are dropped for a subscriber
+// that falls subscriberBuffer behind.
+func (n *Node) Subscribe() (<-chan Message, func()) {
+	ch := make(chan Message, subscriberBuffer)
+	subscribers.Lock()
+	subscribers.m[ch] = true
+	subscribers.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subscribers.Lock()
+			delete(subscribers.m, ch)
+			subscribers.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Peers lists the nodes we have links to, by address.
+func (n *Node) Peers() []Peer {
+	var l []Peer
+	for addr := range peers.Channels() {
+		l = append(l, Peer{
+			Addr:      addr,
+			Nick:      nickName(addr),
+			Transport: peers.Transport(addr),
+			Inbound:   peers.Inbound(addr),
+			Since:     peers.Since(addr),
+		})
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Addr < l[j].Addr })
+	return l
+}
+
+// Close stops accepting links and drops the ones the node has, without
+// redialing them. The node's background work keeps running until the
+// process exits, and no other node can be started in its place.
+func (n *Node) Close() error {
+	err := n.l.Close()
+	for addr := range peers.Channels() {
+		noReconnect(addr)
+		peers.Disconnect(addr)
+	}
+	return err
+}
+
+const subscriberBuffer = 64
+
+var subscribers = struct {
+	m map[chan Message]bool
+	sync.Mutex
+}{m: make(map[chan Message]bool)}
+
+func newMessage(whisper SweetNothing) Message {
+	return Message{
+		ID:   whisper.ID,
+		From: whisper.Addr,
+		Nick: nickName(whisper.Addr),
+		Room: whisper.Room,
+		Body: whisper.Body,
+		Time: whisper.Timestamp,
+	}
+}
+
+// deliver hands a message we showed to the subscribers.
+func deliver(whisper SweetNothing) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	if len(subscribers.m) == 0 {
+		return
+	}
+	m := newMessage(whisper)
+	for ch := range subscribers.m {
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
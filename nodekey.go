@@ -0,0 +1,44 @@
+package sweetnothings
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// nodeKey is our long-term X25519 key, used by the Noise transport and
+// end-to-end encryption.
+var nodeKey *ecdh.PrivateKey
+
+// fingerprint is a readable form of a key, long enough that nobody can
+// make another key to match it.
+func fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:16])
+}
+
+// loadNodeKey reads our key from the profile, creating it on first run.
+func loadNodeKey() error {
+	if ephemeral {
+		k, err := ecdh.X25519().GenerateKey(rand.Reader)
+		nodeKey = k
+		return err
+	}
+	path := filepath.Join(dataDir(), "node.key")
+	b, err := os.ReadFile(path)
+	if err == nil {
+		nodeKey, err = ecdh.X25519().NewPrivateKey(b)
+		return err
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if nodeKey, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return err
+	}
+	os.MkdirAll(dataDir(), 0700)
+	return os.WriteFile(path, nodeKey.Bytes(), 0600)
+}
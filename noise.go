@@ -0,0 +1,408 @@
+package sweetnothings
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+/**
+ * Noise transport
+ *
+ * With -noise every peer link runs a Noise XX handshake before anything
+ * else, so both ends learn each other's node key and the link is
+ * encrypted without certificates. We use Noise_XX_25519_AESGCM_SHA256:
+ * ChaChaPoly isn't in the standard library, and AES-GCM is an equally
+ * standard choice. Handshake and transport messages are framed with a
+ * two-byte length as usual for Noise over TCP.
+ */
+
+const noiseProtocol = "Noise_XX_25519_AESGCM_SHA256"
+
+const noiseMaxMessage = 65535
+
+const noiseTagSize = 16
+
+var noiseEnabled bool
+
+// The static keys peers proved they hold, by address.
+var linkKeys = struct {
+	m map[string][]byte
+	sync.Mutex
+}{m: make(map[string][]byte)}
+
+func setLinkKey(addr string, key []byte) {
+	if len(addr) == 0 || key == nil {
+		return
+	}
+	linkKeys.Lock()
+	defer linkKeys.Unlock()
+	linkKeys.m[addr] = key
+}
+
+// linkKey is the static key addr proved it holds, if its link runs Noise.
+func linkKey(addr string) ([]byte, bool) {
+	linkKeys.Lock()
+	defer linkKeys.Unlock()
+	key, ok := linkKeys.m[addr]
+	return key, ok
+}
+
+/**
+ * Handshake state
+ */
+type noiseCipher struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func newNoiseCipher(k []byte) *noiseCipher {
+	block, _ := aes.NewCipher(k)
+	aead, _ := cipher.NewGCM(block)
+	return &noiseCipher{aead: aead}
+}
+
+// AESGCM nonces are 32 zero bits followed by the big-endian counter.
+func (c *noiseCipher) nonce() []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], c.n)
+	c.n++
+	return nonce
+}
+
+func (c *noiseCipher) encrypt(ad []byte, plaintext []byte) []byte {
+	return c.aead.Seal(nil, c.nonce(), plaintext, ad)
+}
+
+func (c *noiseCipher) decrypt(ad []byte, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nonce(), ciphertext, ad)
+}
+
+type noiseSymmetric struct {
+	ck, h []byte
+	c     *noiseCipher
+}
+
+func newNoiseSymmetric() *noiseSymmetric {
+	h := make([]byte, sha256.Size)
+	copy(h, noiseProtocol)
+	s := &noiseSymmetric{ck: append([]byte(nil), h...), h: h}
+	// An empty prologue.
+	s.mixHash(nil)
+	return s
+}
+
+// noiseHKDF is HKDF as the Noise spec defines it, returning two outputs.
+func noiseHKDF(ck []byte, ikm []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write(ikm)
+	temp := mac.Sum(nil)
+	mac = hmac.New(sha256.New, temp)
+	mac.Write([]byte{1})
+	out1 := mac.Sum(nil)
+	mac = hmac.New(sha256.New, temp)
+	mac.Write(out1)
+	mac.Write([]byte{2})
+	return out1, mac.Sum(nil)
+}
+
+func (s *noiseSymmetric) mixHash(data []byte) {
+	sum := sha256.Sum256(append(append([]byte(nil), s.h...), data...))
+	s.h = sum[:]
+}
+
+func (s *noiseSymmetric) mixKey(ikm []byte) {
+	var k []byte
+	s.ck, k = noiseHKDF(s.ck, ikm)
+	s.c = newNoiseCipher(k[:32])
+}
+
+func (s *noiseSymmetric) encryptAndHash(plaintext []byte) []byte {
+	if s.c == nil {
+		s.mixHash(plaintext)
+		return plaintext
+	}
+	ct := s.c.encrypt(s.h, plaintext)
+	s.mixHash(ct)
+	return ct
+}
+
+func (s *noiseSymmetric) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	if s.c == nil {
+		s.mixHash(ciphertext)
+		return ciphertext, nil
+	}
+	pt, err := s.c.decrypt(s.h, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return pt, nil
+}
+
+func (s *noiseSymmetric) split() (*noiseCipher, *noiseCipher) {
+	k1, k2 := noiseHKDF(s.ck, nil)
+	return newNoiseCipher(k1[:32]), newNoiseCipher(k2[:32])
+}
+
+func dh(priv *ecdh.PrivateKey, pub []byte) ([]byte, error) {
+	p, err := ecdh.X25519().NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(p)
+}
+
+/**
+ * noiseConn
+ */
+type noiseConn struct {
+	net.Conn
+	initiator bool
+
+	once      sync.Once
+	err       error
+	send      *noiseCipher
+	recv      *noiseCipher
+	remoteKey []byte
+
+	readBuf []byte
+	rmu     sync.Mutex
+	wmu     sync.Mutex
+}
+
+func (c *noiseConn) writeMessage(b []byte) error {
+	if len(b) > noiseMaxMessage {
+		return errors.New("noise: message too long")
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+func (c *noiseConn) readMessage() ([]byte, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(c.Conn, n[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(n[:]))
+	_, err := io.ReadFull(c.Conn, b)
+	return b, err
+}
+
+// Handshake runs the XX pattern:
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s, se
+func (c *noiseConn) Handshake() error {
+	c.once.Do(func() {
+		c.err = c.handshake()
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+	return c.err
+}
+
+func (c *noiseConn) handshake() error {
+	s := newNoiseSymmetric()
+	e, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	mix := func(priv *ecdh.PrivateKey, pub []byte) error {
+		shared, err := dh(priv, pub)
+		if err == nil {
+			s.mixKey(shared)
+		}
+		return err
+	}
+	pubLen := len(e.PublicKey().Bytes())
+	if c.initiator {
+		// -> e
+		s.mixHash(e.PublicKey().Bytes())
+		if err := c.writeMessage(append(e.PublicKey().Bytes(), s.encryptAndHash(nil)...)); err != nil {
+			return err
+		}
+		// <- e, ee, s, es
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if len(msg) < pubLen+pubLen+noiseTagSize {
+			return errors.New("noise: short handshake message")
+		}
+		re := msg[:pubLen]
+		s.mixHash(re)
+		if err := mix(e, re); err != nil {
+			return err
+		}
+		rs, err := s.decryptAndHash(msg[pubLen : 2*pubLen+noiseTagSize])
+		if err != nil {
+			return err
+		}
+		if err := mix(e, rs); err != nil {
+			return err
+		}
+		if _, err := s.decryptAndHash(msg[2*pubLen+noiseTagSize:]); err != nil {
+			return err
+		}
+		// -> s, se
+		out := s.encryptAndHash(nodeKey.PublicKey().Bytes())
+		if err := mix(nodeKey, re); err != nil {
+			return err
+		}
+		out = append(out, s.encryptAndHash(nil)...)
+		if err := c.writeMessage(out); err != nil {
+			return err
+		}
+		c.remoteKey = rs
+		c.send, c.recv = s.split()
+		return nil
+	}
+
+	// -> e
+	msg, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+	if len(msg) < pubLen {
+		return errors.New("noise: short handshake message")
+	}
+	re := msg[:pubLen]
+	s.mixHash(re)
+	if _, err := s.decryptAndHash(msg[pubLen:]); err != nil {
+		return err
+	}
+	// <- e, ee, s, es
+	s.mixHash(e.PublicKey().Bytes())
+	out := append([]byte(nil), e.PublicKey().Bytes()...)
+	if err := mix(e, re); err != nil {
+		return err
+	}
+	out = append(out, s.encryptAndHash(nodeKey.PublicKey().Bytes())...)
+	if err := mix(nodeKey, re); err != nil {
+		return err
+	}
+	out = append(out, s.encryptAndHash(nil)...)
+	if err := c.writeMessage(out); err != nil {
+		return err
+	}
+	// -> s, se
+	if msg, err = c.readMessage(); err != nil {
+		return err
+	}
+	if len(msg) < pubLen+noiseTagSize {
+		return errors.New("noise: short handshake message")
+	}
+	rs, err := s.decryptAndHash(msg[:pubLen+noiseTagSize])
+	if err != nil {
+		return err
+	}
+	if err := mix(e, rs); err != nil {
+		return err
+	}
+	if _, err := s.decryptAndHash(msg[pubLen+noiseTagSize:]); err != nil {
+		return err
+	}
+	c.remoteKey = rs
+	c.recv, c.send = s.split()
+	return nil
+}
+
+func (c *noiseConn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for len(c.readBuf) == 0 {
+		msg, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if c.readBuf, err = c.recv.decrypt(nil, msg); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *noiseConn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > noiseMaxMessage-noiseTagSize {
+			chunk = chunk[:noiseMaxMessage-noiseTagSize]
+		}
+		if err := c.writeMessage(c.send.encrypt(nil, chunk)); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// RemoteKey is the static key the peer proved it holds, after the
+// handshake.
+func (c *noiseConn) RemoteKey() []byte {
+	if c.Handshake() != nil {
+		return nil
+	}
+	return c.remoteKey
+}
+
+func (c *noiseConn) Transport() string {
+	return "noise"
+}
+
+type noiseListener struct {
+	net.Listener
+}
+
+func (l noiseListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &noiseConn{Conn: c}, nil
+}
+
+func dialNoise(addr string) (net.Conn, error) {
+	c, err := dialTCP(addr)
+	if err != nil {
+		return nil, err
+	}
+	nc := &noiseConn{Conn: c, initiator: true}
+	if err := nc.Handshake(); err != nil {
+		return nil, err
+	}
+	return nc, nil
+}
+
+// remoteKey returns the peer's proven key for links that have one.
+func remoteKey(c net.Conn) []byte {
+	if nc, ok := c.(*noiseConn); ok {
+		return nc.RemoteKey()
+	}
+	return nil
+}
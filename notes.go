@@ -0,0 +1,241 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Shared notes are documents of lines replicated through the metadata store
+// as an RGA sequence: every line records the line it was inserted after, and
+// lines inserted after the same one are ordered newest first. Each line's
+// text is its own register, and deleting a line writes a separate
+// tombstone key so a concurrent edit can't bring it back.
+
+const notesPrefix = "notes/"
+
+type noteLine struct {
+	After  string
+	Clock  uint64
+	Origin string
+	Text   string
+
+	id   string
+	gone bool
+}
+
+func (l noteLine) before(o noteLine) bool {
+	if l.Clock != o.Clock {
+		return l.Clock > o.Clock
+	}
+	return l.Origin > o.Origin
+}
+
+func noteKey(doc string) string {
+	return notesPrefix + url.PathEscape(doc) + "/"
+}
+
+// noteLines returns every line of doc in document order, deleted ones
+// included, since they still anchor the lines inserted after them.
+func noteLines(doc string) []noteLine {
+	prefix := noteKey(doc)
+	lines := make(map[string]*noteLine)
+	gone := make(map[string]bool)
+	for _, e := range meta.Prefix(prefix) {
+		id := strings.TrimPrefix(e.Key, prefix)
+		if strings.HasSuffix(id, "/gone") {
+			gone[strings.TrimSuffix(id, "/gone")] = true
+			continue
+		}
+		var l noteLine
+		if err := json.Unmarshal([]byte(e.Value), &l); err != nil {
+			continue
+		}
+		l.id = id
+		lines[id] = &l
+	}
+
+	children := make(map[string][]*noteLine)
+	for _, l := range lines {
+		l.gone = gone[l.id]
+		children[l.After] = append(children[l.After], l)
+	}
+	for _, c := range children {
+		sort.Slice(c, func(i, j int) bool { return c[i].before(*c[j]) })
+	}
+
+	var out []noteLine
+	var walk func(id string)
+	walk = func(id string) {
+		for _, l := range children[id] {
+			out = append(out, *l)
+			walk(l.id)
+		}
+	}
+	walk("")
+	return out
+}
+
+func visibleLines(doc string) []noteLine {
+	var l []noteLine
+	for _, line := range noteLines(doc) {
+		if !line.gone {
+			l = append(l, line)
+		}
+	}
+	return l
+}
+
+func writeNoteLine(doc string, l noteLine) {
+	b, _ := json.Marshal(l)
+	setMeta(noteKey(doc)+l.id, string(b))
+}
+
+// insertNote adds a line after visible line n (0 for the top, -1 for the
+// end).
+func insertNote(doc string, n int, text string) error {
+	all := noteLines(doc)
+	after := ""
+	if n < 0 {
+		if len(all) > 0 {
+			after = all[len(all)-1].id
+		}
+	} else if n > 0 {
+		vis := visibleLines(doc)
+		if n > len(vis) {
+			return fmt.Errorf(T("%s has %d lines"), doc, len(vis))
+		}
+		after = vis[n-1].id
+	}
+	l := noteLine{After: after, Clock: meta.Clock() + 1, Origin: localInfo.Addr(), Text: text}
+	l.id = fmt.Sprintf("%d-%s", l.Clock, l.Origin)
+	writeNoteLine(doc, l)
+	return nil
+}
+
+func noteLineAt(doc string, n int) (noteLine, error) {
+	vis := visibleLines(doc)
+	if n < 1 || n > len(vis) {
+		return noteLine{}, fmt.Errorf(T("%s has no line %d"), doc, n)
+	}
+	return vis[n-1], nil
+}
+
+func editNote(doc string, n int, text string) error {
+	l, err := noteLineAt(doc, n)
+	if err != nil {
+		return err
+	}
+	l.Text = text
+	writeNoteLine(doc, l)
+	return nil
+}
+
+func deleteNote(doc string, n int) error {
+	l, err := noteLineAt(doc, n)
+	if err != nil {
+		return err
+	}
+	setMeta(noteKey(doc)+l.id+"/gone", "")
+	return nil
+}
+
+func noteDocs() []string {
+	seen := make(map[string]bool)
+	var docs []string
+	for _, e := range meta.Prefix(notesPrefix) {
+		rest := strings.TrimPrefix(e.Key, notesPrefix)
+		name, err := url.PathUnescape(rest[:strings.Index(rest, "/")])
+		if err == nil && !seen[name] {
+			seen[name] = true
+			docs = append(docs, name)
+		}
+	}
+	return docs
+}
+
+func showNote(doc string) {
+	vis := visibleLines(doc)
+	if len(vis) == 0 {
+		statusLn(tr("Note %s is empty", doc))
+		return
+	}
+	if accessible {
+		fmt.Fprintln(stdout, tr("Note %s, %d lines", doc, len(vis)))
+	} else {
+		fmt.Fprintln(stdout, bold(fmt.Sprintf("--- %s ---", doc)))
+	}
+	for i, l := range vis {
+		if accessible {
+			fmt.Fprintln(stdout, tr("Line %d: %s", i+1, l.Text))
+		} else {
+			fmt.Fprintf(stdout, "%3d  %s\n", i+1, l.Text)
+		}
+	}
+}
+
+// handleNote runs "/note [doc [add|insert n|edit n|del n] [text]]".
+func handleNote(args []string) {
+	if len(args) == 0 {
+		docs := noteDocs()
+		if len(docs) == 0 {
+			statusLn(tr("No notes yet; try /note <name> add <text>"))
+		} else {
+			statusLn(tr("Notes: %s", strings.Join(docs, ", ")))
+		}
+		return
+	}
+	doc := strings.ToLower(args[0])
+	if len(args) == 1 {
+		showNote(doc)
+		return
+	}
+
+	var err error
+	op, rest := strings.ToLower(args[1]), args[2:]
+	switch op {
+	case "add":
+		err = insertNote(doc, -1, strings.Join(rest, " "))
+	case "insert", "edit", "del":
+		if len(rest) == 0 {
+			err = fmt.Errorf(T("usage: /note %s %s <line> ..."), doc, op)
+			break
+		}
+		n, convErr := strconv.Atoi(rest[0])
+		if convErr != nil {
+			err = fmt.Errorf(T("bad line number %q"), rest[0])
+			break
+		}
+		text := strings.Join(rest[1:], " ")
+		switch op {
+		case "insert":
+			err = insertNote(doc, n, text)
+		case "edit":
+			err = editNote(doc, n, text)
+		case "del":
+			err = deleteNote(doc, n)
+		}
+	default:
+		err = fmt.Errorf(T("unknown note command %q"), op)
+	}
+	if err != nil {
+		statusLn(err.Error())
+		return
+	}
+	showNote(doc)
+}
+
+func watchNotes() {
+	meta.Watch(notesPrefix, func(e MetaEntry) {
+		if e.Origin == localInfo.Addr() {
+			return
+		}
+		rest := strings.TrimPrefix(e.Key, notesPrefix)
+		if doc, err := url.PathUnescape(rest[:strings.Index(rest, "/")]); err == nil {
+			statusLn(tr("%s edited note %s", nickName(e.Origin), doc))
+		}
+	})
+}
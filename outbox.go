@@ -0,0 +1,183 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Outbox
+ *
+ * Messages a peer can't take right now wait in its outbox instead of
+ * being dropped: ones that find its writer busy, and ones we write while
+ * we're reconnecting to it. The writer sends them when it's free, or as
+ * soon as the link is back. Each outbox keeps maxOutbox frames, dropping
+ * the oldest beyond that, or with -drop-policy newest refusing new ones.
+ * With -persist-outbox they're kept in the profile's outbox.json, so they
+ * survive a restart too.
+ */
+
+const maxOutbox = 200
+
+const (
+	dropOldest = "oldest"
+	dropNewest = "newest"
+)
+
+var dropPolicy = dropOldest
+
+const outboxSaveEvery = 5 * time.Second
+
+var persistOutbox bool
+
+var outbox = struct {
+	m     map[string][]Frame
+	path  string
+	dirty bool
+	sync.Mutex
+}{m: make(map[string][]Frame)}
+
+// enqueue holds f for addr until it can be sent.
+func enqueue(addr string, f Frame) {
+	outbox.Lock()
+	defer outbox.Unlock()
+	setOutbox(addr, append(outbox.m[addr], f))
+}
+
+// setOutbox keeps maxOutbox of q for addr as dropPolicy says. It must be
+// called with outbox locked.
+func setOutbox(addr string, q []Frame) {
+	if len(q) > maxOutbox {
+		n := uint64(len(q) - maxOutbox)
+		atomic.AddUint64(&stats.Dropped, n)
+		atomic.AddUint64(&stats.Peer(addr).Dropped, n)
+		if dropPolicy == dropNewest {
+			q = q[:maxOutbox]
+		} else {
+			q = q[len(q)-maxOutbox:]
+		}
+	}
+	outbox.m[addr] = q
+	outbox.dirty = true
+}
+
+// requeue puts frames back at the front of addr's outbox, oldest first.
+func requeue(addr string, frames []Frame) {
+	if len(frames) == 0 {
+		return
+	}
+	outbox.Lock()
+	defer outbox.Unlock()
+	setOutbox(addr, append(append([]Frame(nil), frames...), outbox.m[addr]...))
+}
+
+// nextQueued takes the oldest frame waiting for addr.
+func nextQueued(addr string) (Frame, bool) {
+	outbox.Lock()
+	defer outbox.Unlock()
+	q := outbox.m[addr]
+	if len(q) == 0 {
+		return Frame{}, false
+	}
+	if len(q) == 1 {
+		delete(outbox.m, addr)
+	} else {
+		outbox.m[addr] = q[1:]
+	}
+	outbox.dirty = true
+	return q[0], true
+}
+
+func queued(addr string) int {
+	outbox.Lock()
+	defer outbox.Unlock()
+	return len(outbox.m[addr])
+}
+
+// drainLink moves the messages still buffered for addr to its outbox as
+// the link closes.
+func drainLink(addr string, ch <-chan Frame) {
+	for {
+		select {
+		case f := <-ch:
+			if f.Type == msgFrame {
+				enqueue(addr, f)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// lostPeers are the peers on network we're trying to get back.
+func lostPeers(network string) []string {
+	reconnects.Lock()
+	defer reconnects.Unlock()
+	var l []string
+	for addr := range reconnects.active {
+		if netOf(addr) == network && peers.Get(addr) == nil {
+			l = append(l, addr)
+		}
+	}
+	return l
+}
+
+func loadOutbox(path string) {
+	outbox.Lock()
+	defer outbox.Unlock()
+	outbox.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, &outbox.m); err != nil {
+		logger.Warn(T("Discarding unreadable outbox"), "event", "outbox", "err", err)
+		outbox.m = make(map[string][]Frame)
+	}
+}
+
+// saveOutbox writes the outbox out if it has changed.
+func saveOutbox() {
+	outbox.Lock()
+	defer outbox.Unlock()
+	if len(outbox.path) == 0 || !outbox.dirty {
+		return
+	}
+	b, err := json.Marshal(outbox.m)
+	if err == nil {
+		os.MkdirAll(filepath.Dir(outbox.path), 0700)
+		tmp := outbox.path + ".tmp"
+		if err = os.WriteFile(tmp, b, 0600); err == nil {
+			err = os.Rename(tmp, outbox.path)
+		}
+	}
+	if err != nil {
+		logger.Error(T("Error saving outbox"), "event", "outbox", "path", outbox.path, "err", err)
+		return
+	}
+	outbox.dirty = false
+}
+
+// dialOutbox reaches out to peers that messages saved last time are
+// waiting for.
+func dialOutbox() {
+	outbox.Lock()
+	var addrs []string
+	for addr := range outbox.m {
+		addrs = append(addrs, addr)
+	}
+	outbox.Unlock()
+	for _, addr := range addrs {
+		go keepDialing(addr)
+	}
+}
+
+func startOutboxSaver() {
+	for range time.Tick(outboxSaveEvery) {
+		saveOutbox()
+	}
+}
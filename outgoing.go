@@ -0,0 +1,185 @@
+package sweetnothings
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/**
+ * Outgoing middleware
+ *
+ * Each -outgoing flag adds a step, in order, to the pipeline our chat
+ * messages go through before they're sent. A step is "name" or
+ * "name=arg"; plugins add their own with RegisterMiddleware.
+ */
+
+// A Middleware rewrites an outgoing message. Returning an error stops the
+// message from being sent.
+type Middleware func(whisper SweetNothing) (SweetNothing, error)
+
+// A MiddlewareFactory builds a Middleware from the text after "name=".
+type MiddlewareFactory func(arg string) (Middleware, error)
+
+var middlewareFactories = make(map[string]MiddlewareFactory)
+
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	middlewareFactories[name] = factory
+}
+
+var outgoing []Middleware
+
+// outgoingFlag collects -outgoing steps.
+type outgoingFlag struct{}
+
+func (outgoingFlag) String() string { return "" }
+
+func (outgoingFlag) Set(v string) error {
+	name, arg := v, ""
+	if i := strings.Index(v, "="); i >= 0 {
+		name, arg = v[:i], v[i+1:]
+	}
+	factory, ok := middlewareFactories[name]
+	if !ok {
+		return fmt.Errorf(T("unknown middleware %q"), name)
+	}
+	m, err := factory(arg)
+	if err != nil {
+		return err
+	}
+	outgoing = append(outgoing, m)
+	return nil
+}
+
+// runOutgoing passes whisper through the pipeline. Only messages with
+// free text go through it; vote choices and the like are left alone.
+func runOutgoing(whisper SweetNothing) (SweetNothing, error) {
+	if whisper.Kind != "" && whisper.Kind != askKind && whisper.Kind != editKind && whisper.Kind != dmKind {
+		return whisper, nil
+	}
+	for _, m := range outgoing {
+		var err error
+		if whisper, err = m(whisper); err != nil {
+			return whisper, err
+		}
+	}
+	return whisper, nil
+}
+
+// prepareText readies a message we typed for publish: the pipeline and
+// -max-body. The message stays in the room it names, so anything typed
+// should say activeRoom().
+func prepareText(whisper SweetNothing) (SweetNothing, error) {
+	whisper, err := runOutgoing(whisper)
+	if err != nil {
+		return whisper, err
+	}
+	return limitOutgoing(whisper)
+}
+
+// publishText runs a message we typed through the pipeline and publishes
+// it, reporting whether it was sent.
+func publishText(whisper SweetNothing) (SweetNothing, bool) {
+	whisper, err := prepareText(whisper)
+	if err != nil {
+		statusLn(tr("Not sent: %v", err))
+		return whisper, false
+	}
+	return publish(whisper), true
+}
+
+func init() {
+	RegisterMiddleware("emoji", func(string) (Middleware, error) {
+		return expandEmoji, nil
+	})
+	RegisterMiddleware("capitalize", func(string) (Middleware, error) {
+		return capitalize, nil
+	})
+	RegisterMiddleware("redact", newRedactor)
+	RegisterMiddleware("signature", newSignature)
+}
+
+// capitalize upper-cases the first letter of each sentence.
+func capitalize(whisper SweetNothing) (SweetNothing, error) {
+	// Leave anything starting with a URL or a path as typed.
+	if strings.Contains(firstWord(whisper.Body), "/") {
+		return whisper, nil
+	}
+	var b strings.Builder
+	start := true
+	for _, r := range whisper.Body {
+		if start && unicode.IsLetter(r) {
+			r = unicode.ToUpper(r)
+			start = false
+		} else if r == '.' || r == '!' || r == '?' {
+			start = true
+		} else if !unicode.IsSpace(r) {
+			start = false
+		}
+		b.WriteRune(r)
+	}
+	whisper.Body = b.String()
+	return whisper, nil
+}
+
+func firstWord(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// Secrets that are redacted by a bare "redact" step.
+var secretPatterns = []string{
+	`AKIA[0-9A-Z]{16}`,
+	`gh[pousr]_[A-Za-z0-9]{36,}`,
+	`xox[abpr]-[A-Za-z0-9-]{10,}`,
+	`sk-[A-Za-z0-9]{20,}`,
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+	`(?i)(password|passwd|secret|token)\s*[=:]\s*\S+`,
+}
+
+func newRedactor(arg string) (Middleware, error) {
+	patterns := secretPatterns
+	if len(arg) > 0 {
+		patterns = []string{arg}
+	}
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return func(whisper SweetNothing) (SweetNothing, error) {
+		for _, re := range res {
+			whisper.Body = re.ReplaceAllString(whisper.Body, "[redacted]")
+		}
+		return whisper, nil
+	}, nil
+}
+
+// newSignature appends text to each message, or only to one channel's
+// with "#channel=text".
+func newSignature(arg string) (Middleware, error) {
+	channel, text := "", arg
+	if strings.HasPrefix(arg, "#") {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			return nil, fmt.Errorf(T("expected #channel=text, got %q"), arg)
+		}
+		channel, text = arg[:i], arg[i+1:]
+	}
+	if len(text) == 0 {
+		return nil, errors.New(T("empty signature"))
+	}
+	return func(whisper SweetNothing) (SweetNothing, error) {
+		if len(channel) == 0 || whisper.Channel() == channel {
+			whisper.Body += " " + text
+		}
+		return whisper, nil
+	}, nil
+}
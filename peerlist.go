@@ -0,0 +1,113 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+ * Remembered peers
+ *
+ * Every peer we link to is remembered in the profile's peers.json, along
+ * with its network and when we last linked, and redialed on startup so a
+ * restarted node finds its way back into the mesh by itself. Peers we
+ * haven't linked to in rememberFor are left out, and /forget drops one
+ * for good.
+ */
+
+const rememberFor = 30 * 24 * time.Hour
+
+var redialPeers = true
+
+type rememberedPeer struct {
+	Net  string `json:",omitempty"`
+	Last time.Time
+}
+
+var remembered = struct {
+	m    map[string]rememberedPeer
+	path string
+	sync.Mutex
+}{m: make(map[string]rememberedPeer)}
+
+func loadRememberedPeers(path string) {
+	remembered.Lock()
+	defer remembered.Unlock()
+	remembered.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, &remembered.m); err != nil {
+		logger.Warn(T("Discarding unreadable peer list"), "event", "peers", "err", err)
+		remembered.m = make(map[string]rememberedPeer)
+	}
+}
+
+// saveRememberedPeers must be called with remembered locked.
+func saveRememberedPeers() {
+	if len(remembered.path) == 0 {
+		return
+	}
+	b, err := json.MarshalIndent(remembered.m, "", "  ")
+	if err == nil {
+		os.MkdirAll(filepath.Dir(remembered.path), 0700)
+		tmp := remembered.path + ".tmp"
+		if err = os.WriteFile(tmp, b, 0600); err == nil {
+			err = os.Rename(tmp, remembered.path)
+		}
+	}
+	if err != nil {
+		logger.Error(T("Error saving peer list"), "event", "peers", "path", remembered.path, "err", err)
+	}
+}
+
+// rememberPeer notes that we've just linked to addr.
+func rememberPeer(addr string) {
+	if isLocal(addr) {
+		return
+	}
+	remembered.Lock()
+	defer remembered.Unlock()
+	remembered.m[addr] = rememberedPeer{Net: netOf(addr), Last: time.Now().UTC()}
+	saveRememberedPeers()
+}
+
+// unrememberPeer drops addr from the list, reporting whether it was on it.
+func unrememberPeer(addr string) bool {
+	remembered.Lock()
+	defer remembered.Unlock()
+	_, ok := remembered.m[addr]
+	if ok {
+		delete(remembered.m, addr)
+		saveRememberedPeers()
+	}
+	return ok
+}
+
+// dialRememberedPeers redials the peers we linked to recently, other than
+// those the profile dials anyway.
+func dialRememberedPeers() {
+	configured := make(map[string]bool)
+	for _, addr := range profileConfig.Peers {
+		configured[addr] = true
+	}
+	remembered.Lock()
+	l := make(map[string]rememberedPeer)
+	for addr, p := range remembered.m {
+		if time.Since(p.Last) < rememberFor && !configured[addr] {
+			l[addr] = p
+		}
+	}
+	remembered.Unlock()
+	if len(l) > 0 {
+		statusLn(tr("Redialing %d peers from last time", len(l)))
+	}
+	for addr, p := range l {
+		setNet(addr, p.Net)
+		go keepDialing(addr)
+	}
+}
@@ -0,0 +1,66 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+)
+
+/**
+ * Peer exchange
+ *
+ * Each time we connect to a peer we tell it who else we're connected to on
+ * its network, and it dials the ones it doesn't know yet. That way the
+ * mesh fills in by itself after a single /dial, and a node that loses a
+ * link usually knows someone else to reach.
+ */
+
+var pexEnabled = true
+
+// Most addresses sent in one exchange.
+const maxExchange = 50
+
+type peerList struct {
+	Peers []string
+}
+
+func init() {
+	controlHandlers["pex"] = handlePex
+}
+
+// exchangePeers sends addr the peers we know on its network.
+func exchangePeers(addr string) {
+	if !pexEnabled || rendezvousMode {
+		return
+	}
+	var l peerList
+	for p := range netPeers(netOf(addr)) {
+		// A ws:// URL is however we reached that peer, which may not
+		// work from elsewhere.
+		if p != addr && !isWebSocket(p) && len(l.Peers) < maxExchange {
+			l.Peers = append(l.Peers, p)
+		}
+	}
+	if len(l.Peers) > 0 {
+		sendSoon(addr, controlFrame("pex", l), sessionTimeout)
+	}
+}
+
+func handlePex(from string, data json.RawMessage) {
+	var l peerList
+	if !pexEnabled || rendezvousMode {
+		return
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return
+	}
+	network := netOf(from)
+	for i, p := range l.Peers {
+		if i >= maxExchange {
+			break
+		}
+		if isLocal(p) || peers.Get(p) != nil {
+			continue
+		}
+		setNet(p, network)
+		go autoDial(p)
+	}
+}
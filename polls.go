@@ -0,0 +1,184 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	pollKind = "poll"
+	voteKind = "vote"
+)
+
+type pollState struct {
+	poll SweetNothing
+	// Each voter's latest vote, so changing your mind replaces the old one.
+	votes map[string]SweetNothing
+}
+
+var polls = struct {
+	m map[string]*pollState
+	// Votes that arrived before their poll.
+	early map[string][]SweetNothing
+	sync.Mutex
+}{m: make(map[string]*pollState), early: make(map[string][]SweetNothing)}
+
+// splitQuoted splits s on spaces, keeping "double quoted" runs together.
+func splitQuoted(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	quoted, have := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			have = true
+		case unicode.IsSpace(r) && !quoted:
+			if have {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				have = false
+			}
+		default:
+			cur.WriteRune(r)
+			have = true
+		}
+	}
+	if have {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+func addPoll(whisper SweetNothing) {
+	polls.Lock()
+	defer polls.Unlock()
+	if _, ok := polls.m[whisper.ID]; ok {
+		return
+	}
+	p := &pollState{poll: whisper, votes: make(map[string]SweetNothing)}
+	polls.m[whisper.ID] = p
+	for _, v := range polls.early[whisper.ID] {
+		p.add(v)
+	}
+	delete(polls.early, whisper.ID)
+}
+
+func (p *pollState) add(v SweetNothing) bool {
+	if cur, ok := p.votes[v.Addr]; ok && !v.Timestamp.After(cur.Timestamp) {
+		return false
+	}
+	p.votes[v.Addr] = v
+	return true
+}
+
+func (p *pollState) tally() []int {
+	counts := make([]int, len(p.poll.Options))
+	for _, v := range p.votes {
+		if n, err := strconv.Atoi(v.Body); err == nil && n >= 1 && n <= len(counts) {
+			counts[n-1]++
+		}
+	}
+	return counts
+}
+
+func (p *pollState) summary() string {
+	counts := p.tally()
+	parts := make([]string, len(counts))
+	for i, n := range counts {
+		parts[i] = fmt.Sprintf("%s %d", p.poll.Options[i], n)
+	}
+	sep := " | "
+	if accessible {
+		sep = ", "
+	}
+	return fmt.Sprintf("%s: %s", p.poll.Body, strings.Join(parts, sep))
+}
+
+func showPoll(whisper SweetNothing) {
+	addPoll(whisper)
+	if accessible {
+		chatLn(whisper.Addr, tr("poll: %s", whisper.Body))
+	} else {
+		chatLn(whisper.Addr, wrapColor(T("POLL"), "header")+" "+whisper.Body)
+	}
+	for i, opt := range whisper.Options {
+		noteLn(tr("Option %d", i+1), fmt.Sprintf("%d) ", i+1), opt, "end")
+	}
+	noteLn(T("To vote"), "", fmt.Sprintf("/vote %s <n>", whisper.ID), "blue")
+}
+
+// countVote applies a vote, printing the poll's new tally when show is set.
+func countVote(v SweetNothing, show bool) {
+	polls.Lock()
+	p, ok := polls.m[v.Ref]
+	if !ok {
+		polls.early[v.Ref] = append(polls.early[v.Ref], v)
+		polls.Unlock()
+		return
+	}
+	changed := p.add(v)
+	summary := p.summary()
+	polls.Unlock()
+	if changed && show {
+		noteLn(T("Poll results"), "-> ", summary, "green")
+	}
+}
+
+// replayPolls rebuilds tallies from archived polls and votes.
+func replayPolls(msgs []SweetNothing) {
+	for _, whisper := range msgs {
+		switch whisper.Kind {
+		case pollKind:
+			addPoll(whisper)
+		case voteKind:
+			countVote(whisper, false)
+		}
+	}
+}
+
+func createPoll(args string) {
+	fields := splitQuoted(args)
+	if len(fields) < 3 {
+		statusLn(tr(`Usage: /poll "question" "option" "option" ...`))
+		return
+	}
+	whisper := publish(SweetNothing{Kind: pollKind, Body: fields[0], Options: fields[1:]})
+	showPoll(whisper)
+}
+
+func findPoll(id string) (*pollState, bool) {
+	polls.Lock()
+	defer polls.Unlock()
+	if p, ok := polls.m[id]; ok {
+		return p, true
+	}
+	var found *pollState
+	for pid, p := range polls.m {
+		if strings.HasPrefix(pid, id) {
+			if found != nil {
+				return nil, false
+			}
+			found = p
+		}
+	}
+	return found, found != nil
+}
+
+func vote(id string, choice string) {
+	p, ok := findPoll(id)
+	if !ok {
+		statusLn(tr("No poll %s", id))
+		return
+	}
+	n, err := strconv.Atoi(choice)
+	if err != nil || n < 1 || n > len(p.poll.Options) {
+		statusLn(tr("Pick an option from 1 to %d", len(p.poll.Options)))
+		return
+	}
+	v := publishIn(p.poll.Net, SweetNothing{Kind: voteKind, Ref: p.poll.ID, Body: choice})
+	countVote(v, true)
+}
@@ -0,0 +1,372 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Port mapping
+ *
+ * With -portmap, a node on a private address asks the router to forward
+ * its listen ports, trying NAT-PMP first and then UPnP, and from then on
+ * gives the router's external address as its own so peers outside the
+ * LAN can dial in. Mappings are leased, and renewed at half their
+ * lifetime. Routers often can't loop a LAN peer's connection to the
+ * external address back inside, so peers on the same LAN are better off
+ * dialing each other directly.
+ */
+
+var portmapEnabled bool
+
+const portmapLifetime = time.Hour
+
+const portmapTimeout = 3 * time.Second
+
+type portMapper interface {
+	Name() string
+	ExternalIP() (net.IP, error)
+	// Map forwards port on the router to the same port here.
+	Map(port int, lifetime time.Duration) error
+}
+
+// defaultGateway reads the default route on Linux, and otherwise guesses
+// the .1 address on our subnet, which is what most home routers use.
+func defaultGateway(local net.IP) net.IP {
+	if b, err := os.ReadFile("/proc/net/route"); err == nil {
+		for _, line := range strings.Split(string(b), "\n")[1:] {
+			f := strings.Fields(line)
+			if len(f) < 3 || f[1] != "00000000" {
+				continue
+			}
+			gw, err := hex.DecodeString(f[2])
+			if err != nil || len(gw) != 4 {
+				continue
+			}
+			return net.IPv4(gw[3], gw[2], gw[1], gw[0])
+		}
+	}
+	ip := local.To4()
+	if ip == nil {
+		return nil
+	}
+	return net.IPv4(ip[0], ip[1], ip[2], 1)
+}
+
+/**
+ * NAT-PMP (RFC 6886)
+ */
+type natPMP struct {
+	gateway net.IP
+}
+
+func (natPMP) Name() string { return "NAT-PMP" }
+
+// call sends req to the gateway, retrying as the RFC suggests, and
+// returns the response if its result code is success.
+func (n natPMP) call(req []byte, size int) ([]byte, error) {
+	c, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: n.gateway, Port: 5351})
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	buf := make([]byte, 16)
+	for wait := 250 * time.Millisecond; wait <= time.Second; wait *= 2 {
+		if _, err := c.Write(req); err != nil {
+			return nil, err
+		}
+		c.SetReadDeadline(time.Now().Add(wait))
+		k, err := c.Read(buf)
+		if err != nil {
+			continue
+		}
+		if k < size || buf[1] != req[1]+128 {
+			return nil, errors.New("nat-pmp: bad response")
+		}
+		if code := binary.BigEndian.Uint16(buf[2:]); code != 0 {
+			return nil, fmt.Errorf("nat-pmp: result code %d", code)
+		}
+		return buf[:k], nil
+	}
+	return nil, errors.New("nat-pmp: no answer from " + n.gateway.String())
+}
+
+func (n natPMP) ExternalIP() (net.IP, error) {
+	resp, err := n.call([]byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IP(resp[8:12]), nil
+}
+
+func (n natPMP) Map(port int, lifetime time.Duration) error {
+	req := []byte{0, 2, 0, 0}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	req = binary.BigEndian.AppendUint32(req, uint32(lifetime/time.Second))
+	resp, err := n.call(req, 16)
+	if err != nil {
+		return err
+	}
+	if got := int(binary.BigEndian.Uint16(resp[10:])); got != port {
+		return fmt.Errorf(T("the router mapped port %d instead of %d"), got, port)
+	}
+	return nil
+}
+
+/**
+ * UPnP IGD
+ */
+type upnp struct {
+	controlURL  string
+	serviceType string
+	local       net.IP
+}
+
+func (upnp) Name() string { return "UPnP" }
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// findWAN looks through a device tree for the service that does port
+// mapping.
+func (d upnpDevice) findWAN() (string, string, bool) {
+	for _, s := range d.Services {
+		if strings.Contains(s.ServiceType, ":WANIPConnection:") || strings.Contains(s.ServiceType, ":WANPPPConnection:") {
+			return s.ServiceType, s.ControlURL, true
+		}
+	}
+	for _, child := range d.Devices {
+		if st, cu, ok := child.findWAN(); ok {
+			return st, cu, true
+		}
+	}
+	return "", "", false
+}
+
+// discoverUPnP finds the router with SSDP and reads its description.
+func discoverUPnP(local net.IP) (*upnp, error) {
+	c, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := c.WriteTo([]byte(search), &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}); err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(time.Now().Add(portmapTimeout))
+	buf := make([]byte, 2048)
+	for {
+		k, _, err := c.ReadFrom(buf)
+		if err != nil {
+			return nil, errors.New("upnp: no gateway answered")
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:k])), nil)
+		if err != nil {
+			continue
+		}
+		if location := resp.Header.Get("Location"); len(location) > 0 {
+			return describeUPnP(location, local)
+		}
+	}
+}
+
+func describeUPnP(location string, local net.IP) (*upnp, error) {
+	client := http.Client{Timeout: portmapTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return nil, err
+	}
+	st, cu, ok := root.Device.findWAN()
+	if !ok {
+		return nil, errors.New("upnp: the gateway doesn't do port mapping")
+	}
+	base, err := url.Parse(location)
+	if len(root.URLBase) > 0 {
+		base, err = url.Parse(root.URLBase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	control, err := base.Parse(cu)
+	if err != nil {
+		return nil, err
+	}
+	return &upnp{controlURL: control.String(), serviceType: st, local: local}, nil
+}
+
+// soap calls action with args in order and returns the value of the
+// result element, if any.
+func (u *upnp) soap(action string, args [][2]string, result string) (string, error) {
+	var body strings.Builder
+	fmt.Fprintf(&body, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%s xmlns:u="%s">`, action, u.serviceType)
+	for _, a := range args {
+		fmt.Fprintf(&body, "<%s>", a[0])
+		xml.EscapeText(&body, []byte(a[1]))
+		fmt.Fprintf(&body, "</%s>", a[0])
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+	req, err := http.NewRequest("POST", u.controlURL, strings.NewReader(body.String()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, u.serviceType, action))
+	client := http.Client{Timeout: portmapTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upnp: %s failed: %s", action, resp.Status)
+	}
+	dec := xml.NewDecoder(resp.Body)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == result {
+			var v string
+			err := dec.DecodeElement(&v, &se)
+			return strings.TrimSpace(v), err
+		}
+	}
+}
+
+func (u *upnp) ExternalIP() (net.IP, error) {
+	v, err := u.soap("GetExternalIPAddress", nil, "NewExternalIPAddress")
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil, fmt.Errorf("upnp: bad external address %q", v)
+	}
+	return ip, nil
+}
+
+func (u *upnp) Map(port int, lifetime time.Duration) error {
+	p := strconv.Itoa(port)
+	_, err := u.soap("AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", p},
+		{"NewProtocol", "TCP"},
+		{"NewInternalPort", p},
+		{"NewInternalClient", u.local.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "sweetnothings"},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	}, "")
+	return err
+}
+
+// findPortMapper returns the first way of mapping ports the router
+// answers to.
+func findPortMapper(local net.IP) (portMapper, error) {
+	var errs []string
+	if gw := defaultGateway(local); gw != nil {
+		m := natPMP{gw}
+		_, err := m.ExternalIP()
+		if err == nil {
+			return m, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	m, err := discoverUPnP(local)
+	if err == nil {
+		return m, nil
+	}
+	errs = append(errs, err.Error())
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// mappedPorts are the TCP ports peers may dial us on.
+func mappedPorts() []int {
+	ports := []string{localInfo.ListenPort, wsPort}
+	for _, port := range networks {
+		ports = append(ports, port)
+	}
+	var l []int
+	for _, p := range ports {
+		if n, err := strconv.Atoi(p); err == nil {
+			l = append(l, n)
+		}
+	}
+	return l
+}
+
+// setupPortMapping maps our ports if we're behind a router, and switches
+// our address to the external one if that worked.
+func setupPortMapping() {
+	local := net.ParseIP(localInfo.IP())
+	if local == nil || !local.IsPrivate() {
+		statusLn(tr("%s isn't a private address; not mapping ports", localInfo.IP()))
+		return
+	}
+	m, err := findPortMapper(local)
+	if err != nil {
+		statusLn(tr("No port mapping: %v", err))
+		return
+	}
+	ext, err := m.ExternalIP()
+	if err != nil {
+		statusLn(tr("No port mapping: %v", err))
+		return
+	}
+	mapAll := func() error {
+		for _, port := range mappedPorts() {
+			if err := m.Map(port, portmapLifetime); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := mapAll(); err != nil {
+		statusLn(tr("No port mapping: %v", err))
+		return
+	}
+	localInfo.ip = ext.String()
+	statusLn(tr("Mapped our ports with %s; peers can reach us at %s", m.Name(), localInfo.Addr()))
+	go func() {
+		for range time.Tick(portmapLifetime / 2) {
+			if err := mapAll(); err != nil {
+				statusLn(tr("Couldn't renew port mapping: %v", err))
+			}
+		}
+	}()
+}
@@ -0,0 +1,189 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/**
+ * Presence
+ *
+ * Each node is online, away or offline. /away [note] and /back change
+ * ours and tell direct peers with a presence frame; new peers are told
+ * when they connect. With -away-after we go away by ourselves once the
+ * keyboard has been idle that long. A peer is offline once its link
+ * closes. Every frame or message from a peer counts as seeing it, so
+ * /peers and /seen can say who's actually around.
+ */
+
+const (
+	presenceOnline  = "online"
+	presenceAway    = "away"
+	presenceOffline = "offline"
+)
+
+var awayAfter time.Duration
+
+type presenceNotice struct {
+	State string
+	Note  string `json:",omitempty"`
+}
+
+type peerPresence struct {
+	presenceNotice
+	LastSeen time.Time
+}
+
+var presence = struct {
+	ours      presenceNotice
+	lastInput time.Time
+	// Auto is set when we went away because we were idle.
+	auto bool
+	m    map[string]*peerPresence
+	sync.Mutex
+}{ours: presenceNotice{State: presenceOnline}, lastInput: time.Now(), m: make(map[string]*peerPresence)}
+
+func init() {
+	controlHandlers["presence"] = handlePresence
+}
+
+// setPresence changes our state and tells everyone we're linked to.
+func setPresence(state string, note string) {
+	presence.Lock()
+	presence.ours = presenceNotice{State: state, Note: note}
+	presence.auto = false
+	presence.Unlock()
+	for addr := range peers.Channels() {
+		go announcePresence(addr)
+	}
+	if state == presenceAway {
+		statusLn(T("You're away"))
+	} else {
+		statusLn(T("You're back"))
+	}
+}
+
+// announcePresence tells a peer how we are.
+func announcePresence(addr string) {
+	presence.Lock()
+	n := presence.ours
+	presence.Unlock()
+	sendSoon(addr, controlFrame("presence", n), sessionTimeout)
+}
+
+func handlePresence(from string, data json.RawMessage) {
+	var n presenceNotice
+	if json.Unmarshal(data, &n) != nil || (n.State != presenceOnline && n.State != presenceAway && n.State != presenceOffline) {
+		return
+	}
+	n.Note = excerpt(n.Note, 80)
+	presence.Lock()
+	p := seenLocked(from)
+	changed := p.State != n.State || p.Note != n.Note
+	wasAway := p.State == presenceAway
+	p.presenceNotice = n
+	presence.Unlock()
+	switch {
+	case !changed:
+	case n.State == presenceAway && len(n.Note) > 0:
+		statusLn(tr("%s is away: %s", nickName(from), n.Note))
+	case n.State == presenceAway:
+		statusLn(tr("%s is away", nickName(from)))
+	case n.State == presenceOnline && wasAway:
+		statusLn(tr("%s is back", nickName(from)))
+	}
+}
+
+// seenLocked notes that we've just heard from addr, which is online
+// unless it said otherwise.
+func seenLocked(addr string) *peerPresence {
+	p, ok := presence.m[addr]
+	if !ok {
+		p = &peerPresence{presenceNotice: presenceNotice{State: presenceOnline}}
+		presence.m[addr] = p
+	}
+	if p.State == presenceOffline {
+		p.presenceNotice = presenceNotice{State: presenceOnline}
+	}
+	p.LastSeen = time.Now()
+	return p
+}
+
+func seenPeer(addr string) {
+	if len(addr) == 0 || isLocal(addr) {
+		return
+	}
+	presence.Lock()
+	seenLocked(addr)
+	presence.Unlock()
+}
+
+// peerGone marks addr offline once its link has closed.
+func peerGone(addr string) {
+	presence.Lock()
+	defer presence.Unlock()
+	if p, ok := presence.m[addr]; ok {
+		p.presenceNotice = presenceNotice{State: presenceOffline}
+	}
+}
+
+func presenceOf(addr string) (peerPresence, bool) {
+	presence.Lock()
+	defer presence.Unlock()
+	p, ok := presence.m[addr]
+	if !ok {
+		return peerPresence{}, false
+	}
+	return *p, true
+}
+
+// presenceLabel describes addr's state for /peers.
+func presenceLabel(addr string) string {
+	p, ok := presenceOf(addr)
+	switch {
+	case !ok:
+		return T(presenceOnline)
+	case p.State == presenceAway && len(p.Note) > 0:
+		return fmt.Sprintf("%s (%s)", T(presenceAway), p.Note)
+	}
+	return T(p.State)
+}
+
+func showSeen(name string) {
+	addr := dialAddr(peerFor(name))
+	p, ok := presenceOf(addr)
+	if !ok {
+		statusLn(tr("Haven't seen %s", name))
+		return
+	}
+	statusLn(tr("%s is %s, last seen %s ago", nickName(addr), presenceLabel(addr), time.Since(p.LastSeen).Round(time.Second)))
+}
+
+// typed notes keyboard activity, coming back if we went away for being
+// idle.
+func typed() {
+	presence.Lock()
+	presence.lastInput = time.Now()
+	back := presence.auto
+	presence.Unlock()
+	if back {
+		setPresence(presenceOnline, "")
+	}
+}
+
+// watchIdle goes away after -away-after without input.
+func watchIdle() {
+	for range time.Tick(awayAfter / 10) {
+		presence.Lock()
+		idle := presence.ours.State == presenceOnline && time.Since(presence.lastInput) >= awayAfter
+		presence.Unlock()
+		if idle {
+			setPresence(presenceAway, T("idle"))
+			presence.Lock()
+			presence.auto = true
+			presence.Unlock()
+		}
+	}
+}
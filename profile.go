@@ -0,0 +1,87 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The -profile in use. Empty is the default profile, which lives directly
+// in ~/.sweetnothings for compatibility with installs from before profiles.
+var profile string
+
+/**
+ * Profile
+ *
+ * Settings kept in each profile's config.json, e.g.
+ *
+ *	{"port": "9001", "peers": ["10.0.0.5:9001"], "nick": "harvey", "theme": {"blue": "36"}, "allow": ["10.0.0.0/8"]}
+ */
+type Profile struct {
+	// Port is listened on when -p isn't given.
+	Port string `json:"port,omitempty"`
+	// Peers are dialed on startup.
+	Peers []string `json:"peers,omitempty"`
+	// Nick is the name we go by when -nick isn't given. /nick sets it.
+	Nick string `json:"nick,omitempty"`
+	// Theme overrides the terminal colors by name with SGR parameters,
+	// e.g. "32" or "1;35".
+	Theme map[string]string `json:"theme,omitempty"`
+	// Allow and Deny are the access lists, of CIDRs, IPs or host names.
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	// Ignored and Blocked are the peers /ignore and /block name.
+	Ignored []string `json:"ignored,omitempty"`
+	Blocked []string `json:"blocked,omitempty"`
+}
+
+var profileConfig Profile
+
+// validProfile keeps profile names to a single path element.
+func validProfile(name string) bool {
+	return len(name) > 0 && !strings.ContainsAny(name, `/\`) && name != "." && name != ".."
+}
+
+// loadProfile reads the current profile's config.json, if it has one.
+func loadProfile() error {
+	b, err := os.ReadFile(filepath.Join(dataDir(), "config.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &profileConfig); err != nil {
+		return err
+	}
+	for name, sgr := range profileConfig.Theme {
+		if _, ok := colors[name]; ok && name != "end" {
+			colors[name] = "\033[" + sgr + "m"
+		}
+	}
+	return nil
+}
+
+// saveProfile writes the current profile's config.json back.
+func saveProfile() error {
+	b, err := json.MarshalIndent(profileConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir(), "config.json")
+	os.MkdirAll(filepath.Dir(path), 0700)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// dialProfilePeers connects to the profile's configured peers.
+func dialProfilePeers() {
+	for _, addr := range profileConfig.Peers {
+		pinPeer(addr)
+		go dial(addr)
+	}
+}
@@ -0,0 +1,263 @@
+package sweetnothings
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+/**
+ * Protobuf
+ *
+ * The codec for -encoding proto, laid out in wire.proto and encoded by
+ * hand. Control payloads stay JSON inside their frames, and timestamps
+ * are sent as the text that was signed, so signatures still check.
+ */
+
+var errBadProto = errors.New("malformed protobuf")
+
+type protoWriter []byte
+
+func (w *protoWriter) tag(field int, wireType int) {
+	*w = binary.AppendUvarint(*w, uint64(field<<3|wireType))
+}
+
+func (w *protoWriter) uint(field int, v uint64) {
+	if v != 0 {
+		w.tag(field, 0)
+		*w = binary.AppendUvarint(*w, v)
+	}
+}
+
+func (w *protoWriter) bool(field int, v bool) {
+	if v {
+		w.uint(field, 1)
+	}
+}
+
+// embed writes b even if it's empty, for repeated fields and messages.
+func (w *protoWriter) embed(field int, b []byte) {
+	w.tag(field, 2)
+	*w = binary.AppendUvarint(*w, uint64(len(b)))
+	*w = append(*w, b...)
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	if len(b) > 0 {
+		w.embed(field, b)
+	}
+}
+
+func (w *protoWriter) string(field int, s string) {
+	w.bytes(field, []byte(s))
+}
+
+func marshalProtoFrame(f Frame) []byte {
+	var w protoWriter
+	w.string(1, f.Type)
+	w.string(2, f.From)
+	if f.Msg != nil {
+		w.embed(3, marshalProtoMessage(*f.Msg))
+	}
+	w.bytes(4, f.Data)
+	w.uint(5, f.Seq)
+	for _, inner := range f.Batch {
+		w.embed(6, marshalProtoFrame(inner))
+	}
+	return w
+}
+
+func marshalProtoMessage(whisper SweetNothing) []byte {
+	var w protoWriter
+	w.string(1, whisper.ID)
+	w.string(2, whisper.Addr)
+	w.string(3, whisper.Body)
+	ts, _ := whisper.Timestamp.MarshalText()
+	w.bytes(4, ts)
+	for _, hop := range whisper.Path {
+		w.embed(5, []byte(hop))
+	}
+	w.uint(6, uint64(max(whisper.Hops, 0)))
+	w.string(7, whisper.Room)
+	w.string(8, whisper.To)
+	w.bool(9, whisper.Edited)
+	w.bool(10, whisper.Deleted)
+	w.string(11, whisper.Kind)
+	w.string(12, whisper.Ref)
+	for _, o := range whisper.Options {
+		w.embed(13, []byte(o))
+	}
+	w.uint(14, whisper.Clock)
+	w.string(15, whisper.Net)
+	if s := whisper.Sealed; s != nil {
+		var sw protoWriter
+		sw.bytes(1, s.Body)
+		for to, key := range s.Keys {
+			var kw protoWriter
+			kw.string(1, to)
+			kw.bytes(2, key)
+			sw.embed(2, kw)
+		}
+		w.embed(16, sw)
+	}
+	w.bytes(17, whisper.Key)
+	w.bytes(18, whisper.Sig)
+	w.uint(19, uint64(max(whisper.TTL, 0)))
+	return w
+}
+
+// protoFields calls fn with each field in b: v for varints, data for
+// length-delimited ones. Fields of other types are skipped.
+func protoFields(b []byte, fn func(field int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errBadProto
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errBadProto
+			}
+			b = b[n:]
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return errBadProto
+			}
+			b = b[size:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errBadProto
+			}
+			data := b[n : n+int(l)]
+			b = b[n+int(l):]
+			if err := fn(field, 0, data); err != nil {
+				return err
+			}
+		default:
+			return errBadProto
+		}
+	}
+	return nil
+}
+
+func unmarshalProtoFrame(b []byte, f *Frame) error {
+	return protoFields(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			f.Type = string(data)
+		case 2:
+			f.From = string(data)
+		case 3:
+			var whisper SweetNothing
+			if err := unmarshalProtoMessage(data, &whisper); err != nil {
+				return err
+			}
+			f.Msg = &whisper
+		case 4:
+			f.Data = json.RawMessage(append([]byte(nil), data...))
+		case 5:
+			f.Seq = v
+		case 6:
+			var inner Frame
+			if err := unmarshalProtoFrame(data, &inner); err != nil {
+				return err
+			}
+			f.Batch = append(f.Batch, inner)
+		}
+		return nil
+	})
+}
+
+func unmarshalProtoMessage(b []byte, whisper *SweetNothing) error {
+	return protoFields(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			whisper.ID = string(data)
+		case 2:
+			whisper.Addr = string(data)
+		case 3:
+			whisper.Body = string(data)
+		case 4:
+			var ts time.Time
+			if err := ts.UnmarshalText(data); err != nil {
+				return err
+			}
+			whisper.Timestamp = ts
+		case 5:
+			whisper.Path = append(whisper.Path, string(data))
+		case 6:
+			whisper.Hops = int(min(v, math.MaxInt32))
+		case 7:
+			whisper.Room = string(data)
+		case 8:
+			whisper.To = string(data)
+		case 9:
+			whisper.Edited = v != 0
+		case 10:
+			whisper.Deleted = v != 0
+		case 11:
+			whisper.Kind = string(data)
+		case 12:
+			whisper.Ref = string(data)
+		case 13:
+			whisper.Options = append(whisper.Options, string(data))
+		case 14:
+			whisper.Clock = v
+		case 15:
+			whisper.Net = string(data)
+		case 16:
+			s := &Sealed{Keys: make(map[string][]byte)}
+			if err := unmarshalProtoSealed(data, s); err != nil {
+				return err
+			}
+			whisper.Sealed = s
+		case 17:
+			whisper.Key = append([]byte(nil), data...)
+		case 18:
+			whisper.Sig = append([]byte(nil), data...)
+		case 19:
+			whisper.TTL = time.Duration(min(v, math.MaxInt64))
+		}
+		return nil
+	})
+}
+
+func unmarshalProtoSealed(b []byte, s *Sealed) error {
+	return protoFields(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			s.Body = append([]byte{}, data...)
+		case 2:
+			var to string
+			key := []byte{}
+			err := protoFields(data, func(field int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					to = string(data)
+				case 2:
+					key = append(key, data...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Keys[to] = key
+		}
+		return nil
+	})
+}
@@ -0,0 +1,146 @@
+package sweetnothings
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+/**
+ * SOCKS proxy
+ *
+ * With -proxy socks5://host:port every peer connection we make goes
+ * through a SOCKS5 proxy, such as Tor's on 9050. Host names are passed to
+ * the proxy unresolved, so .onion addresses work and lookups don't leak.
+ * -advertise puts an address of our own, like our onion address, in
+ * place of the LAN IP peers see. UDP discovery doesn't go through the
+ * proxy, so leave it off when that matters.
+ */
+
+var proxyURL *url.URL
+
+const proxyTimeout = 30 * time.Second
+
+// setProxy checks and remembers the -proxy URL.
+func setProxy(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return fmt.Errorf(T("unsupported proxy %q; only socks5:// is"), s)
+	}
+	if len(u.Port()) == 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), "1080")
+	}
+	proxyURL = u
+	return nil
+}
+
+// dialTCP opens a TCP connection to addr, through the proxy if there is
+// one.
+func dialTCP(addr string) (net.Conn, error) {
+	if proxyURL == nil {
+		return net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	c, err := net.DialTimeout("tcp", proxyURL.Host, proxyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c.SetDeadline(time.Now().Add(proxyTimeout))
+	if err := socksConnect(c, addr); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("socks5 %s: %v", proxyURL.Host, err)
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// socksConnect asks the proxy on c to connect us to addr (RFC 1928), with
+// the username and password from the proxy URL if it has them (RFC 1929).
+func socksConnect(c net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+	user := proxyURL.User
+	method := byte(0x00)
+	if user != nil {
+		method = 0x02
+	}
+	if _, err := c.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(c, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("proxy refused our authentication method")
+	}
+	if user != nil {
+		pass, _ := user.Password()
+		req := []byte{1, byte(len(user.Username()))}
+		req = append(req, user.Username()...)
+		req = append(req, byte(len(pass)))
+		req = append(req, pass...)
+		if _, err := c.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(c, reply[:]); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("proxy rejected the username or password")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else if len(host) <= 255 {
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else {
+		return errors.New("host name too long")
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+	var head [4]byte
+	if _, err := io.ReadFull(c, head[:]); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("connect failed with code %d", head[1])
+	}
+	// Skip the address the proxy bound.
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = 4
+	case 4:
+		skip = 16
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return errors.New("bad reply from proxy")
+	}
+	_, err = io.ReadFull(c, make([]byte, skip+2))
+	return err
+}
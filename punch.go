@@ -0,0 +1,234 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+/**
+ * Duplex links and hole punching
+ *
+ * Links are one-way: we write on the connections we dial and read on the
+ * ones we accept. So that a peer behind NAT, which nobody can dial, still
+ * hears from the mesh, the dialer also reads, and says so with a "duplex"
+ * frame. If dialing such a peer back fails, we write to it over the link
+ * it made to us instead.
+ *
+ * Two peers behind NAT can't reach each other either way. When a dial
+ * fails we ask our peers for help; one that has links to both picks a
+ * moment and tells each the address it sees the other at, and at that
+ * moment both dial each other from their listen ports. Many NATs let the
+ * connection through then, since each side's attempt looks like a reply
+ * to the other's. If it doesn't work, messages still get between the two
+ * by way of the peers they share. Punching needs plain TCP links.
+ */
+
+const duplexFrame = "duplex"
+
+var punchEnabled = true
+
+// How far ahead the helper schedules the attempt, to give both
+// orders time to arrive.
+const punchDelay = time.Second
+
+// How long both sides keep trying.
+const punchWindow = 10 * time.Second
+
+// How soon we'll ask for help reaching the same peer again.
+const punchRetry = 5 * time.Minute
+
+type punchRequest struct {
+	Nonce  string
+	Target string
+}
+
+type punchOrder struct {
+	Nonce string
+	Peer  string
+	Addr  string
+	At    time.Time
+}
+
+// Incoming links whose far end reads what we write back, by address.
+var duplexLinks = struct {
+	m map[string]net.Conn
+	sync.Mutex
+}{m: make(map[string]net.Conn)}
+
+// The remote IP each peer's incoming link comes from, which is its NAT's
+// address if it has one.
+var observed = struct {
+	m map[string]string
+	sync.Mutex
+}{m: make(map[string]string)}
+
+var punches = struct {
+	asked map[string]time.Time
+	seen  map[string]bool
+	sync.Mutex
+}{asked: make(map[string]time.Time), seen: make(map[string]bool)}
+
+func init() {
+	controlHandlers["punch-req"] = handlePunchRequest
+	controlHandlers["punch"] = handlePunch
+}
+
+func addDuplex(addr string, c net.Conn) bool {
+	duplexLinks.Lock()
+	defer duplexLinks.Unlock()
+	if _, ok := duplexLinks.m[addr]; ok || len(addr) == 0 {
+		return false
+	}
+	duplexLinks.m[addr] = c
+	return true
+}
+
+func removeDuplex(addr string, c net.Conn) {
+	duplexLinks.Lock()
+	defer duplexLinks.Unlock()
+	if duplexLinks.m[addr] == c {
+		delete(duplexLinks.m, addr)
+	}
+}
+
+func duplexConn(addr string) net.Conn {
+	duplexLinks.Lock()
+	defer duplexLinks.Unlock()
+	return duplexLinks.m[addr]
+}
+
+func observeLink(addr string, c net.Conn) {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil || len(addr) == 0 {
+		return
+	}
+	observed.Lock()
+	defer observed.Unlock()
+	observed.m[addr] = host
+}
+
+// observedAddr is where addr's NAT would forward its listen port, assuming
+// the NAT keeps port numbers, as most home routers do.
+func observedAddr(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	observed.Lock()
+	defer observed.Unlock()
+	if host, ok := observed.m[addr]; ok {
+		return net.JoinHostPort(host, port)
+	}
+	return addr
+}
+
+func canPunch() bool {
+	return punchEnabled && tlsConfig == nil && !noiseEnabled && !quicEnabled && proxyURL == nil && reusePortAvailable
+}
+
+// requestPunch asks all our peers to help us reach target.
+func requestPunch(target string) {
+	if !canPunch() || isWebSocket(target) {
+		return
+	}
+	punches.Lock()
+	if time.Since(punches.asked[target]) < punchRetry {
+		punches.Unlock()
+		return
+	}
+	punches.asked[target] = time.Now()
+	punches.Unlock()
+	req := punchRequest{Nonce: newSessionToken(), Target: target}
+	asked := 0
+	for addr := range peers.Channels() {
+		if addr != target && sendTo(addr, controlFrame("punch-req", req)) {
+			asked++
+		}
+	}
+	if asked > 0 {
+		statusLn(tr("Asking %d peers to help us reach %s", asked, target))
+	}
+}
+
+func handlePunchRequest(from string, data json.RawMessage) {
+	var req punchRequest
+	if !punchEnabled || json.Unmarshal(data, &req) != nil {
+		return
+	}
+	if peers.Get(req.Target) == nil || peers.Get(from) == nil || req.Target == from {
+		return
+	}
+	at := time.Now().Add(punchDelay)
+	sendTo(req.Target, controlFrame("punch", punchOrder{req.Nonce, from, observedAddr(from), at}))
+	sendTo(from, controlFrame("punch", punchOrder{req.Nonce, req.Target, observedAddr(req.Target), at}))
+	statusLn(tr("Helping %s and %s connect directly", from, req.Target))
+}
+
+func handlePunch(from string, data json.RawMessage) {
+	var o punchOrder
+	if !canPunch() || json.Unmarshal(data, &o) != nil || isLocal(o.Peer) {
+		return
+	}
+	punches.Lock()
+	seen := punches.seen[o.Nonce]
+	punches.seen[o.Nonce] = true
+	punches.Unlock()
+	if seen || peers.Get(o.Peer) != nil {
+		return
+	}
+	go punch(o, from)
+}
+
+// punch dials o.Addr from our listen port until it connects, the other
+// side's attempt reaches our listener, or time runs out.
+func punch(o punchOrder, helper string) {
+	time.Sleep(time.Until(o.At))
+	port := localInfo.ListenPort
+	if network := netOf(o.Peer); len(network) > 0 {
+		port = networks[network]
+	}
+	deadline := time.Now().Add(punchWindow)
+	for time.Now().Before(deadline) {
+		if c := duplexConn(o.Peer); c != nil {
+			linkOver(o.Peer, c, false)
+			return
+		}
+		if c, err := punchDial(port, o.Addr); err == nil {
+			statusLn(tr("Punched through to %s", o.Peer))
+			linkOver(o.Peer, c, true)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	statusLn(tr("Couldn't punch through to %s; messages still reach it through %s", o.Peer, helper))
+}
+
+// linkOver makes c our link to addr. If we dialed it, we read replies
+// on it too.
+func linkOver(addr string, c net.Conn, dialed bool) {
+	ch, bulk, done := peers.Add(addr)
+	if ch == nil {
+		if dialed {
+			c.Close()
+		}
+		return
+	}
+	defer peers.Remove(addr)
+	if dialed {
+		readReplies(addr, c)
+	} else {
+		peers.SetInbound(addr)
+	}
+	writeLink(addr, c, ch, bulk, done)
+}
+
+func punchDial(port string, addr string) (net.Conn, error) {
+	local, err := net.ResolveTCPAddr("tcp", net.JoinHostPort("", port))
+	if err != nil {
+		return nil, err
+	}
+	d := net.Dialer{LocalAddr: local, Control: reusePort, Timeout: time.Second}
+	return d.Dial("tcp", addr)
+}
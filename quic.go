@@ -0,0 +1,130 @@
+//go:build quic
+
+package sweetnothings
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+/**
+ * QUIC transport
+ *
+ * Built with -tags quic, -quic carries peer links over QUIC on the same
+ * port number as -p, but UDP. Each link is one stream on its own
+ * connection, so QUIC's handshake and encryption take the place of TCP
+ * and TLS. QUIC always needs a certificate, so it uses the one -tls
+ * would, and -cert, -key and -tls-ca work the same way.
+ */
+
+const quicALPN = "sweetnothings"
+
+const quicAvailable = true
+
+var quicConfig = &quic.Config{
+	KeepAlivePeriod: 15 * time.Second,
+	MaxIdleTimeout:  time.Minute,
+}
+
+// quicConn is a stream made to look like the TCP connections the rest of
+// the code expects.
+type quicConn struct {
+	quic.Stream
+	conn quic.Connection
+}
+
+func (c *quicConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *quicConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+func (c *quicConn) Transport() string    { return "quic" }
+
+func (c *quicConn) Close() error {
+	c.Stream.Close()
+	return c.conn.CloseWithError(0, "")
+}
+
+func quicTLS() *tls.Config {
+	config := quicTLSConfig.Clone()
+	config.NextProtos = []string{quicALPN}
+	config.MinVersion = tls.VersionTLS13
+	return config
+}
+
+func dialQUIC(addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := quicTLS()
+	config.ServerName = host
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, addr, config, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	s, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+	return &quicConn{Stream: s, conn: conn}, nil
+}
+
+type quicListener struct {
+	l     *quic.Listener
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+// listenQUIC listens for QUIC links on UDP port.
+func listenQUIC(port string) (net.Listener, error) {
+	l, err := quic.ListenAddr(net.JoinHostPort("", port), quicTLS(), quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	ql := &quicListener{l: l, conns: make(chan net.Conn), done: make(chan struct{})}
+	go ql.accept()
+	return ql, nil
+}
+
+// accept waits for each connection's stream on its own, so a slow peer
+// can't hold up the others.
+func (ql *quicListener) accept() {
+	defer close(ql.done)
+	for {
+		conn, err := ql.l.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			s, err := conn.AcceptStream(ctx)
+			if err != nil {
+				conn.CloseWithError(0, "")
+				return
+			}
+			select {
+			case ql.conns <- &quicConn{Stream: s, conn: conn}:
+			case <-ql.done:
+				conn.CloseWithError(0, "")
+			}
+		}()
+	}
+}
+
+func (ql *quicListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-ql.conns:
+		return c, nil
+	case <-ql.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (ql *quicListener) Close() error   { return ql.l.Close() }
+func (ql *quicListener) Addr() net.Addr { return ql.l.Addr() }
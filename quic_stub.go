@@ -0,0 +1,21 @@
+//go:build !quic
+
+package sweetnothings
+
+import (
+	"errors"
+	"net"
+)
+
+// QUIC needs quic-go, so it's only in builds made with -tags quic.
+const quicAvailable = false
+
+var errNoQUIC = errors.New("built without QUIC support")
+
+func dialQUIC(addr string) (net.Conn, error) {
+	return nil, errNoQUIC
+}
+
+func listenQUIC(port string) (net.Listener, error) {
+	return nil, errNoQUIC
+}
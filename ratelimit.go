@@ -0,0 +1,121 @@
+package sweetnothings
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Rate limits
+ *
+ * With -peer-rate, each link and each author gets a bucket of that many
+ * messages a second, with inboundBurst seconds' worth to spend at once.
+ * New messages past it are dropped before they're shown or relayed, so
+ * one noisy peer can't flood our terminal or, through us, the mesh. With -rate-action
+ * mute it's also muted for rateMuteFor, dropping everything it sends in
+ * the meantime. Our own messages are never limited.
+ */
+
+const (
+	rateDrop = "drop"
+	rateMute = "mute"
+)
+
+// Messages a second each link or author may send us; 0 means no limit.
+var inboundRate float64
+
+var rateAction = rateDrop
+
+// How many seconds' worth of -peer-rate can be used in a burst.
+const inboundBurst = 5
+
+// How long -rate-action mute lasts, and how often we say we're still
+// dropping someone's messages otherwise.
+const rateMuteFor = time.Minute
+
+type inboundBucket struct {
+	tokens     float64
+	filled     time.Time
+	warned     time.Time
+	mutedUntil time.Time
+}
+
+// Buckets are kept for each link and each author, and dropped once
+// they've been idle long enough to have refilled.
+var inbound = struct {
+	links   map[string]*inboundBucket
+	authors map[string]*inboundBucket
+	swept   time.Time
+	sync.Mutex
+}{links: make(map[string]*inboundBucket), authors: make(map[string]*inboundBucket)}
+
+// allowInbound charges a message that came over the link to from, written
+// by addr, against both their rates, reporting whether it may go on. The
+// author is whoever the message says it is, so the link is what holds a
+// peer making up authors to its limit.
+func allowInbound(from string, addr string) bool {
+	if inboundRate <= 0 || isLocal(addr) {
+		return true
+	}
+	now := time.Now()
+	inbound.Lock()
+	if now.Sub(inbound.swept) >= rateMuteFor {
+		sweepInbound(inbound.links, now)
+		sweepInbound(inbound.authors, now)
+		inbound.swept = now
+	}
+	who := from
+	allowed, muting, warn := chargeInbound(inbound.links, from, now)
+	if allowed && addr != from {
+		who = addr
+		allowed, muting, warn = chargeInbound(inbound.authors, addr, now)
+	}
+	inbound.Unlock()
+
+	if !allowed {
+		atomic.AddUint64(&stats.Limited, 1)
+	}
+	if muting {
+		statusLn(tr("%s is sending too fast; muted for %v", nickName(who), rateMuteFor))
+	} else if warn {
+		statusLn(tr("%s is sending too fast; dropping some of its messages", nickName(who)))
+	}
+	return allowed
+}
+
+// chargeInbound takes a message from key's bucket in m, reporting whether
+// there was room, whether key is now muted, and whether to warn that its
+// messages are being dropped. It must be called with inbound locked.
+func chargeInbound(m map[string]*inboundBucket, key string, now time.Time) (allowed bool, muting bool, warn bool) {
+	b, ok := m[key]
+	if !ok {
+		b = &inboundBucket{tokens: inboundRate * inboundBurst, filled: now}
+		m[key] = b
+	}
+	b.tokens = min(b.tokens+now.Sub(b.filled).Seconds()*inboundRate, inboundRate*inboundBurst)
+	b.filled = now
+	allowed = now.After(b.mutedUntil) && b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	muting = !allowed && rateAction == rateMute && now.After(b.mutedUntil)
+	if muting {
+		b.mutedUntil = now.Add(rateMuteFor)
+	}
+	warn = !allowed && rateAction == rateDrop && now.Sub(b.warned) >= rateMuteFor
+	if warn {
+		b.warned = now
+	}
+	return allowed, muting, warn
+}
+
+// sweepInbound forgets buckets that would be full again by now, which a
+// new bucket would be too. It must be called with inbound locked.
+func sweepInbound(m map[string]*inboundBucket, now time.Time) {
+	for key, b := range m {
+		if now.Sub(b.filled) >= inboundBurst*time.Second && now.After(b.mutedUntil) && now.Sub(b.warned) >= rateMuteFor {
+			delete(m, key)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/**
+ * Reactions
+ *
+ * /react <id> :emoji: gossips a reaction to an earlier message. Rather
+ * than a chat line of its own, each reaction shows as the message's
+ * running tally, on a note line quoting it.
+ */
+
+const reactKind = "react"
+
+type reactionTally struct {
+	// Emoji in the order they were first used.
+	order []string
+	by    map[string]map[string]bool
+}
+
+var reactions = struct {
+	m map[string]*reactionTally
+	sync.Mutex
+}{m: make(map[string]*reactionTally)}
+
+// findMessage looks a message up by ID or ID prefix, in history if we
+// keep it and otherwise among those we've seen lately.
+func findMessage(id string) (SweetNothing, bool) {
+	if history != nil {
+		if whisper, ok := history.Get(id); ok {
+			return whisper, true
+		}
+		return history.FindPrefix(id)
+	}
+	recent.Lock()
+	defer recent.Unlock()
+	for i := len(recent.entries) - 1; i >= 0; i-- {
+		if strings.HasPrefix(recent.entries[i].whisper.ID, id) {
+			return recent.entries[i].whisper, true
+		}
+	}
+	return SweetNothing{}, false
+}
+
+// reactionEmoji turns ":thumbsup:" into 👍. Emoji typed as they are
+// are taken as long as they're short and not plain text.
+func reactionEmoji(s string) (string, bool) {
+	if strings.HasPrefix(s, ":") && strings.HasSuffix(s, ":") && len(s) > 2 {
+		e, ok := emojiCodes[strings.ToLower(s[1:len(s)-1])]
+		return e, ok
+	}
+	if len(s) == 0 || utf8.RuneCountInString(s) > 8 {
+		return "", false
+	}
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+func react(id string, emoji string) {
+	target, ok := findMessage(id)
+	if !ok {
+		statusLn(tr("No message %s", id))
+		return
+	}
+	e, ok := reactionEmoji(emoji)
+	if !ok {
+		statusLn(tr("Unknown emoji %s", emoji))
+		return
+	}
+	r := publishIn(target.Net, SweetNothing{Kind: reactKind, Ref: target.ID, Room: target.Room, Body: e})
+	countReaction(r, true)
+}
+
+// countReaction adds a reaction to its message's tally, showing the new
+// tally when show is set and the reaction is news.
+func countReaction(r SweetNothing, show bool) {
+	reactions.Lock()
+	t, ok := reactions.m[r.Ref]
+	if !ok {
+		t = &reactionTally{by: make(map[string]map[string]bool)}
+		reactions.m[r.Ref] = t
+	}
+	if t.by[r.Body] == nil {
+		t.by[r.Body] = make(map[string]bool)
+		t.order = append(t.order, r.Body)
+	}
+	dup := t.by[r.Body][r.Addr]
+	t.by[r.Body][r.Addr] = true
+	summary := t.summary()
+	reactions.Unlock()
+	if dup || !show {
+		return
+	}
+	quote := r.Ref
+	if target, ok := findMessage(r.Ref); ok {
+		quote = fmt.Sprintf("%s: %s", nickName(target.Addr), excerpt(target.Body, 40))
+	}
+	noteLn(T("Reactions"), "↳ ", fmt.Sprintf("%s  (%s)", summary, quote), "yellow")
+}
+
+// summary must be called with reactions locked.
+func (t *reactionTally) summary() string {
+	parts := make([]string, len(t.order))
+	for i, e := range t.order {
+		parts[i] = fmt.Sprintf("%s %d", e, len(t.by[e]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// excerpt shortens s to n runes.
+func excerpt(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// replayReactions rebuilds tallies from history.
+func replayReactions(msgs []SweetNothing) {
+	for _, whisper := range msgs {
+		if whisper.Kind == reactKind {
+			countReaction(whisper, false)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Receipts
+ *
+ * Whoever receives a message or DM sends its author a receipt frame,
+ * directly or through a relay, never gossiped. With -read-receipts they
+ * send another once it's been shown to them. /receipts <id> lists who
+ * has our message; the latest maxTracked of ours are kept track of.
+ */
+
+var readReceipts bool
+
+const maxTracked = 1000
+
+const receiptTimeout = 10 * time.Second
+
+type receipt struct {
+	ID   string
+	Read bool `json:",omitempty"`
+}
+
+type receiptState struct {
+	Delivered time.Time
+	Read      time.Time
+}
+
+var receipts = struct {
+	// For each of our messages, keyed by ID, who has it.
+	m     map[string]map[string]*receiptState
+	order []string
+	sync.Mutex
+}{m: make(map[string]map[string]*receiptState)}
+
+func init() {
+	controlHandlers["receipt"] = handleReceipt
+}
+
+// wantsReceipt is whether whisper is the kind of message people read, as
+// opposed to votes, reactions and the like.
+func wantsReceipt(whisper SweetNothing) bool {
+	switch whisper.Kind {
+	case "", pollKind, askKind, dmKind:
+		return true
+	}
+	return false
+}
+
+// trackReceipts starts counting receipts for a message of ours.
+func trackReceipts(whisper SweetNothing) {
+	if !wantsReceipt(whisper) {
+		return
+	}
+	receipts.Lock()
+	defer receipts.Unlock()
+	receipts.m[whisper.ID] = make(map[string]*receiptState)
+	receipts.order = append(receipts.order, whisper.ID)
+	if len(receipts.order) > maxTracked {
+		delete(receipts.m, receipts.order[0])
+		receipts.order = receipts.order[1:]
+	}
+}
+
+// sendReceipt tells whisper's author we have it, or with read set that
+// we've seen it.
+func sendReceipt(whisper SweetNothing, read bool) {
+	if isLocal(whisper.Addr) || !wantsReceipt(whisper) || (read && !readReceipts) {
+		return
+	}
+	go sendSoon(whisper.Addr, controlFrame("receipt", receipt{ID: whisper.ID, Read: read}), receiptTimeout)
+}
+
+func handleReceipt(from string, data json.RawMessage) {
+	var r receipt
+	if json.Unmarshal(data, &r) != nil {
+		return
+	}
+	receipts.Lock()
+	defer receipts.Unlock()
+	got, ok := receipts.m[r.ID]
+	if !ok {
+		return
+	}
+	s, ok := got[from]
+	if !ok {
+		s = &receiptState{Delivered: time.Now()}
+		got[from] = s
+	}
+	if r.Read && s.Read.IsZero() {
+		s.Read = time.Now()
+	}
+}
+
+// showReceipts lists who has the message of ours with the given ID
+// prefix, or our latest one.
+func showReceipts(id string) {
+	receipts.Lock()
+	defer receipts.Unlock()
+	if len(id) == 0 && len(receipts.order) > 0 {
+		id = receipts.order[len(receipts.order)-1]
+	}
+	var got map[string]*receiptState
+	for i := len(receipts.order) - 1; i >= 0 && len(id) > 0; i-- {
+		if strings.HasPrefix(receipts.order[i], id) {
+			id, got = receipts.order[i], receipts.m[receipts.order[i]]
+			break
+		}
+	}
+	if got == nil {
+		statusLn(tr("No receipts for %s", id))
+		return
+	}
+	var addrs []string
+	for addr := range got {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	statusLn(tr("%s delivered to %d", id, len(addrs)))
+	for _, addr := range addrs {
+		s := got[addr]
+		if s.Read.IsZero() {
+			noteLn(T("Delivered"), "✓  ", fmt.Sprintf("%s %s", nickName(addr), s.Delivered.Format("15:04:05")), "green")
+		} else {
+			noteLn(T("Read"), "✓✓ ", tr("%s read at %s", nickName(addr), s.Read.Format("15:04:05")), "green")
+		}
+	}
+}
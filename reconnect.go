@@ -0,0 +1,159 @@
+package sweetnothings
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * Reconnecting
+ *
+ * When a link we dialed drops, we dial it again after a backoff that
+ * doubles from reconnectBase up to reconnectMax, jittered so a mesh that
+ * lost a node doesn't redial it in lockstep. After -reconnect-tries
+ * failed dials in a row we give up. A link that comes back and lasts
+ * reconnectSettled before dropping again starts the count over; one that
+ * a peer hangs up on at once counts as a failure, and isn't dialed again
+ * meanwhile just because we have something to send it. Peers that said
+ * they were leaving, that we pruned, or that /forget names aren't retried;
+ * /forget also drops a peer from the ones redialed on startup.
+ */
+
+const (
+	reconnectBase = time.Second
+	reconnectMax  = 5 * time.Minute
+
+	reconnectSettled = 30 * time.Second
+)
+
+var reconnectTries = 10
+
+var reconnects = struct {
+	// Peers being retried, with a channel closed to stop, peers not to
+	// retry, and when we last dialed each.
+	active map[string]chan struct{}
+	skip   map[string]bool
+	dialed map[string]time.Time
+	sync.Mutex
+}{active: make(map[string]chan struct{}), skip: make(map[string]bool), dialed: make(map[string]time.Time)}
+
+// reconnectDelay is how long to wait before the nth retry.
+func reconnectDelay(n int) time.Duration {
+	d := reconnectMax
+	if n < 20 {
+		d = min(reconnectBase<<n, reconnectMax)
+	}
+	return time.Duration(float64(d) * (0.5 + rand.Float64()))
+}
+
+// reconnect keeps dialing addr after its link dropped until it's back,
+// we run out of tries or we're told to stop.
+func reconnect(addr string) {
+	reconnects.Lock()
+	_, busy := reconnects.active[addr]
+	if busy || reconnects.skip[addr] || reconnectTries <= 0 {
+		reconnects.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	reconnects.active[addr] = stop
+	reconnects.Unlock()
+	defer func() {
+		reconnects.Lock()
+		delete(reconnects.active, addr)
+		reconnects.Unlock()
+	}()
+
+	for failed := 0; failed < reconnectTries; {
+		select {
+		case <-time.After(reconnectDelay(failed)):
+		case <-stop:
+			return
+		}
+		if peers.Get(addr) != nil || !wantReconnect(addr) {
+			return
+		}
+		start := time.Now()
+		if dialLink(addr) {
+			if !wantReconnect(addr) {
+				return
+			}
+			if time.Since(start) >= reconnectSettled {
+				statusLn(tr("Lost %s; reconnecting", nickName(addr)))
+				failed = 0
+				continue
+			}
+		}
+		failed++
+	}
+	statusLn(tr("Gave up reconnecting to %s after %d tries", nickName(addr), reconnectTries))
+}
+
+// keepDialing dials addr now, and keeps at it like reconnect if that
+// fails or the link later drops.
+func keepDialing(addr string) {
+	if dialLink(addr) {
+		if !wantReconnect(addr) {
+			return
+		}
+		statusLn(tr("Lost %s; reconnecting", nickName(addr)))
+	}
+	reconnect(addr)
+}
+
+// noteDial records that we're dialing addr.
+func noteDial(addr string) {
+	reconnects.Lock()
+	defer reconnects.Unlock()
+	reconnects.dialed[addr] = time.Now()
+}
+
+// redialing reports whether reconnect has addr in hand, or we dialed it
+// within reconnectBase, so there's no call to dial it again now.
+func redialing(addr string) bool {
+	reconnects.Lock()
+	defer reconnects.Unlock()
+	_, busy := reconnects.active[addr]
+	return busy || time.Since(reconnects.dialed[addr]) < reconnectBase
+}
+
+func wantReconnect(addr string) bool {
+	reconnects.Lock()
+	defer reconnects.Unlock()
+	return !reconnects.skip[addr]
+}
+
+// allowReconnect undoes noReconnect once we're linked to addr again.
+func allowReconnect(addr string) {
+	reconnects.Lock()
+	defer reconnects.Unlock()
+	delete(reconnects.skip, addr)
+}
+
+// noReconnect stops retrying addr the next time its link drops, or now
+// if it already has.
+func noReconnect(addr string) {
+	reconnects.Lock()
+	defer reconnects.Unlock()
+	reconnects.skip[addr] = true
+	if stop, ok := reconnects.active[addr]; ok {
+		close(stop)
+		delete(reconnects.active, addr)
+	}
+}
+
+// forgetPeer handles /forget <addr>.
+func forgetPeer(name string) {
+	addr := dialAddr(peerFor(name))
+	reconnects.Lock()
+	_, retrying := reconnects.active[addr]
+	reconnects.Unlock()
+	noReconnect(addr)
+	unrememberPeer(addr)
+	if retrying {
+		statusLn(tr("Stopped reconnecting to %s", nickName(addr)))
+	} else {
+		statusLn(tr("Won't reconnect to %s if its link drops", nickName(addr)))
+	}
+}
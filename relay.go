@@ -0,0 +1,112 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Maximum number of peers a received message is relayed to; 0 means every
+// peer.
+var relayFanout int
+
+// Hop budget given to messages we send; 0 means no limit.
+var maxHops int
+
+// Chance that each relay slot goes to a random peer instead of the
+// best-scoring one, so slow or new peers still carry some traffic.
+const relayExplore = 0.2
+
+// Assumed RTT for peers that haven't answered a ping yet.
+const unknownRTT = 100 * time.Millisecond
+
+// Connections younger than this are scored as less reliable.
+const settledUptime = 10 * time.Minute
+
+// hopBudget is the Hops a message starts out with under -max-hops: one
+// for reaching our peers and one for each relay.
+func hopBudget() int {
+	if maxHops == 0 {
+		return 0
+	}
+	return maxHops + 1
+}
+
+// relay forwards a received message, skipping the peer it came from and its
+// author, unless its hop budget is spent or we're over -relay-limit. With
+// a fanout limit it prefers fast, long-lived connections.
+func relay(whisper SweetNothing, from string) {
+	// Anyone along the way could have raised the budget or lifted it, so
+	// it's never more than we'd have given the message ourselves.
+	if budget := hopBudget(); budget > 0 && (whisper.Hops == 0 || whisper.Hops > budget) {
+		whisper.Hops = budget
+	}
+	if whisper.Hops > 0 {
+		whisper.Hops--
+		if whisper.Hops == 0 {
+			return
+		}
+	}
+	targets := netPeers(whisper.Net)
+	delete(targets, from)
+	delete(targets, whisper.Addr)
+	fanout := relayFanout
+	if fanout == 0 && gossipMode == digestGossip {
+		fanout = digestFanout
+	}
+	if fanout > 0 && len(targets) > fanout {
+		chosen := make(map[string]chan<- Frame, fanout)
+		for _, addr := range pickRelays(targets, fanout) {
+			chosen[addr] = targets[addr]
+		}
+		targets = chosen
+	}
+	if len(targets) == 0 || !allowRelay() {
+		return
+	}
+	if relayMode {
+		b, _ := json.Marshal(whisper)
+		if !relayAllowed(from, len(b)*len(targets)) {
+			return
+		}
+	}
+	sendRelayed(whisper, targets)
+}
+
+// relayScore is lower for better relays: low latency, long uptime.
+func relayScore(addr string) float64 {
+	rtt := unknownRTT
+	if r, ok := peerRTT(addr); ok {
+		rtt = r.Avg
+	}
+	uptime := time.Since(peers.Since(addr))
+	settled := float64(uptime) / float64(settledUptime)
+	if settled > 1 {
+		settled = 1
+	} else if settled < 0.1 {
+		settled = 0.1
+	}
+	return float64(rtt) / settled
+}
+
+func pickRelays(targets map[string]chan<- Frame, k int) []string {
+	addrs := make([]string, 0, len(targets))
+	scores := make(map[string]float64, len(targets))
+	for addr := range targets {
+		addrs = append(addrs, addr)
+		scores[addr] = relayScore(addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return scores[addrs[i]] < scores[addrs[j]] })
+
+	picked := make([]string, 0, k)
+	for len(picked) < k {
+		i := 0
+		if rand.Float64() < relayExplore {
+			i = rand.Intn(len(addrs))
+		}
+		picked = append(picked, addrs[i])
+		addrs = append(addrs[:i], addrs[i+1:]...)
+	}
+	return picked
+}
@@ -0,0 +1,210 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * Relay nodes
+ *
+ * A publicly reachable node started with -relay serves peers that can't
+ * reach each other: it links back to them at once over the links they
+ * make to it, rather than trying to dial them first, and passes frames
+ * meant for one peer along to another. Peers learn which of their links
+ * go to relays from a "relay-hello" frame, and send through one when a
+ * frame can't go direct. Operators can see what each client has used
+ * with /relay, and cap it with -relay-rate.
+ */
+
+var relayMode bool
+
+// Per-client forwarding limit in KB/s; 0 means no limit.
+var relayRate int
+
+// How many seconds' worth of -relay-rate a client can use in a burst.
+const relayBurst = 10
+
+type relayEnvelope struct {
+	To    string
+	From  string `json:",omitempty"`
+	Frame Frame
+}
+
+// relayAccount is what a relay has forwarded for one client.
+type relayAccount struct {
+	// Bytes sent on the client's behalf, to however many peers.
+	Forwarded uint64
+	// Bytes passed to the client from others.
+	Delivered uint64
+	Frames    uint64
+	Dropped   uint64
+	Since     time.Time
+
+	tokens float64
+	filled time.Time
+}
+
+var relayAccounts = struct {
+	m map[string]*relayAccount
+	sync.Mutex
+}{m: make(map[string]*relayAccount)}
+
+// The relays among our peers.
+var relayNodes = struct {
+	m map[string]bool
+	sync.Mutex
+}{m: make(map[string]bool)}
+
+func init() {
+	controlHandlers["relay-hello"] = handleRelayHello
+	controlHandlers["relay"] = handleRelay
+	controlHandlers["relayed"] = handleRelayed
+}
+
+func relayAccountFor(addr string) *relayAccount {
+	a, ok := relayAccounts.m[addr]
+	if !ok {
+		a = &relayAccount{Since: time.Now(), filled: time.Now(), tokens: float64(relayRate * 1024 * relayBurst)}
+		relayAccounts.m[addr] = a
+	}
+	return a
+}
+
+// relayAllowed charges n bytes forwarded for client against its rate,
+// reporting whether they may go.
+func relayAllowed(client string, n int) bool {
+	relayAccounts.Lock()
+	defer relayAccounts.Unlock()
+	a := relayAccountFor(client)
+	if relayRate > 0 {
+		rate := float64(relayRate * 1024)
+		a.tokens += time.Since(a.filled).Seconds() * rate
+		if max := rate * relayBurst; a.tokens > max {
+			a.tokens = max
+		}
+		a.filled = time.Now()
+		if a.tokens < float64(n) {
+			a.Dropped++
+			return false
+		}
+		a.tokens -= float64(n)
+	}
+	a.Forwarded += uint64(n)
+	a.Frames++
+	return true
+}
+
+func relayDelivered(client string, n int) {
+	relayAccounts.Lock()
+	defer relayAccounts.Unlock()
+	relayAccountFor(client).Delivered += uint64(n)
+}
+
+// announceRelay tells a new peer that it can send through us.
+func announceRelay(addr string) {
+	if relayMode {
+		sendSoon(addr, controlFrame("relay-hello", struct{}{}), sessionTimeout)
+	}
+}
+
+func handleRelayHello(from string, data json.RawMessage) {
+	relayNodes.Lock()
+	defer relayNodes.Unlock()
+	if !relayNodes.m[from] {
+		relayNodes.m[from] = true
+		statusLn(tr("%s is a relay", from))
+	}
+}
+
+// viaRelay sends f to addr through the first relay we're linked to that
+// is also linked to it, as far as we know.
+func viaRelay(addr string, f Frame) bool {
+	relayNodes.Lock()
+	var relays []string
+	for r := range relayNodes.m {
+		relays = append(relays, r)
+	}
+	relayNodes.Unlock()
+	sort.Strings(relays)
+	for _, r := range relays {
+		if r != addr && sendDirect(r, controlFrame("relay", relayEnvelope{To: addr, Frame: f})) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleRelay(from string, data json.RawMessage) {
+	var env relayEnvelope
+	if !relayMode || json.Unmarshal(data, &env) != nil || env.Frame.Type == msgFrame {
+		return
+	}
+	if !relayAllowed(from, len(data)) {
+		return
+	}
+	if sendDirect(env.To, controlFrame("relayed", relayEnvelope{To: env.To, From: from, Frame: env.Frame})) {
+		relayDelivered(env.To, len(data))
+	}
+}
+
+func handleRelayed(from string, data json.RawMessage) {
+	var env relayEnvelope
+	if json.Unmarshal(data, &env) != nil || env.Frame.Type == msgFrame || !isLocal(env.To) {
+		return
+	}
+	relayNodes.Lock()
+	ok := relayNodes.m[from]
+	relayNodes.Unlock()
+	if !ok {
+		return
+	}
+	env.Frame.From = env.From
+	handleControl(env.Frame)
+}
+
+// showRelay lists what we've forwarded for each client, or which relays
+// we're using.
+func showRelay() {
+	if !relayMode {
+		relayNodes.Lock()
+		defer relayNodes.Unlock()
+		if len(relayNodes.m) == 0 {
+			statusLn(T("No relays"))
+		}
+		for r := range relayNodes.m {
+			statusLn(tr("Relay %s", nick(r)))
+		}
+		return
+	}
+	relayAccounts.Lock()
+	defer relayAccounts.Unlock()
+	if len(relayAccounts.m) == 0 {
+		statusLn(T("Nothing relayed yet"))
+		return
+	}
+	var clients []string
+	for addr := range relayAccounts.m {
+		clients = append(clients, addr)
+	}
+	sort.Strings(clients)
+	for _, addr := range clients {
+		a := relayAccounts.m[addr]
+		statusLn(fmt.Sprintf("%s %s", nick(addr), tr("forwarded %d bytes in %d frames, delivered %d bytes, dropped %d, since %s",
+			a.Forwarded, a.Frames, a.Delivered, a.Dropped, a.Since.Format(time.Kitchen))))
+	}
+}
+
+// relayStats is the accounting for the dashboard.
+func relayStats() map[string]relayAccount {
+	relayAccounts.Lock()
+	defer relayAccounts.Unlock()
+	m := make(map[string]relayAccount, len(relayAccounts.m))
+	for addr, a := range relayAccounts.m {
+		m[addr] = *a
+	}
+	return m
+}
@@ -0,0 +1,184 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Reminder struct {
+	ID     string
+	Target string
+	Body   string
+	Due    time.Time
+}
+
+var reminders = struct {
+	path string
+	l    []Reminder
+	wake chan struct{}
+	sync.Mutex
+}{wake: make(chan struct{}, 1)}
+
+// parseDuration is time.ParseDuration plus a "d" suffix for days.
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func loadReminders(path string) {
+	reminders.Lock()
+	defer reminders.Unlock()
+	reminders.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, &reminders.l); err != nil {
+		logger.Warn(T("Discarding unreadable reminders"), "event", "reminders", "err", err)
+	}
+}
+
+// saveReminders must be called with reminders locked.
+func saveReminders() {
+	if len(reminders.path) == 0 {
+		return
+	}
+	b, _ := json.Marshal(reminders.l)
+	os.MkdirAll(filepath.Dir(reminders.path), 0700)
+	tmp := reminders.path + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil {
+		err = os.Rename(tmp, reminders.path)
+	}
+	if err != nil {
+		logger.Error(T("Error saving reminders"), "event", "reminders", "path", reminders.path, "err", err)
+	}
+}
+
+// addReminder handles "/remind me|#channel in <duration> <text>".
+func addReminder(args []string) {
+	if len(args) < 4 || args[1] != "in" || (args[0] != "me" && !strings.HasPrefix(args[0], "#")) {
+		statusLn(tr("Usage: /remind me|#channel in <duration> <text>"))
+		return
+	}
+	d, err := parseDuration(args[2])
+	if err != nil || d <= 0 {
+		statusLn(tr("Bad duration %q (try 30m, 2h, 1d)", args[2]))
+		return
+	}
+	r := Reminder{uniqueId(), args[0], strings.Join(args[3:], " "), time.Now().Add(d)}
+
+	reminders.Lock()
+	reminders.l = append(reminders.l, r)
+	sort.Slice(reminders.l, func(i, j int) bool { return reminders.l[i].Due.Before(reminders.l[j].Due) })
+	saveReminders()
+	reminders.Unlock()
+
+	select {
+	case reminders.wake <- struct{}{}:
+	default:
+	}
+	statusLn(tr("Will remind %s at %s", r.Target, r.Due.Format("Mon 15:04")))
+}
+
+func showReminders() {
+	reminders.Lock()
+	defer reminders.Unlock()
+	if len(reminders.l) == 0 {
+		statusLn(tr("No reminders"))
+		return
+	}
+	for i, r := range reminders.l {
+		statusLn(fmt.Sprintf("%d) %s %s: %s", i+1, r.Due.Format("Mon Jan 2 15:04"), r.Target, r.Body))
+	}
+}
+
+// cancelReminder removes a reminder by its /reminders number or ID prefix.
+func cancelReminder(arg string) {
+	reminders.Lock()
+	defer reminders.Unlock()
+	i := -1
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(reminders.l) {
+		i = n - 1
+	} else {
+		for j, r := range reminders.l {
+			if strings.HasPrefix(r.ID, arg) {
+				i = j
+				break
+			}
+		}
+	}
+	if i < 0 {
+		statusLn(tr("No reminder %s", arg))
+		return
+	}
+	r := reminders.l[i]
+	reminders.l = append(reminders.l[:i], reminders.l[i+1:]...)
+	saveReminders()
+	statusLn(tr("Cancelled reminder: %s", r.Body))
+}
+
+func deliverReminder(r Reminder) {
+	if r.Target == "me" {
+		late := ""
+		if time.Since(r.Due) > time.Minute {
+			late = tr(" (due %s)", r.Due.Format("Mon 15:04"))
+		}
+		if accessible {
+			fmt.Fprintln(stdout, tr("Reminder%s: %s", late, r.Body))
+		} else {
+			fmt.Fprintln(stdout, wrapColor(tr("[Reminder%s] %s", late, r.Body), "yellow"))
+		}
+		return
+	}
+	room := roomName(r.Target)
+	if len(room) == 0 {
+		room = activeRoom()
+	}
+	if whisper, ok := publishText(SweetNothing{Room: room, Body: r.Body}); ok {
+		showMessage(whisper)
+	}
+}
+
+// startReminders delivers reminders as they come due, including any that
+// fell due while we weren't running.
+func startReminders() {
+	for {
+		reminders.Lock()
+		var due []Reminder
+		now := time.Now()
+		for len(reminders.l) > 0 && !reminders.l[0].Due.After(now) {
+			due = append(due, reminders.l[0])
+			reminders.l = reminders.l[1:]
+		}
+		if len(due) > 0 {
+			saveReminders()
+		}
+		wait := time.Minute
+		if len(reminders.l) > 0 {
+			wait = time.Until(reminders.l[0].Due)
+		}
+		reminders.Unlock()
+
+		for _, r := range due {
+			deliverReminder(r)
+		}
+		select {
+		case <-time.After(wait):
+		case <-reminders.wake:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package sweetnothings
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MessageView is what a -format template sees for each chat message.
+type MessageView struct {
+	// ID is what /react, /pin and the like take.
+	ID        string
+	Nick      string
+	Addr      string
+	Channel   string
+	Network   string
+	Timestamp time.Time
+	Body      string
+	// Fingerprint identifies the author's signing key, if they signed.
+	Fingerprint string
+	// Flags describe the message: "self" if we wrote it, "relayed" if it
+	// reached us through other peers (only known with -trace), "edited" if
+	// its author has changed it, "mention" if it mentions us.
+	Flags []string
+}
+
+func (v MessageView) Has(flag string) bool {
+	for _, f := range v.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+var renderFuncs = template.FuncMap{
+	"color": func(color string, s string) string { return wrapColor(s, color) },
+	"bold":  bold,
+	"time":  func(layout string, t time.Time) string { return t.Local().Format(layout) },
+	"join":  strings.Join,
+	// markdown styles a body the way plain output does.
+	"markdown": renderMarkdown,
+}
+
+// Message templates by channel; "" is the default for every channel
+// without its own.
+var formats = make(map[string]*template.Template)
+
+// formatFlag collects -format values of the form "template" or
+// "#channel=template".
+type formatFlag struct{}
+
+func (formatFlag) String() string { return "" }
+
+func (formatFlag) Set(v string) error {
+	channel := ""
+	if strings.HasPrefix(v, "#") {
+		i := strings.Index(v, "=")
+		if i < 0 {
+			return fmt.Errorf(T("expected #channel=template, got %q"), v)
+		}
+		channel, v = v[:i], v[i+1:]
+	}
+	if !strings.HasSuffix(v, "\n") {
+		v += "\n"
+	}
+	t, err := template.New(channel).Funcs(renderFuncs).Parse(v)
+	if err != nil {
+		return err
+	}
+	formats[channel] = t
+	return nil
+}
+
+func messageView(whisper SweetNothing) MessageView {
+	v := MessageView{
+		ID:          whisper.ID,
+		Nick:        nickName(whisper.Addr),
+		Fingerprint: identityFingerprint(whisper.Addr),
+		Addr:        whisper.Addr,
+		Channel:     whisper.Channel(),
+		Network:     whisper.Net,
+		Timestamp:   whisper.Timestamp,
+		Body:        whisper.Body,
+	}
+	if isLocal(whisper.Addr) {
+		v.Flags = append(v.Flags, "self")
+	}
+	if len(whisper.Path) > 2 {
+		v.Flags = append(v.Flags, "relayed")
+	}
+	if whisper.Edited {
+		v.Flags = append(v.Flags, "edited")
+	}
+	if mentionsUs(whisper) {
+		v.Flags = append(v.Flags, "mention")
+	}
+	return v
+}
+
+// showMessage prints a chat message through its channel's template, or the
+// standard chat line if none is configured.
+func showMessage(whisper SweetNothing) {
+	v := messageView(whisper)
+	t, ok := formats[v.Channel]
+	if !ok {
+		t, ok = formats[""]
+	}
+	body := whisper.Body
+	if expandEmojiIn {
+		body = expandShortcodes(body)
+	}
+	body = renderMarkdown(body)
+	if v.Has("mention") {
+		body = highlightMention(body)
+	}
+	if whisper.Edited {
+		body += " " + wrapColor(T("(edited)"), "blue")
+	}
+	if !ok {
+		fmt.Fprint(stdout, roomTag(whisper.Room))
+		chatLn(whisper.Addr, body)
+		return
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, v); err != nil {
+		logger.Error(T("Error rendering message"), "event", "render", "id", whisper.ID, "err", err)
+		fmt.Fprint(stdout, roomTag(whisper.Room))
+		chatLn(whisper.Addr, body)
+		return
+	}
+	fmt.Fprint(stdout, b.String())
+}
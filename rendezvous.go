@@ -0,0 +1,146 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Rendezvous
+ *
+ * A node started with -rendezvous only introduces peers: it doesn't chat,
+ * relay or show messages. Clients started with -bootstrap addr register
+ * with it and get back the peers that registered recently, dial them, and
+ * drop the link to the rendezvous node once they've heard back.
+ */
+
+var rendezvousMode bool
+var bootstrapAddrs string
+
+// Registrations older than this are left out of peer lists.
+const registrationTTL = 30 * time.Minute
+
+const reregisterEvery = 10 * time.Minute
+
+// Most peers handed to a new client.
+const maxIntroductions = 50
+
+const rendezvousTimeout = 10 * time.Second
+
+type registration struct {
+	Nonce string
+}
+
+type introduction struct {
+	Nonce string
+	Peers []string
+}
+
+// Who has registered with us, when we're a rendezvous node.
+var registry = struct {
+	m map[string]time.Time
+	sync.Mutex
+}{m: make(map[string]time.Time)}
+
+// Registrations we're waiting to hear back about, by nonce, with the
+// address we dialed.
+var registering = struct {
+	m map[string]string
+	sync.Mutex
+}{m: make(map[string]string)}
+
+func init() {
+	controlHandlers["register"] = handleRegister
+	controlHandlers["introduce"] = handleIntroduce
+}
+
+func handleRegister(from string, data json.RawMessage) {
+	var r registration
+	if !rendezvousMode || len(netOf(from)) > 0 {
+		return
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return
+	}
+	registry.Lock()
+	registry.m[from] = time.Now()
+	type seen struct {
+		addr string
+		at   time.Time
+	}
+	var l []seen
+	for addr, at := range registry.m {
+		if time.Since(at) > registrationTTL {
+			delete(registry.m, addr)
+		} else if addr != from {
+			l = append(l, seen{addr, at})
+		}
+	}
+	registry.Unlock()
+	sort.Slice(l, func(i, j int) bool { return l[i].at.After(l[j].at) })
+	intro := introduction{Nonce: r.Nonce}
+	for i := 0; i < len(l) && i < maxIntroductions; i++ {
+		intro.Peers = append(intro.Peers, l[i].addr)
+	}
+	statusLn(tr("%s registered, introducing %d peers", from, len(intro.Peers)))
+	go func() {
+		sendSoon(from, controlFrame("introduce", intro), rendezvousTimeout)
+		// Give the frame a moment to go out before hanging up.
+		time.Sleep(time.Second)
+		noReconnect(from)
+		peers.Disconnect(from)
+	}()
+}
+
+func handleIntroduce(from string, data json.RawMessage) {
+	var intro introduction
+	if err := json.Unmarshal(data, &intro); err != nil {
+		return
+	}
+	registering.Lock()
+	addr, ok := registering.m[intro.Nonce]
+	delete(registering.m, intro.Nonce)
+	registering.Unlock()
+	if !ok {
+		return
+	}
+	noReconnect(addr)
+	peers.Disconnect(addr)
+	statusLn(tr("%s introduced %d peers", addr, len(intro.Peers)))
+	for _, p := range intro.Peers {
+		if !isLocal(p) && peers.Get(p) == nil {
+			go autoDial(p)
+		}
+	}
+}
+
+func register(addr string) {
+	nonce := newSessionToken()
+	registering.Lock()
+	registering.m[nonce] = addr
+	registering.Unlock()
+	if !sendSoon(addr, controlFrame("register", registration{Nonce: nonce}), rendezvousTimeout) {
+		registering.Lock()
+		delete(registering.m, nonce)
+		registering.Unlock()
+	}
+}
+
+// startBootstrap registers with each -bootstrap node now and then, so we
+// stay listed and hear about newcomers.
+func startBootstrap() {
+	var addrs []string
+	for _, addr := range strings.Split(bootstrapAddrs, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	for ; ; time.Sleep(reregisterEvery) {
+		for _, addr := range addrs {
+			go register(addr)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const compactEvery = time.Hour
+
+// Ephemeral messages are looked for this often, so they don't outlive
+// their TTL by much.
+const expireEvery = time.Minute
+
+/**
+ * RetentionPolicy
+ *
+ * MaxAge and MaxBytes bound each room's history, unless Rooms gives the
+ * room limits of its own. Ephemeral messages are dropped once their TTL
+ * is up whatever the policy, and never archived.
+ */
+type RetentionPolicy struct {
+	MaxAge      time.Duration
+	MaxBytes    int64
+	Rooms       map[string]RoomRetention
+	ArchivePath string
+}
+
+// RoomRetention is how much history to keep for one room.
+type RoomRetention struct {
+	MaxAge   time.Duration
+	MaxBytes int64
+}
+
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxBytes > 0 || len(p.Rooms) > 0
+}
+
+func (p RetentionPolicy) forRoom(room string) RoomRetention {
+	if r, ok := p.Rooms[room]; ok {
+		return r
+	}
+	return RoomRetention{p.MaxAge, p.MaxBytes}
+}
+
+// roomRetentionFlag collects -retain-room limits into a policy.
+type roomRetentionFlag struct {
+	p *RetentionPolicy
+}
+
+func (roomRetentionFlag) String() string { return "" }
+
+// Set takes "#room=7d", "#room=50mb" or "#room=7d,50mb"; "#" is the main
+// room.
+func (f roomRetentionFlag) Set(v string) error {
+	name, limits, ok := strings.Cut(v, "=")
+	if !ok || !strings.HasPrefix(name, "#") {
+		return fmt.Errorf(T("want #room=<days>d,<size>mb, not %q"), v)
+	}
+	var r RoomRetention
+	for _, limit := range strings.Split(limits, ",") {
+		limit = strings.ToLower(strings.TrimSpace(limit))
+		if mb, ok := strings.CutSuffix(limit, "mb"); ok {
+			n, err := strconv.Atoi(mb)
+			if err != nil || n < 0 {
+				return fmt.Errorf(T("bad size %q"), limit)
+			}
+			r.MaxBytes = int64(n) * 1024 * 1024
+			continue
+		}
+		d, err := parseDuration(limit)
+		if err != nil || d < 0 {
+			return fmt.Errorf(T("bad age %q"), limit)
+		}
+		r.MaxAge = d
+	}
+	if f.p.Rooms == nil {
+		f.p.Rooms = make(map[string]RoomRetention)
+	}
+	f.p.Rooms[roomName(name)] = r
+	return nil
+}
+
+// sayEphemeral handles "/ephemeral <duration> <text>": text in the active
+// room that everyone drops from history once duration is up.
+func sayEphemeral(args []string) {
+	if len(args) < 2 {
+		statusLn(T("Usage: /ephemeral <duration> <text>"))
+		return
+	}
+	d, err := parseDuration(args[0])
+	if err != nil || d <= 0 {
+		statusLn(tr("Bad duration %q (try 30m, 2h, 1d)", args[0]))
+		return
+	}
+	if whisper, ok := publishText(SweetNothing{Room: activeRoom(), Body: strings.Join(args[1:], " "), TTL: d}); ok {
+		showMessage(whisper)
+	}
+}
+
+// expired reports whether an ephemeral message's TTL is up.
+func expired(whisper SweetNothing, now time.Time) bool {
+	return whisper.TTL > 0 && !now.Before(whisper.Timestamp.Add(whisper.TTL))
+}
+
+// Compact drops expired messages, then, room by room, messages older than
+// the room's max age and the oldest messages until the room fits in its
+// byte budget. It returns the messages that were dropped.
+func (h *History) Compact(p RetentionPolicy) ([]SweetNothing, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	// Walk newest to oldest so the byte budget favors recent messages.
+	size := make(map[string]int64)
+	full := make(map[string]bool)
+	var ids []string
+	var pruned []SweetNothing
+	for i := len(h.msgs) - 1; i >= 0; i-- {
+		whisper := h.msgs[i]
+		r := p.forRoom(whisper.Room)
+		drop := expired(whisper, now) || full[whisper.Room] ||
+			(r.MaxAge > 0 && whisper.Timestamp.Before(now.Add(-r.MaxAge)))
+		if !drop && r.MaxBytes > 0 {
+			b, _ := json.Marshal(whisper)
+			size[whisper.Room] += int64(len(b)) + 1
+			drop = size[whisper.Room] > r.MaxBytes
+			full[whisper.Room] = drop
+		}
+		if drop {
+			ids = append(ids, whisper.ID)
+			pruned = append(pruned, whisper)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+
+	// Oldest first, as they were archived.
+	for i, j := 0, len(pruned)-1; i < j; i, j = i+1, j-1 {
+		pruned[i], pruned[j] = pruned[j], pruned[i]
+	}
+	h.drop(ids)
+	h.garbage += len(ids) + 1
+	if err := h.log(historyLine{Drop: ids}); err != nil {
+		return pruned, err
+	}
+	return pruned, h.settle()
+}
+
+func archiveMessages(path string, msgs []SweetNothing) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, whisper := range msgs {
+		if err := enc.Encode(whisper); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func compactHistory(p RetentionPolicy) {
+	pruned, err := history.Compact(p)
+	if err != nil {
+		logger.Error(T("Error compacting history"), "event", "retention", "err", err)
+		return
+	}
+	if len(pruned) == 0 {
+		return
+	}
+	var keep []SweetNothing
+	for _, whisper := range pruned {
+		if whisper.TTL == 0 {
+			keep = append(keep, whisper)
+		}
+	}
+	if len(p.ArchivePath) > 0 && len(keep) > 0 {
+		if err := archiveMessages(p.ArchivePath, keep); err != nil {
+			logger.Error(T("Error archiving history"), "event", "retention", "path", p.ArchivePath, "err", err)
+		}
+	}
+	searchIndex.Rebuild(history)
+	if p.Enabled() {
+		statusLn(tr("Compacted history: pruned %d messages", len(pruned)))
+	}
+}
+
+// startCompactor applies p every compactEvery, and drops expired
+// messages in between.
+func startCompactor(p RetentionPolicy) {
+	var last time.Time
+	for {
+		if p.Enabled() && time.Since(last) >= compactEvery {
+			compactHistory(p)
+			last = time.Now()
+		} else {
+			compactHistory(RetentionPolicy{})
+		}
+		time.Sleep(expireEvery)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package sweetnothings
+
+import "syscall"
+
+const reusePortAvailable = true
+
+// reusePort lets a dialer share our listen port, which hole punching
+// needs.
+func reusePort(network string, address string, c syscall.RawConn) error {
+	var err error
+	c.Control(func(fd uintptr) {
+		if err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err == nil {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+		}
+	})
+	return err
+}
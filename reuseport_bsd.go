@@ -0,0 +1,7 @@
+//go:build darwin || freebsd
+
+package sweetnothings
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
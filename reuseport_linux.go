@@ -0,0 +1,4 @@
+package sweetnothings
+
+// SO_REUSEPORT, which package syscall leaves out on some Linux ports.
+const soReusePort = 0xf
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package sweetnothings
+
+import "syscall"
+
+// Without SO_REUSEPORT a dialer can't share the listen port, so there's no
+// hole punching here.
+const reusePortAvailable = false
+
+func reusePort(network string, address string, c syscall.RawConn) error {
+	return nil
+}
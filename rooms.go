@@ -0,0 +1,164 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+ * Rooms
+ *
+ * Besides the mesh-wide main room, messages can be said in a named room
+ * like #ops. Every node still relays and records every room's messages,
+ * but only shows those in rooms it has joined. Whatever we type goes to
+ * the active room, the one we last joined. Joined rooms are remembered
+ * in rooms.json.
+ */
+
+var rooms = struct {
+	path   string
+	joined map[string]bool
+	active string
+	sync.Mutex
+}{joined: make(map[string]bool)}
+
+type savedRooms struct {
+	Joined []string
+	Active string
+}
+
+// roomName normalizes "ops" and "#Ops" to "#ops".
+func roomName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 0 || s == "#" {
+		return ""
+	}
+	return "#" + strings.TrimPrefix(s, "#")
+}
+
+func loadRooms(path string) {
+	rooms.Lock()
+	defer rooms.Unlock()
+	rooms.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var saved savedRooms
+	if err := json.Unmarshal(b, &saved); err != nil {
+		logger.Warn(T("Discarding unreadable rooms"), "event", "rooms", "err", err)
+		return
+	}
+	for _, room := range saved.Joined {
+		rooms.joined[room] = true
+	}
+	if rooms.joined[saved.Active] {
+		rooms.active = saved.Active
+	}
+}
+
+// saveRooms must be called with rooms locked.
+func saveRooms() {
+	if len(rooms.path) == 0 {
+		return
+	}
+	saved := savedRooms{Active: rooms.active}
+	for room := range rooms.joined {
+		saved.Joined = append(saved.Joined, room)
+	}
+	sort.Strings(saved.Joined)
+	b, _ := json.Marshal(saved)
+	os.MkdirAll(filepath.Dir(rooms.path), 0700)
+	tmp := rooms.path + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil {
+		err = os.Rename(tmp, rooms.path)
+	}
+	if err != nil {
+		logger.Error(T("Error saving rooms"), "event", "rooms", "path", rooms.path, "err", err)
+	}
+}
+
+func activeRoom() string {
+	rooms.Lock()
+	defer rooms.Unlock()
+	return rooms.active
+}
+
+// inRoom reports whether we show messages said in room.
+func inRoom(room string) bool {
+	if len(room) == 0 {
+		return true
+	}
+	rooms.Lock()
+	defer rooms.Unlock()
+	return rooms.joined[room]
+}
+
+// joinRoom joins a room, or just switches to it if we're already in, so
+// that what we type goes there. "/join #" goes back to the main room.
+func joinRoom(arg string) {
+	room := roomName(arg)
+	rooms.Lock()
+	defer rooms.Unlock()
+	if len(room) > 0 && !rooms.joined[room] {
+		rooms.joined[room] = true
+		statusLn(tr("Joined %s", room))
+	}
+	rooms.active = room
+	saveRooms()
+	statusLn(tr("Talking in %s", roomLabel(room)))
+}
+
+func leaveRoom(arg string) {
+	room := roomName(arg)
+	rooms.Lock()
+	defer rooms.Unlock()
+	if !rooms.joined[room] {
+		statusLn(tr("Not in %s", arg))
+		return
+	}
+	delete(rooms.joined, room)
+	statusLn(tr("Left %s", room))
+	if rooms.active == room {
+		rooms.active = ""
+		statusLn(tr("Talking in %s", roomLabel("")))
+	}
+	saveRooms()
+}
+
+func showRooms() {
+	rooms.Lock()
+	defer rooms.Unlock()
+	names := []string{""}
+	for room := range rooms.joined {
+		names = append(names, room)
+	}
+	sort.Strings(names)
+	for _, room := range names {
+		label := roomLabel(room)
+		if room == rooms.active {
+			label += " *"
+		}
+		statusLn(label)
+	}
+}
+
+func roomLabel(room string) string {
+	if len(room) == 0 {
+		return T("the main room")
+	}
+	return room
+}
+
+// roomTag goes in front of a chat line said in a room.
+func roomTag(room string) string {
+	if len(room) == 0 {
+		return ""
+	}
+	return wrapColor(room, "cyan") + " "
+}
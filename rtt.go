@@ -0,0 +1,138 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const pingInterval = 10 * time.Second
+
+// A link is dropped as dead once this many pings in a row go unanswered,
+// so a peer that vanished without closing it (a sleeping laptop, a NAT
+// that forgot us) doesn't swallow what we send it. 0 never drops links.
+var keepaliveMisses = 3
+
+// Number of RTT samples kept per peer.
+const rttSamples = 30
+
+type Ping struct {
+	Seq uint64
+}
+
+type RTTStats struct {
+	Last    time.Duration
+	Min     time.Duration
+	Avg     time.Duration
+	P95     time.Duration
+	Samples int
+}
+
+var rtts = struct {
+	seq     uint64
+	pending map[string]map[uint64]time.Time
+	samples map[string][]time.Duration
+	// Pings sent to each peer since its last pong.
+	unanswered map[string]int
+	sync.Mutex
+}{
+	pending:    make(map[string]map[uint64]time.Time),
+	samples:    make(map[string][]time.Duration),
+	unanswered: make(map[string]int),
+}
+
+func init() {
+	controlHandlers["ping"] = handlePing
+	controlHandlers["pong"] = handlePong
+}
+
+// pingFrame builds the next ping for addr and remembers when it was sent.
+func pingFrame(addr string) Frame {
+	rtts.Lock()
+	defer rtts.Unlock()
+	rtts.seq++
+	p, ok := rtts.pending[addr]
+	if !ok {
+		p = make(map[uint64]time.Time)
+		rtts.pending[addr] = p
+	}
+	now := time.Now()
+	for seq, sent := range p {
+		if now.Sub(sent) > rttSamples*pingInterval {
+			delete(p, seq)
+		}
+	}
+	p[rtts.seq] = now
+	rtts.unanswered[addr]++
+	return controlFrame("ping", Ping{rtts.seq})
+}
+
+// linkDead reports whether addr has missed enough pongs to give up on.
+func linkDead(addr string) bool {
+	rtts.Lock()
+	defer rtts.Unlock()
+	return keepaliveMisses > 0 && rtts.unanswered[addr] >= keepaliveMisses
+}
+
+func handlePing(from string, data json.RawMessage) {
+	f := Frame{Type: "pong", Data: data}
+	if peers.Get(from) == nil {
+		if !sendTo(from, f) {
+			// We aren't talking back to this peer yet; the next ping will
+			// land.
+			go autoDial(from)
+		}
+		return
+	}
+	// Wait for a busy writer rather than miss a pong and look dead.
+	go sendSoon(from, f, pingInterval)
+}
+
+func handlePong(from string, data json.RawMessage) {
+	var p Ping
+	if err := json.Unmarshal(data, &p); err != nil {
+		return
+	}
+	rtts.Lock()
+	defer rtts.Unlock()
+	sent, ok := rtts.pending[from][p.Seq]
+	if !ok {
+		return
+	}
+	rtts.unanswered[from] = 0
+	delete(rtts.pending[from], p.Seq)
+	s := append(rtts.samples[from], time.Since(sent))
+	if len(s) > rttSamples {
+		s = s[len(s)-rttSamples:]
+	}
+	rtts.samples[from] = s
+}
+
+func peerRTT(addr string) (RTTStats, bool) {
+	rtts.Lock()
+	s := append([]time.Duration(nil), rtts.samples[addr]...)
+	rtts.Unlock()
+	if len(s) == 0 {
+		return RTTStats{}, false
+	}
+
+	r := RTTStats{Last: s[len(s)-1], Samples: len(s)}
+	var total time.Duration
+	for _, d := range s {
+		total += d
+	}
+	r.Avg = total / time.Duration(len(s))
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	r.Min = s[0]
+	r.P95 = s[(len(s)*95-1)/100]
+	return r, true
+}
+
+func forgetRTT(addr string) {
+	rtts.Lock()
+	defer rtts.Unlock()
+	delete(rtts.pending, addr)
+	delete(rtts.samples, addr)
+	delete(rtts.unanswered, addr)
+}
@@ -0,0 +1,99 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/**
+ * Search
+ *
+ * /search <terms> looks history up in the search index: every term has
+ * to appear, and a term ending in * matches words starting with it. The
+ * latest maxSearchResults matches are shown oldest first with their
+ * terms underlined, between the messages said just before and after.
+ */
+
+const maxSearchResults = 20
+
+func searchHistory(query string) {
+	if history == nil || searchIndex == nil {
+		statusLn(tr("History is disabled"))
+		return
+	}
+	if len(strings.TrimSpace(query)) == 0 {
+		statusLn(T("Usage: /search <terms>"))
+		return
+	}
+	var matches []SweetNothing
+	for _, whisper := range history.Lookup(searchIndex.Search(query)) {
+		if searchable(whisper) {
+			matches = append(matches, whisper)
+		}
+	}
+	if len(matches) == 0 {
+		statusLn(tr("Nothing matches %q", query))
+		return
+	}
+	if len(matches) > maxSearchResults {
+		statusLn(tr("%d messages match %q; showing the latest %d", len(matches), query, maxSearchResults))
+		matches = matches[len(matches)-maxSearchResults:]
+	} else {
+		statusLn(tr("%d messages match %q", len(matches), query))
+	}
+	terms := searchTerms(query)
+	for _, whisper := range matches {
+		around, at := history.Around(whisper.ID, 3)
+		if before, ok := nearest(around[:at], true); ok {
+			contextLn(before)
+		}
+		fmt.Fprint(stdout, wrapColor(historyStamp(whisper.Timestamp), "blue")+" "+roomTag(whisper.Room))
+		chatLn(whisper.Addr, terms.ReplaceAllStringFunc(whisper.Body, func(m string) string { return wrapColor(m, "underline") }))
+		if after, ok := nearest(around[at+1:], false); ok {
+			contextLn(after)
+		}
+		fmt.Fprintln(stdout)
+	}
+}
+
+// searchable is whether whisper is something to show in search results.
+func searchable(whisper SweetNothing) bool {
+	return (len(whisper.Kind) == 0 || whisper.Kind == dmKind) && !whisper.Deleted && inRoom(whisper.Room)
+}
+
+// nearest finds the message in msgs closest to the match, which comes
+// after them if last is set.
+func nearest(msgs []SweetNothing, last bool) (SweetNothing, bool) {
+	for i := range msgs {
+		j := i
+		if last {
+			j = len(msgs) - 1 - i
+		}
+		if searchable(msgs[j]) {
+			return msgs[j], true
+		}
+	}
+	return SweetNothing{}, false
+}
+
+func contextLn(whisper SweetNothing) {
+	fmt.Fprintln(stdout, wrapColor(fmt.Sprintf("%s %s%s: %s", historyStamp(whisper.Timestamp), roomTag(whisper.Room), nickName(whisper.Addr), excerpt(whisper.Body, 100)), "dim"))
+}
+
+// searchTerms matches the words of query in a body.
+func searchTerms(query string) *regexp.Regexp {
+	var words []string
+	for _, w := range strings.Fields(query) {
+		prefix := strings.HasSuffix(w, "*")
+		terms := tokenize(w)
+		for i, t := range terms {
+			p := `\b` + regexp.QuoteMeta(t) + `\b`
+			if prefix && i == len(terms)-1 {
+				p = `\b` + regexp.QuoteMeta(t) + `\w*`
+			}
+			words = append(words, p)
+		}
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+}
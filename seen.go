@@ -0,0 +1,100 @@
+package sweetnothings
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/**
+ * Seen message IDs
+ *
+ * Relaying needs to know which messages we've already handled, but a
+ * long-running node can't remember every ID forever. SeenCache keeps the
+ * most recently seen ones, up to -seen-cap of them and for -seen-ttl
+ * since each was last seen, evicting the stalest first. Both comfortably
+ * outlast how long a message keeps circulating: gossip stops offering
+ * one after recentWindow.
+ */
+
+const (
+	defaultSeenCap = 100000
+	defaultSeenTTL = 24 * time.Hour
+)
+
+type seenEntry struct {
+	id   string
+	seen time.Time
+}
+
+type SeenCache struct {
+	cap   int
+	ttl   time.Duration
+	order *list.List
+	m     map[string]*list.Element
+	sync.Mutex
+}
+
+func NewSeenCache(cap int, ttl time.Duration) *SeenCache {
+	return &SeenCache{cap: cap, ttl: ttl, order: list.New(), m: make(map[string]*list.Element)}
+}
+
+// SetLimits changes the capacity and expiry, evicting to fit.
+func (c *SeenCache) SetLimits(cap int, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.cap, c.ttl = cap, ttl
+	c.evict(time.Now())
+}
+
+// Add marks id seen and reports whether it already was.
+func (c *SeenCache) Add(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	c.evict(now)
+	if e, ok := c.m[id]; ok {
+		e.Value.(*seenEntry).seen = now
+		c.order.MoveToFront(e)
+		return true
+	}
+	c.m[id] = c.order.PushFront(&seenEntry{id: id, seen: now})
+	c.evict(now)
+	return false
+}
+
+func (c *SeenCache) Has(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.m[id]
+	return ok && (c.ttl <= 0 || time.Since(e.Value.(*seenEntry).seen) < c.ttl)
+}
+
+func (c *SeenCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.m)
+}
+
+// IDs lists what's remembered, stalest first.
+func (c *SeenCache) IDs() []string {
+	c.Lock()
+	defer c.Unlock()
+	l := make([]string, 0, len(c.m))
+	for e := c.order.Back(); e != nil; e = e.Prev() {
+		l = append(l, e.Value.(*seenEntry).id)
+	}
+	return l
+}
+
+// evict must be called with c locked.
+func (c *SeenCache) evict(now time.Time) {
+	for e := c.order.Back(); e != nil; e = c.order.Back() {
+		entry := e.Value.(*seenEntry)
+		if (c.cap <= 0 || len(c.m) <= c.cap) && (c.ttl <= 0 || now.Sub(entry.seen) < c.ttl) {
+			return
+		}
+		c.order.Remove(e)
+		delete(c.m, entry.id)
+	}
+}
@@ -0,0 +1,264 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+/**
+ * Service
+ *
+ * `sweetnothings service install [flags]` sets up a node to run in the
+ * background under the platform's service manager: a systemd user unit on
+ * Linux, a launchd agent on macOS, and a logon task on Windows. Any flags
+ * after install are passed to the node. Data and logs go to the XDG
+ * locations rather than ~/.sweetnothings.
+ */
+
+const serviceName = "sweetnothings"
+
+// xdgBase returns the XDG base directory in $env, falling back to ~/def.
+func xdgBase(env string, def string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(T("Unable to find home directory:"), err)
+	}
+	return filepath.Join(home, def)
+}
+
+func xdgDir(env string, def string) string {
+	return filepath.Join(xdgBase(env, def), serviceName)
+}
+
+type serviceConfig struct {
+	Exe     string
+	Args    []string
+	DataDir string
+	LogPath string
+}
+
+func newServiceConfig(args []string) serviceConfig {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := serviceConfig{
+		Exe:     exe,
+		DataDir: xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share")),
+		LogPath: filepath.Join(xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")), serviceName+".log"),
+	}
+	c.Args = append([]string{"-dir", c.DataDir}, args...)
+	return c
+}
+
+// systemdArgs quotes a command line for ExecStart, which expands $ and %
+// specifiers.
+func systemdArgs(args []string) string {
+	q := make([]string, len(args))
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%")
+	for i, a := range args {
+		if len(a) > 0 && !strings.ContainsAny(a, " \t\"'\\;$%") {
+			q[i] = a
+		} else {
+			q[i] = `"` + escape.Replace(a) + `"`
+		}
+	}
+	return strings.Join(q, " ")
+}
+
+// windowsArgs quotes a command line for cmd.exe. Backslashes are path
+// separators there, not escapes.
+func windowsArgs(args []string) string {
+	q := make([]string, len(args))
+	for i, a := range args {
+		if len(a) > 0 && !strings.ContainsAny(a, " \t&|<>^") {
+			q[i] = a
+		} else {
+			q[i] = `"` + strings.ReplaceAll(a, `"`, `""`) + `"`
+		}
+	}
+	return strings.Join(q, " ")
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+func systemdUnit(c serviceConfig) string {
+	return fmt.Sprintf(`[Unit]
+Description=Sweet Nothings node
+After=network-online.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+StandardInput=null
+StandardOutput=append:%s
+StandardError=inherit
+
+[Install]
+WantedBy=default.target
+`, systemdArgs(append([]string{c.Exe}, c.Args...)), c.LogPath)
+}
+
+func launchdPlist(c serviceConfig) string {
+	var b strings.Builder
+	for _, a := range append([]string{c.Exe}, c.Args...) {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(a))
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, serviceName, b.String(), xmlEscape(c.LogPath), xmlEscape(c.LogPath))
+}
+
+// servicePath is where the unit or plist lives. Windows keeps its tasks to
+// itself.
+func servicePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(T("Unable to find home directory:"), err)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "LaunchAgents", serviceName+".plist")
+	case "windows":
+		return ""
+	}
+	return filepath.Join(xdgBase("XDG_CONFIG_HOME", ".config"), "systemd", "user", serviceName+".service")
+}
+
+func runAll(cmds ...[]string) error {
+	for _, c := range cmds {
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %v", strings.Join(c, " "), err)
+		}
+	}
+	return nil
+}
+
+func installService(args []string) error {
+	c := newServiceConfig(args)
+	for _, dir := range []string{c.DataDir, filepath.Dir(c.LogPath)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	path := servicePath()
+	switch runtime.GOOS {
+	case "windows":
+		cmd := windowsArgs(append([]string{c.Exe}, c.Args...)) + " >> " + windowsArgs([]string{c.LogPath}) + " 2>&1 < NUL"
+		err := runAll([]string{"schtasks", "/Create", "/F", "/TN", serviceName, "/SC", "ONLOGON", "/TR", "cmd /c " + cmd})
+		if err == nil {
+			statusLn(tr("Installed task %s", serviceName))
+		}
+		return err
+	case "darwin":
+		if err := writeServiceFile(path, launchdPlist(c)); err != nil {
+			return err
+		}
+	default:
+		if err := writeServiceFile(path, systemdUnit(c)); err != nil {
+			return err
+		}
+		if err := runAll([]string{"systemctl", "--user", "daemon-reload"}, []string{"systemctl", "--user", "enable", serviceName}); err != nil {
+			return err
+		}
+	}
+	statusLn(tr("Installed %s", path))
+	statusLn(tr("Data in %s, log in %s", c.DataDir, c.LogPath))
+	return nil
+}
+
+func writeServiceFile(path string, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(contents), 0644)
+}
+
+func startService() error {
+	switch runtime.GOOS {
+	case "windows":
+		return runAll([]string{"schtasks", "/Run", "/TN", serviceName})
+	case "darwin":
+		return runAll([]string{"launchctl", "load", "-w", servicePath()})
+	}
+	return runAll([]string{"systemctl", "--user", "start", serviceName})
+}
+
+func stopService() error {
+	switch runtime.GOOS {
+	case "windows":
+		return runAll([]string{"schtasks", "/End", "/TN", serviceName})
+	case "darwin":
+		return runAll([]string{"launchctl", "unload", servicePath()})
+	}
+	return runAll([]string{"systemctl", "--user", "stop", serviceName})
+}
+
+func uninstallService() error {
+	switch runtime.GOOS {
+	case "windows":
+		return runAll([]string{"schtasks", "/Delete", "/F", "/TN", serviceName})
+	case "darwin":
+		runAll([]string{"launchctl", "unload", servicePath()})
+	default:
+		runAll([]string{"systemctl", "--user", "disable", "--now", serviceName})
+	}
+	if err := os.Remove(servicePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	statusLn(tr("Removed %s", servicePath()))
+	return nil
+}
+
+// runService handles `sweetnothings service ...`.
+func runService(args []string) {
+	setupLocale("")
+	if len(args) == 0 {
+		log.Fatal(T("Usage: sweetnothings service install [flags] | start | stop | uninstall"))
+	}
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(args[1:])
+	case "start":
+		err = startService()
+	case "stop":
+		err = stopService()
+	case "uninstall":
+		err = uninstallService()
+	default:
+		log.Fatal(T("Usage: sweetnothings service install [flags] | start | stop | uninstall"))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
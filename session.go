@@ -0,0 +1,134 @@
+package sweetnothings
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+/**
+ * Session resumption
+ *
+ * When we dial a peer we present the token it gave us last time. If it
+ * recognizes the token, the link resumes: our digest cursor carries on
+ * from where the old connection stopped and metadata sync stays
+ * incremental. Otherwise (it restarted, or we were gone too long) it
+ * issues a new token and we start the link over from scratch.
+ */
+
+// How long after a connection drops it can still be resumed.
+const resumeWindow = 2 * time.Minute
+
+const sessionTimeout = 5 * time.Second
+
+type sessionToken struct {
+	Token   string
+	Resumed bool `json:",omitempty"`
+}
+
+// Tokens we issued to peers that dial us.
+type issuedSession struct {
+	token  string
+	closed time.Time
+}
+
+// Tokens peers issued us, with the state of our last link to them.
+type heldSession struct {
+	token  string
+	cursor uint64
+	closed time.Time
+}
+
+var sessions = struct {
+	issued map[string]*issuedSession
+	held   map[string]*heldSession
+	sync.Mutex
+}{
+	issued: make(map[string]*issuedSession),
+	held:   make(map[string]*heldSession),
+}
+
+func init() {
+	controlHandlers["resume"] = handleResume
+	controlHandlers["session"] = handleSession
+}
+
+func newSessionToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// resumeSession is called when a dial to addr connects. It restores the
+// last link's state if that's still recent and asks addr to confirm.
+func resumeSession(addr string) {
+	sessions.Lock()
+	token := ""
+	if s, ok := sessions.held[addr]; ok && time.Since(s.closed) < resumeWindow {
+		token = s.token
+		resumeDigests(addr, s.cursor)
+	}
+	sessions.Unlock()
+	go sendSoon(addr, controlFrame("resume", sessionToken{Token: token}), sessionTimeout)
+}
+
+// suspendSession remembers the state of the link to addr as it closes.
+func suspendSession(addr string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+	if s, ok := sessions.held[addr]; ok {
+		s.cursor = digestCursor(addr)
+		s.closed = time.Now()
+	}
+}
+
+// closeIncoming notes that the connection from addr has dropped, starting
+// the clock on resuming it.
+func closeIncoming(addr string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+	if s, ok := sessions.issued[addr]; ok {
+		s.closed = time.Now()
+	}
+}
+
+func handleResume(from string, data json.RawMessage) {
+	var t sessionToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return
+	}
+	sessions.Lock()
+	s, ok := sessions.issued[from]
+	resumed := ok && len(t.Token) > 0 && t.Token == s.token &&
+		(s.closed.IsZero() || time.Since(s.closed) < resumeWindow)
+	if !resumed {
+		s = &issuedSession{token: newSessionToken()}
+		sessions.issued[from] = s
+	}
+	s.closed = time.Time{}
+	reply := sessionToken{Token: s.token, Resumed: resumed}
+	sessions.Unlock()
+	go sendSoon(from, controlFrame("session", reply), sessionTimeout)
+}
+
+func handleSession(from string, data json.RawMessage) {
+	var t sessionToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return
+	}
+	sessions.Lock()
+	sessions.held[from] = &heldSession{token: t.Token}
+	sessions.Unlock()
+	if t.Resumed {
+		stats.Event("resumed", from)
+		return
+	}
+	// A fresh session: the peer may have lost its metadata, so don't trust
+	// our watermark for it.
+	if meta.Synced(from) > 0 {
+		meta.Unsync(from)
+		go requestMeta(from)
+	}
+}
@@ -0,0 +1,189 @@
+package sweetnothings
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxEvents = 50
+
+// Label under which peers beyond the cardinality limit are aggregated.
+const otherLabel = "other"
+
+// Maximum number of distinct peers tracked individually in metrics.
+var maxPeerLabels = 64
+
+type Event struct {
+	Time time.Time
+	Kind string
+	Addr string
+}
+
+/**
+ * Stats
+ */
+type Stats struct {
+	Started      time.Time
+	Sent         uint64
+	Received     uint64
+	Duplicates   uint64
+	Relayed      uint64
+	Dropped      uint64
+	DialFailures uint64
+	// Limited counts messages dropped for being over -peer-rate, and
+	// Throttled relays held back by flood protection.
+	Limited   uint64
+	Throttled uint64
+
+	events []Event
+	peers  map[string]*PeerStats
+	rooms  map[string]*RoomStats
+	mu     sync.Mutex
+}
+
+type PeerStats struct {
+	MessagesIn  uint64
+	MessagesOut uint64
+	BytesIn     uint64
+	BytesOut    uint64
+	Dropped     uint64
+}
+
+// Peer returns the counters for addr. Once maxPeerLabels peers are being
+// tracked, any new peer shares the counters of the "other" bucket.
+func (s *Stats) Peer(addr string) *PeerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ps, ok := s.peers[addr]; ok {
+		return ps
+	}
+	if len(s.peers) >= maxPeerLabels {
+		addr = otherLabel
+		if ps, ok := s.peers[addr]; ok {
+			return ps
+		}
+	}
+	ps := new(PeerStats)
+	s.peers[addr] = ps
+	return ps
+}
+
+// RoomStats counts the messages said in one room.
+type RoomStats struct {
+	MessagesIn  uint64
+	MessagesOut uint64
+}
+
+// Room returns the counters for room, grouping rooms beyond maxPeerLabels
+// as "other" the same way Peer does.
+func (s *Stats) Room(room string) *RoomStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rs, ok := s.rooms[room]; ok {
+		return rs
+	}
+	if len(s.rooms) >= maxPeerLabels {
+		room = otherLabel
+		if rs, ok := s.rooms[room]; ok {
+			return rs
+		}
+	}
+	rs := new(RoomStats)
+	s.rooms[room] = rs
+	return rs
+}
+
+// Rooms returns a copy of the per-room counters.
+func (s *Stats) Rooms() map[string]RoomStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]RoomStats, len(s.rooms))
+	for room, rs := range s.rooms {
+		m[room] = RoomStats{
+			MessagesIn:  atomic.LoadUint64(&rs.MessagesIn),
+			MessagesOut: atomic.LoadUint64(&rs.MessagesOut),
+		}
+	}
+	return m
+}
+
+// Peers returns a copy of the per-peer counters.
+func (s *Stats) Peers() map[string]PeerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]PeerStats, len(s.peers))
+	for addr, ps := range s.peers {
+		m[addr] = PeerStats{
+			MessagesIn:  atomic.LoadUint64(&ps.MessagesIn),
+			MessagesOut: atomic.LoadUint64(&ps.MessagesOut),
+			BytesIn:     atomic.LoadUint64(&ps.BytesIn),
+			BytesOut:    atomic.LoadUint64(&ps.BytesOut),
+			Dropped:     atomic.LoadUint64(&ps.Dropped),
+		}
+	}
+	return m
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *uint64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	atomic.AddUint64(c.n, uint64(n))
+	return n, err
+}
+
+// Event records a connection lifecycle event, keeping only the most recent.
+func (s *Stats) Event(kind string, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, Event{time.Now(), kind, addr})
+	if len(s.events) > maxEvents {
+		s.events = s.events[len(s.events)-maxEvents:]
+	}
+}
+
+func (s *Stats) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := make([]Event, len(s.events))
+	copy(l, s.events)
+	return l
+}
+
+var stats = &Stats{Started: time.Now(), peers: make(map[string]*PeerStats), rooms: make(map[string]*RoomStats)}
+
+// showStats prints mesh health for /stats: totals since we started, then
+// each linked peer's traffic over the life of its link.
+func showStats() {
+	seen := seenIds.Len()
+	links := peers.Channels()
+	statusLn(tr("Up %v, %d peers", time.Since(stats.Started).Round(time.Second), len(links)))
+	noteLn(T("Messages"), "", tr("%d sent, %d received, %d relayed, %d duplicates suppressed, %d dropped",
+		atomic.LoadUint64(&stats.Sent), atomic.LoadUint64(&stats.Received), atomic.LoadUint64(&stats.Relayed),
+		atomic.LoadUint64(&stats.Duplicates), atomic.LoadUint64(&stats.Dropped)), "blue")
+	noteLn(T("Dedup"), "", tr("%d message IDs remembered, %d failed dials", seen, atomic.LoadUint64(&stats.DialFailures)), "blue")
+	if inboundRate > 0 || relayLimit > 0 {
+		noteLn(T("Limits"), "", tr("%d messages over -peer-rate dropped, %d relays throttled",
+			atomic.LoadUint64(&stats.Limited), atomic.LoadUint64(&stats.Throttled)), "blue")
+	}
+	var addrs []string
+	for addr := range links {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		ps := stats.Peer(addr)
+		in, out := atomic.LoadUint64(&ps.BytesIn), atomic.LoadUint64(&ps.BytesOut)
+		secs := max(time.Since(peers.Since(addr)).Seconds(), 1)
+		noteLn(T("Peer"), "", tr("%s: %d/%d messages in/out, %s in (%s/s), %s out (%s/s), %d queued, %d dropped", nickName(addr),
+			atomic.LoadUint64(&ps.MessagesIn), atomic.LoadUint64(&ps.MessagesOut),
+			formatSize(int64(in)), formatSize(int64(float64(in)/secs)), formatSize(int64(out)), formatSize(int64(float64(out)/secs)),
+			len(links[addr])+queued(addr), atomic.LoadUint64(&ps.Dropped)), "blue")
+	}
+}
@@ -1,29 +1,46 @@
-package main
+package sweetnothings
 
 import (
 	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var colors = map[string]string{
-	"header": "\033[95m",
-	"blue":   "\033[94m",
-	"green":  "\033[92m",
-	"yellow": "\033[93m",
-	"red":    "\033[91m",
-	"bold":   "\033[1m",
-	"end":    "\033[0m",
+	"header":    "\033[95m",
+	"blue":      "\033[94m",
+	"green":     "\033[92m",
+	"yellow":    "\033[93m",
+	"red":       "\033[91m",
+	"cyan":      "\033[96m",
+	"magenta":   "\033[35m",
+	"bold":      "\033[1m",
+	"italic":    "\033[3m",
+	"underline": "\033[4m",
+	"code":      "\033[36m",
+	"dim":       "\033[2m",
+	"end":       "\033[0m",
 }
 
+// In accessible mode output carries no color or decoration, and every line
+// reads the same way aloud: who or what it's from, then the text.
+var accessible bool
+
 func wrapColor(s string, color string) string {
+	if accessible {
+		return s
+	}
 	return fmt.Sprintf("%s%s%s", colors[color], s, colors["end"])
 }
 
@@ -31,9 +48,38 @@ func bold(s string) string {
 	return wrapColor(s, "bold")
 }
 
+// Where chat and status lines are printed; Config.Output changes it for
+// an embedded node.
+var stdout io.Writer = os.Stdout
+
 func statusLn(s string) {
+	logStatus(s)
+	if accessible {
+		fmt.Fprintln(stdout, tr("Status: %s", s))
+		return
+	}
 	msg := fmt.Sprintf("[%s]", s)
-	fmt.Println(wrapColor(msg, "blue"))
+	fmt.Fprintln(stdout, wrapColor(msg, "blue"))
+}
+
+// chatLn prints something said by addr.
+func chatLn(addr string, s string) {
+	if accessible {
+		fmt.Fprintf(stdout, "%s: %s\n", whoLabel(addr), s)
+		return
+	}
+	fmt.Fprintf(stdout, "%s %s\n", bold(nick(addr)), s)
+}
+
+// noteLn prints a line that belongs to the message above it, such as a
+// hint, tally or translation. Normally it's indented under the message with
+// tag in front; in accessible mode label says what it is instead.
+func noteLn(label string, tag string, s string, color string) {
+	if accessible {
+		fmt.Fprintf(stdout, "%s: %s\n", label, s)
+		return
+	}
+	fmt.Fprintln(stdout, wrapColor("    "+tag+s, color))
 }
 
 func logColor(s string, color string) {
@@ -48,46 +94,191 @@ type SweetNothing struct {
 	Addr      string
 	Body      string
 	Timestamp time.Time
+	Path      []string `json:",omitempty"`
+
+	// Hops is how many more links the message may cross, or 0 for no
+	// limit, so a message relayed at most n times starts with n+1. Like
+	// Path it isn't signed, since each receiver spends one.
+	Hops int `json:",omitempty"`
+
+	// Room is the #room the message was said in, or empty for the main
+	// room.
+	Room string `json:",omitempty"`
+
+	// To is who a direct message is for.
+	To string `json:",omitempty"`
+
+	// Edited and Deleted mark our copy of a message its author has since
+	// changed with /edit or /delete.
+	Edited  bool `json:",omitempty"`
+	Deleted bool `json:",omitempty"`
+
+	// Kind is empty for plain chat. Structured messages (polls, asks...)
+	// set it and may refer to an earlier message by Ref.
+	Kind    string   `json:",omitempty"`
+	Ref     string   `json:",omitempty"`
+	Options []string `json:",omitempty"`
+
+	// Clock is the author's Lamport clock when it wrote the message.
+	Clock uint64 `json:",omitempty"`
+
+	// TTL makes a message ephemeral: it's dropped from history this long
+	// after Timestamp.
+	TTL time.Duration `json:",omitempty"`
+
+	// Net is the -mesh network the message was said on, set by whoever
+	// receives it from the connection it arrived on.
+	Net string `json:",omitempty"`
+
+	// Sealed replaces Body when the message is end-to-end encrypted.
+	Sealed *Sealed `json:",omitempty"`
+
+	// Key is the author's signing key and Sig their signature.
+	Key []byte `json:",omitempty"`
+	Sig []byte `json:",omitempty"`
 }
 
 func (s SweetNothing) String() string {
 	return fmt.Sprintf("%s %s", bold(s.Addr), s.Body)
 }
 
+// Channel is the room a message was said in, as filters and -format see
+// it.
+func (s SweetNothing) Channel() string {
+	return s.Room
+}
+
 /**
  * Peers
  */
+
+// peerBuffer is how many interactive frames wait for each peer's writer
+// before the rest go to its outbox.
+var peerBuffer = 64
+
 type Peers struct {
-	channels map[string]chan<- SweetNothing
-	mu       sync.RWMutex
+	channels  map[string]chan<- Frame
+	bulk      map[string]chan<- Frame
+	since     map[string]time.Time
+	done      map[string]chan struct{}
+	transport map[string]string
+	inbound   map[string]bool
+	mu        sync.RWMutex
 }
 
-func (p *Peers) Add(addr string) <-chan SweetNothing {
+// Add registers a connection to addr, returning its interactive and bulk
+// lanes and a channel closed to disconnect it.
+func (p *Peers) Add(addr string) (<-chan Frame, <-chan Frame, <-chan struct{}) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if _, ok := p.channels[addr]; ok {
-		return nil
+		return nil, nil, nil
 	}
-	c := make(chan SweetNothing)
+	c := make(chan Frame, peerBuffer)
+	bulk := make(chan Frame)
+	done := make(chan struct{})
 	p.channels[addr] = c
-	return c
+	p.bulk[addr] = bulk
+	p.since[addr] = time.Now()
+	p.done[addr] = done
+	return c, bulk, done
+}
+
+// Disconnect tells the connection to addr to close. It reports whether
+// there was one.
+func (p *Peers) Disconnect(addr string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	done, ok := p.done[addr]
+	if ok {
+		close(done)
+		delete(p.done, addr)
+	}
+	return ok
+}
+
+// Since returns when the connection to addr was added.
+func (p *Peers) Since(addr string) time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.since[addr]
+}
+
+// SetTransport records what the link to addr runs over.
+func (p *Peers) SetTransport(addr string, transport string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.channels[addr]; ok {
+		p.transport[addr] = transport
+	}
+}
+
+// SetInbound records that the link to addr is one it made to us.
+func (p *Peers) SetInbound(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.channels[addr]; ok {
+		p.inbound[addr] = true
+	}
+}
+
+func (p *Peers) Inbound(addr string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.inbound[addr]
+}
+
+func (p *Peers) Transport(addr string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.transport[addr]
+}
+
+func (p *Peers) Get(addr string) chan<- Frame {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.channels[addr]
+}
+
+// Bulk returns the lane for addr's large, low-priority frames.
+func (p *Peers) Bulk(addr string) chan<- Frame {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.bulk[addr]
 }
 
 func (p *Peers) Remove(addr string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	delete(p.channels, addr)
+	delete(p.bulk, addr)
+	delete(p.since, addr)
+	delete(p.done, addr)
+	delete(p.transport, addr)
+	delete(p.inbound, addr)
 }
 
-func (p *Peers) List() []chan<- SweetNothing {
+// Depths reports how many messages are waiting in each peer's channel.
+func (p *Peers) Depths() map[string]int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	l := make([]chan<- SweetNothing, 0, len(p.channels))
-	for _, ch := range p.channels {
-		l = append(l, ch)
+	m := make(map[string]int, len(p.channels))
+	for addr, ch := range p.channels {
+		m[addr] = len(ch)
 	}
-	return l
+	return m
+}
+
+func (p *Peers) Channels() map[string]chan<- Frame {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	m := make(map[string]chan<- Frame, len(p.channels))
+	for addr, ch := range p.channels {
+		m[addr] = ch
+	}
+	return m
 }
 
 /**
@@ -102,11 +293,11 @@ func (i *LocalInfo) IP() string {
 	if len(i.ip) == 0 {
 		hostname, err := os.Hostname()
 		if err != nil {
-			log.Fatal("Unable to get hostname:", err)
+			log.Fatal(T("Unable to get hostname:"), err)
 		}
 		localIps, err := net.LookupHost(hostname)
 		if err != nil {
-			log.Fatal("Unable to determine local ip:", err)
+			log.Fatal(T("Unable to determine local ip:"), err)
 		}
 		i.ip = localIps[0]
 	}
@@ -114,23 +305,23 @@ func (i *LocalInfo) IP() string {
 }
 
 func (i LocalInfo) Addr() string {
-	return fmt.Sprintf("%s:%s", i.IP(), i.ListenPort)
+	return net.JoinHostPort(i.IP(), i.ListenPort)
 }
 
 var localInfo = new(LocalInfo)
-var peers = &Peers{channels: make(map[string]chan<- SweetNothing)}
+var peers = &Peers{
+	channels:  make(map[string]chan<- Frame),
+	bulk:      make(map[string]chan<- Frame),
+	since:     make(map[string]time.Time),
+	done:      make(map[string]chan struct{}),
+	transport: make(map[string]string),
+	inbound:   make(map[string]bool),
+}
 
-var seenIds = struct {
-	m map[string]bool
-	sync.Mutex
-}{m: make(map[string]bool)}
+var seenIds = NewSeenCache(defaultSeenCap, defaultSeenTTL)
 
 func SeenId(id string) bool {
-	seenIds.Lock()
-	ok := seenIds.m[id]
-	seenIds.m[id] = true
-	seenIds.Unlock()
-	return ok
+	return seenIds.Add(id)
 }
 
 var nicknames = struct {
@@ -138,162 +329,1100 @@ var nicknames = struct {
 	sync.Mutex
 }{m: make(map[string]string)}
 
-func nick(addr string) (n string) {
-	if addr == localInfo.Addr() {
-		n = "you"
+func nickName(addr string) (n string) {
+	if isLocal(addr) {
+		n = T("you")
 	} else if n_, ok := nicknames.m[addr]; ok {
 		n = n_
+	} else if n_, ok := offeredName(addr); ok {
+		n = n_
+	} else if g, ok := guestName(addr); ok {
+		n = g
 	} else {
 		n = addr
 	}
-	return fmt.Sprintf("[%s]", n)
+	return n
+}
+
+func nick(addr string) string {
+	if accessible {
+		return whoLabel(addr)
+	}
+	return fmt.Sprintf("[%s]", whoLabel(addr))
 }
 
 func setNick(addr string, nick string) {
 	nicknames.m[addr] = nick
-	statusLn(fmt.Sprintf("%s nicknamed %s", addr, nick))
+	statusLn(tr("%s nicknamed %s", addr, nick))
 }
 
-func uniqueId() string {
-	now := time.Now()
-	return fmt.Sprintf(
-		"%d%d%d%d%d%d%d",
-		now.Year(),
-		now.Month(),
-		now.Day(),
-		now.Hour(),
-		now.Minute(),
-		now.Second(),
-		now.Nanosecond())
+func serveIncoming(c net.Conn, network string) {
+	if !accessAllowed(c.RemoteAddr().String(), false) {
+		logger.Info(T("Refusing a connection the access lists don't allow"), "event", "accept", "peer", c.RemoteAddr().String())
+		c.Close()
+		return
+	}
+	from := readLink(c, network)
+	c.Close()
+	closeIncoming(from)
+	stats.Event("incoming closed", c.RemoteAddr().String())
+	statusLn(tr("Closed connection to %s", c.RemoteAddr()))
 }
 
-func serveIncoming(c net.Conn) {
-	var whisper SweetNothing
+// readLink handles the frames that come in on c until it fails, and
+// returns who they were from.
+func readLink(c net.Conn, network string) (from string) {
+	frames := newFrameReader(c, c.RemoteAddr().String())
+	// Frames from a batch still to be handled.
+	var pending []Frame
 	for {
-		dec := json.NewDecoder(c)
-		err := dec.Decode(&whisper)
-		if err != nil {
+		var f Frame
+		if len(pending) > 0 {
+			f, pending = pending[0], pending[1:]
+		} else if err := frames.Read(&f); err != nil {
 			break
 		}
+		if len(from) == 0 {
+			if !checkHello(c, f) || blocked(f.From) {
+				return
+			}
+			setLinkKey(f.From, remoteKey(c))
+			observeLink(f.From, c)
+			if ws, ok := c.(*wsConn); ok && !ws.client && len(f.From) > 0 && !isLocal(f.From) && linkBack(f.From, c) {
+				defer peers.Disconnect(f.From)
+			}
+		}
+		from = f.From
+		seenPeer(f.From)
+		setNet(f.From, network)
+		if f.Type == helloFrame {
+			continue
+		}
+		if f.Type == batchFrame {
+			pending = unbatch(f)
+			continue
+		}
+		if f.Type == compressFrame {
+			if err := frames.decompress(f); err != nil {
+				logger.Warn(T("Can't read compressed link; dropping the connection"), "event", "link", "peer", f.From, "err", err)
+				return
+			}
+			continue
+		}
+		if f.Type == encodingFrame {
+			if err := frames.decode(f); err != nil {
+				logger.Warn(T("Can't read the link's encoding; dropping the connection"), "event", "link", "peer", f.From, "err", err)
+				return
+			}
+			continue
+		}
+		if f.Type == duplexFrame {
+			if addDuplex(f.From, c) {
+				defer removeDuplex(f.From, c)
+				if relayMode {
+					go linkOver(f.From, c, false)
+				}
+			}
+			continue
+		}
+		if f.Type != msgFrame {
+			handleControl(f)
+			continue
+		}
+		if f.Seq > 0 {
+			ackLater(f.From, f.Seq)
+		}
+		if f.Msg == nil || rendezvousMode {
+			continue
+		}
+		whisper := *f.Msg
+		whisper.Net = network
 
+		if err := verifyMessage(whisper); err == errKeyChanged {
+			continue
+		} else if err != nil {
+			logger.Warn(T("Rejected message"), "event", "reject", "peer", whisper.Addr, "id", whisper.ID, "err", err)
+			continue
+		}
 		if SeenId(whisper.ID) {
+			atomic.AddUint64(&stats.Duplicates, 1)
 			continue
 		}
-		fmt.Printf("%s %s\n", bold(nick(whisper.Addr)), whisper.Body)
-		broadcast(whisper)
-		go dial(whisper.Addr)
+		if blocked(whisper.Addr) || !allowInbound(f.From, whisper.Addr) {
+			continue
+		}
+		tooBig := oversized(whisper)
+		if tooBig {
+			logger.Warn(T("Message over -max-body"), "event", "reject", "peer", whisper.Addr, "id", whisper.ID, "bytes", bodySize(whisper))
+			if bodyAction == bodyReject {
+				continue
+			}
+		}
+		atomic.AddUint64(&stats.Received, 1)
+		atomic.AddUint64(&stats.Room(whisper.Room).MessagesIn, 1)
+		seenPeer(whisper.Addr)
+		ps := stats.Peer(whisper.Addr)
+		atomic.AddUint64(&ps.MessagesIn, 1)
+		if b, err := json.Marshal(whisper); err == nil {
+			atomic.AddUint64(&ps.BytesIn, uint64(len(b)))
+		}
+		if tracePaths {
+			whisper.Path = append(whisper.Path, localAddr(network))
+		}
+		observePath(whisper.Path)
+		// Relays pass sealed messages on as they came, and keep them that
+		// way if they can't read them.
+		shown, readable := unseal(whisper)
+		shown = amended(truncateBody(shown))
+		if readable {
+			sendReceipt(shown, false)
+		}
+		observeClock(whisper.Clock)
+		reorder(shown)
+		if readable {
+			recordHistory(shown)
+		} else if !tooBig {
+			recordHistory(whisper)
+		}
+		if !tooBig {
+			rememberMessage(whisper)
+			relay(whisper, f.From)
+		}
+		if !isLocal(whisper.Addr) {
+			setNet(whisper.Addr, network)
+			go autoDial(whisper.Addr)
+		}
 	}
-	c.Close()
-	statusLn(fmt.Sprintf("Closed connection to %s", c.RemoteAddr()))
+	return from
+}
+
+func displayMessage(whisper SweetNothing) {
+	if !inRoom(whisper.Room) || whisper.Deleted || ignoring(whisper.Addr) {
+		return
+	}
+	if whisper.Kind != voteKind && whisper.Kind != ackKind && whisper.Kind != reactKind && whisper.Kind != deleteKind {
+		switch filterMessage(whisper) {
+		case filterDrop:
+			return
+		case filterNotify:
+			fmt.Fprint(stdout, "\a")
+		}
+	}
+	switch whisper.Kind {
+	case pollKind:
+		showPoll(whisper)
+		sendReceipt(whisper, true)
+	case voteKind:
+		countVote(whisper, true)
+	case askKind:
+		showAsk(whisper)
+		sendReceipt(whisper, true)
+	case ackKind:
+		countAck(whisper)
+	case reactKind:
+		countReaction(whisper, true)
+	case editKind, deleteKind:
+		amend(whisper, true)
+	default:
+		if mentionBell && mentionsUs(whisper) {
+			fmt.Fprint(stdout, "\a")
+		}
+		doneTyping(whisper.Addr)
+		showMessage(whisper)
+		deliver(whisper)
+		sendReceipt(whisper, true)
+		speakMessage(whisper)
+		if !isLocal(whisper.Addr) {
+			if imageLinks {
+				go previewImageURLs(whisper.Body)
+			}
+			if linkPreviews {
+				go previewLinks(whisper.Body)
+			}
+		}
+		if translator != nil {
+			go translateIncoming(whisper)
+		}
+	}
+}
+
+// publish stamps a message we wrote and sends it to every peer on the
+// current network.
+func publish(whisper SweetNothing) SweetNothing {
+	if len(whisper.Room) == 0 {
+		whisper.Room = activeRoom()
+	}
+	return publishIn(currentNetwork(), whisper)
+}
+
+// publishIn is publish for a particular network, e.g. to answer a message
+// from it.
+func publishIn(network string, whisper SweetNothing) SweetNothing {
+	whisper.ID = uniqueId()
+	whisper.Addr = localAddr(network)
+	whisper.Net = network
+	whisper.Timestamp = time.Now().UTC()
+	whisper.Clock = tickClock()
+	whisper.Hops = hopBudget()
+	if tracePaths {
+		whisper.Path = []string{whisper.Addr}
+	}
+	SeenId(whisper.ID)
+	trackReceipts(whisper)
+	sent := signMessage(seal(whisper))
+	rememberMessage(sent)
+	recordHistory(whisper)
+	atomic.AddUint64(&stats.Sent, 1)
+	atomic.AddUint64(&stats.Room(whisper.Room).MessagesOut, 1)
+	broadcast(sent)
+	return whisper
 }
 
 func broadcast(whisper SweetNothing) {
-	for _, ch := range peers.List() {
+	send(whisper, netPeers(whisper.Net))
+	for _, addr := range lostPeers(whisper.Net) {
+		enqueue(addr, Frame{Type: msgFrame, Msg: &whisper})
+	}
+}
+
+func send(whisper SweetNothing, targets map[string]chan<- Frame) {
+	f := Frame{Type: msgFrame, Msg: &whisper}
+	for addr, ch := range targets {
 		select {
-		case ch <- whisper:
+		case ch <- f:
+			atomic.AddUint64(&stats.Relayed, 1)
 		default:
-			// Message dropped
+			enqueue(addr, f)
 		}
 	}
 }
 
+// dial links to addr, and tries to get it back if the link drops.
 func dial(addr string) {
-	if addr == localInfo.Addr() {
-		return
+	if dialLink(addr) && wantReconnect(addr) {
+		statusLn(tr("Lost %s; reconnecting", nickName(addr)))
+		reconnect(addr)
 	}
+}
 
-	ch := peers.Add(addr)
+// dialLink links to addr until the link drops, and reports whether it
+// ever came up.
+func dialLink(addr string) bool {
+	if isLocal(addr) || blocked(addr) {
+		return false
+	}
+	if !accessAllowed(addr, true) {
+		logger.Info(T("Not dialing a peer the access lists don't allow"), "event", "dial", "peer", addr)
+		return false
+	}
+
+	ch, bulk, done := peers.Add(addr)
 	if ch == nil {
-		return
+		return false
 	}
 	defer peers.Remove(addr)
 
-	statusLn(fmt.Sprintf("Dialing %s", addr))
+	// Relay clients are usually behind NAT, so don't keep them waiting on
+	// a dial that won't work.
+	if c := duplexConn(addr); c != nil && relayMode {
+		peers.SetInbound(addr)
+		writeLink(addr, c, ch, bulk, done)
+		return true
+	}
+
+	statusLn(tr("Dialing %s", addr))
+	noteDial(addr)
 
-	c, err := net.Dial("tcp", addr)
+	c, err := dialPeer(addr)
 	if err != nil {
-		log.Printf("[Error dialing %s]\n", addr)
-		return
+		logger.Warn(T("Error dialing"), "event", "dial", "peer", addr, "err", err)
+		stats.Event("dial failed", addr)
+		atomic.AddUint64(&stats.DialFailures, 1)
+		if c := duplexConn(addr); c != nil {
+			statusLn(tr("Reaching %s over the link it made to us", addr))
+			peers.SetInbound(addr)
+			writeLink(addr, c, ch, bulk, done)
+			return true
+		} else if punchEnabled {
+			go requestPunch(addr)
+		}
+		return false
 	}
+	readReplies(addr, c)
+	writeLink(addr, c, ch, bulk, done)
+	return true
+}
 
-	statusLn(fmt.Sprintf("Connected to %s", addr))
+// readReplies listens for frames coming back on a link we made, and tells
+// the other end we will.
+func readReplies(addr string, c net.Conn) {
+	go func() {
+		readLink(c, netOf(addr))
+		peers.Disconnect(addr)
+	}()
+	go sendSoon(addr, Frame{Type: duplexFrame}, sessionTimeout)
+}
+
+// writeLink writes addr's frames to c until the link fails or is
+// disconnected.
+func writeLink(addr string, c net.Conn, ch <-chan Frame, bulk <-chan Frame, done <-chan struct{}) {
+	defer forgetRTT(addr)
+	startDigests(addr)
+	defer stopDigests(addr)
+	defer suspendSession(addr)
+
+	statusLn(tr("Connected to %s", addr))
+	peers.SetTransport(addr, linkTransport(c))
+	setLinkKey(addr, remoteKey(c))
+	stats.Event("connected", addr)
+	allowReconnect(addr)
+	rememberPeer(addr)
+	if !rendezvousMode {
+		resumeSession(addr)
+		go requestMeta(addr)
+		go exchangePeers(addr)
+		go announceRelay(addr)
+		go announcePresence(addr)
+		go backfillOnJoin(addr)
+	}
 
 	defer func() {
 		c.Close()
-		statusLn(fmt.Sprintf("Closed connection to %s", c.RemoteAddr()))
+		peerGone(addr)
+		stats.Event("disconnected", addr)
+		statusLn(tr("Closed connection to %s", c.RemoteAddr()))
 	}()
 
-	enc := json.NewEncoder(c)
-	for s := range ch {
-		err := enc.Encode(s)
+	ps := stats.Peer(addr)
+	w := countingWriter{c, &ps.BytesOut}
+	encode := jsonFrames(w)
+	negotiated := false
+	hi := helloFrameFor(addr)
+	hi.From = localAddr(netOf(addr))
+	if err := encode(hi); err != nil {
+		logger.Error(T("Error encoding message"), "event", "link", "peer", addr, "err", err)
+		return
+	}
+	defer drainLink(addr, ch)
+	defer requeueUnacked(addr)
+	if n := queued(addr); n > 0 {
+		statusLn(tr("Sending %s %d messages that waited for it", nickName(addr), n))
+	}
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	digests := time.NewTicker(digestInterval)
+	defer digests.Stop()
+	streak := 0
+	for {
+		var f Frame
+		// Interactive frames go first, but a waiting bulk frame gets a
+		// turn every so often.
+		ready := false
+		if streak < bulkEvery {
+			select {
+			case f = <-ch:
+				ready = true
+				streak++
+			default:
+				f, ready = nextQueued(addr)
+			}
+		}
+		interactive := ready
+		if !ready {
+			select {
+			case f = <-ch:
+				interactive = true
+				streak++
+			case f = <-bulk:
+				streak = 0
+			case <-ticker.C:
+				if linkDead(addr) {
+					statusLn(tr("%s stopped answering; dropping the link", nickName(addr)))
+					return
+				}
+				f = pingFrame(addr)
+			case <-digests.C:
+				var ok bool
+				if f, ok = digestFrame(addr); !ok {
+					continue
+				}
+			case <-done:
+				return
+			}
+		}
+		frames := []Frame{f}
+		if interactive && hasFeature(addr, "batch") {
+			frames = append(frames, moreFrames(addr, ch, f)...)
+			streak += len(frames) - 1
+		}
+		msgs := 0
+		for i := range frames {
+			frames[i].From = localAddr(netOf(addr))
+			if frames[i].Type == msgFrame {
+				msgs++
+				if hasFeature(addr, "acks") {
+					frames[i] = trackUnacked(addr, frames[i])
+				}
+			}
+		}
+		f = frames[0]
+		if len(frames) > 1 {
+			f = Frame{Type: batchFrame, From: frames[0].From, Batch: frames}
+			for i := range frames {
+				frames[i].From = ""
+			}
+		}
+		if _, ok := peerHello(addr); ok && !negotiated {
+			negotiated = true
+			var err error
+			if encode, err = negotiateEncoding(addr, w); err != nil {
+				logger.Error(T("Error encoding message"), "event", "link", "peer", addr, "err", err)
+				return
+			}
+		}
+		err := encode(f)
 		if err != nil {
-			log.Printf("[Error encoding message] %v\n", err)
+			logger.Error(T("Error encoding message"), "event", "link", "peer", addr, "err", err)
 			return
 		}
+		atomic.AddUint64(&ps.MessagesOut, uint64(msgs))
 	}
 }
 
 func handleCommand(c string) {
+	raw := strings.Split(strings.TrimSpace(c), " ")
 	parts := strings.Split(strings.ToLower(strings.TrimSpace(c)), " ")
 	switch parts[0] {
 	case "/dial":
-		go dial(parts[1])
+		if len(parts) < 2 {
+			statusLn(T("Usage: /dial <addr>"))
+			return
+		}
+		addr := dialAddr(parts[1])
+		setNet(addr, currentNetwork())
+		pinPeer(addr)
+		go dial(addr)
 	case "/setnick":
 		if len(parts) == 3 {
 			setNick(parts[1], parts[2])
 		}
+	case "/topic":
+		topic := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c), raw[0]))
+		if len(topic) > 0 {
+			setMeta("topic", topic)
+		} else {
+			showTopic()
+		}
+	case "/pin":
+		if len(raw) == 2 {
+			pinMessage(raw[1])
+		}
+	case "/unpin":
+		if len(raw) == 2 {
+			unpinMessage(raw[1])
+		}
+	case "/pins":
+		showPins()
+	case "/net":
+		switchNetwork(strings.Join(raw[1:], " "))
+	case "/filters":
+		handleFilters(strings.Join(parts[1:], " "))
+	case "/poll":
+		createPoll(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c), raw[0])))
+	case "/vote":
+		if len(raw) == 3 {
+			vote(raw[1], raw[2])
+		}
+	case "/ask":
+		ask(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c), raw[0])))
+	case "/ack":
+		if len(raw) == 2 {
+			ackAsk(raw[1])
+		} else {
+			ackAsk("")
+		}
+	case "/asks":
+		showAsks()
+	case "/remind":
+		addReminder(raw[1:])
+	case "/ephemeral":
+		sayEphemeral(raw[1:])
+	case "/reminders":
+		if len(raw) == 3 && parts[1] == "cancel" {
+			cancelReminder(raw[2])
+		} else {
+			showReminders()
+		}
+	case "/mute":
+		setMuted(true)
+	case "/unmute":
+		setMuted(false)
+	case "/note":
+		handleNote(raw[1:])
+	case "/verify":
+		if len(raw) == 3 {
+			verifyPeer(raw[1], raw[2])
+		} else {
+			showKnownKeys()
+		}
+	case "/msg":
+		sendDM(raw[1:])
+	case "/react":
+		if len(raw) == 3 {
+			react(raw[1], raw[2])
+		} else {
+			statusLn(T("Usage: /react <id> :emoji:"))
+		}
+	case "/receipts":
+		if len(raw) == 2 {
+			showReceipts(raw[1])
+		} else {
+			showReceipts("")
+		}
+	case "/edit":
+		editMessage(raw[1:])
+	case "/delete":
+		if len(raw) == 2 {
+			deleteMessage(raw[1])
+		}
+	case "/emoji":
+		findEmoji(strings.Join(raw[1:], " "))
+	case "/sendfile":
+		sendFile(raw[1:])
+	case "/accept":
+		acceptFile(raw[1:])
+	case "/decline":
+		if len(raw) == 2 {
+			declineFile(raw[1])
+		} else {
+			declineFile("")
+		}
+	case "/files":
+		if len(raw) == 3 && parts[1] == "cancel" {
+			cancelTransfer(raw[2])
+		} else {
+			showTransfers()
+		}
+	case "/join":
+		if len(raw) == 2 {
+			joinRoom(raw[1])
+		}
+	case "/leave":
+		if len(raw) == 2 {
+			leaveRoom(raw[1])
+		}
+	case "/rooms":
+		showRooms()
+	case "/relay":
+		showRelay()
+	case "/search":
+		searchHistory(strings.Join(raw[1:], " "))
+	case "/history":
+		showHistory(strings.Join(raw[1:], " "))
+	case "/backfill":
+		n := backfillLimit
+		if len(raw) == 2 {
+			n, _ = strconv.Atoi(raw[1])
+		}
+		if n <= 0 {
+			statusLn(T("Usage: /backfill [n]"))
+		} else {
+			backfillCommand(n)
+		}
+	case "/nick":
+		changeNick(strings.Join(raw[1:], " "))
+	case "/quit":
+		quit(strings.Join(raw[1:], " "))
+	case "/peers", "/who":
+		showPeers()
+	case "/stats":
+		showStats()
+	case "/away":
+		setPresence(presenceAway, strings.Join(raw[1:], " "))
+	case "/back":
+		setPresence(presenceOnline, "")
+	case "/forget":
+		if len(raw) == 2 {
+			forgetPeer(raw[1])
+		} else {
+			statusLn(T("Usage: /forget <peer>"))
+		}
+	case "/ignore", "/unignore":
+		ignoreCommand(strings.Join(raw[1:], " "), parts[0] == "/ignore")
+	case "/block", "/unblock":
+		blockCommand(strings.Join(raw[1:], " "), parts[0] == "/block")
+	case "/seen":
+		if len(raw) == 2 {
+			showSeen(raw[1])
+		}
+	case "/reindex":
+		reindexHistory()
+	case "/trace":
+		if len(raw) == 2 {
+			showTrace(raw[1])
+		} else {
+			showTrace("")
+		}
+	case "/topology":
+		if len(raw) == 2 {
+			exportTopology(raw[1])
+		} else {
+			exportTopology("")
+		}
+	case "/export":
+		exportCommand(raw[1:])
+	case "/import":
+		if len(raw) == 2 {
+			importHistory(raw[1])
+		}
 	}
 }
 
 func startInputScanner() {
-	s := bufio.NewScanner(os.Stdin)
+	// Lines are read whole, however long, so that -max-body decides what
+	// happens to a huge paste.
+	r := bufio.NewReader(os.Stdin)
 	for {
-		s.Scan()
-		text := s.Text()
-		if len(text) == 0 {
-			continue
+		line, err := r.ReadString('\n')
+		if len(line) > 0 {
+			handleInput(strings.TrimRight(line, "\r\n"))
 		}
-		if strings.HasPrefix(text, "/") {
-			handleCommand(text)
-		} else {
-			whisper := SweetNothing{uniqueId(), localInfo.Addr(), s.Text(), time.Now().UTC()}
-			broadcast(whisper)
+		// Without a terminal (e.g. as a service) stdin ends right away
+		// and we just keep relaying.
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
-	if err := s.Err(); err != nil {
-		log.Fatal(err)
+}
+
+// handleInput acts on a line typed at the terminal or an attached one.
+func handleInput(text string) {
+	if len(text) == 0 {
+		return
+	}
+	typed()
+	if strings.HasPrefix(text, "/") {
+		handleCommand(text)
+	} else {
+		publishText(SweetNothing{Room: activeRoom(), Body: text})
 	}
 }
 
-func main() {
+// Main runs the sweetnothings command with os.Args.
+func Main() {
 	var port string
+	var historyPath string
+	var exportPath, exportRoom string
+	var exportPrivate bool
+	var retainDays, retainMB int
+	var retention RetentionPolicy
+	var dashboardAddr string
+	var metricsAddr string
+	var seenCap int
+	var seenTTL time.Duration
+	var gossip string
+	var translateCmd, translateURL, translateTarget, translateSource string
+	var ttsCmd string
+	var lang string
+	var filterPath string
+	var useTLS bool
+	var certPath, keyPath, caPath string
+	var proxy, advertise string
+	var mentions string
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "daemon" {
+		if !inheritDaemon() {
+			runDaemon(args[1:])
+			return
+		}
+		daemonMode = true
+		args = args[1:]
+	}
+	if len(os.Args) > 1 && os.Args[1] == "attach" {
+		runAttach(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		runService(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
 
 	flag.StringVar(&port, "p", "", "Listen port")
-	flag.Parse()
+	flag.StringVar(&dataRoot, "dir", "", "Keep history, settings and profiles in this directory (default: ~/.sweetnothings)")
+	flag.BoolVar(&ephemeral, "ephemeral", false, "Join as a throwaway guest, keeping everything in memory and writing nothing to disk")
+	flag.StringVar(&profile, "profile", "", "Use a separate named profile with its own history, settings and peers")
+	flag.StringVar(&historyPath, "history-db", "", "Message history store (default: history.db in the profile; empty to disable)")
+	flag.StringVar(&historyPath, "history", "", "Same as -history-db")
+	flag.StringVar(&exportPath, "export-html", "", "Write history to an HTML page and exit")
+	flag.StringVar(&exportRoom, "export-room", "", "Only export this room with -export-html, \"#\" for the main one")
+	flag.BoolVar(&exportPrivate, "export-private", false, "Include direct and ephemeral messages with -export-html")
+	flag.IntVar(&retainDays, "retain-days", 0, "Prune history older than this many days (0 keeps everything)")
+	flag.IntVar(&retainMB, "retain-mb", 0, "Prune the oldest history beyond this many megabytes (0 for no limit)")
+	flag.Var(roomRetentionFlag{&retention}, "retain-room", "Keep a room's history to its own limits, e.g. \"#ops=7d,50mb\" (\"#\" is the main room; repeatable)")
+	flag.StringVar(&retention.ArchivePath, "retain-archive", "", "Append pruned history to this file instead of discarding it")
+	flag.StringVar(&dashboardAddr, "dashboard-addr", "", "Serve a web stats dashboard on this address (e.g. localhost:8080)")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics at /metrics on this address (e.g. localhost:9100)")
+	flag.IntVar(&maxPeerLabels, "metrics-max-peers", maxPeerLabels, "Peers, and rooms, tracked individually in metrics before the rest are grouped as \"other\"")
+	flag.BoolVar(&tracePaths, "trace", false, "Record the relay path of each message for /trace")
+	flag.Float64Var(&inboundRate, "peer-rate", 0, "Drop messages from anyone sending more than this many a second (0 for no limit)")
+	flag.StringVar(&rateAction, "rate-action", rateAction, "What to do with someone over -peer-rate: \"drop\" what's over, or \"mute\" them for a minute")
+	flag.Float64Var(&relayLimit, "relay-limit", 0, "Relay at most this many new messages a second for others (0 for no limit)")
+	flag.IntVar(&relayFanout, "fanout", 0, "Relay each message to at most this many peers (0 relays to all)")
+	flag.IntVar(&maxHops, "max-hops", 0, "Let messages be relayed at most this many times, ours and any passing through (0 for no limit)")
+	flag.IntVar(&maxDistant, "max-distant", -1, "Direct connections to keep to distant peers, reaching the rest through relays (-1 for no limit)")
+	flag.StringVar(&gossip, "gossip", floodGossip, "Relay strategy: \"flood\" pushes every message, \"digest\" pushes to a few peers and lets the rest pull")
+	flag.StringVar(&translateCmd, "translate-cmd", "", "Shell command that translates stdin to stdout, e.g. \"trans -b :en\"")
+	flag.StringVar(&translateURL, "translate-url", "", "LibreTranslate-compatible endpoint for translating incoming messages")
+	flag.StringVar(&translateTarget, "translate-to", "en", "Language to translate incoming messages into")
+	flag.StringVar(&translateSource, "translate-from", "", "Comma-separated languages to translate from (default: any)")
+	flag.StringVar(&ttsCmd, "tts-cmd", "", "Speak incoming messages by piping them to this command, e.g. \"espeak --stdin\"")
+	flag.BoolVar(&accessible, "accessible", false, "Screen-reader-friendly output: no color or decoration")
+	flag.BoolVar(&markdownEnabled, "markdown", true, "Show **bold**, *italics*, `code` and [links](url) in messages with terminal styling")
+	flag.IntVar(&keepaliveMisses, "keepalive-misses", keepaliveMisses, "Drop a link once this many pings in a row go unanswered (0 to keep links however quiet)")
+	flag.IntVar(&maxFrame, "max-frame", maxFrame, "Skip frames from peers longer than this many bytes")
+	flag.IntVar(&maxBody, "max-body", maxBody, "Longest message body in bytes we send, show or relay (0 for no limit)")
+	flag.StringVar(&bodyAction, "body-action", bodyAction, "What to do with a message over -max-body: \"truncate\" it or \"reject\" it")
+	flag.StringVar(&linkEncoding, "encoding", linkEncoding, "Encoding to write to peers that can read it: "+strings.Join(codecNames(), ", "))
+	flag.BoolVar(&compressLinks, "compress", false, "Gzip what we write to peers that can read it, for slow links")
+	flag.BoolVar(&persistOutbox, "persist-outbox", false, "Keep messages waiting for disconnected peers on disk, so they're still sent after a restart")
+	flag.BoolVar(&redialPeers, "redial", redialPeers, "Redial the peers we were linked to last time on startup")
+	flag.IntVar(&seenCap, "seen-cap", defaultSeenCap, "Message IDs remembered for dropping duplicates")
+	flag.DurationVar(&seenTTL, "seen-ttl", defaultSeenTTL, "How long a message ID is remembered after it was last seen")
+	flag.DurationVar(&reorderWindow, "reorder-window", reorderWindow, "Hold incoming messages this long to show them in causal order (0 shows them as they arrive)")
+	flag.IntVar(&peerBuffer, "peer-buffer", peerBuffer, "Frames buffered for each peer's connection before more wait in its outbox")
+	flag.StringVar(&dropPolicy, "drop-policy", dropPolicy, "Which messages to drop when a peer's outbox is full: \"oldest\" or \"newest\"")
+	flag.IntVar(&reconnectTries, "reconnect-tries", reconnectTries, "Failed redials in a row before giving up on a peer whose link dropped (0 to not redial)")
+	flag.IntVar(&backfillLimit, "backfill", backfillLimit, "Ask the first peer we link to for up to this many messages we missed (0 to not ask)")
+	flag.StringVar(&offeredNick, "nick", "", "Name to ask peers to show us as")
+	flag.DurationVar(&awayAfter, "away-after", 0, "Go away by ourselves after this long without typing, e.g. 15m")
+	flag.BoolVar(&readReceipts, "read-receipts", false, "Tell authors when their messages have been shown to us, not just delivered")
+	flag.BoolVar(&sendTyping, "typing", true, "Tell direct peers when we're typing (reported by frontends on the control socket)")
+	flag.BoolVar(&linkPreviews, "link-previews", false, "Fetch pages linked in messages we receive and show their titles (the sites see us do it)")
+	flag.BoolVar(&inlineImages, "inline-images", true, "Draw image files we're sent in terminals that can (iTerm2, kitty, sixel)")
+	flag.BoolVar(&imageLinks, "image-links", false, "Also fetch and draw images linked in messages we receive (the sites see us do it)")
+	flag.BoolVar(&expandEmojiIn, "expand-emoji", false, "Show :shortcodes: in messages we receive as emoji (use -outgoing emoji for our own)")
+	flag.StringVar(&mentions, "mention", "", "Comma-separated names people use for you, so \"@name\" highlights the message")
+	flag.BoolVar(&mentionBell, "mention-bell", false, "Ring the terminal bell when someone mentions you")
+	flag.Var(formatFlag{}, "format", "Go template for chat lines, e.g. '{{time \"15:04\" .Timestamp}} {{.Nick}}: {{.Body}}'; prefix with #channel= to set one channel's (repeatable)")
+	flag.StringVar(&filterPath, "filters", "", "File of inbound filter rules, e.g. 'from == spammer -> drop' (default: filters in the profile)")
+	flag.StringVar(&controlPath, "control", "", "Unix socket that scripts can send JSON commands to (default: control.sock in the profile; empty to disable)")
+	flag.StringVar(&downloadDir, "downloads", "", "Directory to save files peers send us (default: ~/Downloads, or the current directory)")
+	flag.Var(outgoingFlag{}, "outgoing", "Add a step to the outgoing message pipeline: emoji, capitalize, redact[=regexp], signature=[#channel=]text (repeatable, applied in order)")
+	flag.BoolVar(&mdnsEnabled, "mdns", false, "Advertise over mDNS and dial other instances found on the local network")
+	flag.BoolVar(&broadcastEnabled, "broadcast", false, "Announce ourselves with UDP broadcast beacons and dial peers whose beacons we hear, for networks that block mDNS")
+	flag.StringVar(&broadcastKey, "broadcast-key", "", "Shared secret that beacons are signed with; beacons signed with any other key are ignored")
+	flag.IntVar(&dhtPort, "dht-port", 0, "Join the peer discovery DHT on this UDP port (0 to stay out)")
+	flag.StringVar(&dhtBootstrap, "dht-bootstrap", "", "Comma-separated host:port UDP addresses of DHT nodes to join through")
+	flag.StringVar(&dhtNetwork, "dht-network", "default", "Name that peers announce and look each other up under in the DHT")
+	flag.BoolVar(&rendezvousMode, "rendezvous", false, "Only introduce peers that register with us to each other, without chatting or relaying")
+	flag.StringVar(&bootstrapAddrs, "bootstrap", "", "Comma-separated rendezvous nodes to register with and get peers from")
+	flag.BoolVar(&relayMode, "relay", false, "Act as a relay: link straight back to peers over their own connections and pass frames between peers that can't reach each other")
+	flag.IntVar(&relayRate, "relay-rate", 0, "With -relay, most KB/s forwarded for each client (0 for no limit)")
+	flag.BoolVar(&pexEnabled, "pex", pexEnabled, "Swap peer lists with each peer we connect to and dial the ones we don't know")
+	flag.BoolVar(&punchEnabled, "punch", punchEnabled, "When a peer can't be dialed, ask mutual peers to help punch through its NAT")
+	flag.BoolVar(&useTLS, "tls", false, "Encrypt all peer connections with TLS (every peer needs it too)")
+	flag.StringVar(&certPath, "cert", "", "TLS certificate to present (default: a self-signed one generated in the profile)")
+	flag.StringVar(&keyPath, "key", "", "Private key for -cert")
+	flag.StringVar(&caPath, "tls-ca", "", "Only talk to peers whose certificates this CA signed")
+	flag.BoolVar(&e2eEnabled, "e2e", false, "Encrypt chat end to end so only peers whose keys we know can read it, not the relays in between")
+	flag.BoolVar(&noiseEnabled, "noise", false, "Encrypt and authenticate peer connections with a Noise handshake on the profile's node key instead of TLS")
+	flag.StringVar(&wsPort, "ws", "", "Also accept WebSocket connections on this port, for browsers and nodes behind restrictive firewalls")
+	flag.BoolVar(&quicEnabled, "quic", false, "Carry peer links over QUIC on UDP instead of TCP (experimental; every peer needs it too)")
+	flag.StringVar(&proxy, "proxy", "", "Make every outbound peer connection through this SOCKS5 proxy, e.g. socks5://127.0.0.1:9050 for Tor")
+	flag.StringVar(&advertise, "advertise", "", "Host that peers should reach us at instead of our LAN IP, e.g. our .onion address")
+	flag.BoolVar(&portmapEnabled, "portmap", false, "Behind a home router, forward our ports with NAT-PMP or UPnP and give peers the external address")
+	flag.Var(networkFlag{}, "mesh", "Also join the mesh named name on this port, as name=port (repeatable)")
+	flag.StringVar(&logPath, "logfile", "", "Write errors and diagnostics to this file instead of the terminal, along with a copy of status lines")
+	flag.Var(levelFlag{}, "log-level", "Least severe diagnostics to log: debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", logFormat, "How -logfile is written: text (logfmt) or json")
+	flag.StringVar(&lang, "lang", "", "Language for prompts and help, e.g. \"de\" or \"es\" (default: from $LANG)")
+	flag.Usage = func() {
+		setupLocale(lang)
+		localizedUsage()
+	}
+	flag.CommandLine.Parse(args)
+
+	setupLocale(lang)
+	seenIds.SetLimits(seenCap, seenTTL)
+	maxHops = max(maxHops, 0)
+	if _, ok := wireCodecs[linkEncoding]; !ok {
+		log.Fatalf(T("-encoding must be one of %s"), strings.Join(codecNames(), ", "))
+	}
+	if rateAction != rateDrop && rateAction != rateMute {
+		log.Fatalf(T("-rate-action must be %q or %q"), rateDrop, rateMute)
+	}
+	if bodyAction != bodyTruncate && bodyAction != bodyReject {
+		log.Fatalf(T("-body-action must be %q or %q"), bodyTruncate, bodyReject)
+	}
+	if dropPolicy != dropOldest && dropPolicy != dropNewest {
+		log.Fatalf(T("-drop-policy must be %q or %q"), dropOldest, dropNewest)
+	}
+	peerBuffer = max(peerBuffer, 0)
+	stdout = io.MultiWriter(os.Stdout, attachedOutput{})
+	terminalOut = os.Stdout
+	if daemonMode {
+		stdout = attachedOutput{}
+		terminalOut = nil
+		if len(logPath) == 0 {
+			os.MkdirAll(dataDir(), 0700)
+			logPath = filepath.Join(dataDir(), "daemon.log")
+		}
+	}
+	if len(logPath) > 0 {
+		if err := openLogFile(logPath); err != nil {
+			log.Fatal(T("Unable to open log file:"), err)
+		}
+	}
+	if len(downloadDir) == 0 {
+		downloadDir = defaultDownloadDir()
+	}
+	if len(mentions) > 0 {
+		mentionNames = strings.Split(mentions, ",")
+	}
+	inheritUpgrade()
+
+	if len(profile) > 0 && !validProfile(profile) {
+		log.Fatalf(T("Invalid profile name (%s)"), profile)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["history"] && !set["history-db"] {
+		historyPath = defaultHistoryPath()
+	}
+	if !set["filters"] {
+		filterPath = filepath.Join(dataDir(), "filters")
+	}
+	if !set["control"] {
+		controlPath = filepath.Join(dataDir(), "control.sock")
+	}
+	if ephemeral {
+		// Don't pick up whoever owns this machine's history or settings
+		// either.
+		historyPath, filterPath, controlPath = "", "", ""
+	} else if err := loadProfile(); err != nil {
+		log.Fatal(T("Unable to load profile:"), err)
+	}
+	if daemonMode && len(controlPath) == 0 {
+		log.Fatal(T("A daemon needs a control socket to attach to"))
+	}
+	if daemonMode && controlInUse(controlPath) && !upgraded() {
+		log.Fatalf(T("A node is already running on %s"), controlPath)
+	}
+	if len(port) == 0 {
+		port = profileConfig.Port
+	}
+	if len(offeredNick) == 0 {
+		offeredNick = cleanNick(profileConfig.Nick)
+	}
+	loadShunned()
+
+	if err := setGossipMode(gossip); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadFilters(filterPath); err != nil {
+		log.Fatal(T("Unable to load filters:"), err)
+	}
+	if useTLS && noiseEnabled {
+		log.Fatal(T("Pick one of -tls and -noise"))
+	}
+	if quicEnabled && noiseEnabled {
+		log.Fatal(T("Pick one of -quic and -noise"))
+	}
+	if len(proxy) > 0 {
+		if err := setProxy(proxy); err != nil {
+			log.Fatal(err)
+		}
+		if quicEnabled {
+			log.Fatal(T("QUIC runs over UDP, which -proxy can't carry"))
+		}
+	}
+	if quicEnabled && !quicAvailable {
+		log.Fatal(T("This build has no QUIC support; rebuild with -tags quic"))
+	}
+	if useTLS || quicEnabled {
+		config, err := setupTLS(certPath, keyPath, caPath)
+		if err != nil {
+			log.Fatal(T("Unable to set up TLS:"), err)
+		}
+		quicTLSConfig = config
+		if useTLS {
+			tlsConfig = config
+		}
+	}
+	if err := loadNodeKey(); err != nil {
+		log.Fatal(T("Unable to load the node key:"), err)
+	}
+	if err := loadIdentity(); err != nil {
+		log.Fatal(T("Unable to load the identity key:"), err)
+	}
+	if !ephemeral {
+		loadKnownKeys(filepath.Join(dataDir(), "known_keys.json"))
+	}
+	setupTranslation(translateCmd, translateURL, translateTarget, translateSource)
+	if len(ttsCmd) > 0 {
+		setupSpeech(ttsCmd)
+	}
+
+	if len(exportPath) > 0 {
+		if len(historyPath) == 0 {
+			log.Fatal(T("Nothing to export with history disabled"))
+		}
+		localInfo.ListenPort = port
+		openHistory(historyPath)
+		n, err := exportHistory(exportPath, exportPage, time.Time{}, time.Time{}, exportFilter{Room: exportRoom, Private: exportPrivate})
+		if err != nil {
+			log.Fatal(T("Unable to export history:"), err)
+		}
+		statusLn(tr("Exported %d messages to %s", n, exportPath))
+		return
+	}
 
 	if len(port) < 4 {
-		log.Fatalf("Invalid listen port (%s)", port)
+		log.Fatalf(T("Invalid listen port (%s)"), port)
 	}
 
-	fmt.Println(bold("--- Sweet Nothings ---"))
+	if accessible {
+		fmt.Fprintln(stdout, "Sweet Nothings")
+	} else {
+		fmt.Fprintln(stdout, bold("--- Sweet Nothings ---"))
+	}
+	if len(profile) > 0 {
+		statusLn(tr("Profile: %s", profile))
+	}
 
 	localInfo.ListenPort = port
+	if len(advertise) > 0 {
+		localInfo.ip = advertise
+	} else if portmapEnabled {
+		setupPortMapping()
+	}
 
-	go startInputScanner()
+	if len(historyPath) > 0 {
+		openHistory(historyPath)
+
+		retention.MaxAge = time.Duration(retainDays) * 24 * time.Hour
+		retention.MaxBytes = int64(retainMB) * 1024 * 1024
+		go startCompactor(retention)
+	}
+
+	if len(dashboardAddr) > 0 {
+		go serveDashboard(dashboardAddr)
+		statusLn(tr("Dashboard on http://%s/", dashboardAddr))
+	}
+	if len(metricsAddr) > 0 {
+		go serveMetrics(metricsAddr)
+		statusLn(tr("Metrics on http://%s/metrics", metricsAddr))
+	}
 
-	listenAddr := fmt.Sprintf("0.0.0.0:%s", localInfo.ListenPort)
-	l, err := net.Listen("tcp", listenAddr)
+	l, err := startNode()
 	if err != nil {
 		log.Fatal(err)
 	}
-	statusLn(fmt.Sprintf("Local address: %s", localInfo.Addr()))
-	statusLn(fmt.Sprintf("Listening on %s", l.Addr()))
+	if daemonMode {
+		signalDaemonReady()
+	} else {
+		go startInputScanner()
+	}
+	go watchUpgrades()
+	go watchExit()
 
-	for {
-		con, err := l.Accept()
+	serve(l, "")
+}
+
+// startNode brings up everything a node runs once its profile is loaded,
+// from the metadata store to the listener and the peers it dials, and
+// returns the listener to serve.
+func startNode() (net.Listener, error) {
+	metaPath, remindersPath := filepath.Join(dataDir(), "meta.json"), filepath.Join(dataDir(), "reminders.json")
+	roomsPath := filepath.Join(dataDir(), "rooms.json")
+	if ephemeral {
+		metaPath, remindersPath, roomsPath = "", "", ""
+	}
+	meta = NewMetaStore(metaPath)
+	watchTopic()
+	watchPins()
+	watchNotes()
+	watchGuests()
+	publishE2EKey()
+	if _, ok := meta.Get("topic"); ok {
+		showTopic()
+	}
+
+	loadReminders(remindersPath)
+	loadRooms(roomsPath)
+	go startReminders()
+	if persistOutbox && !ephemeral {
+		loadOutbox(filepath.Join(dataDir(), "outbox.json"))
+		go startOutboxSaver()
+		go dialOutbox()
+	}
+
+	if maxDistant >= 0 {
+		go startLocalityPruner()
+	}
+	if awayAfter > 0 {
+		go watchIdle()
+	}
+
+	l, err := listen("", localInfo.ListenPort)
+	if err != nil {
+		return nil, err
+	}
+	statusLn(tr("Local address: %s", localInfo.Addr()))
+	statusLn(tr("Identity %s", fingerprint(identityPublic())))
+	if noiseEnabled || e2eEnabled {
+		statusLn(tr("Node key %s", fingerprint(nodeKey.PublicKey().Bytes())))
+	}
+	statusLn(tr("Listening on %s", l.Addr()))
+	if quicEnabled {
+		ql, err := listenQUIC(localInfo.ListenPort)
 		if err != nil {
-			log.Println("<", fmt.Sprintf("Error on accept: %s", err))
+			l.Close()
+			return nil, err
+		}
+		statusLn(tr("Listening for QUIC on udp %s", ql.Addr()))
+		go serve(ql, "")
+	}
+	listenNetworks()
+	if len(wsPort) > 0 {
+		listenWebSocket()
+	}
+	takeOver()
+	if len(controlPath) > 0 {
+		listenControl(controlPath)
+	}
+	if ephemeral && !upgraded() {
+		announceGuest()
+	}
+	dialProfilePeers()
+	if !ephemeral {
+		loadRememberedPeers(filepath.Join(dataDir(), "peers.json"))
+		if redialPeers && !upgraded() && !rendezvousMode {
+			dialRememberedPeers()
 		}
-		go serveIncoming(con)
 	}
+	if mdnsEnabled {
+		go startDiscovery()
+	}
+	if broadcastEnabled {
+		go startBeacons()
+	}
+	if dhtPort > 0 {
+		go startDHT()
+	}
+	if rendezvousMode {
+		statusLn(tr("Rendezvous mode: introducing peers only"))
+	}
+	if len(bootstrapAddrs) > 0 {
+		go startBootstrap()
+	}
+	return l, nil
 }
@@ -0,0 +1,147 @@
+package sweetnothings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Relay hops learned from traced paths are forgotten after this long.
+const edgeTTL = 30 * time.Minute
+
+var observedEdges = struct {
+	m map[[2]string]time.Time
+	sync.Mutex
+}{m: make(map[[2]string]time.Time)}
+
+// observePath remembers each hop of a traced message as a mesh edge.
+func observePath(path []string) {
+	observedEdges.Lock()
+	defer observedEdges.Unlock()
+	now := time.Now()
+	for i := 1; i < len(path); i++ {
+		observedEdges.m[[2]string{path[i-1], path[i]}] = now
+	}
+}
+
+type TopologyNode struct {
+	Addr string
+	Nick string
+}
+
+type TopologyEdge struct {
+	From     string
+	To       string
+	Direct   bool
+	RTTMs    float64    `json:",omitempty"`
+	LastSeen *time.Time `json:",omitempty"`
+}
+
+type Topology struct {
+	Nodes []TopologyNode
+	Edges []TopologyEdge
+}
+
+// currentTopology combines our own connections with hops observed in traced
+// message paths.
+func currentTopology() Topology {
+	local := localInfo.Addr()
+	nodes := map[string]bool{local: true}
+	var t Topology
+
+	for addr := range peers.Channels() {
+		nodes[addr] = true
+		e := TopologyEdge{From: local, To: addr, Direct: true}
+		if r, ok := peerRTT(addr); ok {
+			e.RTTMs = float64(r.Avg) / float64(time.Millisecond)
+		}
+		t.Edges = append(t.Edges, e)
+	}
+
+	observedEdges.Lock()
+	for e, seen := range observedEdges.m {
+		if time.Since(seen) > edgeTTL {
+			delete(observedEdges.m, e)
+			continue
+		}
+		nodes[e[0]] = true
+		nodes[e[1]] = true
+		seen := seen
+		t.Edges = append(t.Edges, TopologyEdge{From: e[0], To: e[1], LastSeen: &seen})
+	}
+	observedEdges.Unlock()
+
+	for addr := range nodes {
+		t.Nodes = append(t.Nodes, TopologyNode{addr, nickName(addr)})
+	}
+	sort.Slice(t.Nodes, func(i, j int) bool { return t.Nodes[i].Addr < t.Nodes[j].Addr })
+	sort.Slice(t.Edges, func(i, j int) bool {
+		if t.Edges[i].From != t.Edges[j].From {
+			return t.Edges[i].From < t.Edges[j].From
+		}
+		return t.Edges[i].To < t.Edges[j].To
+	})
+	return t
+}
+
+func (t Topology) DOT() []byte {
+	var b bytes.Buffer
+	b.WriteString("digraph sweetnothings {\n")
+	for _, n := range t.Nodes {
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", n.Addr, n.Nick)
+	}
+	for _, e := range t.Edges {
+		style := "dashed"
+		if e.Direct {
+			style = "solid"
+		}
+		if e.RTTMs > 0 {
+			fmt.Fprintf(&b, "\t%q -> %q [style=%s, label=\"%.1fms\"];\n", e.From, e.To, style, e.RTTMs)
+		} else {
+			fmt.Fprintf(&b, "\t%q -> %q [style=%s];\n", e.From, e.To, style)
+		}
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func (t Topology) JSON() []byte {
+	b, _ := json.MarshalIndent(t, "", "  ")
+	return append(b, '\n')
+}
+
+// exportTopology writes the topology to path as JSON or DOT depending on its
+// extension, or prints DOT when path is empty.
+func exportTopology(path string) {
+	t := currentTopology()
+	if len(path) == 0 {
+		fmt.Fprint(stdout, string(t.DOT()))
+		return
+	}
+	out := t.DOT()
+	if filepath.Ext(path) == ".json" {
+		out = t.JSON()
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		logger.Error(T("Error writing file"), "event", "topology", "path", path, "err", err)
+		return
+	}
+	statusLn(tr("Wrote topology (%d nodes, %d edges) to %s", len(t.Nodes), len(t.Edges), path))
+}
+
+func handleTopology(w http.ResponseWriter, r *http.Request) {
+	t := currentTopology()
+	if r.URL.Path == "/topology.dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write(t.DOT())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(t.JSON())
+}
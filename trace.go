@@ -0,0 +1,45 @@
+package sweetnothings
+
+import (
+	"strings"
+)
+
+// When set, every node a message passes through appends its address to the
+// message's Path.
+var tracePaths bool
+
+// showTrace prints the relay path of the archived message with the given ID
+// (or ID prefix), or of the most recent message when id is empty.
+func showTrace(id string) {
+	if history == nil {
+		statusLn(tr("History is disabled"))
+		return
+	}
+
+	var whisper SweetNothing
+	var ok bool
+	if len(id) == 0 {
+		if n := history.Len(); n > 0 {
+			whisper, ok = history.Since(n - 1)[0], true
+		}
+	} else {
+		whisper, ok = history.Get(id)
+		if !ok {
+			whisper, ok = history.FindPrefix(id)
+		}
+	}
+	if !ok {
+		statusLn(tr("No message %s", id))
+		return
+	}
+
+	if len(whisper.Path) == 0 {
+		statusLn(tr("No path recorded for %s (start peers with -trace)", whisper.ID))
+		return
+	}
+	hops := make([]string, len(whisper.Path))
+	for i, addr := range whisper.Path {
+		hops[i] = nickName(addr)
+	}
+	statusLn(tr("%s: %s (%d hops)", whisper.ID, strings.Join(hops, " -> "), len(hops)-1))
+}
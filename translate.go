@@ -0,0 +1,119 @@
+package sweetnothings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const translateTimeout = 10 * time.Second
+
+// Translator turns text into the configured target language. It returns the
+// source language when it can tell, or "" when it can't.
+type Translator interface {
+	Translate(ctx context.Context, text string) (translated string, lang string, err error)
+}
+
+// commandTranslator pipes the text through a shell command and reads the
+// translation from its output, e.g. "trans -b :en".
+type commandTranslator struct {
+	command string
+}
+
+func (t commandTranslator) Translate(ctx context.Context, text string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.command)
+	cmd.Stdin = strings.NewReader(text)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(string(out)), "", nil
+}
+
+// libreTranslator talks to a LibreTranslate-compatible HTTP API.
+type libreTranslator struct {
+	url    string
+	target string
+}
+
+func (t libreTranslator) Translate(ctx context.Context, text string) (string, string, error) {
+	body, _ := json.Marshal(map[string]string{
+		"q":      text,
+		"source": "auto",
+		"target": t.target,
+		"format": "text",
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	var r struct {
+		TranslatedText   string
+		DetectedLanguage struct {
+			Language string
+		}
+		Error string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", "", err
+	}
+	if len(r.Error) > 0 {
+		return "", "", fmt.Errorf("%s", r.Error)
+	}
+	return r.TranslatedText, r.DetectedLanguage.Language, nil
+}
+
+var translator Translator
+
+// Source languages to translate from; empty means anything that isn't
+// already in the target language.
+var translateFrom map[string]bool
+
+var translateTo string
+
+func setupTranslation(command, url, to, from string) {
+	translateTo = to
+	if len(command) > 0 {
+		translator = commandTranslator{command}
+	} else if len(url) > 0 {
+		translator = libreTranslator{url, to}
+	}
+	if len(from) > 0 {
+		translateFrom = make(map[string]bool)
+		for _, lang := range strings.Split(from, ",") {
+			translateFrom[strings.TrimSpace(lang)] = true
+		}
+	}
+}
+
+// translateIncoming prints a translation of an incoming message beneath it,
+// when it's in one of the configured languages.
+func translateIncoming(whisper SweetNothing) {
+	ctx, cancel := context.WithTimeout(context.Background(), translateTimeout)
+	defer cancel()
+	text, lang, err := translator.Translate(ctx, whisper.Body)
+	if err != nil || len(text) == 0 || text == whisper.Body {
+		return
+	}
+	if lang == translateTo || (len(lang) > 0 && translateFrom != nil && !translateFrom[lang]) {
+		return
+	}
+	label := T("translated")
+	spoken := T("Translation")
+	if len(lang) > 0 {
+		label = lang + " -> " + translateTo
+		spoken = tr("Translation from %s", lang)
+	}
+	noteLn(spoken, "("+label+") ", text, "green")
+}
@@ -0,0 +1,191 @@
+package sweetnothings
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/**
+ * Transport
+ *
+ * Peer links are plain TCP unless -tls is given, in which case every
+ * connection we make or accept is TLS. With -cert and -key we present that
+ * certificate; otherwise a self-signed one is generated into the profile
+ * on first run. Self-signed certificates can't be checked against
+ * anything, so on their own they only keep eavesdroppers out. -tls-ca
+ * makes both ends verify each other against a CA. -noise is the
+ * alternative that needs no certificates at all, and -quic swaps TCP for
+ * QUIC.
+ */
+
+var tlsConfig *tls.Config
+
+var quicEnabled bool
+
+// The TLS settings QUIC links use; the same as tlsConfig under -tls.
+var quicTLSConfig *tls.Config
+
+// How long to wait for a peer to answer a dial.
+const dialTimeout = 10 * time.Second
+
+// How long an auto-generated certificate is good for.
+const selfSignedLifetime = 10 * 365 * 24 * time.Hour
+
+func dialPeer(addr string) (net.Conn, error) {
+	if isWebSocket(addr) {
+		return dialWebSocket(addr)
+	}
+	if quicEnabled {
+		return dialQUIC(addr)
+	}
+	if noiseEnabled {
+		return dialNoise(addr)
+	}
+	if tlsConfig == nil {
+		return dialTCP(addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := dialTCP(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := tlsConfig.Clone()
+	config.ServerName = host
+	tc := tls.Client(c, config)
+	if err := tc.Handshake(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+func wrapListener(l net.Listener) net.Listener {
+	if noiseEnabled {
+		return noiseListener{l}
+	}
+	if tlsConfig == nil {
+		return l
+	}
+	return tls.NewListener(l, tlsConfig)
+}
+
+// linkTransport names what a link runs over, for the peer table.
+func linkTransport(c net.Conn) string {
+	if t, ok := c.(interface{ Transport() string }); ok {
+		return t.Transport()
+	}
+	if _, ok := c.(*tls.Conn); ok {
+		return "tls"
+	}
+	return "tcp"
+}
+
+// setupTLS loads or creates our certificate, and the CA to verify peers
+// against if caPath is given.
+func setupTLS(certPath string, keyPath string, caPath string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case len(certPath) > 0 && len(keyPath) > 0:
+		cert, err = tls.LoadX509KeyPair(certPath, keyPath)
+	case len(certPath) > 0 || len(keyPath) > 0:
+		return nil, errors.New(T("-cert and -key go together"))
+	case ephemeral:
+		var certPEM, keyPEM []byte
+		if certPEM, keyPEM, err = selfSigned(); err == nil {
+			cert, err = tls.X509KeyPair(certPEM, keyPEM)
+		}
+	default:
+		cert, err = loadSelfSigned(filepath.Join(dataDir(), "tls-cert.pem"), filepath.Join(dataDir(), "tls-key.pem"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if len(caPath) == 0 {
+		config.InsecureSkipVerify = true
+		return config, nil
+	}
+	b, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New(T("no certificates found in the CA file"))
+	}
+	config.RootCAs = pool
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
+
+// loadSelfSigned reads the generated certificate, making it first if
+// there isn't one.
+func loadSelfSigned(certPath string, keyPath string) (tls.Certificate, error) {
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		return cert, nil
+	} else if _, serr := os.Stat(certPath); !os.IsNotExist(serr) {
+		return tls.Certificate{}, err
+	}
+	certPEM, keyPEM, err := selfSigned()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	os.MkdirAll(filepath.Dir(certPath), 0700)
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	statusLn(tr("Generated a self-signed certificate in %s", certPath))
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func selfSigned() (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "sweetnothings"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(selfSignedLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
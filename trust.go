@@ -0,0 +1,207 @@
+package sweetnothings
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Known keys
+ *
+ * The first signing key we see for an address is remembered across runs
+ * in known_keys.json. If that address later signs with a different key we
+ * drop its messages and say so, loudly, once per key. /verify marks a key
+ * as checked with its owner out of band, and is also how a changed key
+ * gets accepted once the new fingerprint has been confirmed in full.
+ */
+
+type knownKey struct {
+	Key      ed25519.PublicKey
+	First    time.Time
+	Verified bool
+}
+
+var knownKeys = struct {
+	m       map[string]knownKey
+	changed map[string]ed25519.PublicKey
+	path    string
+	sync.Mutex
+}{m: make(map[string]knownKey), changed: make(map[string]ed25519.PublicKey)}
+
+// errKeyChanged rejects messages from a known address signed with a new
+// key; the warning has already been shown.
+var errKeyChanged = errors.New("key changed")
+
+func loadKnownKeys(path string) {
+	knownKeys.Lock()
+	defer knownKeys.Unlock()
+	knownKeys.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, &knownKeys.m); err != nil {
+		logger.Warn(T("Discarding unreadable known keys"), "event", "trust", "err", err)
+	}
+}
+
+// saveKnownKeys must be called with knownKeys locked.
+func saveKnownKeys() {
+	if len(knownKeys.path) == 0 {
+		return
+	}
+	b, _ := json.Marshal(knownKeys.m)
+	os.MkdirAll(filepath.Dir(knownKeys.path), 0700)
+	tmp := knownKeys.path + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil {
+		err = os.Rename(tmp, knownKeys.path)
+	}
+	if err != nil {
+		logger.Error(T("Error saving known keys"), "event", "trust", "path", knownKeys.path, "err", err)
+	}
+}
+
+// checkKnownKey trusts key for addr if we've never seen addr before, and
+// otherwise insists it's the key we know.
+func checkKnownKey(addr string, key ed25519.PublicKey) error {
+	knownKeys.Lock()
+	defer knownKeys.Unlock()
+	known, ok := knownKeys.m[addr]
+	if !ok {
+		knownKeys.m[addr] = knownKey{Key: key, First: time.Now()}
+		saveKnownKeys()
+		return nil
+	}
+	if known.Key.Equal(key) {
+		return nil
+	}
+	if prev, warned := knownKeys.changed[addr]; !warned || !prev.Equal(key) {
+		knownKeys.changed[addr] = key
+		fmt.Fprint(stdout, "\a")
+		warnLn(tr("WARNING: %s is signing with a new key %s instead of %s. Someone may be impersonating them, so their messages are being dropped.", addr, fingerprint(key), fingerprint(known.Key)))
+		warnLn(tr("If they really changed keys, confirm the new fingerprint with them and run /verify %s %s", addr, fingerprint(key)))
+	}
+	return errKeyChanged
+}
+
+func warnLn(s string) {
+	if accessible {
+		fmt.Fprintln(stdout, tr("Warning: %s", s))
+		return
+	}
+	fmt.Fprintln(stdout, wrapColor(fmt.Sprintf("[%s]", s), "red"))
+}
+
+// peerFor finds the address a nickname or guest name refers to.
+func peerFor(name string) string {
+	knownKeys.Lock()
+	_, known := knownKeys.m[name]
+	var addrs []string
+	for addr := range knownKeys.m {
+		addrs = append(addrs, addr)
+	}
+	knownKeys.Unlock()
+	if known {
+		return name
+	}
+	nicknames.Lock()
+	for addr, n := range nicknames.m {
+		if n == name {
+			nicknames.Unlock()
+			return addr
+		}
+	}
+	nicknames.Unlock()
+	if addr, ok := peerOffering(name); ok {
+		return addr
+	}
+	for _, addr := range addrs {
+		if g, ok := guestName(addr); ok && g == name {
+			return addr
+		}
+	}
+	return name
+}
+
+// verifyPeer marks the key with fingerprint fp as checked for peer. fp may
+// be shortened to the eight characters shown next to names.
+func verifyPeer(peer string, fp string) {
+	addr := peerFor(peer)
+	fp = strings.ToLower(fp)
+	if len(fp) < 8 {
+		statusLn(T("Give at least the first 8 characters of the fingerprint"))
+		return
+	}
+	knownKeys.Lock()
+	defer knownKeys.Unlock()
+	known, ok := knownKeys.m[addr]
+	switch {
+	case !ok:
+		statusLn(tr("No key known for %s", addr))
+	case strings.HasPrefix(fingerprint(known.Key), fp):
+		known.Verified = true
+		knownKeys.m[addr] = known
+		saveKnownKeys()
+		statusLn(tr("Verified %s as %s", addr, fingerprint(known.Key)))
+	case knownKeys.changed[addr] != nil && strings.HasPrefix(fingerprint(knownKeys.changed[addr]), fp) && fp != fingerprint(knownKeys.changed[addr]):
+		// Anyone can make a key that matches a few characters, so taking
+		// a new key needs all of them.
+		warnLn(tr("Give the whole fingerprint, %d characters, to accept a changed key", len(fingerprint(knownKeys.changed[addr]))))
+	case knownKeys.changed[addr] != nil && fp == fingerprint(knownKeys.changed[addr]):
+		knownKeys.m[addr] = knownKey{Key: knownKeys.changed[addr], First: time.Now(), Verified: true}
+		delete(knownKeys.changed, addr)
+		saveKnownKeys()
+		statusLn(tr("Accepted the new key for %s and verified it as %s", addr, fingerprint(knownKeys.m[addr].Key)))
+	default:
+		warnLn(tr("%s doesn't match the key %s uses (%s)", fp, addr, fingerprint(known.Key)))
+	}
+}
+
+// showKnownKeys lists every key we know and whether it's been verified.
+func showKnownKeys() {
+	knownKeys.Lock()
+	defer knownKeys.Unlock()
+	if len(knownKeys.m) == 0 {
+		statusLn(T("No known keys"))
+		return
+	}
+	var addrs []string
+	for addr := range knownKeys.m {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		k := knownKeys.m[addr]
+		state := T("unverified")
+		if k.Verified {
+			state = T("verified")
+		}
+		if _, ok := knownKeys.changed[addr]; ok {
+			state = T("KEY CHANGED")
+		}
+		statusLn(fmt.Sprintf("%s %s %s", addr, fingerprint(k.Key), state))
+	}
+}
+
+func verifiedMark() string {
+	if accessible {
+		return " " + T("verified")
+	}
+	return "✓"
+}
+
+// keyVerified reports whether addr's key has been checked with /verify.
+func keyVerified(addr string) bool {
+	knownKeys.Lock()
+	defer knownKeys.Unlock()
+	return knownKeys.m[addr].Verified
+}
@@ -0,0 +1,63 @@
+package sweetnothings
+
+import (
+	"os/exec"
+	"strings"
+	"sync/atomic"
+)
+
+// Utterances waiting to be spoken beyond this are dropped rather than
+// piling up behind a slow voice.
+const ttsQueue = 8
+
+var tts = struct {
+	command string
+	queue   chan string
+	muted   int32
+}{queue: make(chan string, ttsQueue)}
+
+// setupSpeech enables speaking incoming messages through command, e.g.
+// "espeak --stdin" or "say".
+func setupSpeech(command string) {
+	tts.command = command
+	go startSpeaker()
+}
+
+// startSpeaker speaks queued text one utterance at a time.
+func startSpeaker() {
+	for text := range tts.queue {
+		cmd := exec.Command("sh", "-c", tts.command)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			logger.Error(T("Error running TTS command"), "event", "tts", "err", err)
+		}
+	}
+}
+
+func speak(text string) {
+	if len(tts.command) == 0 || atomic.LoadInt32(&tts.muted) == 1 {
+		return
+	}
+	select {
+	case tts.queue <- text:
+	default:
+	}
+}
+
+func speakMessage(whisper SweetNothing) {
+	speak(tr("%s says: %s", nickName(whisper.Addr), whisper.Body))
+}
+
+func setMuted(muted bool) {
+	if len(tts.command) == 0 {
+		statusLn(tr("Speech is off (start with -tts-cmd)"))
+		return
+	}
+	if muted {
+		atomic.StoreInt32(&tts.muted, 1)
+		statusLn(tr("Speech muted"))
+	} else {
+		atomic.StoreInt32(&tts.muted, 0)
+		statusLn(tr("Speech unmuted"))
+	}
+}
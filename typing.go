@@ -0,0 +1,82 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+/**
+ * Typing indicators
+ *
+ * While we type, direct peers on the current network get a typing frame
+ * at most every typingInterval; it isn't gossiped or kept anywhere. They
+ * show "X is typing…" once, and forget it when our message arrives or
+ * typingTimeout passes without another. The terminal reads whole lines,
+ * so it's frontends on the control socket that report typing, with
+ * {"Command": "typing"}. -typing=false stops us sending them.
+ */
+
+var sendTyping = true
+
+const (
+	typingInterval = 3 * time.Second
+	typingTimeout  = 8 * time.Second
+)
+
+type typingNotice struct {
+	Room string `json:",omitempty"`
+}
+
+var typing = struct {
+	// When we last told peers, and when each peer last told us.
+	sent time.Time
+	last map[string]time.Time
+	sync.Mutex
+}{last: make(map[string]time.Time)}
+
+func init() {
+	controlHandlers["typing"] = handleTyping
+}
+
+// nowTyping tells peers we're typing in the active room.
+func nowTyping() {
+	if !sendTyping {
+		return
+	}
+	typing.Lock()
+	if time.Since(typing.sent) < typingInterval {
+		typing.Unlock()
+		return
+	}
+	typing.sent = time.Now()
+	typing.Unlock()
+	f := controlFrame("typing", typingNotice{Room: activeRoom()})
+	for addr := range netPeers(currentNetwork()) {
+		if hasFeature(addr, "typing") {
+			sendDirect(addr, f)
+		}
+	}
+}
+
+func handleTyping(from string, data json.RawMessage) {
+	var n typingNotice
+	if err := json.Unmarshal(data, &n); err != nil || !inRoom(n.Room) {
+		return
+	}
+	typing.Lock()
+	prev, ok := typing.last[from]
+	typing.last[from] = time.Now()
+	typing.Unlock()
+	if ok && time.Since(prev) < typingTimeout {
+		return
+	}
+	statusLn(tr("%s is typing…", roomTag(n.Room)+nickName(from)))
+}
+
+// doneTyping forgets that addr was typing, once their message is in.
+func doneTyping(addr string) {
+	typing.Lock()
+	delete(typing.last, addr)
+	typing.Unlock()
+}
@@ -0,0 +1,267 @@
+package sweetnothings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+/**
+ * Upgrades
+ *
+ * On SIGUSR2 we exec a fresh copy of our binary and hand it the listening
+ * sockets along with what it needs to pick up the mesh where we left off:
+ * who we were connected to, session tokens, and the messages we've already
+ * seen. The new process takes over the listeners without ever closing
+ * them, redials our peers and resumes their sessions, then tells us it's
+ * ready and we exit. Peers see at most a brief reconnect.
+ */
+
+// Set in the new process's environment. Its file descriptors start with
+// the state file, then the ready pipe, then the listeners in order.
+const upgradeEnv = "SWEETNOTHINGS_UPGRADE"
+
+const upgradeTimeout = 30 * time.Second
+
+type upgradeState struct {
+	// Networks of the inherited listeners, in descriptor order.
+	Listeners []string
+	// Peers we had dialed, by network.
+	Peers     map[string]string
+	Pinned    []string
+	Held      map[string]string
+	Issued    map[string]string
+	Seen      []string
+	Nicknames map[string]string
+}
+
+var listeners = struct {
+	m map[string]*net.TCPListener
+	sync.Mutex
+}{m: make(map[string]*net.TCPListener)}
+
+// What the previous process handed us, if we were started by an upgrade.
+var inherited struct {
+	state     upgradeState
+	listeners map[string]*os.File
+	ready     *os.File
+}
+
+// inheritUpgrade picks up the state passed by the process we're replacing.
+func inheritUpgrade() {
+	if len(os.Getenv(upgradeEnv)) == 0 {
+		return
+	}
+	os.Unsetenv(upgradeEnv)
+	f := os.NewFile(3, "upgrade-state")
+	err := json.NewDecoder(f).Decode(&inherited.state)
+	f.Close()
+	if err != nil {
+		log.Fatal(T("Unable to read upgrade state:"), err)
+	}
+	inherited.ready = os.NewFile(4, "upgrade-ready")
+	inherited.listeners = make(map[string]*os.File)
+	for i, network := range inherited.state.Listeners {
+		inherited.listeners[network] = os.NewFile(uintptr(5+i), "listener")
+	}
+}
+
+func upgraded() bool {
+	return inherited.ready != nil
+}
+
+// listen opens the listener for network, taking over the previous
+// process's socket after an upgrade.
+func listen(network string, port string) (net.Listener, error) {
+	l, err := listenRaw(network, port)
+	if err != nil {
+		return nil, err
+	}
+	return wrapListener(l), nil
+}
+
+// listenRaw is listen without the peer transport on top, for listeners
+// that speak something else.
+func listenRaw(name string, port string) (net.Listener, error) {
+	var l net.Listener
+	var err error
+	if f, ok := inherited.listeners[name]; ok {
+		l, err = net.FileListener(f)
+		f.Close()
+	} else {
+		// No host listens on both IPv4 and IPv6. Hole punching dials out
+		// from this port too.
+		lc := net.ListenConfig{Control: reusePort}
+		l, err = lc.Listen(context.Background(), "tcp", net.JoinHostPort("", port))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tl, ok := l.(*net.TCPListener); ok {
+		listeners.Lock()
+		listeners.m[name] = tl
+		listeners.Unlock()
+	}
+	return l, nil
+}
+
+// takeOver restores the handed-over state once we're listening, then lets
+// the previous process go.
+func takeOver() {
+	if !upgraded() {
+		return
+	}
+	s := inherited.state
+	for _, id := range s.Seen {
+		seenIds.Add(id)
+	}
+	nicknames.Lock()
+	for addr, n := range s.Nicknames {
+		nicknames.m[addr] = n
+	}
+	nicknames.Unlock()
+	sessions.Lock()
+	for addr, token := range s.Held {
+		sessions.held[addr] = &heldSession{token: token, closed: time.Now()}
+	}
+	for addr, token := range s.Issued {
+		sessions.issued[addr] = &issuedSession{token: token, closed: time.Now()}
+	}
+	sessions.Unlock()
+	for _, addr := range s.Pinned {
+		pinPeer(addr)
+	}
+
+	inherited.ready.Write([]byte{1})
+	inherited.ready.Close()
+	statusLn(tr("Took over from the previous process"))
+
+	for addr, network := range s.Peers {
+		setNet(addr, network)
+		go dial(addr)
+	}
+}
+
+func snapshotUpgrade() upgradeState {
+	s := upgradeState{
+		Peers:     make(map[string]string),
+		Held:      make(map[string]string),
+		Issued:    make(map[string]string),
+		Nicknames: make(map[string]string),
+	}
+	for addr := range peers.Channels() {
+		s.Peers[addr] = netOf(addr)
+	}
+	pinned.Lock()
+	for addr := range pinned.m {
+		s.Pinned = append(s.Pinned, addr)
+	}
+	pinned.Unlock()
+	sessions.Lock()
+	for addr, h := range sessions.held {
+		s.Held[addr] = h.token
+	}
+	for addr, i := range sessions.issued {
+		s.Issued[addr] = i.token
+	}
+	sessions.Unlock()
+	s.Seen = seenIds.IDs()
+	nicknames.Lock()
+	for addr, n := range nicknames.m {
+		s.Nicknames[addr] = n
+	}
+	nicknames.Unlock()
+	return s
+}
+
+// upgrade starts the new process and waits for it to take over. If it
+// fails we carry on as before.
+func upgrade() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	s := snapshotUpgrade()
+	listeners.Lock()
+	var files []*os.File
+	for network, l := range listeners.m {
+		f, err := l.File()
+		if err != nil {
+			listeners.Unlock()
+			return err
+		}
+		defer f.Close()
+		s.Listeners = append(s.Listeners, network)
+		files = append(files, f)
+	}
+	listeners.Unlock()
+
+	state, err := os.CreateTemp("", "sweetnothings-upgrade")
+	if err != nil {
+		return err
+	}
+	os.Remove(state.Name())
+	defer state.Close()
+	if err := json.NewEncoder(state).Encode(s); err != nil {
+		return err
+	}
+	if _, err := state.Seek(0, 0); err != nil {
+		return err
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	statusLn(tr("Upgrading: starting %s", exe))
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), upgradeEnv+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append([]*os.File{state, readyW}, files...)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	// The pipe closes without a byte if the new process dies first.
+	ok := make(chan bool, 1)
+	go func() {
+		b := make([]byte, 1)
+		n, _ := ready.Read(b)
+		ok <- n == 1
+	}()
+	select {
+	case good := <-ok:
+		if !good {
+			cmd.Wait()
+			return errors.New(T("the new process exited before taking over"))
+		}
+	case <-time.After(upgradeTimeout):
+		cmd.Process.Kill()
+		return errors.New(T("timed out waiting for the new process"))
+	}
+	go cmd.Wait()
+
+	// The new process has its own copies of the listeners, so exiting
+	// doesn't close them.
+	statusLn(tr("Handed over to process %d", cmd.Process.Pid))
+	if history != nil {
+		history.Close()
+	}
+	os.Exit(0)
+	return nil
+}
+
+func handleUpgrade() {
+	if err := upgrade(); err != nil {
+		logger.Error(T("Error upgrading"), "event", "upgrade", "err", err)
+	}
+}
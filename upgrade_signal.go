@@ -0,0 +1,18 @@
+//go:build !windows
+
+package sweetnothings
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchUpgrades hands over to a freshly exec'd binary on SIGUSR2.
+func watchUpgrades() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	for range c {
+		handleUpgrade()
+	}
+}
@@ -0,0 +1,4 @@
+package sweetnothings
+
+// Windows has no SIGUSR2 and can't pass sockets to a child this way.
+func watchUpgrades() {}
@@ -0,0 +1,291 @@
+package sweetnothings
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+/**
+ * WebSocket transport
+ *
+ * With -ws port we also accept WebSocket connections, so browsers and
+ * nodes that can only get out over HTTP can join. Frames are the same
+ * JSON as on TCP, one per text message. Unlike TCP links, a WebSocket
+ * link carries frames both ways: whatever connects to us gets frames
+ * back on the same connection, named after the From of its first frame.
+ * /dial ws://host:port/ (or wss:// under -tls) connects to one.
+ */
+
+var wsPort string
+
+// The listener name SIGUSR2 hands the WebSocket listener over under.
+const wsListener = "ws:"
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// The largest message we'll read.
+const wsMaxMessage = 1 << 20
+
+type wsConn struct {
+	net.Conn
+	r *bufio.Reader
+	// Clients mask what they send; servers don't.
+	client bool
+
+	readBuf []byte
+	rmu     sync.Mutex
+	wmu     sync.Mutex
+}
+
+func isWebSocket(addr string) bool {
+	return strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://")
+}
+
+func (c *wsConn) Transport() string {
+	if _, ok := c.Conn.(*tls.Conn); ok {
+		return "wss"
+	}
+	return "ws"
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if c.client {
+		header[1] |= 0x80
+		var mask [4]byte
+		rand.Read(mask[:])
+		header = append(header, mask[:]...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+	_, err := c.Conn.Write(append(header, payload...))
+	return err
+}
+
+func (c *wsConn) readFrame() (op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.r, h[:]); err != nil {
+		return
+	}
+	op = h[0] & 0x0f
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.r, b[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.r, b[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if n > wsMaxMessage {
+		return 0, nil, errors.New("websocket: message too long")
+	}
+	var mask [4]byte
+	if h[1]&0x80 != 0 {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if h[1]&0x80 != 0 {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, payload, nil
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for len(c.readBuf) == 0 {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case wsText, wsBinary, wsContinuation:
+			// Frames are JSON objects, so we needn't keep track of where
+			// one message ends and the next begins.
+			c.readBuf = payload
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, err
+			}
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write sends b as one text message. The JSON encoder writes a whole
+// frame at a time.
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(wsText, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) Close() error {
+	c.writeFrame(wsClose, nil)
+	return c.Conn.Close()
+}
+
+func dialWebSocket(addr string) (net.Conn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	hostport := u.Host
+	if len(u.Port()) == 0 {
+		hostport = net.JoinHostPort(u.Hostname(), map[string]string{"ws": "80", "wss": "443"}[u.Scheme])
+	}
+	c, err := dialTCP(hostport)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "wss" {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		config.ServerName = u.Hostname()
+		tc := tls.Client(c, config)
+		if err := tc.Handshake(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tc
+	}
+	var k [16]byte
+	rand.Read(k[:])
+	key := base64.StdEncoding.EncodeToString(k[:])
+	path := u.RequestURI()
+	fmt.Fprintf(c, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, u.Host, key)
+	r := bufio.NewReader(c)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		c.Close()
+		return nil, fmt.Errorf("websocket: handshake failed: %s", resp.Status)
+	}
+	return &wsConn{Conn: c, r: r, client: true}, nil
+}
+
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || len(r.Header.Get("Sec-WebSocket-Key")) == 0 {
+		http.Error(w, "This is a sweetnothings WebSocket endpoint", http.StatusUpgradeRequired)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Can't upgrade this connection", http.StatusInternalServerError)
+		return
+	}
+	c, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", wsAccept(r.Header.Get("Sec-WebSocket-Key")))
+	if err := rw.Flush(); err != nil {
+		c.Close()
+		return
+	}
+	statusLn(tr("WebSocket connection from %s", c.RemoteAddr()))
+	serveIncoming(&wsConn{Conn: c, r: rw.Reader}, "")
+}
+
+// linkBack starts sending frames for addr down a WebSocket it connected
+// to us on, unless we already have a link to it. It reports whether it
+// did.
+func linkBack(addr string, c net.Conn) bool {
+	ch, bulk, done := peers.Add(addr)
+	if ch == nil {
+		return false
+	}
+	peers.SetInbound(addr)
+	go func() {
+		defer peers.Remove(addr)
+		writeLink(addr, c, ch, bulk, done)
+	}()
+	return true
+}
+
+// listenWebSocket serves the WebSocket endpoint on -ws, over TLS when
+// -tls is on.
+func listenWebSocket() {
+	l, err := listenRaw(wsListener, wsPort)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheme := "ws"
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+		scheme = "wss"
+	}
+	statusLn(tr("WebSocket endpoint on %s://%s:%s/", scheme, localInfo.IP(), wsPort))
+	go func() {
+		err := http.Serve(l, http.HandlerFunc(handleWebSocket))
+		logger.Error(T("Error serving WebSockets"), "event", "websocket", "err", err)
+	}()
+}
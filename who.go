@@ -0,0 +1,46 @@
+package sweetnothings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// showPeers lists everyone we're linked to, for /peers and /who.
+func showPeers() {
+	var addrs []string
+	for addr := range peers.Channels() {
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		statusLn(tr("No peers"))
+		return
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		rtt := T("rtt n/a")
+		if r, ok := peerRTT(addr); ok {
+			rtt = tr("rtt min/avg/p95 %v/%v/%v", r.Min.Round(time.Microsecond), r.Avg.Round(time.Microsecond), r.P95.Round(time.Microsecond))
+		}
+		who := nick(addr)
+		if nickName(addr) != addr {
+			who += " " + addr
+		}
+		statusLn(fmt.Sprintf("%s %s", who, presenceLabel(addr)))
+
+		direction := T("outbound")
+		if peers.Inbound(addr) {
+			direction = T("inbound")
+		}
+		since := peers.Since(addr)
+		ps := stats.Peer(addr)
+		noteLn(T("Connection"), "", tr("%s %s since %s (%v), %d messages in, %d out, %s",
+			direction, peers.Transport(addr), since.Format("15:04"), time.Since(since).Round(time.Second),
+			atomic.LoadUint64(&ps.MessagesIn), atomic.LoadUint64(&ps.MessagesOut), rtt), "blue")
+		if h, ok := peerHello(addr); ok && len(h.Client) > 0 {
+			noteLn(T("Client"), "", tr("version %s, protocol %d, features: %s", h.Client, linkVersion(addr), strings.Join(h.Features, ", ")), "blue")
+		}
+	}
+}
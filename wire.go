@@ -0,0 +1,139 @@
+package sweetnothings
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+const msgFrame = "msg"
+
+// Large frames, like file chunks, go on a peer's bulk lane so they can't
+// hold up chat and control frames to the same peer. Bulk senders should
+// keep each frame under maxBulkFrame so an interactive frame never waits
+// long behind one.
+const maxBulkFrame = 32 * 1024
+
+// After this many interactive frames in a row, a waiting bulk frame is
+// sent.
+const bulkEvery = 16
+
+// Frame is what peers write to each other: either a chat message to be
+// gossiped, or a control message meant only for the peer on the other end.
+type Frame struct {
+	Type string
+	From string
+	Msg  *SweetNothing   `json:",omitempty"`
+	Data json.RawMessage `json:",omitempty"`
+	// Seq numbers message frames to peers that ack them.
+	Seq uint64 `json:",omitempty"`
+	// Batch holds the frames of a batch frame.
+	Batch []Frame `json:",omitempty"`
+}
+
+// negotiateEncoding switches what we write to addr on w to the
+// compression and encoding it can read, once its hello has told us, and
+// returns the encoder to carry on with.
+func negotiateEncoding(addr string, w io.Writer) (func(Frame) error, error) {
+	encode := jsonFrames(w)
+	if compressLinks && hasFeature(addr, "gzip") {
+		zw, err := startCompression(addr, encode, w)
+		if err != nil {
+			return nil, err
+		}
+		w, encode = zw, jsonFrames(zw)
+	}
+	if _, ok := wireCodecs[linkEncoding]; ok && hasFeature(addr, linkEncoding) {
+		return startEncoding(addr, linkEncoding, encode, w)
+	}
+	return encode, nil
+}
+
+// jsonFrames writes frames to w as JSON, one per line.
+func jsonFrames(w io.Writer) func(Frame) error {
+	enc := json.NewEncoder(w)
+	return func(f Frame) error { return enc.Encode(f) }
+}
+
+type controlHandler func(from string, data json.RawMessage)
+
+// Handlers for control frames, keyed by frame type. Subsystems register
+// theirs in init.
+var controlHandlers = make(map[string]controlHandler)
+
+func controlFrame(kind string, v interface{}) Frame {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Error(T("Error encoding frame"), "event", "link", "frame", kind, "err", err)
+	}
+	return Frame{Type: kind, Data: b}
+}
+
+func handleControl(f Frame) {
+	h, ok := controlHandlers[f.Type]
+	if !ok {
+		logger.Debug(T("Ignoring unknown frame"), "event", "link", "frame", f.Type, "peer", f.From)
+		return
+	}
+	h(f.From, f.Data)
+}
+
+// sendTo hands a frame to the connection for addr without blocking, or
+// to a relay if we have no link to addr. It reports whether the frame was
+// accepted.
+func sendTo(addr string, f Frame) bool {
+	return sendDirect(addr, f) || viaRelay(addr, f)
+}
+
+// sendDirect is sendTo without relays.
+func sendDirect(addr string, f Frame) bool {
+	ch := peers.Get(addr)
+	if ch == nil {
+		return false
+	}
+	select {
+	case ch <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendBulk queues a frame on addr's bulk lane, waiting up to timeout for
+// the lane to drain. It reports whether the frame was accepted.
+func sendBulk(addr string, f Frame, timeout time.Duration) bool {
+	ch := peers.Bulk(addr)
+	if ch == nil {
+		return false
+	}
+	select {
+	case ch <- f:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// sendSoon delivers a frame to addr, dialing it first if we aren't connected
+// yet, and gives up after timeout. Call it in its own goroutine.
+func sendSoon(addr string, f Frame, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	ch := peers.Get(addr)
+	if ch == nil {
+		go autoDial(addr)
+	}
+	for ch == nil {
+		select {
+		case <-deadline:
+			return viaRelay(addr, f)
+		case <-time.After(50 * time.Millisecond):
+		}
+		ch = peers.Get(addr)
+	}
+	select {
+	case ch <- f:
+		return true
+	case <-deadline:
+		return false
+	}
+}